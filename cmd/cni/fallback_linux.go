@@ -0,0 +1,39 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// removePodInterface deletes the pod's Tailscale veth from its netns.
+// Deleting one end of a veth pair also removes the host-side peer.
+// A missing netns or interface is not an error.
+func removePodInterface(netnsPath, ifName string) error {
+	if netnsPath == "" {
+		return nil
+	}
+	err := ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(ifName)
+		if err != nil {
+			var notFound netlink.LinkNotFoundError
+			if errors.As(err, &notFound) {
+				return nil
+			}
+			return fmt.Errorf("getting %s: %w", ifName, err)
+		}
+		if err := netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("deleting %s: %w", ifName, err)
+		}
+		return nil
+	})
+	var nsErr ns.NSPathNotExistErr
+	if errors.As(err, &nsErr) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// removePodInterface is a no-op off Linux; the plugin only runs on Linux nodes.
+func removePodInterface(netnsPath, ifName string) error {
+	return nil
+}
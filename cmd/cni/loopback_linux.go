@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// setupLoopback brings up lo in the pod's netns. Chained setups get this
+// from the loopback plugin; standalone we do it ourselves.
+func setupLoopback(netnsPath string) error {
+	return ns.WithNetNSPath(netnsPath, func(_ ns.NetNS) error {
+		lo, err := netlink.LinkByName("lo")
+		if err != nil {
+			return fmt.Errorf("getting lo: %w", err)
+		}
+		if err := netlink.LinkSetUp(lo); err != nil {
+			return fmt.Errorf("bringing up lo: %w", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// setupLoopback is a no-op off Linux; the plugin only runs on Linux nodes.
+func setupLoopback(netnsPath string) error {
+	return nil
+}
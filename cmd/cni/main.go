@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
@@ -14,7 +16,9 @@ import (
 	"github.com/containernetworking/cni/pkg/version"
 	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 // NetConf represents the CNI network configuration.
@@ -22,8 +26,52 @@ type NetConf struct {
 	types.NetConf
 	DaemonSocket string `json:"daemonSocket"`
 	ClusterName  string `json:"clusterName"`
+	// TailscaleRoutes are the CIDRs routed via the pod's Tailscale interface.
+	// Defaults to the whole Tailscale CGNAT range.
+	TailscaleRoutes []string `json:"tailscaleRoutes,omitempty"`
+	// RoutingMode is "kernel" or "netstack". Defaults to the daemon's
+	// -routing-mode.
+	RoutingMode string `json:"routingMode,omitempty"`
+	// DaemonDialTimeoutSeconds bounds each attempt to connect to the daemon.
+	DaemonDialTimeoutSeconds int `json:"daemonDialTimeoutSeconds,omitempty"`
+	// DaemonMaxRetries is how many times to try connecting to the daemon,
+	// with exponential backoff in between, before giving up.
+	DaemonMaxRetries int `json:"daemonMaxRetries,omitempty"`
+	// RequirePrevResult fails ADD unless a primary plugin ran first and
+	// gave the pod an IP, instead of falling back to standalone mode or
+	// carrying on without a cluster IP.
+	RequirePrevResult bool `json:"requirePrevResult,omitempty"`
 }
 
+// podIfName is the pod-side Tailscale interface the daemon creates.
+const podIfName = "ts0"
+
+// tombstoneDirName is the directory, next to the daemon socket, where cmdDel
+// leaves a marker for each container it couldn't hand to the daemon.
+// The daemon finishes cleanup for these on startup.
+const tombstoneDirName = "tombstones"
+
+// Retryable Add failures (see pb.ErrorDetail) are retried up to maxAddAttempts
+// times, waiting addRetryDelay times the attempt number in between.
+const (
+	maxAddAttempts = 3
+	addRetryDelay  = 2 * time.Second
+)
+
+// Defaults for connecting to the daemon. With these, a daemon that never
+// comes up fails ADD after well over a minute.
+const (
+	defaultDaemonDialTimeoutSeconds = 5
+	defaultDaemonMaxRetries         = 10
+)
+
+// errPluginNotAvailable is the CNI error code for a plugin that can't
+// service ADD requests yet. The cni library doesn't define it.
+const errPluginNotAvailable uint = 50
+
+// defaultTailscaleRoutes are the Tailscale CGNAT range and IPv6 ULA range.
+var defaultTailscaleRoutes = []string{"100.64.0.0/10", "fd7a:115c:a1e0::/48"}
+
 // K8sArgs represents Kubernetes-specific CNI arguments.
 type K8sArgs struct {
 	types.CommonArgs
@@ -33,12 +81,18 @@ type K8sArgs struct {
 	K8S_POD_UID                types.UnmarshallableString
 }
 
+// supportedVersions are the CNI spec versions the plugin accepts. cmdAdd's
+// result is converted to whichever of them the network config asks for.
+var supportedVersions = version.PluginSupports("0.3.0", "0.3.1", "0.4.0", "1.0.0", "1.1.0")
+
 func main() {
 	skel.PluginMainFuncs(skel.CNIFuncs{
-		Add:   cmdAdd,
-		Del:   cmdDel,
-		Check: cmdCheck,
-	}, version.PluginSupports("0.3.0", "0.3.1", "0.4.0", "1.0.0"), "tailscale-cni")
+		Add:    cmdAdd,
+		Del:    cmdDel,
+		Check:  cmdCheck,
+		GC:     cmdGC,
+		Status: cmdStatus,
+	}, supportedVersions, "tailscale-cni")
 }
 
 func loadConf(bytes []byte) (*NetConf, error) {
@@ -49,6 +103,18 @@ func loadConf(bytes []byte) (*NetConf, error) {
 	if conf.DaemonSocket == "" {
 		conf.DaemonSocket = "/var/run/tailscale-cni/daemon.sock"
 	}
+	if len(conf.TailscaleRoutes) == 0 {
+		conf.TailscaleRoutes = defaultTailscaleRoutes
+	}
+	if conf.DaemonDialTimeoutSeconds == 0 {
+		conf.DaemonDialTimeoutSeconds = defaultDaemonDialTimeoutSeconds
+	}
+	if conf.DaemonMaxRetries == 0 {
+		conf.DaemonMaxRetries = defaultDaemonMaxRetries
+	}
+	if err := conf.validate(); err != nil {
+		return nil, fmt.Errorf("invalid network config: %w", err)
+	}
 	// Parse the previous result from raw JSON
 	if err := version.ParsePrevResult(&conf.NetConf); err != nil {
 		return nil, fmt.Errorf("failed to parse prevResult: %w", err)
@@ -56,6 +122,52 @@ func loadConf(bytes []byte) (*NetConf, error) {
 	return conf, nil
 }
 
+// validate checks the plugin's own fields, after defaults are applied, so
+// that a typo fails every ADD with the field at fault rather than somewhere
+// in the daemon.
+func (conf *NetConf) validate() error {
+	if !filepath.IsAbs(conf.DaemonSocket) {
+		return fmt.Errorf("daemonSocket %q is not an absolute path", conf.DaemonSocket)
+	}
+	// The daemon lowercases the name and replaces anything but letters,
+	// digits and hyphens, so it only has to leave something behind
+	if conf.ClusterName != "" && !strings.ContainsFunc(conf.ClusterName, isHostnameAlnum) {
+		return fmt.Errorf("clusterName %q has no letters or digits to use in a hostname", conf.ClusterName)
+	}
+	for _, cidr := range conf.TailscaleRoutes {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid tailscaleRoutes entry %q: %w", cidr, err)
+		}
+	}
+	if conf.DaemonDialTimeoutSeconds < 0 || conf.DaemonMaxRetries < 0 {
+		return fmt.Errorf("daemonDialTimeoutSeconds and daemonMaxRetries must not be negative")
+	}
+	switch conf.RoutingMode {
+	case "", "kernel", "netstack":
+	default:
+		return fmt.Errorf("invalid routingMode %q (want \"kernel\" or \"netstack\")", conf.RoutingMode)
+	}
+	return nil
+}
+
+// isHostnameAlnum reports whether r survives hostname sanitization.
+func isHostnameAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// prevResultClusterIP returns the pod's first IP from the primary plugin's
+// result.
+func prevResultClusterIP(conf *NetConf) (string, error) {
+	prevResult, err := current.GetResult(conf.PrevResult)
+	if err != nil {
+		return "", fmt.Errorf("reading prevResult: %w", err)
+	}
+	if len(prevResult.IPs) == 0 {
+		return "", fmt.Errorf("prevResult has no IPs")
+	}
+	return prevResult.IPs[0].Address.IP.String(), nil
+}
+
 func parseK8sArgs(args string) (*K8sArgs, error) {
 	k8sArgs := &K8sArgs{}
 	if err := types.LoadArgs(args, k8sArgs); err != nil {
@@ -64,48 +176,63 @@ func parseK8sArgs(args string) (*K8sArgs, error) {
 	return k8sArgs, nil
 }
 
-func connectToDaemon(socketPath string) (pb.TailscaleCNIClient, *grpc.ClientConn, error) {
+func connectToDaemon(conf *NetConf) (pb.TailscaleCNIClient, *grpc.ClientConn, error) {
 	// Retry connection with exponential backoff
 	// This handles the case where pods start before the daemon is ready
-	var conn *grpc.ClientConn
-	var err error
-
-	maxRetries := 10
+	socketPath := conf.DaemonSocket
+	dialTimeout := time.Duration(conf.DaemonDialTimeoutSeconds) * time.Second
 	baseDelay := 500 * time.Millisecond
 
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-
-		conn, err = grpc.DialContext(ctx, "unix://"+socketPath,
+	var err error
+	for attempt := 0; attempt < conf.DaemonMaxRetries; attempt++ {
+		var conn *grpc.ClientConn
+		conn, err = grpc.NewClient("unix://"+socketPath,
 			grpc.WithTransportCredentials(insecure.NewCredentials()),
-			grpc.WithBlock(),
 		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("creating daemon client: %w", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		err = waitForReady(ctx, conn)
 		cancel()
 
 		if err == nil {
 			return pb.NewTailscaleCNIClient(conn), conn, nil
 		}
+		conn.Close()
+
+		if attempt == conf.DaemonMaxRetries-1 {
+			break
+		}
 
 		// Check if socket exists - if not, daemon isn't ready yet
+		maxDelay := 5 * time.Second
 		if _, statErr := os.Stat(socketPath); os.IsNotExist(statErr) {
-			// Socket doesn't exist, wait and retry
-			delay := baseDelay * time.Duration(1<<uint(attempt))
-			if delay > 10*time.Second {
-				delay = 10 * time.Second
-			}
-			time.Sleep(delay)
-			continue
+			maxDelay = 10 * time.Second
 		}
-
-		// Socket exists but connection failed - wait shorter and retry
 		delay := baseDelay * time.Duration(1<<uint(attempt))
-		if delay > 5*time.Second {
-			delay = 5 * time.Second
+		if delay > maxDelay {
+			delay = maxDelay
 		}
 		time.Sleep(delay)
 	}
 
-	return nil, nil, fmt.Errorf("connecting to daemon at %s after %d attempts: %w", socketPath, maxRetries, err)
+	return nil, nil, fmt.Errorf("connecting to daemon at %s after %d attempts: %w", socketPath, conf.DaemonMaxRetries, err)
+}
+
+// waitForReady connects conn and waits until it is ready to send RPCs.
+func waitForReady(ctx context.Context, conn *grpc.ClientConn) error {
+	conn.Connect()
+	for {
+		state := conn.GetState()
+		if state == connectivity.Ready {
+			return nil
+		}
+		if !conn.WaitForStateChange(ctx, state) {
+			return fmt.Errorf("daemon connection %s: %w", strings.ToLower(state.String()), ctx.Err())
+		}
+	}
 }
 
 func cmdAdd(args *skel.CmdArgs) error {
@@ -119,16 +246,28 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 
-	// Get cluster IP from previous CNI result (chaining)
+	// Get cluster IP from previous CNI result (chaining). Without one we're
+	// the only plugin and Tailscale is the pod's only network.
 	var clusterIP string
-	if conf.PrevResult != nil {
-		prevResult, err := current.GetResult(conf.PrevResult)
-		if err == nil && len(prevResult.IPs) > 0 {
-			clusterIP = prevResult.IPs[0].Address.IP.String()
+	standalone := conf.PrevResult == nil
+	if standalone && conf.RequirePrevResult {
+		return fmt.Errorf("no prevResult: requirePrevResult is set, so a primary CNI plugin must run before tailscale-cni")
+	}
+	if standalone {
+		if err := setupLoopback(args.Netns); err != nil {
+			return fmt.Errorf("setting up loopback: %w", err)
+		}
+	} else {
+		clusterIP, err = prevResultClusterIP(conf)
+		if err != nil && conf.RequirePrevResult {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: continuing without a cluster IP: %v\n", err)
 		}
 	}
 
-	client, conn, err := connectToDaemon(conf.DaemonSocket)
+	client, conn, err := connectToDaemon(conf)
 	if err != nil {
 		return err
 	}
@@ -138,32 +277,80 @@ func cmdAdd(args *skel.CmdArgs) error {
 	defer cancel()
 
 	req := &pb.AddRequest{
-		ContainerId:  args.ContainerID,
-		Netns:        args.Netns,
-		IfName:       args.IfName,
-		PodName:      string(k8sArgs.K8S_POD_NAME),
-		PodNamespace: string(k8sArgs.K8S_POD_NAMESPACE),
-		PodUid:       string(k8sArgs.K8S_POD_UID),
-		ClusterIp:    clusterIP,
+		ContainerId:     args.ContainerID,
+		Netns:           args.Netns,
+		IfName:          args.IfName,
+		PodName:         string(k8sArgs.K8S_POD_NAME),
+		PodNamespace:    string(k8sArgs.K8S_POD_NAMESPACE),
+		PodUid:          string(k8sArgs.K8S_POD_UID),
+		ClusterIp:       clusterIP,
+		TailscaleRoutes: conf.TailscaleRoutes,
+		Standalone:      standalone,
+		RoutingMode:     conf.RoutingMode,
+	}
+
+	var resp *pb.AddResponse
+	for attempt := 1; ; attempt++ {
+		resp, err = client.Add(ctx, req)
+		if err == nil {
+			break
+		}
+		detail := errorDetail(err)
+		if detail == nil || !detail.Retryable || attempt == maxAddAttempts {
+			return addError(err, detail)
+		}
+		fmt.Fprintf(os.Stderr, "Warning: daemon Add failed (attempt %d/%d), retrying: %v\n", attempt, maxAddAttempts, err)
+		select {
+		case <-time.After(addRetryDelay * time.Duration(attempt)):
+		case <-ctx.Done():
+			return addError(err, detail)
+		}
 	}
 
-	resp, err := client.Add(ctx, req)
+	// Tailscale is disabled for the pod's namespace, or the pod is on the
+	// host network: leave the pod's network as the previous plugin set it up
+	if resp.Skipped {
+		if standalone {
+			return fmt.Errorf("tailscale skipped the pod (disabled for namespace %s, or host network) and the pod has no other network", k8sArgs.K8S_POD_NAMESPACE)
+		}
+		return types.PrintResult(conf.PrevResult, conf.CNIVersion)
+	}
+
+	result, err := buildResult(conf, args, resp)
 	if err != nil {
-		return fmt.Errorf("daemon Add failed: %w", err)
+		return err
 	}
+	return types.PrintResult(result, conf.CNIVersion)
+}
 
+// buildResult builds the CNI result for a pod from the daemon's response.
+// The pod's Tailscale addresses are reported on the interface the daemon
+// created in its netns (interface 0); the host veth, if known, is interface 1.
+//
+// The result is at the library's current spec version, not the config's:
+// labelling it with an older version would make PrintResult skip the
+// conversion and print current fields under an old version, e.g. IPs
+// without the "version" key 0.3.x and 0.4.0 consumers need.
+func buildResult(conf *NetConf, args *skel.CmdArgs, resp *pb.AddResponse) (*current.Result, error) {
 	// Parse the returned IP
 	tailscaleIP := net.ParseIP(resp.TailscaleIpv4)
 	if tailscaleIP == nil {
-		return fmt.Errorf("invalid Tailscale IP: %s", resp.TailscaleIpv4)
+		return nil, fmt.Errorf("invalid Tailscale IP: %s", resp.TailscaleIpv4)
+	}
+
+	// Report the interface the daemon actually created. Daemons that don't
+	// say use args.IfName.
+	ifName := resp.InterfaceName
+	if ifName == "" {
+		ifName = args.IfName
 	}
 
 	// Build CNI result
 	result := &current.Result{
-		CNIVersion: conf.CNIVersion,
+		CNIVersion: current.ImplementedSpecVersion,
 		Interfaces: []*current.Interface{
 			{
-				Name:    args.IfName,
+				Name:    ifName,
 				Sandbox: args.Netns,
 			},
 		},
@@ -176,15 +363,21 @@ func cmdAdd(args *skel.CmdArgs) error {
 				Interface: intPtr(0),
 			},
 		},
-		// Add route for Tailscale CGNAT range
-		Routes: []*types.Route{
-			{
-				Dst: net.IPNet{
-					IP:   net.ParseIP("100.64.0.0"),
-					Mask: net.CIDRMask(10, 32),
-				},
-			},
-		},
+	}
+
+	// The host side of the veth pair, so the result describes the whole link
+	if resp.HostInterfaceName != "" {
+		result.Interfaces = append(result.Interfaces, &current.Interface{Name: resp.HostInterfaceName})
+	}
+
+	// Add routes for the configured Tailscale ranges (validated in loadConf).
+	// The daemon skips IPv6 ranges for a node without an IPv6 address.
+	for _, cidr := range conf.TailscaleRoutes {
+		_, dst, _ := net.ParseCIDR(cidr)
+		if dst.IP.To4() == nil && resp.TailscaleIpv6 == "" {
+			continue
+		}
+		result.Routes = append(result.Routes, &types.Route{Dst: *dst})
 	}
 
 	// Add IPv6 if available
@@ -201,7 +394,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 		}
 	}
 
-	return types.PrintResult(result, conf.CNIVersion)
+	return result, nil
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -210,11 +403,18 @@ func cmdDel(args *skel.CmdArgs) error {
 		return err
 	}
 
-	client, conn, err := connectToDaemon(conf.DaemonSocket)
+	client, conn, err := connectToDaemon(conf)
 	if err != nil {
-		// If daemon is not available, assume cleanup already happened
-		// This is safe because DEL must be idempotent
+		// The daemon is down, so it can't tear down the pod's node. Remove
+		// what we can ourselves and leave a tombstone so the daemon finishes
+		// the job on startup. DEL must be idempotent, so never fail here.
 		fmt.Fprintf(os.Stderr, "Warning: could not connect to daemon: %v\n", err)
+		if err := removePodInterface(args.Netns, podIfName); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: removing pod interface: %v\n", err)
+		}
+		if err := writeTombstone(conf.DaemonSocket, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: writing tombstone: %v\n", err)
+		}
 		return nil
 	}
 	defer conn.Close()
@@ -243,7 +443,7 @@ func cmdCheck(args *skel.CmdArgs) error {
 		return err
 	}
 
-	client, conn, err := connectToDaemon(conf.DaemonSocket)
+	client, conn, err := connectToDaemon(conf)
 	if err != nil {
 		return err
 	}
@@ -270,6 +470,129 @@ func cmdCheck(args *skel.CmdArgs) error {
 	return nil
 }
 
+// cmdGC has the daemon remove pods for containers the runtime no longer has
+// attached to this network (CNI 1.1).
+func cmdGC(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	client, conn, err := connectToDaemon(conf)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	req := &pb.GCRequest{}
+	for _, a := range conf.ValidAttachments {
+		req.ValidContainerIds = append(req.ValidContainerIds, a.ContainerID)
+	}
+
+	resp, err := client.GC(ctx, req)
+	if err != nil {
+		return fmt.Errorf("daemon GC failed: %w", err)
+	}
+	if len(resp.RemovedContainerIds) > 0 {
+		fmt.Fprintf(os.Stderr, "Removed pods for %d stale containers\n", len(resp.RemovedContainerIds))
+	}
+
+	return nil
+}
+
+// cmdStatus reports whether the daemon is ready for ADDs (CNI 1.1). The
+// runtime polls it, so it tries the daemon once rather than waiting for it.
+func cmdStatus(args *skel.CmdArgs) error {
+	conf, err := loadConf(args.StdinData)
+	if err != nil {
+		return err
+	}
+
+	once := *conf
+	once.DaemonMaxRetries = 1
+	client, conn, err := connectToDaemon(&once)
+	if err != nil {
+		return types.NewError(errPluginNotAvailable, "daemon not reachable", err.Error())
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resp, err := client.Status(ctx, &pb.StatusRequest{})
+	if err != nil {
+		return types.NewError(errPluginNotAvailable, "daemon Status failed", err.Error())
+	}
+	if !resp.Ready {
+		return types.NewError(errPluginNotAvailable, "daemon not ready", resp.Message)
+	}
+
+	return nil
+}
+
+// errorDetail returns the ErrorDetail attached to a daemon error, if any.
+func errorDetail(err error) *pb.ErrorDetail {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	for _, d := range st.Details() {
+		if detail, ok := d.(*pb.ErrorDetail); ok {
+			return detail
+		}
+	}
+	return nil
+}
+
+// addError converts a failed Add into a CNI error. Retryable failures get
+// CNI's "try again later" code; the reason is included so it shows up in
+// the pod's events.
+func addError(err error, detail *pb.ErrorDetail) error {
+	if detail == nil {
+		return fmt.Errorf("daemon Add failed: %w", err)
+	}
+	msg := err.Error()
+	if st, ok := status.FromError(err); ok {
+		msg = st.Message()
+	}
+	code := types.ErrInternal
+	if detail.Retryable {
+		code = types.ErrTryAgainLater
+	}
+	return types.NewError(code, "daemon Add failed: "+detail.Reason.String(), msg)
+}
+
+// tombstone records a DEL the daemon never saw.
+type tombstone struct {
+	ContainerID string    `json:"containerId"`
+	Netns       string    `json:"netns"`
+	DeletedAt   time.Time `json:"deletedAt"`
+}
+
+// writeTombstone marks a container as deleted for the daemon to clean up.
+// The file is named after the container ID; writing it twice is harmless.
+func writeTombstone(socketPath string, args *skel.CmdArgs) error {
+	if args.ContainerID == "" || strings.ContainsAny(args.ContainerID, `/\`) {
+		return fmt.Errorf("invalid container ID %q", args.ContainerID)
+	}
+	dir := filepath.Join(filepath.Dir(socketPath), tombstoneDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(tombstone{
+		ContainerID: args.ContainerID,
+		Netns:       args.Netns,
+		DeletedAt:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, args.ContainerID), data, 0600)
+}
+
 func intPtr(i int) *int {
 	return &i
 }
@@ -1,16 +1,38 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	current "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/status"
 )
 
 func TestLoadConf(t *testing.T) {
 	tests := []struct {
-		name           string
-		input          string
-		wantErr        bool
-		wantSocket     string
-		wantCNIVersion string
+		name            string
+		input           string
+		wantErr         bool
+		wantSocket      string
+		wantCNIVersion  string
+		wantRoutes      []string
+		wantRoutingMode string
 	}{
 		{
 			name: "valid minimal config",
@@ -35,6 +57,16 @@ func TestLoadConf(t *testing.T) {
 			wantSocket:     "/custom/path/daemon.sock",
 			wantCNIVersion: "1.0.0",
 		},
+		{
+			name: "relative socket path",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"daemonSocket": "run/daemon.sock"
+			}`,
+			wantErr: true,
+		},
 		{
 			name: "config with cluster name",
 			input: `{
@@ -47,6 +79,62 @@ func TestLoadConf(t *testing.T) {
 			wantSocket:     "/var/run/tailscale-cni/daemon.sock",
 			wantCNIVersion: "1.0.0",
 		},
+		{
+			name: "config with narrowed tailscale routes",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"tailscaleRoutes": ["100.100.0.0/16", "100.101.1.0/24"]
+			}`,
+			wantErr:        false,
+			wantSocket:     "/var/run/tailscale-cni/daemon.sock",
+			wantCNIVersion: "1.0.0",
+			wantRoutes:     []string{"100.100.0.0/16", "100.101.1.0/24"},
+		},
+		{
+			name: "invalid tailscale route",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"tailscaleRoutes": ["100.100.0.0"]
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "config with routing mode",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"routingMode": "netstack"
+			}`,
+			wantErr:         false,
+			wantSocket:      "/var/run/tailscale-cni/daemon.sock",
+			wantCNIVersion:  "1.0.0",
+			wantRoutingMode: "netstack",
+		},
+		{
+			name: "invalid routing mode",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"routingMode": "userspace"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "negative daemon retries",
+			input: `{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"daemonMaxRetries": -1
+			}`,
+			wantErr: true,
+		},
 		{
 			name:    "invalid json",
 			input:   `{invalid json}`,
@@ -79,10 +167,57 @@ func TestLoadConf(t *testing.T) {
 			if tt.wantCNIVersion != "" && conf.CNIVersion != tt.wantCNIVersion {
 				t.Errorf("loadConf().CNIVersion = %q, want %q", conf.CNIVersion, tt.wantCNIVersion)
 			}
+
+			wantRoutes := tt.wantRoutes
+			if wantRoutes == nil {
+				wantRoutes = []string{"100.64.0.0/10", "fd7a:115c:a1e0::/48"}
+			}
+			if !reflect.DeepEqual(conf.TailscaleRoutes, wantRoutes) {
+				t.Errorf("loadConf().TailscaleRoutes = %v, want %v", conf.TailscaleRoutes, wantRoutes)
+			}
+
+			if conf.RoutingMode != tt.wantRoutingMode {
+				t.Errorf("loadConf().RoutingMode = %q, want %q", conf.RoutingMode, tt.wantRoutingMode)
+			}
 		})
 	}
 }
 
+func TestNetConfValidate(t *testing.T) {
+	valid := func() *NetConf {
+		return &NetConf{
+			DaemonSocket:    "/var/run/tailscale-cni/daemon.sock",
+			ClusterName:     "Prod.EU",
+			TailscaleRoutes: defaultTailscaleRoutes,
+			RoutingMode:     "kernel",
+		}
+	}
+	if err := valid().validate(); err != nil {
+		t.Fatalf("validate() of a valid config error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*NetConf)
+		wantErr string
+	}{
+		{"relative socket", func(c *NetConf) { c.DaemonSocket = "daemon.sock" }, "daemonSocket"},
+		{"cluster name with nothing to keep", func(c *NetConf) { c.ClusterName = "--." }, "clusterName"},
+		{"route without a prefix length", func(c *NetConf) { c.TailscaleRoutes = []string{"100.64.0.0"} }, "tailscaleRoutes"},
+		{"route with a bad prefix length", func(c *NetConf) { c.TailscaleRoutes = []string{"100.64.0.0/33"} }, "tailscaleRoutes"},
+		{"negative dial timeout", func(c *NetConf) { c.DaemonDialTimeoutSeconds = -1 }, "daemonDialTimeoutSeconds"},
+		{"negative retries", func(c *NetConf) { c.DaemonMaxRetries = -1 }, "daemonMaxRetries"},
+		{"unknown routing mode", func(c *NetConf) { c.RoutingMode = "userspace" }, "routingMode"},
+	}
+	for _, tt := range tests {
+		conf := valid()
+		tt.modify(conf)
+		if err := conf.validate(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validate() with %s error = %v, want it to mention %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
 func TestParseK8sArgs(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -157,3 +292,415 @@ func TestParseK8sArgs(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConf_DaemonDial(t *testing.T) {
+	conf, err := loadConf([]byte(`{"cniVersion": "1.0.0", "name": "tailscale", "type": "tailscale-cni"}`))
+	if err != nil {
+		t.Fatalf("loadConf() error = %v", err)
+	}
+	if conf.DaemonDialTimeoutSeconds != 5 || conf.DaemonMaxRetries != 10 {
+		t.Errorf("loadConf() dial timeout, retries = %d, %d; want defaults 5, 10", conf.DaemonDialTimeoutSeconds, conf.DaemonMaxRetries)
+	}
+
+	conf, err = loadConf([]byte(`{"cniVersion": "1.0.0", "name": "tailscale", "type": "tailscale-cni", "daemonDialTimeoutSeconds": 1, "daemonMaxRetries": 2}`))
+	if err != nil {
+		t.Fatalf("loadConf() error = %v", err)
+	}
+	if conf.DaemonDialTimeoutSeconds != 1 || conf.DaemonMaxRetries != 2 {
+		t.Errorf("loadConf() dial timeout, retries = %d, %d; want 1, 2", conf.DaemonDialTimeoutSeconds, conf.DaemonMaxRetries)
+	}
+}
+
+func TestConnectToDaemon(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	conf := &NetConf{DaemonSocket: socketPath, DaemonDialTimeoutSeconds: 1, DaemonMaxRetries: 1}
+
+	// No daemon: one attempt fails at its dial timeout
+	start := time.Now()
+	if _, _, err := connectToDaemon(conf); err == nil {
+		t.Fatalf("connectToDaemon() with no daemon succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("connectToDaemon() took %v with a 1s timeout and one attempt", elapsed)
+	}
+
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterTailscaleCNIServer(srv, pb.UnimplementedTailscaleCNIServer{})
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	_, conn, err := connectToDaemon(conf)
+	if err != nil {
+		t.Fatalf("connectToDaemon() error = %v", err)
+	}
+	defer conn.Close()
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Errorf("connection state = %v, want Ready", state)
+	}
+}
+
+// fakeDaemon records the GC requests it gets and reports ready as its
+// status.
+type fakeDaemon struct {
+	pb.UnimplementedTailscaleCNIServer
+	gcReq *pb.GCRequest
+	ready atomic.Bool
+}
+
+func (d *fakeDaemon) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
+	return &pb.StatusResponse{Ready: d.ready.Load(), Message: "still recovering pods"}, nil
+}
+
+func (d *fakeDaemon) GC(ctx context.Context, req *pb.GCRequest) (*pb.GCResponse, error) {
+	d.gcReq = req
+	return &pb.GCResponse{RemovedContainerIds: []string{"stale"}}, nil
+}
+
+func TestCmdGC(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := &fakeDaemon{}
+	srv := grpc.NewServer()
+	pb.RegisterTailscaleCNIServer(srv, daemon)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conf := `{
+		"cniVersion": "1.1.0",
+		"name": "tailscale",
+		"type": "tailscale-cni",
+		"daemonSocket": "` + socketPath + `",
+		"cni.dev/valid-attachments": [
+			{"containerID": "c1", "ifname": "eth0"},
+			{"containerID": "c2", "ifname": "eth0"}
+		]
+	}`
+	if err := cmdGC(&skel.CmdArgs{StdinData: []byte(conf)}); err != nil {
+		t.Fatalf("cmdGC() error = %v", err)
+	}
+	if daemon.gcReq == nil || !reflect.DeepEqual(daemon.gcReq.ValidContainerIds, []string{"c1", "c2"}) {
+		t.Errorf("daemon got GC request %v, want valid containers [c1 c2]", daemon.gcReq)
+	}
+}
+
+func TestCmdStatus(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	conf := []byte(`{
+		"cniVersion": "1.1.0",
+		"name": "tailscale",
+		"type": "tailscale-cni",
+		"daemonSocket": "` + socketPath + `",
+		"daemonDialTimeoutSeconds": 1
+	}`)
+	wantNotAvailable := func(err error) {
+		t.Helper()
+		var cniErr *types.Error
+		if !errors.As(err, &cniErr) || cniErr.Code != errPluginNotAvailable {
+			t.Errorf("cmdStatus() error = %v, want code %d", err, errPluginNotAvailable)
+		}
+	}
+
+	// No daemon yet
+	wantNotAvailable(cmdStatus(&skel.CmdArgs{StdinData: conf}))
+
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	daemon := &fakeDaemon{}
+	srv := grpc.NewServer()
+	pb.RegisterTailscaleCNIServer(srv, daemon)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	wantNotAvailable(cmdStatus(&skel.CmdArgs{StdinData: conf}))
+
+	daemon.ready.Store(true)
+	if err := cmdStatus(&skel.CmdArgs{StdinData: conf}); err != nil {
+		t.Errorf("cmdStatus() with a ready daemon error = %v", err)
+	}
+}
+
+func TestWriteTombstone(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	args := &skel.CmdArgs{ContainerID: "abc123", Netns: "/var/run/netns/test"}
+
+	// Writing twice must succeed (DEL is idempotent).
+	for i := 0; i < 2; i++ {
+		if err := writeTombstone(socketPath, args); err != nil {
+			t.Fatalf("writeTombstone() error = %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(filepath.Dir(socketPath), "tombstones", "abc123"))
+	if err != nil {
+		t.Fatalf("reading tombstone: %v", err)
+	}
+	var ts tombstone
+	if err := json.Unmarshal(data, &ts); err != nil {
+		t.Fatalf("parsing tombstone: %v", err)
+	}
+	if ts.ContainerID != "abc123" || ts.Netns != "/var/run/netns/test" {
+		t.Errorf("tombstone = %+v", ts)
+	}
+
+	if err := writeTombstone(socketPath, &skel.CmdArgs{ContainerID: "../escape"}); err == nil {
+		t.Errorf("writeTombstone() with path in container ID succeeded, want error")
+	}
+}
+
+func TestAddError(t *testing.T) {
+	tests := []struct {
+		name     string
+		detail   *pb.ErrorDetail
+		wantCode uint
+	}{
+		{
+			name:     "retryable",
+			detail:   &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_API_RATE_LIMITED, Retryable: true},
+			wantCode: types.ErrTryAgainLater,
+		},
+		{
+			name:     "fatal",
+			detail:   &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_NETNS_GONE},
+			wantCode: types.ErrInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st, err := status.New(codes.Internal, "adding pod: failed").WithDetails(tt.detail)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rpcErr := st.Err()
+
+			detail := errorDetail(rpcErr)
+			if detail == nil || detail.Reason != tt.detail.Reason {
+				t.Fatalf("errorDetail() = %v, want reason %v", detail, tt.detail.Reason)
+			}
+
+			cniErr, ok := addError(rpcErr, detail).(*types.Error)
+			if !ok {
+				t.Fatalf("addError() is not a *types.Error")
+			}
+			if cniErr.Code != tt.wantCode {
+				t.Errorf("addError() code = %d, want %d", cniErr.Code, tt.wantCode)
+			}
+			if cniErr.Details != "adding pod: failed" {
+				t.Errorf("addError() details = %q, want the daemon's message", cniErr.Details)
+			}
+		})
+	}
+}
+
+func TestPrevResultClusterIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		prevResult string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "primary plugin IP",
+			prevResult: `{"cniVersion": "1.0.0", "ips": [{"address": "10.42.0.7/24"}, {"address": "fd00::7/64"}]}`,
+			want:       "10.42.0.7",
+		},
+		{
+			name:       "no IPs",
+			prevResult: `{"cniVersion": "1.0.0", "interfaces": [{"name": "eth0"}]}`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := loadConf([]byte(`{
+				"cniVersion": "1.0.0",
+				"name": "tailscale",
+				"type": "tailscale-cni",
+				"prevResult": ` + tt.prevResult + `
+			}`))
+			if err != nil {
+				t.Fatalf("loadConf() error = %v", err)
+			}
+			got, err := prevResultClusterIP(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prevResultClusterIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("prevResultClusterIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildResult_Standalone(t *testing.T) {
+	args := &skel.CmdArgs{ContainerID: "abc", Netns: "/var/run/netns/test", IfName: "eth0"}
+	resp := &pb.AddResponse{TailscaleIpv4: "100.64.0.5", TailscaleIpv6: "fd7a:115c:a1e0::5"}
+
+	for _, cniVersion := range []string{"0.3.1", "0.4.0", "1.0.0"} {
+		t.Run(cniVersion, func(t *testing.T) {
+			conf := &NetConf{TailscaleRoutes: defaultTailscaleRoutes}
+			conf.CNIVersion = cniVersion
+
+			result, err := buildResult(conf, args, resp)
+			if err != nil {
+				t.Fatalf("buildResult() error = %v", err)
+			}
+
+			// The runtime takes the pod IP from the interface it asked for
+			if len(result.Interfaces) != 1 || result.Interfaces[0].Name != "eth0" || result.Interfaces[0].Sandbox != args.Netns {
+				t.Errorf("interfaces = %+v, want eth0 in the pod netns", result.Interfaces)
+			}
+			for _, ip := range result.IPs {
+				if ip.Interface == nil || *ip.Interface != 0 {
+					t.Errorf("IP %s not attached to interface 0", ip.Address.String())
+				}
+			}
+
+			// Must survive conversion to the version the runtime requested
+			converted, err := result.GetAsVersion(cniVersion)
+			if err != nil {
+				t.Fatalf("GetAsVersion(%s) error = %v", cniVersion, err)
+			}
+			if len(result.Routes) != 2 {
+				t.Errorf("routes = %v, want both Tailscale ranges", result.Routes)
+			}
+			if converted.Version() != cniVersion {
+				t.Errorf("converted version = %s, want %s", converted.Version(), cniVersion)
+			}
+		})
+	}
+}
+
+func TestBuildResult_Versions(t *testing.T) {
+	args := &skel.CmdArgs{ContainerID: "abc", Netns: "/var/run/netns/test", IfName: "eth0"}
+	resp := &pb.AddResponse{
+		TailscaleIpv4:     "100.64.0.5",
+		TailscaleIpv6:     "fd7a:115c:a1e0::5",
+		InterfaceName:     "ts0",
+		HostInterfaceName: "veth1a2b3c4d",
+	}
+
+	for _, cniVersion := range supportedVersions.SupportedVersions() {
+		t.Run(cniVersion, func(t *testing.T) {
+			conf := &NetConf{TailscaleRoutes: defaultTailscaleRoutes}
+			conf.CNIVersion = cniVersion
+			result, err := buildResult(conf, args, resp)
+			if err != nil {
+				t.Fatalf("buildResult() error = %v", err)
+			}
+
+			// What PrintResult writes to stdout
+			converted, err := result.GetAsVersion(cniVersion)
+			if err != nil {
+				t.Fatalf("GetAsVersion(%s) error = %v", cniVersion, err)
+			}
+			out, err := json.Marshal(converted)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var raw struct {
+				CNIVersion string `json:"cniVersion"`
+				IPs        []struct {
+					Version   string `json:"version"`
+					Address   string `json:"address"`
+					Interface *int   `json:"interface"`
+				} `json:"ips"`
+			}
+			if err := json.Unmarshal(out, &raw); err != nil {
+				t.Fatalf("unmarshaling %s: %v", out, err)
+			}
+			if raw.CNIVersion != cniVersion {
+				t.Errorf("cniVersion = %q, want %q", raw.CNIVersion, cniVersion)
+			}
+			if len(raw.IPs) != 2 {
+				t.Fatalf("ips = %+v, want IPv4 and IPv6", raw.IPs)
+			}
+			// 0.3.x and 0.4.0 results must say each IP's family
+			legacy := cniVersion < "1.0.0"
+			for i, want := range []string{"4", "6"} {
+				ip := raw.IPs[i]
+				if legacy && ip.Version != want {
+					t.Errorf("ips[%d] version = %q, want %q in %s", i, ip.Version, want, out)
+				}
+				if !legacy && ip.Version != "" {
+					t.Errorf("ips[%d] has version %q, which %s results don't", i, ip.Version, cniVersion)
+				}
+				if ip.Interface == nil || *ip.Interface != 0 {
+					t.Errorf("ips[%d] not on interface 0 in %s", i, out)
+				}
+			}
+
+			// A runtime parsing the output gets everything back
+			parsed, err := version.NewResult(cniVersion, out)
+			if err != nil {
+				t.Fatalf("parsing %s result: %v", cniVersion, err)
+			}
+			back, err := current.NewResultFromResult(parsed)
+			if err != nil {
+				t.Fatalf("converting %s result back: %v", cniVersion, err)
+			}
+			if len(back.Interfaces) != 2 || back.Interfaces[0].Name != "ts0" || back.Interfaces[0].Sandbox != args.Netns {
+				t.Errorf("interfaces after round trip = %+v, want ts0 in the pod and its host veth", back.Interfaces)
+			}
+			if len(back.IPs) != 2 || back.IPs[0].Address.String() != "100.64.0.5/32" || back.IPs[1].Address.String() != "fd7a:115c:a1e0::5/128" {
+				t.Errorf("IPs after round trip = %v", back.IPs)
+			}
+			if len(back.Routes) != 2 {
+				t.Errorf("routes after round trip = %v, want both Tailscale ranges", back.Routes)
+			}
+		})
+	}
+}
+
+func TestBuildResult_InvalidIP(t *testing.T) {
+	conf := &NetConf{TailscaleRoutes: defaultTailscaleRoutes}
+	conf.CNIVersion = "1.0.0"
+	if _, err := buildResult(conf, &skel.CmdArgs{IfName: "eth0"}, &pb.AddResponse{TailscaleIpv4: "bogus"}); err == nil {
+		t.Errorf("buildResult() with invalid IP: want error")
+	}
+}
+
+func TestBuildResult_Chained(t *testing.T) {
+	conf := &NetConf{TailscaleRoutes: defaultTailscaleRoutes}
+	conf.CNIVersion = "1.0.0"
+	args := &skel.CmdArgs{ContainerID: "abc", Netns: "/var/run/netns/test", IfName: "eth0"}
+	resp := &pb.AddResponse{
+		TailscaleIpv4:     "100.64.0.5",
+		InterfaceName:     "ts0",
+		HostInterfaceName: "veth1a2b3c4d",
+	}
+
+	result, err := buildResult(conf, args, resp)
+	if err != nil {
+		t.Fatalf("buildResult() error = %v", err)
+	}
+
+	// eth0 belongs to the primary plugin; the result must name ts0
+	if len(result.Interfaces) != 2 {
+		t.Fatalf("interfaces = %+v, want ts0 and its host veth", result.Interfaces)
+	}
+	if pod := result.Interfaces[0]; pod.Name != "ts0" || pod.Sandbox != args.Netns {
+		t.Errorf("interface 0 = %+v, want ts0 in the pod netns", pod)
+	}
+	if host := result.Interfaces[1]; host.Name != "veth1a2b3c4d" || host.Sandbox != "" {
+		t.Errorf("interface 1 = %+v, want the host veth outside the pod", host)
+	}
+	if ip := result.IPs[0]; ip.Interface == nil || *ip.Interface != 0 {
+		t.Errorf("IP not attached to ts0")
+	}
+	// Without an IPv6 address the daemon doesn't install IPv6 routes
+	if len(result.Routes) != 1 || result.Routes[0].Dst.String() != "100.64.0.0/10" {
+		t.Errorf("routes = %v, want only 100.64.0.0/10", result.Routes)
+	}
+}
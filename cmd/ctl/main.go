@@ -0,0 +1,268 @@
+// Command tailscale-cni-ctl talks to a running tailscale-cni daemon over its
+// Unix socket. It is shipped in the daemon image, so it's usually run with
+// kubectl exec into the daemon pod on the node in question.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+)
+
+// command is a tailscale-cni-ctl subcommand.
+type command struct {
+	name  string
+	usage string // arguments, for the usage message
+	help  string
+	nargs int  // -1 for any, left to run to parse
+	watch bool // runs until interrupted, so -timeout doesn't apply
+	run   func(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error
+}
+
+var commands = []command{
+	{
+		name:  "reattach",
+		usage: "<container-id>",
+		help:  "restart a pod's Tailscale node from its saved state, keeping its identity",
+		nargs: 1,
+		run:   runReattach,
+	},
+	{
+		name: "failures",
+		help: "list the daemon's recent auth key creation failures",
+		run:  runFailures,
+	},
+	{
+		name:  "prune",
+		usage: "[-dry-run=false] [-min-offline=1h]",
+		help:  "list the tailnet devices no pod holds any more, offline for at least -min-offline, and with -dry-run=false delete them",
+		nargs: -1,
+		run:   runPrune,
+	},
+	{
+		name: "drain",
+		help: "remove every pod's Tailscale node and tailnet device, for a node being taken out of service; cordon it first",
+		run:  runDrain,
+	},
+	{
+		name:  "watch",
+		usage: "[-namespace=ns]",
+		help:  "print pods' attach, detach, IP change and unhealthy events as they happen, until interrupted",
+		nargs: -1,
+		watch: true,
+		run:   runWatch,
+	},
+}
+
+func main() {
+	socketPath := flag.String("socket", "/var/run/tailscale-cni/daemon.sock", "Path to the daemon's Unix socket")
+	timeout := flag.Duration("timeout", 2*time.Minute, "How long to wait for the daemon")
+	maxMessageSize := flag.Int("max-message-size", 16<<20, "Largest gRPC message to send or accept, in bytes; match the daemon's -grpc-max-message-size")
+	keepaliveTime := flag.Duration("keepalive", 30*time.Second, "Ping the daemon after this long without activity, to notice a dead connection (at least 10s; 0 disables)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := findCommand(flag.Arg(0))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+	args := flag.Args()[1:]
+	if cmd.nargs >= 0 && len(args) != cmd.nargs {
+		fmt.Fprintf(os.Stderr, "usage: tailscale-cni-ctl %s %s\n", cmd.name, cmd.usage)
+		os.Exit(2)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(*maxMessageSize), grpc.MaxCallSendMsgSize(*maxMessageSize)),
+	}
+	if *keepaliveTime > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{Time: *keepaliveTime, PermitWithoutStream: true}))
+	}
+	conn, err := grpc.NewClient("unix://"+*socketPath, opts...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "creating daemon client: %v\n", err)
+		os.Exit(1)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	if cmd.watch {
+		ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	}
+	defer cancel()
+	if err := cmd.run(ctx, pb.NewTailscaleCNIClient(conn), os.Stdout, args); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+		os.Exit(1)
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tailscale-cni-ctl [flags] <command> [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s %s\n    \t%s\n", c.name, c.usage, c.help)
+	}
+	fmt.Fprintf(os.Stderr, "\nflags:\n")
+	flag.PrintDefaults()
+}
+
+func runReattach(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error {
+	resp, err := client.Reattach(ctx, &pb.ReattachRequest{ContainerId: args[0]})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "reattached %s: %s", args[0], resp.TailscaleIpv4)
+	if resp.TailscaleIpv6 != "" {
+		fmt.Fprintf(out, " %s", resp.TailscaleIpv6)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
+
+func runFailures(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error {
+	resp, err := client.GetRecentFailures(ctx, &pb.GetRecentFailuresRequest{})
+	if err != nil {
+		return err
+	}
+	if len(resp.Failures) == 0 {
+		fmt.Fprintln(out, "no recent auth key failures")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tPOD\tREASON\tERROR")
+	for _, f := range resp.Failures {
+		fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%s\n", f.Time, f.PodNamespace, f.PodName, f.Reason, f.Error)
+	}
+	return tw.Flush()
+}
+
+func runPrune(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", true, "only list the devices that would be deleted")
+	minOffline := fs.Duration("min-offline", time.Hour, "how long a device must have been offline to be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+	if *minOffline < time.Second {
+		return fmt.Errorf("-min-offline %s is less than a second", *minOffline)
+	}
+
+	resp, err := client.PruneStaleDevices(ctx, &pb.PruneStaleDevicesRequest{
+		Delete:            !*dryRun,
+		MinOfflineSeconds: int64(*minOffline / time.Second),
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Devices) == 0 {
+		fmt.Fprintln(out, "no stale devices")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tHOSTNAME\tLAST SEEN")
+	for _, d := range resp.Devices {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", d.Id, d.Hostname, d.LastSeen)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if resp.Deleted {
+		fmt.Fprintf(out, "queued %d devices for deletion\n", len(resp.Devices))
+	} else {
+		fmt.Fprintf(out, "%d devices would be deleted; run again with -dry-run=false to delete them\n", len(resp.Devices))
+	}
+	return nil
+}
+
+func runDrain(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error {
+	resp, err := client.DrainNode(ctx, &pb.DrainNodeRequest{})
+	if err != nil {
+		return err
+	}
+	if len(resp.Pods) == 0 {
+		fmt.Fprintln(out, "no pods to drain")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "POD\tCONTAINER\tIP")
+	for _, p := range resp.Pods {
+		fmt.Fprintf(tw, "%s/%s\t%s\t%s\n", p.PodNamespace, p.PodName, p.ContainerId, p.TailscaleIpv4)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "drained %d pods\n", len(resp.Pods))
+	return nil
+}
+
+func runWatch(ctx context.Context, client pb.TailscaleCNIClient, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	namespace := fs.String("namespace", "", "only print events for pods in this namespace")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{PodNamespace: *namespace})
+	if err != nil {
+		return err
+	}
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, formatPodEvent(ev))
+	}
+}
+
+// formatPodEvent returns ev as a line of watch output.
+func formatPodEvent(ev *pb.PodEvent) string {
+	typ := strings.ToLower(strings.TrimPrefix(ev.Type.String(), "POD_EVENT_TYPE_"))
+	line := fmt.Sprintf("%s %s %s/%s %s", ev.Time, typ, ev.PodNamespace, ev.PodName, ev.ContainerId)
+	switch {
+	case ev.PreviousIpv4 != "":
+		line += fmt.Sprintf(" %s -> %s", ev.PreviousIpv4, ev.TailscaleIpv4)
+	case ev.TailscaleIpv4 != "":
+		line += " " + ev.TailscaleIpv4
+	}
+	if ev.Message != "" {
+		line += ": " + ev.Message
+	}
+	return line
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// fakeDaemon reattaches the container "c1" only.
+type fakeDaemon struct {
+	pb.UnimplementedTailscaleCNIServer
+	failures []*pb.AuthKeyFailure
+	prune    *pb.PruneStaleDevicesRequest // the last prune request
+	drained  []*pb.DrainedPod
+	events   []*pb.PodEvent // sent to every watcher, which is then left open
+}
+
+func (d *fakeDaemon) Reattach(ctx context.Context, req *pb.ReattachRequest) (*pb.ReattachResponse, error) {
+	if req.ContainerId != "c1" {
+		return nil, status.Error(codes.NotFound, "no pod for container")
+	}
+	return &pb.ReattachResponse{TailscaleIpv4: "100.64.0.1", TailscaleIpv6: "fd7a:115c:a1e0::1"}, nil
+}
+
+func (d *fakeDaemon) GetRecentFailures(ctx context.Context, req *pb.GetRecentFailuresRequest) (*pb.GetRecentFailuresResponse, error) {
+	return &pb.GetRecentFailuresResponse{Failures: d.failures}, nil
+}
+
+func (d *fakeDaemon) PruneStaleDevices(ctx context.Context, req *pb.PruneStaleDevicesRequest) (*pb.PruneStaleDevicesResponse, error) {
+	d.prune = req
+	return &pb.PruneStaleDevicesResponse{
+		Devices: []*pb.StaleDevice{{Id: "n1", Hostname: "prod-default-web-0", LastSeen: "2025-01-02T03:04:05Z"}},
+		Deleted: req.Delete,
+	}, nil
+}
+
+func (d *fakeDaemon) DrainNode(ctx context.Context, req *pb.DrainNodeRequest) (*pb.DrainNodeResponse, error) {
+	return &pb.DrainNodeResponse{Pods: d.drained}, nil
+}
+
+func (d *fakeDaemon) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.PodEvent]) error {
+	for _, ev := range d.events {
+		if req.PodNamespace != "" && ev.PodNamespace != req.PodNamespace {
+			continue
+		}
+		if err := stream.Send(ev); err != nil {
+			return err
+		}
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+// startFakeDaemon serves d on a Unix socket and returns a client for it.
+func startFakeDaemon(t *testing.T, d *fakeDaemon) pb.TailscaleCNIClient {
+	t.Helper()
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterTailscaleCNIServer(srv, d)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewTailscaleCNIClient(conn)
+}
+
+func TestRunReattach(t *testing.T) {
+	client := startFakeDaemon(t, &fakeDaemon{})
+
+	var out strings.Builder
+	if err := runReattach(context.Background(), client, &out, []string{"c1"}); err != nil {
+		t.Fatalf("runReattach() error = %v", err)
+	}
+	if want := "reattached c1: 100.64.0.1 fd7a:115c:a1e0::1\n"; out.String() != want {
+		t.Errorf("runReattach() output = %q, want %q", out.String(), want)
+	}
+
+	err := runReattach(context.Background(), client, &out, []string{"missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("runReattach() for an unknown container error = %v, want NotFound", err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	d := &fakeDaemon{}
+	client := startFakeDaemon(t, d)
+
+	var out strings.Builder
+	if err := runFailures(context.Background(), client, &out, nil); err != nil {
+		t.Fatalf("runFailures() error = %v", err)
+	}
+	if want := "no recent auth key failures\n"; out.String() != want {
+		t.Errorf("runFailures() with none output = %q, want %q", out.String(), want)
+	}
+
+	d.failures = []*pb.AuthKeyFailure{{
+		Time:         "2025-01-02T03:04:05Z",
+		PodNamespace: "default",
+		PodName:      "web-0",
+		Reason:       "rate_limited",
+		Error:        "auth key request failed with status 429",
+	}}
+	out.Reset()
+	if err := runFailures(context.Background(), client, &out, nil); err != nil {
+		t.Fatalf("runFailures() error = %v", err)
+	}
+	for _, s := range []string{"REASON", "default/web-0", "rate_limited", "status 429"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("runFailures() output = %q, want it to contain %q", out.String(), s)
+		}
+	}
+}
+
+func TestRunPrune(t *testing.T) {
+	d := &fakeDaemon{}
+	client := startFakeDaemon(t, d)
+
+	var out strings.Builder
+	if err := runPrune(context.Background(), client, &out, nil); err != nil {
+		t.Fatalf("runPrune() error = %v", err)
+	}
+	if d.prune.Delete || d.prune.MinOfflineSeconds != 3600 {
+		t.Errorf("runPrune() request = %v, want a dry run for devices offline an hour", d.prune)
+	}
+	for _, s := range []string{"prod-default-web-0", "would be deleted"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("runPrune() output = %q, want it to contain %q", out.String(), s)
+		}
+	}
+
+	out.Reset()
+	if err := runPrune(context.Background(), client, &out, []string{"-dry-run=false", "-min-offline=30m"}); err != nil {
+		t.Fatalf("runPrune() error = %v", err)
+	}
+	if !d.prune.Delete || d.prune.MinOfflineSeconds != 1800 {
+		t.Errorf("runPrune(-dry-run=false -min-offline=30m) request = %v", d.prune)
+	}
+	if !strings.Contains(out.String(), "queued 1 devices for deletion") {
+		t.Errorf("runPrune() output = %q, want it to report the deletion", out.String())
+	}
+
+	if err := runPrune(context.Background(), client, &out, []string{"extra"}); err == nil {
+		t.Errorf("runPrune() with an extra argument succeeded")
+	}
+}
+
+func TestRunDrain(t *testing.T) {
+	d := &fakeDaemon{}
+	client := startFakeDaemon(t, d)
+
+	var out strings.Builder
+	if err := runDrain(context.Background(), client, &out, nil); err != nil {
+		t.Fatalf("runDrain() error = %v", err)
+	}
+	if want := "no pods to drain\n"; out.String() != want {
+		t.Errorf("runDrain() with no pods output = %q, want %q", out.String(), want)
+	}
+
+	d.drained = []*pb.DrainedPod{{ContainerId: "c1", PodNamespace: "default", PodName: "web-0", TailscaleIpv4: "100.64.0.1"}}
+	out.Reset()
+	if err := runDrain(context.Background(), client, &out, nil); err != nil {
+		t.Fatalf("runDrain() error = %v", err)
+	}
+	for _, s := range []string{"default/web-0", "100.64.0.1", "drained 1 pods"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("runDrain() output = %q, want it to contain %q", out.String(), s)
+		}
+	}
+}
+
+func TestRunWatch(t *testing.T) {
+	d := &fakeDaemon{events: []*pb.PodEvent{
+		{Type: pb.PodEventType_POD_EVENT_TYPE_ATTACHED, Time: "2025-01-02T03:04:05Z", ContainerId: "c1", PodNamespace: "default", PodName: "web-0", TailscaleIpv4: "100.64.0.1"},
+		{Type: pb.PodEventType_POD_EVENT_TYPE_IP_CHANGED, Time: "2025-01-02T03:04:06Z", ContainerId: "c1", PodNamespace: "default", PodName: "web-0", TailscaleIpv4: "100.64.0.2", PreviousIpv4: "100.64.0.1"},
+		{Type: pb.PodEventType_POD_EVENT_TYPE_UNHEALTHY, Time: "2025-01-02T03:04:07Z", ContainerId: "c2", PodNamespace: "kube-system", PodName: "dns-0", Message: "backend state is Stopped"},
+	}}
+	client := startFakeDaemon(t, d)
+
+	// watch runs until it's interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	out := &syncBuilder{}
+	done := make(chan error, 1)
+	go func() { done <- runWatch(ctx, client, out, []string{"-namespace=default"}) }()
+	want := "2025-01-02T03:04:05Z attached default/web-0 c1 100.64.0.1\n" +
+		"2025-01-02T03:04:06Z ip_changed default/web-0 c1 100.64.0.1 -> 100.64.0.2\n"
+	for deadline := time.Now().Add(5 * time.Second); out.String() != want && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("runWatch() error = %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("runWatch() output = %q, want %q", out.String(), want)
+	}
+
+	if got, want := formatPodEvent(d.events[2]), "2025-01-02T03:04:07Z unhealthy kube-system/dns-0 c2: backend state is Stopped"; got != want {
+		t.Errorf("formatPodEvent() = %q, want %q", got, want)
+	}
+}
+
+// syncBuilder is a strings.Builder safe to write and read concurrently.
+type syncBuilder struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (s *syncBuilder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuilder) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
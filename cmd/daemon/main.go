@@ -4,32 +4,260 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"log"
+	"math"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime/debug"
 	"strings"
 	"syscall"
+	"text/template"
 	"time"
 
 	"github.com/jakedgy/tailscale-cni/pkg/daemon"
+	"tailscale.com/envknob"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
 )
 
+// deviceDeleteDrainTimeout bounds how long shutdown waits for queued device
+// deletions, keeping within the pod's termination grace period.
+const deviceDeleteDrainTimeout = 10 * time.Second
+
+// validateTimeout bounds the API calls made by -validate.
+const validateTimeout = 30 * time.Second
+
+// derpMapLoadTimeout bounds fetching a -derp-map URL.
+const derpMapLoadTimeout = 30 * time.Second
+
+// lowMemoryGCPercent is the GOGC used by -low-memory: the heap may only grow
+// by half before a collection, rather than double.
+const lowMemoryGCPercent = 50
+
 func main() {
 	// Parse flags
 	socketPath := flag.String("socket", "/var/run/tailscale-cni/daemon.sock", "Path to Unix socket")
+	socketGroup := flag.String("socket-group", "", "Group (name or GID) to own the Unix socket; unchanged if empty")
+	socketModeFlag := flag.String("socket-mode", "0660", "Permissions for the Unix socket, in octal")
+	allowedUIDsFlag := flag.String("allowed-uids", "0", "Comma-separated UIDs allowed to call the daemon; empty allows any caller that can open the socket")
+	grpcTCPAddr := flag.String("grpc-tcp-addr", "", "Also serve the gRPC API on this TCP address (e.g. :9443), secured with mTLS; requires -grpc-tls-cert, -grpc-tls-key and -grpc-tls-ca. Disabled if empty")
+	grpcTLSCert := flag.String("grpc-tls-cert", "", "PEM certificate for the -grpc-tcp-addr listener")
+	grpcTLSKey := flag.String("grpc-tls-key", "", "PEM private key for the -grpc-tcp-addr listener")
+	grpcMaxMessageSize := flag.Int("grpc-max-message-size", 16<<20, "Largest gRPC message the daemon receives or sends, in bytes")
+	grpcKeepalive := flag.Duration("grpc-keepalive", time.Minute, "Ping gRPC clients whose connection has been idle this long, to drop dead connections (at least 10s; 0 leaves gRPC's default of 2h)")
+	grpcTLSCA := flag.String("grpc-tls-ca", "", "PEM CA bundle that -grpc-tcp-addr client certificates must chain to")
+	adminAddr := flag.String("admin-addr", "", "Serve the HTTP admin API on this Unix socket path, checked against -allowed-uids, or TCP address, which requires -admin-token-file; disabled if empty")
+	adminTokenFile := flag.String("admin-token-file", "", "File holding the bearer token admin API requests must carry")
 	stateDir := flag.String("state-dir", "/var/lib/tailscale-cni", "Directory for state storage")
 	clusterName := flag.String("cluster-name", "", "Kubernetes cluster name (used in Tailscale hostnames)")
+	hostnameTemplateFlag := flag.String("hostname-template", "", "Go text/template for pod hostnames, e.g. {{.Namespace}}-{{.PodName}} (fields: Cluster, Namespace, PodName, CleanPodName); default <cluster>-<namespace>-<pod>")
+	hostnameSuffix := flag.String("hostname-suffix", "", "Suffix appended to generated hostnames to keep them unique: \"uid\" for a short hash of the pod UID; none if empty")
 	tagsFlag := flag.String("tags", "", "Comma-separated Tailscale tags for pods (e.g., tag:k8s-pod)")
+	tagMerge := flag.String("tag-merge", daemon.TagMergeReplace, "What a pod's tailscale.com/tags annotation does to the tags it would otherwise get: \"replace\" them or \"append\" to them")
+	oauthCredsFile := flag.String("oauth-creds-file", "", "File holding the OAuth client secret, instead of TS_OAUTH_CLIENT_SECRET; reread every 10s so the secret can be rotated without a restart (default $TS_OAUTH_CLIENT_SECRET_FILE)")
+	oauthSecretName := flag.String("oauth-secret-name", "", "Kubernetes Secret holding the OAuth client secret, fetched with the daemon's service account instead of TS_OAUTH_CLIENT_SECRET and refetched every minute so the secret can be rotated")
+	oauthSecretNamespace := flag.String("oauth-secret-namespace", "", "Namespace of -oauth-secret-name (default the daemon's own)")
+	oauthSecretKey := flag.String("oauth-secret-key", "client-secret", "Key of -oauth-secret-name holding the client secret")
+	authKeyFlag := flag.String("auth-key", "", "Reusable auth key (tskey-auth-...) for every pod's node to log in with, instead of an OAuth client; the key decides the nodes' tags, and without API access devices aren't deleted and keys aren't renewed (default $TS_AUTHKEY)")
+	apiBaseURLFlag := flag.String("api-base-url", "", "Base URL of the Tailscale API, e.g. a proxy in front of it; must be https (default $TS_API_BASE_URL, or "+daemon.DefaultAPIBaseURL+")")
 	authKeyTTL := flag.Duration("auth-key-ttl", 5*time.Minute, "TTL for auth keys (default 5m)")
+	authKeyConcurrency := flag.Int("auth-key-concurrency", 5, "Number of auth key requests made to the Tailscale API at once")
+	authKeyMinInterval := flag.Duration("auth-key-min-interval", 100*time.Millisecond, "Minimum time between the starts of auth key requests")
+	authKeyJitter := flag.Duration("auth-key-jitter", 0, "Random extra time, up to this much, added to each gap between auth key requests, so that daemons on many nodes don't request in lockstep")
+	stateBackend := flag.String("state-backend", daemon.StateBackendFile, "Where to store pod Tailscale state: file or k8s-secret")
+	stateBackup := flag.String("state-backup", daemon.StateBackupNone, "Back up each new pod's file-backed state: \"secret\" copies it to a Secret in the pod's namespace, restored on startup if the state file is missing; none if empty")
+	encryptState := flag.Bool("encrypt-state", false, "Encrypt pods' Tailscale state at rest with AES-256-GCM, using the keys in -state-key-file")
+	stateKeyFile := flag.String("state-key-file", "", "File holding state encryption keys for -encrypt-state, one base64-encoded 32-byte key per line, the current one first; state under older keys is re-encrypted as pods are recovered")
+	recoveryConcurrency := flag.Int("recovery-concurrency", 8, "Number of pods to recover in parallel on startup")
+	maxPods := flag.Int("max-pods", 0, "Maximum number of pods given a Tailscale node; further CNI ADDs fail (0 for no limit)")
+	warmPoolSize := flag.Int("warm-pool-size", 0, "Number of ephemeral Tailscale nodes kept logged in ahead of pods, so an ADD only has to connect one; pods with their own tags, key profile or routing mode still get a new node (0 disables)")
+	lowMemory := flag.Bool("low-memory", false, "Trade some CPU and first-packet latency for lower memory use (see README)")
+	maxConcurrentAttach := flag.Int("max-concurrent-attach", 16, "Number of pods brought up in parallel; further CNI ADDs queue")
+	wireguardPort := flag.Uint("wireguard-port", 0, "First UDP port for pods' WireGuard; each pod takes the lowest free port from here up (0 for random ports)")
+	loginAttempts := flag.Int("login-attempts", 3, "Times a pod's node tries to log in to control, with backoff in between, before its attach or recovery fails")
+	manageIPForward := flag.Bool("manage-ip-forward", true, "Enable IPv4 forwarding on each pod's veth and TUN (falls back to the global sysctl, restored when the last pod goes away)")
+	manageProxyARP := flag.Bool("manage-proxy-arp", true, "Enable proxy ARP on each pod's host veth")
+	routingMode := flag.String("routing-mode", daemon.RoutingModeKernel, "Default routing mode for pods whose CNI config doesn't set routingMode: \"kernel\" (per-interface forwarding and proxy ARP sysctls) or \"netstack\" (no sysctl writes)")
+	keyRenewBefore := flag.Duration("key-expiry-renew-before", 24*time.Hour, "Disable key expiry, through the API, for pods' nodes whose key expires within this, so they don't drop off the tailnet (0 disables)")
+	stateDirTTL := flag.Duration("state-dir-ttl", 24*time.Hour, "Remove a pod's state directory once no node uses it, its netns is gone and it has gone unmodified this long, checked every 30m (0 disables)")
+	delDrain := flag.Duration("del-drain", 0, "On CNI DEL, leave a pod's node up this long for connections in flight to finish before taking it offline, within the DEL's 30s timeout (0 shuts it down at once)")
+	handshakeStaleAfter := flag.Duration("handshake-stale-after", 0, "Reattach a pod's node, and fail CNI CHECK for it, once it has gone this long without a WireGuard handshake with any peer it's talking to (at least 3m; 0 disables)")
+	tunInPod := flag.Bool("tun-in-pod", false, "Move each new pod's TUN into its netns as its Tailscale interface instead of bridging to it with a veth; needs no forwarding or proxy ARP sysctls, and -routing-mode doesn't apply")
+	nsConfigName := flag.String("namespace-config", "", "Name of a ConfigMap with per-namespace defaults (tags, hostname template, enabled); disabled if empty")
+	nsConfigNamespace := flag.String("namespace-config-namespace", "kube-system", "Namespace of the -namespace-config ConfigMap")
+	annotateAssignedIP := flag.Bool("annotate-assigned-ip", false, "Write each pod's Tailscale IPs and hostname onto the Pod as tailscale.com/assigned-* annotations")
+	emitEvents := flag.Bool("emit-events", false, "Record Kubernetes Events on pods when they attach to the tailnet or fail to, and when a restart changes their Tailscale IP")
+	derpMapSource := flag.String("derp-map", "", "JSON DERP map file or http(s) URL that replaces the control plane's DERP map for every pod, e.g. for private relays")
+	keyProfilesFile := flag.String("key-profiles", "", "JSON file of named auth key profiles (ephemeral, preauthorized, tags, expiry) that pods select with the tailscale.com/key-profile annotation")
+	tailnetLockKeyFile := flag.String("tailnet-lock-key-file", "", "File holding a tailnet lock private key (nlpriv:...) used to sign each pod's node key; its public key (tlpub:...) must be trusted by the tailnet lock")
+	generateTailnetLockKey := flag.Bool("generate-tailnet-lock-key", false, "Print a new tailnet lock key pair for -tailnet-lock-key-file and exit")
+	preserveOnShutdown := flag.Bool("preserve-on-shutdown", false, "On SIGTERM, leave pods' TUN devices, veths and routes in place for the next daemon to reattach to, instead of shutting their nodes down")
+	forceDERP := flag.Bool("force-derp", false, "Relay all pod traffic through DERP instead of direct UDP, for nodes where UDP is blocked (applies to every pod on the node)")
+	validate := flag.Bool("validate", false, "Check the OAuth credentials and tags against the Tailscale API, then exit 0 on success or 1 on failure")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on (e.g. :9090); disabled if empty")
+	tsLogLevel := flag.String("ts-log-level", daemon.NodeLogLevelDebug, "Log lines forwarded from pods' Tailscale nodes: debug for all, info to drop verbose and DERP connection chatter")
+	quietNodes := flag.Bool("quiet-nodes", false, "Drop log lines from pods' Tailscale nodes other than errors; the daemon's own logs are unaffected")
+	pprofAddr := flag.String("pprof-addr", "", "Loopback address to serve net/http/pprof on (e.g. :6060, bound to 127.0.0.1); disabled if empty")
+	metricsPerPod := flag.Bool("metrics-per-pod", false, "Export each pod's WireGuard traffic as tscni_pod_* metrics labeled with pod and namespace (one series per pod per metric)")
 	flag.Parse()
 
-	// Get OAuth credentials from environment
+	if *generateTailnetLockKey {
+		k := key.NewNLPrivate()
+		priv, err := k.MarshalText()
+		if err != nil {
+			log.Fatalf("Failed to encode tailnet lock key: %v", err)
+		}
+		fmt.Printf("private: %s\npublic:  %s\n", priv, k.Public().CLIString())
+		return
+	}
+
+	if err := daemon.ValidateStateBackend(*stateBackend); err != nil {
+		log.Fatalf("Invalid -state-backend: %v", err)
+	}
+	if err := daemon.ValidateStateBackup(*stateBackup); err != nil {
+		log.Fatalf("Invalid -state-backup: %v", err)
+	}
+	if *stateBackup != daemon.StateBackupNone && *stateBackend != daemon.StateBackendFile {
+		log.Fatalf("-state-backup=%s only applies to -state-backend=%s", *stateBackup, daemon.StateBackendFile)
+	}
+	if err := daemon.ValidateHostnameSuffix(*hostnameSuffix); err != nil {
+		log.Fatalf("Invalid -hostname-suffix: %v", err)
+	}
+	if err := daemon.ValidateTagMerge(*tagMerge); err != nil {
+		log.Fatalf("Invalid -tag-merge: %v", err)
+	}
+	if err := daemon.ValidateRoutingMode(*routingMode); err != nil {
+		log.Fatalf("Invalid -routing-mode: %v", err)
+	}
+	if *wireguardPort > math.MaxUint16 {
+		log.Fatalf("Invalid -wireguard-port: %d is not a UDP port", *wireguardPort)
+	}
+	if err := daemon.ValidateNodeLogLevel(*tsLogLevel); err != nil {
+		log.Fatalf("Invalid -ts-log-level: %v", err)
+	}
+	socketMode, err := daemon.ParseSocketMode(*socketModeFlag)
+	if err != nil {
+		log.Fatalf("Invalid -socket-mode: %v", err)
+	}
+	socketGID, err := daemon.LookupSocketGroup(*socketGroup)
+	if err != nil {
+		log.Fatalf("Invalid -socket-group: %v", err)
+	}
+	allowedUIDs, err := daemon.ParseAllowedUIDs(*allowedUIDsFlag)
+	if err != nil {
+		log.Fatalf("Invalid -allowed-uids: %v", err)
+	}
+	if *pprofAddr != "" {
+		*pprofAddr, err = daemon.PprofListenAddr(*pprofAddr)
+		if err != nil {
+			log.Fatalf("Invalid -pprof-addr: %v", err)
+		}
+	}
+	var stateKeys daemon.StateKeys
+	if *encryptState {
+		if *stateKeyFile == "" {
+			log.Fatalf("-encrypt-state requires -state-key-file")
+		}
+		stateKeys, err = daemon.LoadStateKeys(*stateKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid -state-key-file: %v", err)
+		}
+	}
+	if *grpcMaxMessageSize <= 0 {
+		log.Fatalf("Invalid -grpc-max-message-size: %d is not positive", *grpcMaxMessageSize)
+	}
+	if *grpcKeepalive < 0 || (*grpcKeepalive > 0 && *grpcKeepalive < 10*time.Second) {
+		log.Fatalf("Invalid -grpc-keepalive: %s is shorter than 10s", *grpcKeepalive)
+	}
+	var grpcTLSConfig *tls.Config
+	if *grpcTCPAddr != "" {
+		if *grpcTLSCert == "" || *grpcTLSKey == "" || *grpcTLSCA == "" {
+			log.Fatalf("-grpc-tcp-addr requires -grpc-tls-cert, -grpc-tls-key and -grpc-tls-ca")
+		}
+		grpcTLSConfig, err = daemon.LoadServerTLS(*grpcTLSCert, *grpcTLSKey, *grpcTLSCA)
+		if err != nil {
+			log.Fatalf("Invalid gRPC TLS config: %v", err)
+		}
+	}
+	var adminToken string
+	if *adminTokenFile != "" {
+		data, err := os.ReadFile(*adminTokenFile)
+		if err != nil {
+			log.Fatalf("Invalid -admin-token-file: %v", err)
+		}
+		if adminToken = strings.TrimSpace(string(data)); adminToken == "" {
+			log.Fatalf("Invalid -admin-token-file: %s is empty", *adminTokenFile)
+		}
+	}
+	if *adminAddr != "" && !filepath.IsAbs(*adminAddr) && adminToken == "" {
+		log.Fatalf("-admin-addr on a TCP address requires -admin-token-file")
+	}
+	var hostnameTemplate *template.Template
+	if *hostnameTemplateFlag != "" {
+		hostnameTemplate, err = daemon.ParseHostnameTemplate(*hostnameTemplateFlag)
+		if err != nil {
+			log.Fatalf("Invalid -hostname-template: %v", err)
+		}
+	}
+
+	// A static auth key stands in for the OAuth client
+	authKey := *authKeyFlag
+	if authKey == "" {
+		authKey = os.Getenv("TS_AUTHKEY")
+	}
+
+	// Get OAuth credentials from environment, or the secret from a file
 	clientID := os.Getenv("TS_OAUTH_CLIENT_ID")
 	clientSecret := os.Getenv("TS_OAUTH_CLIENT_SECRET")
+	secretFile := *oauthCredsFile
+	if secretFile == "" {
+		secretFile = os.Getenv("TS_OAUTH_CLIENT_SECRET_FILE")
+	}
+	if secretFile != "" {
+		clientSecret, err = daemon.ReadClientSecretFile(secretFile)
+		if err != nil {
+			log.Fatalf("Invalid -oauth-creds-file: %v", err)
+		}
+	}
+	// Or fetch it from a Secret, keeping it out of the environment
+	var secretRef daemon.ClientSecretRef
+	var secretKube *daemon.KubeClient
+	if *oauthSecretName != "" {
+		if secretFile != "" {
+			log.Fatalf("-oauth-secret-name and -oauth-creds-file are mutually exclusive")
+		}
+		secretKube, err = daemon.NewInClusterKubeClient()
+		if err != nil {
+			log.Fatalf("-oauth-secret-name requires in-cluster Kubernetes access: %v", err)
+		}
+		secretRef = daemon.ClientSecretRef{Namespace: *oauthSecretNamespace, Name: *oauthSecretName, Key: *oauthSecretKey}
+		if secretRef.Namespace == "" {
+			if secretRef.Namespace, err = daemon.InClusterNamespace(); err != nil {
+				log.Fatalf("Invalid -oauth-secret-namespace: %v", err)
+			}
+		}
+		clientSecret, err = daemon.ReadClientSecretRef(context.Background(), secretKube, secretRef)
+		if err != nil {
+			log.Fatalf("Invalid -oauth-secret-name: %v", err)
+		}
+	}
+
+	switch {
+	case authKey != "" && (clientID != "" || clientSecret != ""):
+		log.Fatal("-auth-key (TS_AUTHKEY) and OAuth credentials are mutually exclusive")
+	case authKey == "" && (clientID == "" || clientSecret == ""):
+		log.Fatal("TS_OAUTH_CLIENT_ID and TS_OAUTH_CLIENT_SECRET (or -oauth-creds-file or -oauth-secret-name), or -auth-key, are required")
+	}
 
-	if clientID == "" || clientSecret == "" {
-		log.Fatal("TS_OAUTH_CLIENT_ID and TS_OAUTH_CLIENT_SECRET environment variables are required")
+	// Use the API base URL from flag or environment
+	apiBaseURL := *apiBaseURLFlag
+	if apiBaseURL == "" {
+		apiBaseURL = os.Getenv("TS_API_BASE_URL")
 	}
 
 	// Use cluster name from flag or environment
@@ -60,37 +288,353 @@ func main() {
 	}
 
 	log.Printf("Starting tailscale-cni daemon")
-	log.Printf("  Socket: %s", *socketPath)
+	log.Printf("  Socket: %s (mode %04o)", *socketPath, socketMode)
+	if socketGID > 0 {
+		log.Printf("  Socket group: %d", socketGID)
+	}
+	if len(allowedUIDs) > 0 {
+		log.Printf("  Allowed UIDs: %v", allowedUIDs)
+	} else {
+		log.Printf("  Allowed UIDs: any (peer credential check disabled)")
+	}
+	log.Printf("  gRPC max message size: %d bytes", *grpcMaxMessageSize)
+	if *grpcTCPAddr != "" {
+		log.Printf("  gRPC TCP address: %s (mTLS)", *grpcTCPAddr)
+	}
+	if *adminAddr != "" {
+		log.Printf("  Admin API: %s (token required: %v)", *adminAddr, adminToken != "")
+	}
 	log.Printf("  State dir: %s", *stateDir)
 	log.Printf("  Cluster name: %s", cluster)
-	log.Printf("  Tags: %v", tags)
-	log.Printf("  Auth key TTL: [configured]")
+	if hostnameTemplate != nil {
+		log.Printf("  Hostname template: %s", *hostnameTemplateFlag)
+	}
+	if *hostnameSuffix != "" {
+		log.Printf("  Hostname suffix: %s", *hostnameSuffix)
+	}
+	if *tagMerge != daemon.TagMergeReplace {
+		log.Printf("  Tag merge: %s", *tagMerge)
+	}
+	if authKey != "" {
+		if tagsStr != "" {
+			log.Printf("Warning: ignoring tags %v: the auth key decides the nodes' tags", tags)
+		}
+		log.Printf("  Auth key: static, without Tailscale API access")
+	} else {
+		log.Printf("  Tags: %v", tags)
+		if secretKube != nil {
+			log.Printf("  OAuth client secret: %s", secretRef)
+		}
+		log.Printf("  Auth key TTL: [configured]")
+		log.Printf("  Auth key requests: %d at once, %s apart (+ up to %s jitter)", *authKeyConcurrency, *authKeyMinInterval, *authKeyJitter)
+	}
+	log.Printf("  State backend: %s", *stateBackend)
+	if *stateBackup != daemon.StateBackupNone {
+		log.Printf("  State backup: %s", *stateBackup)
+	}
+	if stateKeys != nil {
+		log.Printf("  State encryption: key %s (%d keys)", stateKeys.ID(), len(stateKeys))
+	}
+	if *tunInPod {
+		log.Printf("  Pod interface: TUN in pod")
+	} else {
+		log.Printf("  Routing mode: %s", *routingMode)
+	}
+	log.Printf("  Recovery concurrency: %d", *recoveryConcurrency)
+	log.Printf("  Max concurrent attach: %d", *maxConcurrentAttach)
+	log.Printf("  Login attempts: %d", *loginAttempts)
+	if *handshakeStaleAfter > 0 {
+		log.Printf("  Reattach after stale handshakes: %s", *handshakeStaleAfter)
+	}
+	if *keyRenewBefore > 0 {
+		log.Printf("  Disable key expiry within: %s", *keyRenewBefore)
+	}
+	if *delDrain > 0 {
+		log.Printf("  DEL drain: %s", *delDrain)
+	}
+	if *stateDirTTL > 0 {
+		log.Printf("  State dir TTL: %s", *stateDirTTL)
+	}
+	if *wireguardPort != 0 {
+		log.Printf("  WireGuard ports: %d and up", *wireguardPort)
+	}
+	if *quietNodes {
+		log.Printf("  Node logs: errors only")
+	} else {
+		log.Printf("  Node logs: %s", *tsLogLevel)
+	}
+	if *maxPods > 0 {
+		log.Printf("  Max pods: %d", *maxPods)
+	}
+	if *warmPoolSize > 0 {
+		log.Printf("  Warm pool: %d nodes", *warmPoolSize)
+	}
+	if *nsConfigName != "" {
+		log.Printf("  Namespace config: %s/%s", *nsConfigNamespace, *nsConfigName)
+	}
+	if *metricsAddr != "" {
+		log.Printf("  Metrics: %s", *metricsAddr)
+	}
+	if *pprofAddr != "" {
+		log.Printf("  pprof: %s", *pprofAddr)
+	}
+	if apiBaseURL != "" {
+		log.Printf("  Tailscale API: %s", apiBaseURL)
+	}
+
+	// A bad DERP map fails startup (and -validate) rather than the first pod
+	var derpMap *tailcfg.DERPMap
+	if *derpMapSource != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), derpMapLoadTimeout)
+		derpMap, err = daemon.LoadDERPMap(ctx, *derpMapSource)
+		cancel()
+		if err != nil {
+			log.Fatalf("Invalid -derp-map: %v", err)
+		}
+		log.Printf("  DERP map: %s (%d regions)", *derpMapSource, len(derpMap.Regions))
+	}
+
+	var keyProfiles map[string]*daemon.KeyProfile
+	if *keyProfilesFile != "" {
+		keyProfiles, err = daemon.LoadKeyProfiles(*keyProfilesFile)
+		if err != nil {
+			log.Fatalf("Invalid -key-profiles: %v", err)
+		}
+		log.Printf("  Key profiles: %s (%d)", *keyProfilesFile, len(keyProfiles))
+	}
+
+	var tailnetLockKey key.NLPrivate
+	if *tailnetLockKeyFile != "" {
+		tailnetLockKey, err = daemon.LoadTailnetLockKey(*tailnetLockKeyFile)
+		if err != nil {
+			log.Fatalf("Invalid -tailnet-lock-key-file: %v", err)
+		}
+		log.Printf("  Tailnet lock signing key: %s", tailnetLockKey.Public().CLIString())
+	}
+
+	// Initialize the auth key provider: the OAuth manager, or the static key
+	var authKeys daemon.AuthKeyProvider
+	var oauthMgr *daemon.OAuthManager
+	if authKey != "" {
+		staticKey, err := daemon.NewStaticAuthKey(authKey)
+		if err != nil {
+			log.Fatalf("Invalid -auth-key: %v", err)
+		}
+		authKeys = staticKey
+	} else {
+		oauthMgr = daemon.NewOAuthManager(clientID, clientSecret, tags, *authKeyTTL)
+		if err := oauthMgr.SetAuthKeyRateLimit(*authKeyConcurrency, *authKeyMinInterval, *authKeyJitter); err != nil {
+			log.Fatalf("Invalid auth key rate limit: %v", err)
+		}
+		if apiBaseURL != "" {
+			if err := oauthMgr.SetAPIBaseURL(apiBaseURL); err != nil {
+				log.Fatalf("Invalid -api-base-url: %v", err)
+			}
+		}
+		authKeys = oauthMgr
+	}
+
+	// In validate mode, check the credentials and tags and stop there
+	if *validate {
+		if oauthMgr == nil {
+			log.Fatal("-validate checks OAuth credentials, and -auth-key has none")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), validateTimeout)
+		err := oauthMgr.Validate(ctx)
+		cancel()
+		if err != nil {
+			log.Fatalf("Validation failed: %v", err)
+		}
+		log.Printf("Validation succeeded: OAuth credentials work and tags %v are permitted", tags)
+		return
+	}
+
+	if secretFile != "" {
+		go oauthMgr.WatchClientSecretFile(context.Background(), secretFile)
+	}
+	if secretKube != nil {
+		go oauthMgr.WatchClientSecretRef(context.Background(), secretKube, secretRef)
+	}
+
+	// Tailscale only exposes this as a process-wide knob, so it must be set
+	// before the first pod's engine is created
+	if *forceDERP {
+		log.Printf("Forcing all pod traffic through DERP")
+		envknob.Setenv("TS_DEBUG_ALWAYS_USE_DERP", "true")
+	}
+
+	if *lowMemory {
+		log.Printf("Low-memory mode: lazy WireGuard peer config, GOGC=%d", lowMemoryGCPercent)
+		// Only configure WireGuard peers that are in use, even if the
+		// control plane asks for the full config
+		envknob.Setenv("TS_DEBUG_TRIM_WIREGUARD", "true")
+		debug.SetGCPercent(lowMemoryGCPercent)
+	}
 
 	// Create state directory
 	if err := os.MkdirAll(*stateDir, 0700); err != nil {
 		log.Fatalf("Failed to create state directory: %v", err)
 	}
 
-	// Initialize OAuth manager
-	oauthMgr := daemon.NewOAuthManager(clientID, clientSecret, tags, *authKeyTTL)
+	// Kubernetes client, for pod annotations and Secret-backed state
+	kubeClient, err := daemon.NewInClusterKubeClient()
+	if err != nil {
+		if *stateBackend == daemon.StateBackendKubeSecret {
+			log.Fatalf("State backend %s requires in-cluster Kubernetes access: %v", *stateBackend, err)
+		}
+		if *stateBackup != daemon.StateBackupNone {
+			log.Fatalf("State backup %s requires in-cluster Kubernetes access: %v", *stateBackup, err)
+		}
+		log.Printf("Kubernetes API unavailable, pod annotations will be ignored: %v", err)
+		kubeClient = nil
+	}
+
+	// Per-namespace defaults, reloaded in the background as the ConfigMap changes
+	var nsConfig *daemon.NamespaceConfig
+	if *nsConfigName != "" {
+		if kubeClient == nil {
+			log.Fatalf("-namespace-config requires in-cluster Kubernetes access")
+		}
+		nsConfig = daemon.NewNamespaceConfig(kubeClient, *nsConfigNamespace, *nsConfigName)
+		if err := nsConfig.Load(context.Background()); err != nil {
+			log.Printf("Warning: namespace defaults not loaded, will retry: %v", err)
+		}
+		go nsConfig.Run(context.Background())
+	}
+
+	// Pod events, if enabled and the Kubernetes API is reachable
+	var events *daemon.EventRecorder
+	if *emitEvents {
+		if kubeClient == nil {
+			log.Printf("Kubernetes API unavailable, pod events will only be logged")
+		} else {
+			nodeName := os.Getenv("NODE_NAME")
+			if nodeName == "" {
+				nodeName, _ = os.Hostname()
+			}
+			events = daemon.NewEventRecorder(kubeClient, nodeName)
+		}
+	}
 
 	// Initialize pod manager
-	podMgr := daemon.NewPodManager(*stateDir, cluster, oauthMgr)
+	podMgr, err := daemon.NewPodManager(daemon.PodManagerConfig{
+		StateDir:            *stateDir,
+		ClusterName:         cluster,
+		HostnameTemplate:    hostnameTemplate,
+		HostnameSuffix:      *hostnameSuffix,
+		TagMerge:            *tagMerge,
+		StateBackend:        *stateBackend,
+		StateBackup:         *stateBackup,
+		StateKeys:           stateKeys,
+		Kube:                kubeClient,
+		RecoveryConcurrency: *recoveryConcurrency,
+		MaxConcurrentAttach: *maxConcurrentAttach,
+		LoginAttempts:       *loginAttempts,
+		WireGuardPort:       uint16(*wireguardPort),
+		NodeLogLevel:        *tsLogLevel,
+		QuietNodes:          *quietNodes,
+		MaxPods:             *maxPods,
+		WarmPoolSize:        *warmPoolSize,
+		ManageIPForward:     *manageIPForward,
+		ManageProxyARP:      *manageProxyARP,
+		RoutingMode:         *routingMode,
+		TUNInPod:            *tunInPod,
+		HandshakeStaleAfter: *handshakeStaleAfter,
+		KeyRenewBefore:      *keyRenewBefore,
+		DelDrain:            *delDrain,
+		StateDirTTL:         *stateDirTTL,
+		DERPMap:             derpMap,
+		KeyProfiles:         keyProfiles,
+		Events:              events,
+		TailnetLockKey:      tailnetLockKey,
+		NamespaceConfig:     nsConfig,
+		// Must match where the CNI plugin writes tombstones: next to the socket
+		TombstoneDir: filepath.Join(filepath.Dir(*socketPath), "tombstones"),
+	}, authKeys)
+	if err != nil {
+		log.Fatalf("Failed to create pod manager: %v", err)
+	}
 
-	// Recover pods from previous daemon session
+	// Recover pods from previous daemon session. A signal cuts recovery
+	// short, leaving the pods not yet recovered for the next start.
 	log.Printf("Recovering pods from previous session...")
-	ctx := context.Background()
-	recovered, errs := podMgr.RecoverPods(ctx)
-	log.Printf("Recovered %d pods", recovered)
+	recoverCtx, stopRecover := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	recovered, cleanedUp, errs := podMgr.RecoverPods(recoverCtx)
+	stopRecover()
+	log.Printf("Recovered %d pods, cleaned up %d that no longer exist", recovered, cleanedUp)
 	for _, err := range errs {
 		log.Printf("Recovery error: %v", err)
 	}
+	if recoverCtx.Err() != nil {
+		log.Printf("Shutting down during recovery...")
+		shutdownPods(podMgr, oauthMgr, *preserveOnShutdown)
+		log.Printf("Shutdown complete")
+		return
+	}
+	ctx := context.Background()
 
 	// Clean up any orphaned network resources
 	podMgr.CleanupOrphanedResources()
 
+	// Reattach nodes whose WireGuard sessions flatline, if enabled
+	go podMgr.RunHandshakeWatch(ctx)
+	go podMgr.RunKeyExpiryWatch(ctx)
+	go podMgr.RunStateSweep(ctx)
+
+	// Fill the warm pool, if enabled
+	go podMgr.RunWarmPool(ctx)
+
+	// Assigned-IP annotations, if enabled and the Kubernetes API is reachable
+	var annotator *daemon.PodAnnotator
+	if *annotateAssignedIP {
+		if kubeClient == nil {
+			log.Printf("Kubernetes API unavailable, assigned IPs will not be annotated")
+		} else {
+			annotator = daemon.NewPodAnnotator(kubeClient)
+		}
+	}
+
+	// Serve metrics, if enabled
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", daemon.MetricsHandler())
+		mux.Handle("/readyz", daemon.ReadyzHandler(podMgr))
+		mux.Handle("/recovery", daemon.RecoveryReportHandler(podMgr))
+		go podMgr.RunPathMetrics(context.Background())
+		if *metricsPerPod {
+			go podMgr.RunTrafficMetrics(context.Background())
+		}
+		go func() {
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				log.Printf("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
+	// Serve pprof, if enabled
+	if *pprofAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*pprofAddr, daemon.PprofHandler()); err != nil {
+				log.Printf("pprof server stopped: %v", err)
+			}
+		}()
+	}
+
 	// Initialize and start gRPC server
-	server := daemon.NewServer(*socketPath, podMgr)
+	server := daemon.NewServer(daemon.ServerConfig{
+		SocketPath:     *socketPath,
+		SocketMode:     socketMode,
+		SocketGID:      socketGID,
+		AllowedUIDs:    allowedUIDs,
+		TCPAddr:        *grpcTCPAddr,
+		TLSConfig:      grpcTLSConfig,
+		Events:         events,
+		Annotator:      annotator,
+		MaxMessageSize: *grpcMaxMessageSize,
+		Keepalive:      *grpcKeepalive,
+		AdminAddr:      *adminAddr,
+		AdminToken:     adminToken,
+	}, podMgr)
 	if err := server.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
@@ -106,9 +650,28 @@ func main() {
 
 	// Graceful shutdown
 	server.Stop()
-	if err := podMgr.Close(); err != nil {
+	shutdownPods(podMgr, oauthMgr, *preserveOnShutdown)
+
+	log.Printf("Shutdown complete")
+}
+
+// shutdownPods stops the pods' nodes, or preserves them for the next start,
+// and flushes the device deletions still queued, if there's an OAuth
+// manager to have queued any.
+func shutdownPods(podMgr *daemon.PodManager, oauthMgr *daemon.OAuthManager, preserve bool) {
+	if preserve {
+		podMgr.Preserve()
+	} else if err := podMgr.Close(); err != nil {
 		log.Printf("Error closing pod manager: %v", err)
 	}
+	if oauthMgr == nil {
+		return
+	}
 
-	log.Printf("Shutdown complete")
+	// Let deletions queued by recent DELs reach the API before exiting
+	drainCtx, cancel := context.WithTimeout(context.Background(), deviceDeleteDrainTimeout)
+	if err := oauthMgr.FlushDeviceDeletions(drainCtx); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	cancel()
 }
@@ -0,0 +1,244 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc/codes"
+)
+
+// adminPod is a pod as the admin API lists it.
+type adminPod struct {
+	ContainerID   string    `json:"containerId"`
+	Namespace     string    `json:"namespace"`
+	PodName       string    `json:"podName"`
+	Hostname      string    `json:"hostname"`
+	DNSName       string    `json:"dnsName,omitempty"`
+	TailscaleIPv4 string    `json:"tailscaleIpv4"`
+	TailscaleIPv6 string    `json:"tailscaleIpv6,omitempty"`
+	DeviceID      string    `json:"deviceId,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// adminPodStatus is a pod's health, as CNI CHECK reports it.
+type adminPodStatus struct {
+	Healthy             bool       `json:"healthy"`
+	Message             string     `json:"message"`
+	DERPRegion          int        `json:"derpRegion,omitempty"`
+	HandshakeAgeSeconds int64      `json:"handshakeAgeSeconds,omitempty"`
+	KeyExpiry           *time.Time `json:"keyExpiry,omitempty"`
+}
+
+func newAdminPod(m *ManagedServer) adminPod {
+	p := adminPod{
+		ContainerID:   m.ContainerID,
+		Namespace:     m.Namespace,
+		PodName:       m.PodName,
+		Hostname:      m.TailnetHostname(),
+		DNSName:       m.MagicDNSName(),
+		TailscaleIPv4: m.TailscaleIPv4.String(),
+		DeviceID:      m.DeviceID,
+		CreatedAt:     m.CreatedAt,
+	}
+	if m.TailscaleIPv6.IsValid() {
+		p.TailscaleIPv6 = m.TailscaleIPv6.String()
+	}
+	return p
+}
+
+// adminHandler serves the admin API, a JSON mirror of the pod management
+// RPCs for scripts and dashboards:
+//
+//	GET    /pods                list running pods
+//	GET    /pods/{id}/status    a pod's health, as CNI CHECK reports it
+//	POST   /pods/{id}/reattach  restart a pod's node, like Reattach
+//	DELETE /pods/{id}           remove a pod's node, like CNI DEL
+//
+// {id} is a container ID. If token is set, every request must carry it as
+// a bearer token.
+func (s *Server) adminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pods", func(w http.ResponseWriter, r *http.Request) {
+		pods := []adminPod{}
+		for _, m := range s.podMgr.ListPods() {
+			pods = append(pods, newAdminPod(m))
+		}
+		writeJSON(w, http.StatusOK, pods)
+	})
+	mux.HandleFunc("GET /pods/{id}/status", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		m, ok := s.podMgr.GetPod(id)
+		if !ok {
+			http.Error(w, fmt.Sprintf("%v %s", errPodNotFound, id), http.StatusNotFound)
+			return
+		}
+		healthy, message, err := s.podMgr.CheckPod(id)
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		st := adminPodStatus{Healthy: healthy, Message: message, DERPRegion: m.HomeDERP()}
+		if age, ok := m.HandshakeAge(); ok {
+			st.HandshakeAgeSeconds = int64(age / time.Second)
+		}
+		if expiry, ok := m.KeyExpiry(); ok {
+			st.KeyExpiry = &expiry
+		}
+		writeJSON(w, http.StatusOK, st)
+	})
+	mux.HandleFunc("POST /pods/{id}/reattach", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		log.Printf("Admin reattach: container=%s", id)
+		m, err := s.reattachPod(r.Context(), id)
+		if err != nil {
+			log.Printf("Admin reattach failed: %v", err)
+			writeAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newAdminPod(m))
+	})
+	mux.HandleFunc("DELETE /pods/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		log.Printf("Admin delete: container=%s", id)
+		if err := s.deletePod(r.Context(), id); err != nil {
+			log.Printf("Admin delete failed: %v", err)
+			writeAdminError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	if token == "" {
+		return mux
+	}
+	return requireBearerToken(token, mux)
+}
+
+// requireBearerToken rejects requests that don't carry token in their
+// Authorization header.
+func requireBearerToken(token string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// ucredKey is the context key under which the admin server keeps the
+// credentials of a Unix socket connection's peer.
+type ucredKey struct{}
+
+// requireUIDs rejects requests over a Unix socket from processes whose UID
+// is not in allowed, as uidAllowlistInterceptor does for gRPC calls.
+func requireUIDs(allowed []uint32, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cred, _ := r.Context().Value(ucredKey{}).(*unix.Ucred)
+		if cred == nil {
+			http.Error(w, "peer credentials unavailable", http.StatusUnauthorized)
+			return
+		}
+		if !slices.Contains(allowed, cred.Uid) {
+			log.Printf("Rejected admin %s %s from uid=%d pid=%d", r.Method, r.URL.Path, cred.Uid, cred.Pid)
+			http.Error(w, fmt.Sprintf("uid %d is not allowed", cred.Uid), http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// startAdmin starts serving the admin API on s.adminAddr: a Unix socket if
+// it's an absolute path, with callers checked against the UID allowlist,
+// or a TCP address otherwise, which Start checks has a token.
+func (s *Server) startAdmin() error {
+	handler := s.adminHandler(s.adminToken)
+	srv := &http.Server{ReadHeaderTimeout: 10 * time.Second}
+
+	var lis net.Listener
+	var err error
+	if filepath.IsAbs(s.adminAddr) {
+		if err := os.Remove(s.adminAddr); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing existing admin socket: %w", err)
+		}
+		if lis, err = net.Listen("unix", s.adminAddr); err != nil {
+			return fmt.Errorf("listening on %s: %w", s.adminAddr, err)
+		}
+		if err := os.Chmod(s.adminAddr, s.socketMode); err != nil {
+			lis.Close()
+			return fmt.Errorf("setting admin socket permissions: %w", err)
+		}
+		if len(s.allowUIDs) > 0 {
+			handler = requireUIDs(s.allowUIDs, handler)
+			srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+				cred, err := peerUcred(c)
+				if err != nil {
+					log.Printf("Admin connection: %v", err)
+					return ctx
+				}
+				return context.WithValue(ctx, ucredKey{}, cred)
+			}
+		}
+	} else {
+		if lis, err = net.Listen("tcp", s.adminAddr); err != nil {
+			return fmt.Errorf("listening on %s: %w", s.adminAddr, err)
+		}
+	}
+	srv.Handler = handler
+	s.adminServer = srv
+
+	log.Printf("Starting admin API on %s", lis.Addr())
+	go func() {
+		if err := srv.Serve(lis); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin API server error: %v", err)
+		}
+	}()
+	return nil
+}
+
+// adminHTTPStatus maps an error from the pod manager to an HTTP status,
+// by way of the gRPC code the RPCs would return.
+func adminHTTPStatus(err error) int {
+	code, _ := classifyError(err)
+	switch code {
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition, codes.AlreadyExists:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusBadGateway
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	http.Error(w, err.Error(), adminHTTPStatus(err))
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
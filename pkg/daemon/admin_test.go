@@ -0,0 +1,95 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	h := NewServer(ServerConfig{}, pm).adminHandler("secret")
+
+	tests := []struct {
+		method, path, token string
+		wantCode            int
+		wantBody            string
+	}{
+		{"GET", "/pods", "", http.StatusUnauthorized, ""},
+		{"GET", "/pods", "wrong", http.StatusUnauthorized, ""},
+		{"GET", "/pods", "secret", http.StatusOK, "[]"},
+		{"GET", "/pods/missing/status", "secret", http.StatusNotFound, "missing"},
+		{"POST", "/pods/missing/reattach", "secret", http.StatusNotFound, "missing"},
+		{"DELETE", "/pods/missing", "secret", http.StatusNoContent, ""},
+		{"GET", "/pods/missing/reattach", "secret", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode || !strings.Contains(rec.Body.String(), tt.wantBody) {
+			t.Errorf("%s %s with token %q = %d %q, want %d containing %q",
+				tt.method, tt.path, tt.token, rec.Code, rec.Body.String(), tt.wantCode, tt.wantBody)
+		}
+	}
+}
+
+func TestServerStart_Admin(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	dir := t.TempDir()
+
+	srv := NewServer(ServerConfig{SocketPath: filepath.Join(dir, "daemon.sock"), AdminAddr: "127.0.0.1:0"}, pm)
+	if err := srv.Start(); err == nil || !strings.Contains(err.Error(), "requires a token") {
+		srv.Stop()
+		t.Fatalf("Start() with a TCP admin address and no token error = %v, want one", err)
+	}
+
+	uid := uint32(os.Getuid())
+	for _, tt := range []struct {
+		name     string
+		allowed  []uint32
+		wantCode int
+	}{
+		{"caller allowed", []uint32{uid}, http.StatusOK},
+		{"caller not allowed", []uint32{uid + 1}, http.StatusForbidden},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			adminPath := filepath.Join(dir, "admin.sock")
+			srv := NewServer(ServerConfig{SocketPath: filepath.Join(dir, "daemon.sock"), AllowedUIDs: tt.allowed, AdminAddr: adminPath}, pm)
+			if err := srv.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer srv.Stop()
+
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return new(net.Dialer).DialContext(ctx, "unix", adminPath)
+				},
+			}}
+			resp, err := client.Get("http://admin/pods")
+			if err != nil {
+				t.Fatalf("GET /pods error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("GET /pods = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AuthKeyProvider supplies the auth keys pods' nodes log in with. The
+// OAuthManager mints one per node; a StaticAuthKey hands out the same
+// reusable key every time.
+type AuthKeyProvider interface {
+	// CreateAuthKey returns a key for a node of pod namespace/podName
+	// with tags, or the provider's default tags if tags is empty, and
+	// profile's capabilities, or the defaults if profile is nil.
+	CreateAuthKey(ctx context.Context, podName, namespace string, tags []string, profile *KeyProfile) (string, error)
+}
+
+// StaticAuthKey is an AuthKeyProvider for a single reusable auth key, for
+// running without an OAuth client. The key decides its nodes' tags and
+// capabilities, and with no access to the Tailscale API the daemon can't
+// delete pods' devices, renew their keys or move them to requested IPs.
+type StaticAuthKey struct {
+	key string
+}
+
+// NewStaticAuthKey returns a provider of key, which must be an auth key
+// (tskey-auth-...).
+func NewStaticAuthKey(key string) (*StaticAuthKey, error) {
+	key = strings.TrimSpace(key)
+	if !strings.HasPrefix(key, "tskey-auth-") || len(key) == len("tskey-auth-") {
+		return nil, errors.New("not an auth key (want tskey-auth-...)")
+	}
+	return &StaticAuthKey{key: key}, nil
+}
+
+// CreateAuthKey returns the key. A node that asks for tags or a key profile
+// of its own can't have them.
+func (k *StaticAuthKey) CreateAuthKey(ctx context.Context, podName, namespace string, tags []string, profile *KeyProfile) (string, error) {
+	if len(tags) > 0 {
+		return "", fmt.Errorf("tags %v %w", tags, errNeedsOAuth)
+	}
+	if profile != nil {
+		return "", fmt.Errorf("a key profile %w", errNeedsOAuth)
+	}
+	return k.key, nil
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentAuthKeyFailures is how many auth key creation failures
+// OAuthManager.RecentFailures remembers.
+const recentAuthKeyFailures = 100
+
+// AuthKeyFailure is a failed attempt to create an auth key for a pod.
+type AuthKeyFailure struct {
+	Time      time.Time
+	Namespace string
+	Pod       string
+	Reason    string // see authKeyFailureReason
+	Err       string
+}
+
+// authKeyFailureReason classifies an auth key creation failure for the
+// reason label of tscni_authkey_failures_total. API failures are named by
+// their status code.
+func authKeyFailureReason(err error) string {
+	var apiErr *apiError
+	switch {
+	case errors.Is(err, errTagNotPermitted):
+		return "tag_not_permitted"
+	case errors.As(err, &apiErr):
+		switch code := apiErr.StatusCode; {
+		case code == http.StatusBadRequest:
+			return "bad_request"
+		case code == http.StatusUnauthorized:
+			return "unauthorized"
+		case code == http.StatusForbidden:
+			return "forbidden"
+		case code == http.StatusTooManyRequests:
+			return "rate_limited"
+		case code >= 500:
+			return "server_error"
+		default:
+			return "client_error"
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return "timeout"
+	}
+	return "other"
+}
+
+// failureRing holds the most recent auth key failures, dropping the oldest
+// once full.
+type failureRing struct {
+	mu    sync.Mutex
+	buf   []AuthKeyFailure
+	next  int // index the next failure is written at, once buf is full
+	limit int
+}
+
+func newFailureRing(limit int) *failureRing {
+	return &failureRing{limit: limit}
+}
+
+func (r *failureRing) add(f AuthKeyFailure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.buf) < r.limit {
+		r.buf = append(r.buf, f)
+		return
+	}
+	r.buf[r.next] = f
+	r.next = (r.next + 1) % r.limit
+}
+
+// list returns the failures, oldest first.
+func (r *failureRing) list() []AuthKeyFailure {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]AuthKeyFailure, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// recordAuthKeyFailure counts a failed CreateAuthKey call for a pod and
+// remembers it for RecentFailures.
+func (m *OAuthManager) recordAuthKeyFailure(podName, namespace string, err error) {
+	reason := authKeyFailureReason(err)
+	metricAuthKeyFailures.Add(authKeyFailureLabels{Namespace: namespace, Reason: reason}, 1)
+	m.failures.add(AuthKeyFailure{
+		Time:      time.Now(),
+		Namespace: namespace,
+		Pod:       podName,
+		Reason:    reason,
+		Err:       err.Error(),
+	})
+}
+
+// RecentFailures returns the most recent auth key creation failures, oldest
+// first, limited to namespace unless it is empty.
+func (m *OAuthManager) RecentFailures(namespace string) []AuthKeyFailure {
+	all := m.failures.list()
+	if namespace == "" {
+		return all
+	}
+	var out []AuthKeyFailure
+	for _, f := range all {
+		if f.Namespace == namespace {
+			out = append(out, f)
+		}
+	}
+	return out
+}
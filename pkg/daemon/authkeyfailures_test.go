@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestAuthKeyFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: tag tag:db", errTagNotPermitted), "tag_not_permitted"},
+		{&apiError{StatusCode: http.StatusBadRequest}, "bad_request"},
+		{&apiError{StatusCode: http.StatusUnauthorized}, "unauthorized"},
+		{&apiError{StatusCode: http.StatusForbidden}, "forbidden"},
+		{fmt.Errorf("wrapped: %w", &apiError{StatusCode: http.StatusTooManyRequests}), "rate_limited"},
+		{&apiError{StatusCode: http.StatusBadGateway}, "server_error"},
+		{&apiError{StatusCode: http.StatusNotFound}, "client_error"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("requesting token: %w", context.Canceled), "timeout"},
+		{fmt.Errorf("connection refused"), "other"},
+	}
+	for _, tt := range tests {
+		if got := authKeyFailureReason(tt.err); got != tt.want {
+			t.Errorf("authKeyFailureReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRecentFailures(t *testing.T) {
+	m := &OAuthManager{failures: newFailureRing(3)}
+	for i := range 5 {
+		ns := "default"
+		if i%2 == 1 {
+			ns = "data"
+		}
+		m.recordAuthKeyFailure(fmt.Sprintf("pod-%d", i), ns, &apiError{StatusCode: http.StatusTooManyRequests})
+	}
+
+	// Only the last three are kept, oldest first
+	var pods []string
+	for _, f := range m.RecentFailures("") {
+		pods = append(pods, f.Pod)
+		if f.Reason != "rate_limited" {
+			t.Errorf("failure %s reason = %q, want rate_limited", f.Pod, f.Reason)
+		}
+	}
+	if fmt.Sprint(pods) != "[pod-2 pod-3 pod-4]" {
+		t.Errorf("RecentFailures(\"\") pods = %v, want [pod-2 pod-3 pod-4]", pods)
+	}
+
+	got := m.RecentFailures("data")
+	if len(got) != 1 || got[0].Pod != "pod-3" {
+		t.Errorf("RecentFailures(\"data\") = %+v, want only pod-3", got)
+	}
+
+	if v := metricAuthKeyFailures.Get(authKeyFailureLabels{Namespace: "default", Reason: "rate_limited"}); v == nil || v.String() == "0" {
+		t.Errorf("tscni_authkey_failures_total for default/rate_limited not incremented")
+	}
+}
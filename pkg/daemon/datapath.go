@@ -0,0 +1,129 @@
+//go:build linux
+
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// datapath is what carries a pod's traffic. Moving the pod to a new netns
+// changes it, so it is read under pm.mu and checked without it.
+type datapath struct {
+	hostVethName string
+	netnsPath    string
+	podIfName    string
+	ipv4, ipv6   netip.Addr
+	routes       []netip.Prefix
+}
+
+// datapath returns m's datapath. Caller must hold pm.mu.
+func (m *ManagedServer) datapath() datapath {
+	return datapath{
+		hostVethName: m.HostVethName,
+		netnsPath:    m.NetnsPath,
+		podIfName:    m.PodIfName,
+		ipv4:         m.TailscaleIPv4,
+		ipv6:         m.TailscaleIPv6,
+		routes:       m.Routes,
+	}
+}
+
+// checkDatapath looks for what carries a pod's traffic, for CheckPod: in
+// the pod's netns its Tailscale interface, with the node's IPs and a route
+// for each of its Tailscale routes, and on the host, for a veth pod, the
+// host veth and the routes to the pod through it. It returns what is
+// missing, or nil if nothing is.
+func (pm *PodManager) checkDatapath(d datapath) []string {
+	var problems []string
+	if d.hostVethName != "" {
+		problems = checkHostDatapath(pm.nl, d.hostVethName, d.ipv4, d.ipv6)
+	}
+
+	podNS, err := getPodNS(d.netnsPath)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	defer podNS.Close()
+	err = podNS.Do(func(ns.NetNS) error {
+		problems = append(problems, checkPodDatapath(pm.nl, d.podIfName, d.ipv4, d.ipv6, d.routes)...)
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("entering the pod's netns: %v", err))
+	}
+	return problems
+}
+
+// checkHostDatapath checks that a pod's host veth is up, with a route to
+// each of the node's IPs through it.
+func checkHostDatapath(nl netlinkOps, hostVethName string, ipv4, ipv6 netip.Addr) []string {
+	link, err := nl.LinkByName(hostVethName)
+	if err != nil {
+		return []string{fmt.Sprintf("host veth %s is missing", hostVethName)}
+	}
+	var problems []string
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		problems = append(problems, fmt.Sprintf("host veth %s is down", hostVethName))
+	}
+	routes, err := nl.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return append(problems, fmt.Sprintf("listing host routes: %v", err))
+	}
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if ip.IsValid() && !hasRouteVia(routes, netip.PrefixFrom(ip, ip.BitLen()), link.Attrs().Index) {
+			problems = append(problems, fmt.Sprintf("no host route to %s via %s", ip, hostVethName))
+		}
+	}
+	return problems
+}
+
+// checkPodDatapath checks, in the current netns, that the pod's Tailscale
+// interface has the node's IPs and a route for each of routes. IPv6 routes
+// aren't expected if the node has no IPv6 address.
+func checkPodDatapath(nl netlinkOps, podIfName string, ipv4, ipv6 netip.Addr, routes []netip.Prefix) []string {
+	link, err := nl.LinkByName(podIfName)
+	if err != nil {
+		return []string{fmt.Sprintf("%s is missing in the pod", podIfName)}
+	}
+	var problems []string
+	addrs, err := nl.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return []string{fmt.Sprintf("listing %s addresses: %v", podIfName, err)}
+	}
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		if !slices.ContainsFunc(addrs, func(a netlink.Addr) bool { return a.IP.Equal(ip.AsSlice()) }) {
+			problems = append(problems, fmt.Sprintf("%s doesn't have %s", podIfName, ip))
+		}
+	}
+
+	podRoutes, err := nl.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return append(problems, fmt.Sprintf("listing pod routes: %v", err))
+	}
+	for _, prefix := range routes {
+		if prefix.Addr().Is6() && !ipv6.IsValid() {
+			continue
+		}
+		if !hasRouteVia(podRoutes, prefix, link.Attrs().Index) {
+			problems = append(problems, fmt.Sprintf("no route for %s via %s in the pod", prefix, podIfName))
+		}
+	}
+	return problems
+}
+
+// hasRouteVia reports whether routes has one for dst via the link at index.
+func hasRouteVia(routes []netlink.Route, dst netip.Prefix, index int) bool {
+	return slices.ContainsFunc(routes, func(r netlink.Route) bool {
+		return r.Dst != nil && r.LinkIndex == index && r.Dst.String() == dst.String()
+	})
+}
@@ -0,0 +1,108 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestCheckHostDatapath(t *testing.T) {
+	ipv4 := netip.MustParseAddr("100.80.0.10")
+	ipv6 := netip.MustParseAddr("fd7a:115c:a1e0::a")
+
+	tests := []struct {
+		name  string
+		setup func(nl *fakeNetlink)
+		want  []string
+	}{
+		{
+			name: "healthy",
+			setup: func(nl *fakeNetlink) {
+				veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "veth1234"}}
+				index := nl.addLink(veth)
+				nl.LinkSetUp(veth)
+				nl.RouteAdd(&netlink.Route{LinkIndex: index, Dst: prefixToIPNet(netip.PrefixFrom(ipv4, 32))})
+				nl.RouteAdd(&netlink.Route{LinkIndex: index, Dst: prefixToIPNet(netip.PrefixFrom(ipv6, 128))})
+			},
+		},
+		{
+			name:  "veth gone",
+			setup: func(nl *fakeNetlink) {},
+			want:  []string{"host veth veth1234 is missing"},
+		},
+		{
+			name: "down, and routes via another link",
+			setup: func(nl *fakeNetlink) {
+				nl.addLink(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "veth1234"}})
+				other := nl.addLink(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "veth5678"}})
+				nl.RouteAdd(&netlink.Route{LinkIndex: other, Dst: prefixToIPNet(netip.PrefixFrom(ipv4, 32))})
+			},
+			want: []string{
+				"host veth veth1234 is down",
+				"no host route to 100.80.0.10 via veth1234",
+				"no host route to fd7a:115c:a1e0::a via veth1234",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nl := newFakeNetlink()
+			tt.setup(nl)
+			if got := checkHostDatapath(nl, "veth1234", ipv4, ipv6); !slices.Equal(got, tt.want) {
+				t.Errorf("checkHostDatapath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPodDatapath(t *testing.T) {
+	ipv4 := netip.MustParseAddr("100.80.0.10")
+	routes := []netip.Prefix{netip.MustParsePrefix("100.64.0.0/10"), netip.MustParsePrefix("fd7a:115c:a1e0::/48")}
+
+	tests := []struct {
+		name  string
+		setup func(nl *fakeNetlink)
+		want  []string
+	}{
+		{
+			// Without an IPv6 address, the IPv6 route isn't expected
+			name: "healthy",
+			setup: func(nl *fakeNetlink) {
+				ts0 := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ts0"}}
+				index := nl.addLink(ts0)
+				nl.AddrAdd(ts0, &netlink.Addr{IPNet: prefixToIPNet(netip.PrefixFrom(ipv4, 32))})
+				nl.RouteAdd(vethRoute(index, routes[0], RoutingModeNetstack))
+			},
+		},
+		{
+			name:  "interface gone",
+			setup: func(nl *fakeNetlink) {},
+			want:  []string{"ts0 is missing in the pod"},
+		},
+		{
+			name: "address and route gone",
+			setup: func(nl *fakeNetlink) {
+				nl.addLink(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "ts0"}})
+				eth0 := nl.addLink(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "eth0"}})
+				nl.RouteAdd(&netlink.Route{LinkIndex: eth0, Dst: prefixToIPNet(routes[0])})
+			},
+			want: []string{
+				"ts0 doesn't have 100.80.0.10",
+				"no route for 100.64.0.0/10 via ts0 in the pod",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nl := newFakeNetlink()
+			tt.setup(nl)
+			if got := checkPodDatapath(nl, "ts0", ipv4, netip.Addr{}, routes); !slices.Equal(got, tt.want) {
+				t.Errorf("checkPodDatapath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"tailscale.com/control/controlclient"
+	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/tailcfg"
+)
+
+// maxDERPMapSize bounds how much of a DERP map file or response is read.
+const maxDERPMapSize = 1 << 20
+
+// LoadDERPMap reads a DERP map from a JSON file or an http(s) URL and
+// validates it. The format is tailcfg.DERPMap, as served by Tailscale's
+// https://login.tailscale.com/derpmap/default or Headscale's derp config.
+func LoadDERPMap(ctx context.Context, source string) (*tailcfg.DERPMap, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		req, err := http.NewRequestWithContext(ctx, "GET", source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetching DERP map: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching DERP map: %s", resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxDERPMapSize))
+		if err != nil {
+			return nil, fmt.Errorf("reading DERP map: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("reading DERP map: %w", err)
+		}
+	}
+	return parseDERPMap(data)
+}
+
+// parseDERPMap decodes and validates a JSON DERP map.
+func parseDERPMap(data []byte) (*tailcfg.DERPMap, error) {
+	var dm tailcfg.DERPMap
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&dm); err != nil {
+		return nil, fmt.Errorf("parsing DERP map: %w", err)
+	}
+	if len(dm.Regions) == 0 {
+		return nil, errors.New("DERP map has no regions")
+	}
+	for id, region := range dm.Regions {
+		if region == nil || region.RegionID != id {
+			return nil, fmt.Errorf("DERP region %d: RegionID does not match its key", id)
+		}
+		if len(region.Nodes) == 0 {
+			return nil, fmt.Errorf("DERP region %d has no nodes", id)
+		}
+		for _, node := range region.Nodes {
+			if node.HostName == "" {
+				return nil, fmt.Errorf("DERP region %d: node %q has no HostName", id, node.Name)
+			}
+			if node.RegionID != id {
+				return nil, fmt.Errorf("DERP region %d: node %q has RegionID %d", id, node.Name, node.RegionID)
+			}
+		}
+	}
+	return &dm, nil
+}
+
+// overrideDERPMap makes lb use dm instead of the DERP map from control. It
+// must be called before lb.Start.
+//
+// LocalBackend has no DERP map setting: it applies the map from every full
+// netmap. Setting it on magicsock after each netmap would drop DERP
+// connections every time control's map replaced ours, so instead the netmap
+// is rewritten on its way from the control client to the backend.
+// SetControlClientGetterForTesting is the only hook for that.
+func overrideDERPMap(lb *ipnlocal.LocalBackend, dm *tailcfg.DERPMap) {
+	lb.SetControlClientGetterForTesting(func(opts controlclient.Options) (controlclient.Client, error) {
+		opts.Observer = derpMapObserver{LocalBackend: lb, derpMap: dm}
+		return controlclient.New(opts)
+	})
+}
+
+// derpMapObserver passes control client updates to a LocalBackend with the
+// netmap's DERP map replaced. Embedding the backend also forwards netmap
+// deltas, which don't carry a DERP map.
+type derpMapObserver struct {
+	*ipnlocal.LocalBackend
+	derpMap *tailcfg.DERPMap
+}
+
+func (o derpMapObserver) SetControlClientStatus(c controlclient.Client, st controlclient.Status) {
+	if st.NetMap != nil {
+		nm := *st.NetMap
+		nm.DERPMap = o.derpMap
+		st.NetMap = &nm
+	}
+	o.LocalBackend.SetControlClientStatus(c, st)
+}
@@ -0,0 +1,98 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testDERPMap = `{
+	"OmitDefaultRegions": true,
+	"Regions": {
+		"900": {
+			"RegionID": 900,
+			"RegionCode": "private",
+			"Nodes": [{"Name": "900a", "RegionID": 900, "HostName": "derp.example.internal"}]
+		}
+	}
+}`
+
+func TestParseDERPMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "valid", input: testDERPMap},
+		{name: "invalid json", input: `{`, wantErr: true},
+		{name: "unknown field", input: `{"Regionz": {}}`, wantErr: true},
+		{name: "no regions", input: `{"Regions": {}}`, wantErr: true},
+		{
+			name:    "region ID mismatch",
+			input:   `{"Regions": {"900": {"RegionID": 901, "Nodes": [{"Name": "a", "RegionID": 901, "HostName": "derp"}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "no nodes",
+			input:   `{"Regions": {"900": {"RegionID": 900}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "node without hostname",
+			input:   `{"Regions": {"900": {"RegionID": 900, "Nodes": [{"Name": "a", "RegionID": 900}]}}}`,
+			wantErr: true,
+		},
+		{
+			name:    "node in wrong region",
+			input:   `{"Regions": {"900": {"RegionID": 900, "Nodes": [{"Name": "a", "RegionID": 1, "HostName": "derp"}]}}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dm, err := parseDERPMap([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDERPMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (!dm.OmitDefaultRegions || dm.Regions[900].Nodes[0].HostName != "derp.example.internal") {
+				t.Errorf("parseDERPMap() = %+v", dm)
+			}
+		})
+	}
+}
+
+func TestLoadDERPMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "derpmap.json")
+	if err := os.WriteFile(path, []byte(testDERPMap), 0600); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/derpmap" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDERPMap))
+	}))
+	defer srv.Close()
+
+	for _, source := range []string{path, srv.URL + "/derpmap"} {
+		dm, err := LoadDERPMap(context.Background(), source)
+		if err != nil {
+			t.Errorf("LoadDERPMap(%q) error = %v", source, err)
+			continue
+		}
+		if _, ok := dm.Regions[900]; !ok {
+			t.Errorf("LoadDERPMap(%q) regions = %v, want 900", source, dm.RegionIDs())
+		}
+	}
+
+	for _, source := range []string{filepath.Join(t.TempDir(), "missing.json"), srv.URL + "/missing"} {
+		if _, err := LoadDERPMap(context.Background(), source); err == nil {
+			t.Errorf("LoadDERPMap(%q): want error", source)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"log"
+)
+
+// DrainNode removes every pod's node and tailnet device, as DEL would for
+// each of them, and the warm pool's nodes, for a node that is being taken
+// out of service. Unlike Close or Preserve, nothing is kept for the next
+// daemon to recover. With DelDrain set, the pods' connections get one drain
+// period between them to finish, for no longer than ctx allows. All nodes
+// are then taken offline before any is shut down, so their peers see them
+// go at once. It returns the pods it removed.
+//
+// Pods ADDed while the drain runs are left alone, so cordon the node
+// first. The warm pool isn't refilled afterwards.
+func (pm *PodManager) DrainNode(ctx context.Context) []*ManagedServer {
+	pm.closeWarmPool()
+
+	pm.mu.RLock()
+	servers := make(map[string]*ManagedServer, len(pm.servers))
+	for containerID, srv := range pm.servers {
+		servers[containerID] = srv
+	}
+	pm.mu.RUnlock()
+	if len(servers) == 0 {
+		return nil
+	}
+
+	log.Printf("Draining node: removing %d pods", len(servers))
+	if pm.delDrain > 0 {
+		if err := waitDrain(ctx, pm.delDrain); err != nil {
+			log.Printf("Warning: node drain cut short: %v", err)
+		}
+	}
+	for _, srv := range servers {
+		srv.takeOffline()
+	}
+	drained := make([]*ManagedServer, 0, len(servers))
+	for containerID, srv := range servers {
+		if err := pm.deletePod(ctx, containerID, 0); err != nil {
+			log.Printf("Warning: failed to remove pod %s/%s: %v", srv.Namespace, srv.PodName, err)
+			continue
+		}
+		drained = append(drained, srv)
+	}
+	log.Printf("Node drained: removed %d pods", len(drained))
+	return drained
+}
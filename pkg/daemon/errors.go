@@ -0,0 +1,80 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors wrapped by AddPod for failures the CNI plugin handles specially.
+var (
+	errNetnsGone    = errors.New("network namespace no longer exists")
+	errTUNCollision = errors.New("TUN device already exists")
+	errPodLimit     = errors.New("node is at its pod limit")
+
+	errTagNotPermitted = errors.New("tag not permitted")
+	errPodNotFound     = errors.New("no pod for container")
+	errNeedsApproval   = errors.New("node requires manual approval; enable preauthorized keys or approve in admin console")
+
+	errDeletedDuringAdd = errors.New("container deleted while being added")
+	errPodReplaced      = errors.New("pod was replaced by a new pod of the same name")
+	errNeedsOAuth       = errors.New("needs an OAuth client, and the daemon has a static auth key")
+	errInvalidRequest   = errors.New("invalid request")
+)
+
+// classifyError maps err to a gRPC code and an ErrorDetail saying whether
+// the CNI plugin should retry.
+func classifyError(err error) (codes.Code, *pb.ErrorDetail) {
+	var apiErr *apiError
+	switch {
+	case errors.Is(err, errNetnsGone):
+		return codes.FailedPrecondition, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_NETNS_GONE}
+	case errors.Is(err, errTUNCollision):
+		// The name is derived from the container ID, so retrying can't help
+		return codes.AlreadyExists, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_TUN_COLLISION}
+	case errors.Is(err, errPodLimit):
+		// Slots free up only when pods are deleted, not within the retry window
+		return codes.ResourceExhausted, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_POD_LIMIT}
+	case errors.Is(err, errPodNotFound):
+		return codes.NotFound, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+	case errors.Is(err, errTagNotPermitted):
+		// Needs a policy or annotation change, not a retry
+		return codes.PermissionDenied, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_TAG_NOT_PERMITTED}
+	case errors.Is(err, errNeedsApproval):
+		// A retry gets a new key with the same capabilities
+		return codes.FailedPrecondition, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_NEEDS_APPROVAL}
+	case errors.Is(err, errPodReplaced):
+		// The container's pod is gone; its DEL is coming
+		return codes.FailedPrecondition, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+	case errors.Is(err, errNeedsOAuth):
+		// Needs an annotation change or OAuth credentials, not a retry
+		return codes.FailedPrecondition, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+	case errors.Is(err, errInvalidRequest):
+		// The plugin's config is wrong; retrying sends the same request
+		return codes.InvalidArgument, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+	case errors.Is(err, errDeletedDuringAdd):
+		// The runtime has already given up on the ADD
+		return codes.Aborted, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		return codes.ResourceExhausted, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_API_RATE_LIMITED, Retryable: true}
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden):
+		return codes.Unauthenticated, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_AUTH_FAILED}
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_TIMEOUT, Retryable: true}
+	}
+	return codes.Internal, &pb.ErrorDetail{Reason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED}
+}
+
+// statusError converts err into a gRPC status error carrying an ErrorDetail.
+func statusError(err error) error {
+	code, detail := classifyError(err)
+	st, detailErr := status.New(code, err.Error()).WithDetails(detail)
+	if detailErr != nil {
+		return status.Error(code, err.Error())
+	}
+	return st.Err()
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantCode      codes.Code
+		wantReason    pb.ErrorReason
+		wantRetryable bool
+	}{
+		{
+			name:       "netns gone",
+			err:        fmt.Errorf("adding pod: %w: /proc/1/ns/net", errNetnsGone),
+			wantCode:   codes.FailedPrecondition,
+			wantReason: pb.ErrorReason_ERROR_REASON_NETNS_GONE,
+		},
+		{
+			name:       "TUN collision",
+			err:        fmt.Errorf("creating TUN device: %w: ts-abc", errTUNCollision),
+			wantCode:   codes.AlreadyExists,
+			wantReason: pb.ErrorReason_ERROR_REASON_TUN_COLLISION,
+		},
+		{
+			name:       "pod limit",
+			err:        fmt.Errorf("%w of %d", errPodLimit, 110),
+			wantCode:   codes.ResourceExhausted,
+			wantReason: pb.ErrorReason_ERROR_REASON_POD_LIMIT,
+		},
+		{
+			name:       "tag not permitted",
+			err:        fmt.Errorf("creating auth key: %w: tag tag:db not permitted by ACL", errTagNotPermitted),
+			wantCode:   codes.PermissionDenied,
+			wantReason: pb.ErrorReason_ERROR_REASON_TAG_NOT_PERMITTED,
+		},
+		{
+			name:       "needs approval",
+			err:        fmt.Errorf("waiting for Tailscale IP: %w (%v)", errNeedsApproval, context.DeadlineExceeded),
+			wantCode:   codes.FailedPrecondition,
+			wantReason: pb.ErrorReason_ERROR_REASON_NEEDS_APPROVAL,
+		},
+		{
+			name:       "pod replaced",
+			err:        fmt.Errorf("%w: default/job-0 has UID uid-2, container's pod had uid-1", errPodReplaced),
+			wantCode:   codes.FailedPrecondition,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:       "static auth key",
+			err:        fmt.Errorf("creating auth key: tags [tag:db] %w", errNeedsOAuth),
+			wantCode:   codes.FailedPrecondition,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:       "invalid request",
+			err:        fmt.Errorf("adding pod: %w: unknown routing mode \"fast\"", errInvalidRequest),
+			wantCode:   codes.InvalidArgument,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:       "deleted during ADD",
+			err:        fmt.Errorf("%w: waiting for Tailscale IP (state: Starting): %v", errDeletedDuringAdd, context.Canceled),
+			wantCode:   codes.Aborted,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:       "pod not found",
+			err:        fmt.Errorf("reattaching pod: %w c1", errPodNotFound),
+			wantCode:   codes.NotFound,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:          "rate limited",
+			err:           fmt.Errorf("creating auth key: %w", &apiError{Op: "auth key request", StatusCode: http.StatusTooManyRequests}),
+			wantCode:      codes.ResourceExhausted,
+			wantReason:    pb.ErrorReason_ERROR_REASON_API_RATE_LIMITED,
+			wantRetryable: true,
+		},
+		{
+			name:       "bad credentials",
+			err:        fmt.Errorf("getting access token: %w", &apiError{Op: "token request", StatusCode: http.StatusUnauthorized}),
+			wantCode:   codes.Unauthenticated,
+			wantReason: pb.ErrorReason_ERROR_REASON_AUTH_FAILED,
+		},
+		{
+			name:          "timeout",
+			err:           fmt.Errorf("timeout waiting for Tailscale IP: %w", context.DeadlineExceeded),
+			wantCode:      codes.DeadlineExceeded,
+			wantReason:    pb.ErrorReason_ERROR_REASON_TIMEOUT,
+			wantRetryable: true,
+		},
+		{
+			name:       "other API error",
+			err:        &apiError{Op: "auth key request", StatusCode: http.StatusInternalServerError},
+			wantCode:   codes.Internal,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+		{
+			name:       "unknown",
+			err:        errors.New("boom"),
+			wantCode:   codes.Internal,
+			wantReason: pb.ErrorReason_ERROR_REASON_UNSPECIFIED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, detail := classifyError(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("code = %v, want %v", code, tt.wantCode)
+			}
+			if detail.Reason != tt.wantReason {
+				t.Errorf("reason = %v, want %v", detail.Reason, tt.wantReason)
+			}
+			if detail.Retryable != tt.wantRetryable {
+				t.Errorf("retryable = %v, want %v", detail.Retryable, tt.wantRetryable)
+			}
+		})
+	}
+}
+
+func TestStatusError_CarriesDetail(t *testing.T) {
+	err := statusError(fmt.Errorf("adding pod: %w", errNetnsGone))
+
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Fatalf("statusError() = %v, not a gRPC status", err)
+	}
+	if st.Code() != codes.FailedPrecondition {
+		t.Errorf("code = %v, want %v", st.Code(), codes.FailedPrecondition)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("got %d details, want 1", len(details))
+	}
+	detail, ok := details[0].(*pb.ErrorDetail)
+	if !ok {
+		t.Fatalf("detail is %T, want *pb.ErrorDetail", details[0])
+	}
+	if detail.Reason != pb.ErrorReason_ERROR_REASON_NETNS_GONE {
+		t.Errorf("reason = %v, want %v", detail.Reason, pb.ErrorReason_ERROR_REASON_NETNS_GONE)
+	}
+}
@@ -0,0 +1,97 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Event reasons recorded on pods.
+const (
+	EventReasonAttached     = "TailscaleAttached"
+	EventReasonAttachFailed = "TailscaleAttachFailed"
+	EventReasonIPChanged    = "TailscaleIPChanged"
+)
+
+// maxEventMessageLen keeps messages within the API server's limit for Events.
+const maxEventMessageLen = 1024
+
+// podRef identifies the pod an event is about.
+type podRef struct {
+	Name      string
+	Namespace string
+	UID       string
+}
+
+// EventRecorder records Kubernetes Events on pods. A nil EventRecorder, or
+// one without a Kubernetes client, only logs.
+type EventRecorder struct {
+	kube     *KubeClient
+	nodeName string
+}
+
+// NewEventRecorder returns an EventRecorder that reports events as coming
+// from the daemon on nodeName.
+func NewEventRecorder(kube *KubeClient, nodeName string) *EventRecorder {
+	return &EventRecorder{kube: kube, nodeName: nodeName}
+}
+
+// Attached records that a pod joined the tailnet.
+func (r *EventRecorder) Attached(pod podRef, ip, hostname string) {
+	r.emit(pod, "Normal", EventReasonAttached, fmt.Sprintf("Attached to tailnet as %s with IP %s", hostname, ip))
+}
+
+// AttachFailed records that a pod could not join the tailnet.
+func (r *EventRecorder) AttachFailed(pod podRef, err error) {
+	r.emit(pod, "Warning", EventReasonAttachFailed, fmt.Sprintf("Failed to attach to tailnet: %v", err))
+}
+
+// IPChanged records that a pod's node came back with a different IP.
+func (r *EventRecorder) IPChanged(pod podRef, oldIP, newIP string) {
+	r.emit(pod, "Warning", EventReasonIPChanged, fmt.Sprintf("Tailscale IP changed from %s to %s when the node was restarted", oldIP, newIP))
+}
+
+// emit records an event in the background so CNI requests aren't held up
+// by the API server.
+func (r *EventRecorder) emit(pod podRef, eventType, reason, message string) {
+	if r == nil || r.kube == nil || pod.Name == "" || pod.Namespace == "" {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+		defer cancel()
+		if err := r.record(ctx, pod, eventType, reason, message); err != nil {
+			log.Printf("Warning: failed to record %s event for pod %s/%s: %v", reason, pod.Namespace, pod.Name, err)
+		}
+	}()
+}
+
+func (r *EventRecorder) record(ctx context.Context, pod podRef, eventType, reason, message string) error {
+	if len(message) > maxEventMessageLen {
+		message = message[:maxEventMessageLen]
+	}
+	now := time.Now()
+	return r.kube.CreateEvent(ctx, &kubeEvent{
+		Metadata: kubeObjectMeta{
+			GenerateName: pod.Name + ".",
+			Namespace:    pod.Namespace,
+		},
+		InvolvedObject: kubeObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       pod.Name,
+			Namespace:  pod.Namespace,
+			UID:        pod.UID,
+		},
+		Reason:              reason,
+		Message:             message,
+		Type:                eventType,
+		Source:              kubeEventSource{Component: "tailscale-cni", Host: r.nodeName},
+		FirstTimestamp:      now,
+		LastTimestamp:       now,
+		Count:               1,
+		ReportingController: "tailscale-cni",
+		ReportingInstance:   r.nodeName,
+	})
+}
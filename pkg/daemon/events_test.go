@@ -0,0 +1,60 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEventRecorder_Record(t *testing.T) {
+	var got kubeEvent
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kube := &KubeClient{baseURL: srv.URL, tokenPath: tokenPath, httpClient: srv.Client()}
+	r := NewEventRecorder(kube, "node-1")
+
+	pod := podRef{Name: "web-0", Namespace: "default", UID: "uid-1"}
+	long := errors.New(strings.Repeat("x", 2*maxEventMessageLen))
+	if err := r.record(context.Background(), pod, "Warning", EventReasonAttachFailed, long.Error()); err != nil {
+		t.Fatalf("record() error = %v", err)
+	}
+
+	if gotPath != "/api/v1/namespaces/default/events" {
+		t.Errorf("path = %q, want events in the pod's namespace", gotPath)
+	}
+	if got.InvolvedObject.Kind != "Pod" || got.InvolvedObject.Name != "web-0" || got.InvolvedObject.UID != "uid-1" {
+		t.Errorf("involvedObject = %+v, want the pod", got.InvolvedObject)
+	}
+	if got.Reason != EventReasonAttachFailed || got.Type != "Warning" {
+		t.Errorf("reason/type = %s/%s, want %s/Warning", got.Reason, got.Type, EventReasonAttachFailed)
+	}
+	if len(got.Message) != maxEventMessageLen {
+		t.Errorf("message length = %d, want truncated to %d", len(got.Message), maxEventMessageLen)
+	}
+	if got.Source.Host != "node-1" {
+		t.Errorf("source host = %q, want %q", got.Source.Host, "node-1")
+	}
+}
+
+func TestEventRecorder_NilIsNoOp(t *testing.T) {
+	var r *EventRecorder
+	r.Attached(podRef{Name: "web-0", Namespace: "default"}, "100.64.0.1", "web")
+	NewEventRecorder(nil, "node-1").AttachFailed(podRef{Name: "web-0", Namespace: "default"}, errors.New("boom"))
+	r.IPChanged(podRef{Name: "web-0", Namespace: "default"}, "100.64.0.1", "100.64.0.2")
+}
@@ -0,0 +1,231 @@
+//go:build linux
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fullTunnelBypass are the ranges a full-tunnel pod still reaches via its
+// primary CNI's default route, so Services, cluster DNS and other pods keep
+// working as before, rather than going to the exit node.
+var fullTunnelBypass = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("fc00::/7"),
+}
+
+// PrimaryRoute is a default route from a pod's primary CNI, replaced by one
+// via the pod's Tailscale interface for full tunnel (AnnotationDefaultRoute)
+// and put back on DEL.
+type PrimaryRoute struct {
+	IPv6    bool   `json:"ipv6,omitempty"`
+	Gateway string `json:"gateway,omitempty"`
+	Dev     string `json:"dev"`
+	Metric  int    `json:"metric,omitempty"`
+	OnLink  bool   `json:"onlink,omitempty"`
+}
+
+// setupFullTunnel points a full-tunnel pod's default routes at its Tailscale
+// interface, once that is up, and returns the primary CNI's default routes
+// it replaced. Only families the node has an address in are changed.
+// fullTunnelBypass stays on the primary network. With a veth (hostVethName
+// set) the default routes are also added to the pod's table on the host
+// (see routePodViaTUN). On failure the primary routes are put back.
+func setupFullTunnel(netnsPath, podIfName, hostVethName, tunName string, table int, ipv4, ipv6 netip.Addr, routingMode string) ([]PrimaryRoute, error) {
+	podNS, err := getPodNS(netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer podNS.Close()
+
+	var saved []PrimaryRoute
+	err = podNS.Do(func(ns.NetNS) error {
+		saved, err = replaceDefaultRoutes(podIfName, ipv4, ipv6, hostVethName == "", routingMode)
+		return err
+	})
+	if err == nil && hostVethName != "" {
+		var tunLink netlink.Link
+		if tunLink, err = netlink.LinkByName(tunName); err == nil {
+			defaults := []netip.Prefix{netip.PrefixFrom(netip.IPv4Unspecified(), 0), netip.PrefixFrom(netip.IPv6Unspecified(), 0)}
+			err = addPodTableRoutes(hostNetlink, tunLink, table, ipv6, defaults)
+		}
+	}
+	if err != nil {
+		if rerr := restorePrimaryRoutes(netnsPath, podIfName, saved); rerr != nil {
+			log.Printf("Warning: failed to restore pod default routes: %v", rerr)
+		}
+		return nil, fmt.Errorf("setting up full tunnel: %w", err)
+	}
+
+	log.Printf("Routed default traffic of %s via %s (replaced %d primary routes)", netnsPath, podIfName, len(saved))
+	return saved, nil
+}
+
+// replaceDefaultRoutes is setupFullTunnel's work inside the pod's netns.
+// Default routes already via podIfName, as when a recovered pod kept its
+// veth, are left alone. tunInPod means podIfName is the TUN itself.
+func replaceDefaultRoutes(podIfName string, ipv4, ipv6 netip.Addr, tunInPod bool, routingMode string) ([]PrimaryRoute, error) {
+	link, err := linkByName(podIfName)
+	if err != nil {
+		return nil, fmt.Errorf("getting %s: %w", podIfName, err)
+	}
+	idx := link.Attrs().Index
+
+	var saved []PrimaryRoute
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		family := netlink.FAMILY_V4
+		if ip.Is6() {
+			family = netlink.FAMILY_V6
+		}
+		routes, err := netlink.RouteListFiltered(family, &netlink.Route{Table: unix.RT_TABLE_MAIN}, netlink.RT_FILTER_TABLE)
+		if err != nil {
+			return saved, fmt.Errorf("listing routes: %w", err)
+		}
+		var primary *netlink.Route
+		for i := range routes {
+			r := &routes[i]
+			if !isDefaultRoute(r) || r.LinkIndex == idx {
+				continue
+			}
+			p, err := primaryRoute(r)
+			if err != nil {
+				return saved, err
+			}
+			if err := netlink.RouteDel(r); err != nil {
+				return saved, fmt.Errorf("deleting default route via %s: %w", p.Dev, err)
+			}
+			saved = append(saved, p)
+			if primary == nil {
+				primary = r
+			}
+		}
+
+		if primary != nil {
+			for _, prefix := range fullTunnelBypass {
+				if prefix.Addr().Is6() != ip.Is6() {
+					continue
+				}
+				bypass := &netlink.Route{
+					LinkIndex: primary.LinkIndex,
+					Dst:       prefixToIPNet(prefix),
+					Gw:        primary.Gw,
+					Flags:     primary.Flags & int(netlink.FLAG_ONLINK),
+					Scope:     primary.Scope,
+				}
+				if err := netlink.RouteAdd(bypass); err != nil && !errors.Is(err, unix.EEXIST) {
+					return saved, fmt.Errorf("adding route %s via primary network: %w", prefix, err)
+				}
+			}
+		}
+
+		def := netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+		if ip.Is6() {
+			def = netip.PrefixFrom(netip.IPv6Unspecified(), 0)
+		}
+		route := &netlink.Route{LinkIndex: idx, Dst: prefixToIPNet(def), Scope: netlink.SCOPE_LINK}
+		if !tunInPod {
+			route = vethRoute(idx, def, routingMode)
+		}
+		if err := netlink.RouteReplace(route); err != nil {
+			return saved, fmt.Errorf("adding default route via %s: %w", podIfName, err)
+		}
+	}
+	return saved, nil
+}
+
+// isDefaultRoute reports whether r is a default route, which netlink lists
+// with either no Dst or a zero-length one.
+func isDefaultRoute(r *netlink.Route) bool {
+	if r.Dst == nil {
+		return true
+	}
+	ones, _ := r.Dst.Mask.Size()
+	return ones == 0
+}
+
+// primaryRoute records r, a default route in the pod's netns.
+func primaryRoute(r *netlink.Route) (PrimaryRoute, error) {
+	link, err := netlink.LinkByIndex(r.LinkIndex)
+	if err != nil {
+		return PrimaryRoute{}, fmt.Errorf("getting default route's interface: %w", err)
+	}
+	p := PrimaryRoute{
+		IPv6:   r.Family == netlink.FAMILY_V6,
+		Dev:    link.Attrs().Name,
+		Metric: r.Priority,
+		OnLink: r.Flags&int(netlink.FLAG_ONLINK) != 0,
+	}
+	if r.Gw != nil {
+		p.Gateway = r.Gw.String()
+	}
+	return p, nil
+}
+
+// restorePrimaryRoutes puts a full-tunnel pod's primary default routes back
+// in place of the ones via podIfName, if that still exists, and removes the
+// fullTunnelBypass routes. It returns errNetnsGone if the pod's netns is.
+func restorePrimaryRoutes(netnsPath, podIfName string, saved []PrimaryRoute) error {
+	if len(saved) == 0 {
+		return nil
+	}
+	podNS, err := getPodNS(netnsPath)
+	if err != nil {
+		return err
+	}
+	defer podNS.Close()
+
+	return podNS.Do(func(ns.NetNS) error {
+		var errs []error
+		for _, p := range saved {
+			link, err := netlink.LinkByName(p.Dev)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("getting %s: %w", p.Dev, err))
+				continue
+			}
+			def := netip.PrefixFrom(netip.IPv4Unspecified(), 0)
+			if p.IPv6 {
+				def = netip.PrefixFrom(netip.IPv6Unspecified(), 0)
+			}
+			route := &netlink.Route{
+				LinkIndex: link.Attrs().Index,
+				Dst:       prefixToIPNet(def),
+				Priority:  p.Metric,
+				Scope:     netlink.SCOPE_LINK,
+			}
+			if p.Gateway != "" {
+				route.Gw = net.ParseIP(p.Gateway)
+				route.Scope = netlink.SCOPE_UNIVERSE
+			}
+			if p.OnLink {
+				route.Flags = int(netlink.FLAG_ONLINK)
+			}
+			// Ours go with the interface, unless it's still there
+			if ours, err := netlink.LinkByName(podIfName); err == nil {
+				netlink.RouteDel(&netlink.Route{LinkIndex: ours.Attrs().Index, Dst: route.Dst})
+			}
+			if err := netlink.RouteAdd(route); err != nil && !errors.Is(err, unix.EEXIST) {
+				errs = append(errs, fmt.Errorf("restoring default route via %s: %w", p.Dev, err))
+				continue
+			}
+			for _, prefix := range fullTunnelBypass {
+				if prefix.Addr().Is6() == p.IPv6 {
+					netlink.RouteDel(&netlink.Route{LinkIndex: route.LinkIndex, Dst: prefixToIPNet(prefix), Gw: route.Gw})
+				}
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
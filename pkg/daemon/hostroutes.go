@@ -0,0 +1,180 @@
+//go:build linux
+
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Every veth pod has its own TUN, so the host can't route the tailnet's
+// ranges to one TUN in its main table: whichever pod's route was added first
+// would carry every pod's traffic, from the wrong node. Instead a pod's
+// traffic arriving on its host veth from its Tailscale IPs is matched by a
+// rule at podRulePriority and routed by a table of the pod's own, one of
+// podTables from podTableBase up (see PodManager.allocRouteTable), holding
+// its routes via that TUN.
+const (
+	podRulePriority = 5210
+	podTableBase    = 0x74530000
+	podTables       = 0x10000
+)
+
+// hostRouteTables lists the routing tables the host has rules or routes in;
+// a variable for tests.
+var hostRouteTables = listRouteTables
+
+// isPodTable reports whether table is in the range pods' tables come from.
+func isPodTable(table int) bool {
+	return table >= podTableBase && table < podTableBase+podTables
+}
+
+// listRouteTables returns the routing tables rules point at or routes are
+// in, in either family.
+func listRouteTables() (map[int]bool, error) {
+	tables := make(map[int]bool)
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := netlink.RuleList(family)
+		if err != nil {
+			return nil, fmt.Errorf("listing rules: %w", err)
+		}
+		for _, rule := range rules {
+			tables[rule.Table] = true
+		}
+	}
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: unix.RT_TABLE_UNSPEC}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("listing routes: %w", err)
+	}
+	for _, route := range routes {
+		tables[route.Table] = true
+	}
+	return tables, nil
+}
+
+// routePodViaTUN steers a veth pod's traffic for routes to its TUN, with
+// rules for its Tailscale IPs on its host veth and its routing table, table.
+// Rules the veth had for another table are replaced. IPv6 routes are
+// skipped if the node has no IPv6 address.
+func routePodViaTUN(nl netlinkOps, hostVethName, tunName string, table int, ipv4, ipv6 netip.Addr, routes []netip.Prefix) error {
+	tunLink, err := nl.LinkByName(tunName)
+	if err != nil {
+		return fmt.Errorf("getting TUN %s: %w", tunName, err)
+	}
+
+	for _, prefix := range routes {
+		if prefix.Addr().Is6() && !ipv6.IsValid() {
+			continue
+		}
+		// Earlier versions routed every pod's ranges via its TUN in the
+		// main table; a TUN preserved across the upgrade still has them
+		nl.RouteDel(&netlink.Route{LinkIndex: tunLink.Attrs().Index, Dst: prefixToIPNet(prefix)})
+	}
+	if err := addPodTableRoutes(nl, tunLink, table, ipv6, routes); err != nil {
+		return err
+	}
+
+	// Rules from before a restart may point at another table, as with
+	// versions that numbered tables by TUN; only flush that one
+	delPodRules(nl, hostVethName, table)
+	for _, rule := range podRules(hostVethName, table, ipv4, ipv6) {
+		if err := nl.RuleAdd(rule); err != nil {
+			return fmt.Errorf("adding rule from %s via %s: %w", rule.Src, hostVethName, err)
+		}
+	}
+	return nil
+}
+
+// podRules returns the rules sending a pod's traffic from its Tailscale IPs,
+// arriving on its host veth, to table.
+func podRules(hostVethName string, table int, ipv4, ipv6 netip.Addr) []*netlink.Rule {
+	var rules []*netlink.Rule
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		rule := netlink.NewRule()
+		rule.Family = netlink.FAMILY_V4
+		if ip.Is6() {
+			rule.Family = netlink.FAMILY_V6
+		}
+		rule.Priority = podRulePriority
+		rule.Table = table
+		rule.Src = prefixToIPNet(netip.PrefixFrom(ip, ip.BitLen()))
+		rule.IifName = hostVethName
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// isPodRule reports whether rule is one of podRules' for hostVethName.
+func isPodRule(rule netlink.Rule, hostVethName string) bool {
+	return rule.Priority == podRulePriority && rule.IifName == hostVethName && isPodTable(rule.Table)
+}
+
+// addPodTableRoutes routes prefixes via tunLink in its pod's table. IPv6
+// prefixes are skipped if the node has no IPv6 address.
+func addPodTableRoutes(nl netlinkOps, tunLink netlink.Link, table int, ipv6 netip.Addr, prefixes []netip.Prefix) error {
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is6() && !ipv6.IsValid() {
+			continue
+		}
+		route := &netlink.Route{
+			LinkIndex: tunLink.Attrs().Index,
+			Dst:       prefixToIPNet(prefix),
+			Scope:     netlink.SCOPE_LINK,
+			Table:     table,
+		}
+		if err := nl.RouteReplace(route); err != nil {
+			return fmt.Errorf("adding route %s via %s to table %d: %w", prefix, tunLink.Attrs().Name, table, err)
+		}
+	}
+	return nil
+}
+
+// delPodRules removes routePodViaTUN's rules for a host veth, which
+// outlive the veth otherwise, matching nothing, and flushes the tables they
+// pointed at other than keep (0 for none). The kernel empties a table when
+// its TUN is deleted, but the TUN may outlive the veth, as when it was
+// preserved for a daemon restart, and a table must be empty before it is
+// given to another pod.
+func delPodRules(nl netlinkOps, hostVethName string, keep int) {
+	flushed := make(map[int]bool)
+	for _, family := range []int{netlink.FAMILY_V4, netlink.FAMILY_V6} {
+		rules, err := nl.RuleList(family)
+		if err != nil {
+			log.Printf("Warning: failed to list rules: %v", err)
+			continue
+		}
+		for _, rule := range rules {
+			if !isPodRule(rule, hostVethName) {
+				continue
+			}
+			if err := nl.RuleDel(&rule); err != nil {
+				log.Printf("Warning: failed to delete rule for %s: %v", hostVethName, err)
+			}
+			if rule.Table != keep && !flushed[rule.Table] {
+				flushed[rule.Table] = true
+				flushPodTable(nl, rule.Table)
+			}
+		}
+	}
+}
+
+// flushPodTable deletes every route in a pod's table.
+func flushPodTable(nl netlinkOps, table int) {
+	routes, err := nl.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		log.Printf("Warning: failed to list routes in table %d: %v", table, err)
+		return
+	}
+	for _, route := range routes {
+		if err := nl.RouteDel(&route); err != nil {
+			log.Printf("Warning: failed to delete route %s from table %d: %v", route.Dst, table, err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestIsPodTable(t *testing.T) {
+	tests := []struct {
+		table int
+		want  bool
+	}{
+		{254, false}, // main
+		{podTableBase - 1, false},
+		{podTableBase, true},
+		{podTableBase + podTables - 1, true},
+		{podTableBase + podTables, false},
+	}
+	for _, tt := range tests {
+		if got := isPodTable(tt.table); got != tt.want {
+			t.Errorf("isPodTable(%#x) = %v, want %v", tt.table, got, tt.want)
+		}
+	}
+}
+
+func TestPodRules(t *testing.T) {
+	ipv4 := netip.MustParseAddr("100.80.0.10")
+	ipv6 := netip.MustParseAddr("fd7a:115c:a1e0::a")
+
+	rules := podRules("veth1234", podTableBase+7, ipv4, ipv6)
+	if len(rules) != 2 {
+		t.Fatalf("podRules() returned %d rules, want one per address", len(rules))
+	}
+	for i, want := range []struct {
+		family int
+		src    string
+	}{{netlink.FAMILY_V4, "100.80.0.10/32"}, {netlink.FAMILY_V6, "fd7a:115c:a1e0::a/128"}} {
+		r := rules[i]
+		if r.Family != want.family || r.Src.String() != want.src || r.IifName != "veth1234" || r.Table != podTableBase+7 || r.Priority != podRulePriority {
+			t.Errorf("rule %d = family %d from %s iif %s table %#x priority %d; want family %d from %s iif veth1234 table %#x priority %d",
+				i, r.Family, r.Src, r.IifName, r.Table, r.Priority, want.family, want.src, podTableBase+7, podRulePriority)
+		}
+	}
+
+	if rules := podRules("veth1234", podTableBase+7, ipv4, netip.Addr{}); len(rules) != 1 {
+		t.Errorf("podRules() without IPv6 returned %d rules, want 1", len(rules))
+	}
+}
+
+func TestIsPodRule(t *testing.T) {
+	ours := *podRules("veth1234", podTableBase+7, netip.MustParseAddr("100.80.0.10"), netip.Addr{})[0]
+
+	other := ours
+	other.IifName = "veth5678"
+	otherPriority := ours
+	otherPriority.Priority = podRulePriority + 1
+	foreignTable := ours
+	foreignTable.Table = 100
+
+	tests := []struct {
+		name string
+		rule netlink.Rule
+		want bool
+	}{
+		{"ours", ours, true},
+		{"another pod's", other, false},
+		{"other priority", otherPriority, false},
+		{"someone else's table", foreignTable, false},
+	}
+	for _, tt := range tests {
+		if got := isPodRule(tt.rule, "veth1234"); got != tt.want {
+			t.Errorf("isPodRule(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Annotations written back onto pods with their Tailscale identity.
+const (
+	AnnotationAssignedIPv4     = "tailscale.com/assigned-ipv4"
+	AnnotationAssignedIPv6     = "tailscale.com/assigned-ipv6"
+	AnnotationAssignedHostname = "tailscale.com/assigned-hostname"
+	AnnotationAssignedFQDN     = "tailscale.com/assigned-fqdn"
+)
+
+// annotateRetryDelay is how long to wait before retrying a failed patch.
+const annotateRetryDelay = time.Second
+
+// PodAnnotator writes a pod's Tailscale IPs and hostname onto the Pod object,
+// so other controllers can find them through the API. A nil PodAnnotator,
+// or one without a Kubernetes client, does nothing.
+type PodAnnotator struct {
+	kube *KubeClient
+}
+
+// NewPodAnnotator returns a PodAnnotator using kube.
+func NewPodAnnotator(kube *KubeClient) *PodAnnotator {
+	return &PodAnnotator{kube: kube}
+}
+
+// Annotate records a pod's Tailscale identity. ipv6 and fqdn may be empty,
+// which removes a stale annotation.
+func (a *PodAnnotator) Annotate(pod podRef, ipv4, ipv6, hostname, fqdn string) {
+	a.patch(pod, assignedIPAnnotations(ipv4, ipv6, hostname, fqdn))
+}
+
+// Clear removes the annotations written by Annotate. The pod is usually
+// gone by the time this runs, which is fine.
+func (a *PodAnnotator) Clear(pod podRef) {
+	a.patch(pod, assignedIPAnnotations("", "", "", ""))
+}
+
+// assignedIPAnnotations returns the annotations for a merge patch. Empty
+// values become nil, which deletes the annotation.
+func assignedIPAnnotations(ipv4, ipv6, hostname, fqdn string) map[string]*string {
+	value := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return &s
+	}
+	return map[string]*string{
+		AnnotationAssignedIPv4:     value(ipv4),
+		AnnotationAssignedIPv6:     value(ipv6),
+		AnnotationAssignedHostname: value(hostname),
+		AnnotationAssignedFQDN:     value(fqdn),
+	}
+}
+
+// patch applies annotations in the background, retrying once, so CNI
+// requests aren't held up by the API server.
+func (a *PodAnnotator) patch(pod podRef, annotations map[string]*string) {
+	if a == nil || a.kube == nil || pod.Name == "" || pod.Namespace == "" {
+		return
+	}
+	go func() {
+		err := a.patchOnce(pod, annotations)
+		if err != nil && !isKubeNotFound(err) {
+			time.Sleep(annotateRetryDelay)
+			err = a.patchOnce(pod, annotations)
+		}
+		if err != nil && !isKubeNotFound(err) {
+			log.Printf("Warning: failed to annotate pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}()
+}
+
+func (a *PodAnnotator) patchOnce(pod podRef, annotations map[string]*string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+	return a.kube.PatchPodAnnotations(ctx, pod.Namespace, pod.Name, pod.UID, annotations)
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPatchPodAnnotations(t *testing.T) {
+	var got map[string]map[string]any
+	var gotMethod, gotPath, gotContentType string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotContentType = r.Method, r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kube := &KubeClient{baseURL: srv.URL, tokenPath: tokenPath, httpClient: srv.Client()}
+
+	annotations := assignedIPAnnotations("100.64.0.1", "", "prod-default-web-0", "prod-default-web-0.tailnet-1234.ts.net")
+	if err := kube.PatchPodAnnotations(context.Background(), "default", "web-0", "uid-1", annotations); err != nil {
+		t.Fatalf("PatchPodAnnotations() error = %v", err)
+	}
+
+	if gotMethod != http.MethodPatch || gotPath != "/api/v1/namespaces/default/pods/web-0" {
+		t.Errorf("request = %s %s, want PATCH of the pod", gotMethod, gotPath)
+	}
+	if gotContentType != "application/merge-patch+json" {
+		t.Errorf("Content-Type = %q, want merge patch", gotContentType)
+	}
+	if got["metadata"]["uid"] != "uid-1" {
+		t.Errorf("uid precondition = %v, want %q", got["metadata"]["uid"], "uid-1")
+	}
+	want := map[string]any{
+		AnnotationAssignedIPv4:     "100.64.0.1",
+		AnnotationAssignedIPv6:     nil, // removed
+		AnnotationAssignedHostname: "prod-default-web-0",
+		AnnotationAssignedFQDN:     "prod-default-web-0.tailnet-1234.ts.net",
+	}
+	gotAnnotations, _ := got["metadata"]["annotations"].(map[string]any)
+	for k, v := range want {
+		if gv, ok := gotAnnotations[k]; !ok || gv != v {
+			t.Errorf("annotation %s = %v (present %v), want %v", k, gv, ok, v)
+		}
+	}
+}
+
+func TestPodAnnotator_NilIsNoOp(t *testing.T) {
+	var a *PodAnnotator
+	a.Annotate(podRef{Name: "web-0", Namespace: "default"}, "100.64.0.1", "", "web", "")
+	NewPodAnnotator(nil).Clear(podRef{Name: "web-0", Namespace: "default"})
+}
@@ -0,0 +1,97 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+// keyExpiryWatchInterval is how often RunKeyExpiryWatch checks nodes, and
+// keyExpiryRequestTimeout bounds each API request it makes.
+const (
+	keyExpiryWatchInterval  = 5 * time.Minute
+	keyExpiryRequestTimeout = 30 * time.Second
+)
+
+// keyExpiry returns when a node's key expires. ok is false if it doesn't,
+// as for tagged nodes and nodes whose key expiry is disabled, or if the
+// node has no netmap yet.
+func keyExpiry(status *ipnstate.Status) (expiry time.Time, ok bool) {
+	if status.Self == nil || status.Self.KeyExpiry == nil || status.Self.KeyExpiry.IsZero() {
+		return time.Time{}, false
+	}
+	return *status.Self.KeyExpiry, true
+}
+
+// KeyExpiry returns keyExpiry for the node.
+func (m *ManagedServer) KeyExpiry() (time.Time, bool) {
+	return keyExpiry(m.Backend.StatusWithoutPeers())
+}
+
+// RunKeyExpiryWatch disables key expiry for nodes whose key expires within
+// KeyRenewBefore, checking every keyExpiryWatchInterval until ctx is done.
+// A node whose key expires drops off the tailnet until it re-authenticates,
+// which a pod's node can't do by itself: its auth key was single-use. It
+// does nothing if KeyRenewBefore is 0.
+func (pm *PodManager) RunKeyExpiryWatch(ctx context.Context) {
+	if pm.renewBefore == 0 {
+		return
+	}
+	ticker := time.NewTicker(keyExpiryWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.renewExpiringKeys(ctx)
+		}
+	}
+}
+
+// renewExpiringKeys disables key expiry, one node at a time, for every node
+// whose key expires within pm.renewBefore. Control then sends the node a
+// netmap without an expiry, so it isn't renewed again.
+func (pm *PodManager) renewExpiringKeys(ctx context.Context) {
+	pm.mu.RLock()
+	servers := make([]*ManagedServer, 0, len(pm.servers))
+	for _, srv := range pm.servers {
+		servers = append(servers, srv)
+	}
+	pm.mu.RUnlock()
+
+	now := time.Now()
+	var expiring []*ManagedServer
+	for _, srv := range servers {
+		if expiry, ok := srv.KeyExpiry(); ok && expiry.Sub(now) < pm.renewBefore {
+			log.Printf("Node key of pod %s/%s expires at %s, disabling its key expiry",
+				srv.Namespace, srv.PodName, expiry.Format(time.RFC3339))
+			expiring = append(expiring, srv)
+		}
+	}
+	metricNodesKeyExpiring.Set(int64(len(expiring)))
+
+	for _, srv := range expiring {
+		if ctx.Err() != nil {
+			return
+		}
+		if srv.DeviceID == "" {
+			metricKeyExpiryRenewFailed.Add(1)
+			log.Printf("Warning: can't disable key expiry of pod %s/%s: its device ID is unknown", srv.Namespace, srv.PodName)
+			continue
+		}
+		reqCtx, cancel := context.WithTimeout(ctx, keyExpiryRequestTimeout)
+		err := pm.oauthMgr.DisableKeyExpiry(reqCtx, srv.DeviceID)
+		cancel()
+		if err != nil {
+			metricKeyExpiryRenewFailed.Add(1)
+			log.Printf("Warning: failed to disable key expiry of pod %s/%s: %v", srv.Namespace, srv.PodName, err)
+			continue
+		}
+		metricKeyExpiryRenewals.Add(1)
+	}
+}
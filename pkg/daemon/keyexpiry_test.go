@@ -0,0 +1,41 @@
+//go:build linux
+
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"tailscale.com/ipn/ipnstate"
+)
+
+func TestKeyExpiry(t *testing.T) {
+	expiry := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name   string
+		status *ipnstate.Status
+		want   time.Time
+		wantOK bool
+	}{
+		{"no netmap", &ipnstate.Status{}, time.Time{}, false},
+		{"doesn't expire", &ipnstate.Status{Self: &ipnstate.PeerStatus{}}, time.Time{}, false},
+		{"zero expiry", &ipnstate.Status{Self: &ipnstate.PeerStatus{KeyExpiry: new(time.Time)}}, time.Time{}, false},
+		{"expires", &ipnstate.Status{Self: &ipnstate.PeerStatus{KeyExpiry: &expiry}}, expiry, true},
+	}
+	for _, tt := range tests {
+		got, ok := keyExpiry(tt.status)
+		if !got.Equal(tt.want) || ok != tt.wantOK {
+			t.Errorf("keyExpiry(%s) = %v, %v; want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestNewPodManager_KeyRenewBefore(t *testing.T) {
+	if _, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir(), KeyRenewBefore: -time.Hour}, nil); err == nil {
+		t.Errorf("NewPodManager() with a negative KeyRenewBefore succeeded")
+	}
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir(), KeyRenewBefore: 24 * time.Hour}, nil)
+	if err != nil || pm.renewBefore != 24*time.Hour {
+		t.Errorf("NewPodManager() = %v; want renewBefore 24h", err)
+	}
+}
@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// KeyProfile is a named set of auth key capabilities. Pods without a
+// profile get a preauthorized, non-ephemeral key with the daemon's TTL.
+type KeyProfile struct {
+	// Ephemeral makes the pod's node ephemeral: the tailnet removes it
+	// once it has been offline for a while, even without a DEL.
+	Ephemeral bool `json:"ephemeral"`
+
+	// Preauthorized skips device approval. Defaults to true; without it
+	// the node waits, and ADD with it, until an admin approves the device.
+	Preauthorized *bool `json:"preauthorized"`
+
+	// Tags are the key's tags for pods without AnnotationTags, in place of
+	// their namespace's or the daemon's tags.
+	Tags []string `json:"tags"`
+
+	// Expiry is how long the key is valid, as a Go duration. Defaults to
+	// the daemon's auth key TTL.
+	Expiry string `json:"expiry"`
+
+	expiry time.Duration
+}
+
+// preauthorized returns p.Preauthorized, defaulting to true.
+func (p *KeyProfile) preauthorized() bool {
+	return p.Preauthorized == nil || *p.Preauthorized
+}
+
+// LoadKeyProfiles reads key profiles from a JSON file mapping profile name
+// to KeyProfile, e.g.
+//
+//	{"batch": {"ephemeral": true, "expiry": "10m"}, "reviewed": {"preauthorized": false}}
+func LoadKeyProfiles(path string) (map[string]*KeyProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key profiles: %w", err)
+	}
+	return parseKeyProfiles(data)
+}
+
+// parseKeyProfiles decodes and validates JSON key profiles.
+func parseKeyProfiles(data []byte) (map[string]*KeyProfile, error) {
+	var profiles map[string]*KeyProfile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("parsing key profiles: %w", err)
+	}
+	for name, p := range profiles {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("key profile with an empty name")
+		}
+		if p == nil {
+			return nil, fmt.Errorf("key profile %q is null", name)
+		}
+		for _, tag := range p.Tags {
+			if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+				return nil, fmt.Errorf("key profile %q: %q is not a tag", name, tag)
+			}
+		}
+		if p.Expiry != "" {
+			d, err := time.ParseDuration(p.Expiry)
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("key profile %q: expiry %q is not a positive duration", name, p.Expiry)
+			}
+			p.expiry = d
+		}
+	}
+	return profiles, nil
+}
+
+// withKeyProfile looks up the pod's key profile, if it names one, and uses
+// its tags if the pod's annotations set none.
+func (c PodConfig) withKeyProfile(profiles map[string]*KeyProfile) (PodConfig, error) {
+	if c.KeyProfile == "" {
+		return c, nil
+	}
+	p, ok := profiles[c.KeyProfile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return PodConfig{}, fmt.Errorf("annotation %s: unknown key profile %q (have %v)", AnnotationKeyProfile, c.KeyProfile, names)
+	}
+	c.keyProfile = p
+	if len(c.Tags) == 0 {
+		c.Tags = p.Tags
+	}
+	return c, nil
+}
@@ -0,0 +1,107 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseKeyProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"valid", `{"batch": {"ephemeral": true, "expiry": "10m"}, "reviewed": {"preauthorized": false, "tags": ["tag:db"]}}`, ""},
+		{"empty", `{}`, ""},
+		{"unknown field", `{"batch": {"reusable": true}}`, "unknown field"},
+		{"bad tag", `{"batch": {"tags": ["db"]}}`, `"db" is not a tag`},
+		{"bad expiry", `{"batch": {"expiry": "soon"}}`, "not a positive duration"},
+		{"negative expiry", `{"batch": {"expiry": "-1m"}}`, "not a positive duration"},
+		{"null profile", `{"batch": null}`, "is null"},
+		{"empty name", `{" ": {}}`, "empty name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseKeyProfiles([]byte(tt.json))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseKeyProfiles() error = %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseKeyProfiles() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithKeyProfile(t *testing.T) {
+	profiles, err := parseKeyProfiles([]byte(`{"batch": {"ephemeral": true, "tags": ["tag:batch"]}, "plain": {}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := PodConfig{KeyProfile: "batch"}.withKeyProfile(profiles)
+	if err != nil {
+		t.Fatalf("withKeyProfile(batch) error = %v", err)
+	}
+	if cfg.keyProfile != profiles["batch"] || !reflect.DeepEqual(cfg.Tags, []string{"tag:batch"}) {
+		t.Errorf("withKeyProfile(batch) = %+v, want the batch profile and its tags", cfg)
+	}
+
+	// The pod's own tags win over the profile's
+	cfg, err = PodConfig{KeyProfile: "batch", Tags: []string{"tag:web"}}.withKeyProfile(profiles)
+	if err != nil || !reflect.DeepEqual(cfg.Tags, []string{"tag:web"}) {
+		t.Errorf("withKeyProfile(batch) with tags = %v, %v, want [tag:web]", cfg.Tags, err)
+	}
+
+	_, err = PodConfig{KeyProfile: "nightly"}.withKeyProfile(profiles)
+	if err == nil || !strings.Contains(err.Error(), `unknown key profile "nightly" (have [batch plain])`) {
+		t.Errorf("withKeyProfile(nightly) error = %v, want unknown key profile listing the known ones", err)
+	}
+}
+
+func TestCreateAuthKey_Profile(t *testing.T) {
+	var got authKeyRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/oauth/token":
+			json.NewEncoder(w).Encode(tokenResponse{AccessToken: "token", ExpiresIn: 3600})
+		case "/api/v2/tailnet/-/keys":
+			json.NewDecoder(r.Body).Decode(&got)
+			json.NewEncoder(w).Encode(authKeyResponse{ID: "k1", Key: "tskey-auth-k1"})
+		}
+	}))
+	defer srv.Close()
+
+	mgr := NewOAuthManager("client-id", "client-secret", []string{"tag:test"}, 5*time.Minute)
+	mgr.baseURL = srv.URL
+
+	no := false
+	tests := []struct {
+		name    string
+		profile *KeyProfile
+		want    authKeyCreate
+		wantTTL int
+	}{
+		{"default", nil, authKeyCreate{Preauthorized: true, Tags: []string{"tag:test"}}, 300},
+		{"ephemeral", &KeyProfile{Ephemeral: true, expiry: 10 * time.Minute}, authKeyCreate{Ephemeral: true, Preauthorized: true, Tags: []string{"tag:test"}}, 600},
+		{"needs approval", &KeyProfile{Preauthorized: &no}, authKeyCreate{Tags: []string{"tag:test"}}, 300},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = authKeyRequest{}
+			if _, err := mgr.createAuthKey(context.Background(), "test", []string{"tag:test"}, tt.profile); err != nil {
+				t.Fatalf("createAuthKey() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Capabilities.Devices.Create, tt.want) || got.ExpirySeconds != tt.wantTTL {
+				t.Errorf("request = %+v, expiry %d; want %+v, expiry %d", got.Capabilities.Devices.Create, got.ExpirySeconds, tt.want, tt.wantTTL)
+			}
+		})
+	}
+}
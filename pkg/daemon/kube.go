@@ -0,0 +1,313 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account credentials.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// kubeRequestTimeout bounds each API call the daemon makes on a pod's behalf.
+const kubeRequestTimeout = 10 * time.Second
+
+// InClusterNamespace returns the namespace the daemon's pod runs in, from
+// its service account.
+func InClusterNamespace() (string, error) {
+	data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return "", fmt.Errorf("reading service account namespace: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// KubeClient is a minimal Kubernetes API client using the daemon's in-cluster
+// service account. It only implements the handful of calls the daemon needs.
+type KubeClient struct {
+	baseURL    string
+	tokenPath  string
+	httpClient *http.Client
+}
+
+// kubeObjectMeta is the subset of Kubernetes ObjectMeta used by the daemon.
+type kubeObjectMeta struct {
+	Name            string            `json:"name,omitempty"`
+	GenerateName    string            `json:"generateName,omitempty"`
+	Namespace       string            `json:"namespace,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+}
+
+// kubeSecret is a Kubernetes Secret.
+type kubeSecret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   kubeObjectMeta    `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+// kubePod is the subset of a Kubernetes Pod used by the daemon.
+type kubePod struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+}
+
+// kubeService is the subset of a Kubernetes Service used by the daemon.
+type kubeService struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Spec     struct {
+		Selector   map[string]string `json:"selector,omitempty"`
+		ClusterIP  string            `json:"clusterIP,omitempty"`
+		ClusterIPs []string          `json:"clusterIPs,omitempty"`
+	} `json:"spec"`
+}
+
+// kubeConfigMap is a Kubernetes ConfigMap.
+type kubeConfigMap struct {
+	Metadata kubeObjectMeta    `json:"metadata"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+// kubeObjectReference identifies the object an Event is about.
+type kubeObjectReference struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Name       string `json:"name,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	UID        string `json:"uid,omitempty"`
+}
+
+// kubeEventSource identifies the component that reported an Event.
+type kubeEventSource struct {
+	Component string `json:"component,omitempty"`
+	Host      string `json:"host,omitempty"`
+}
+
+// kubeEvent is a core/v1 Event.
+type kubeEvent struct {
+	APIVersion          string              `json:"apiVersion"`
+	Kind                string              `json:"kind"`
+	Metadata            kubeObjectMeta      `json:"metadata"`
+	InvolvedObject      kubeObjectReference `json:"involvedObject"`
+	Reason              string              `json:"reason"`
+	Message             string              `json:"message"`
+	Type                string              `json:"type"`
+	Source              kubeEventSource     `json:"source"`
+	FirstTimestamp      time.Time           `json:"firstTimestamp"`
+	LastTimestamp       time.Time           `json:"lastTimestamp"`
+	Count               int32               `json:"count"`
+	ReportingController string              `json:"reportingComponent,omitempty"`
+	ReportingInstance   string              `json:"reportingInstance,omitempty"`
+}
+
+// kubeAPIError is returned for non-2xx responses from the API server.
+type kubeAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *kubeAPIError) Error() string {
+	return fmt.Sprintf("kubernetes API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// isKubeNotFound reports whether err is a 404 from the API server.
+func isKubeNotFound(err error) bool {
+	var apiErr *kubeAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewInClusterKubeClient creates a client from the in-cluster service account.
+// Returns an error if the daemon is not running inside a Kubernetes pod.
+func NewInClusterKubeClient() (*KubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST/PORT unset)")
+	}
+
+	caCert, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("parsing service account CA")
+	}
+
+	tokenPath := filepath.Join(serviceAccountDir, "token")
+	if _, err := os.Stat(tokenPath); err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+
+	return &KubeClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		tokenPath: tokenPath,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+// do performs an API request, JSON-encoding in and decoding the response into out.
+// Either may be nil.
+func (c *KubeClient) do(ctx context.Context, method, path, contentType string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("marshaling request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	// Re-read the token on every request: projected service account tokens rotate.
+	token, err := os.ReadFile(c.tokenPath)
+	if err != nil {
+		return fmt.Errorf("reading service account token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+string(bytes.TrimSpace(token)))
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &kubeAPIError{StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decoding response: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetPod fetches a Pod. Use isKubeNotFound to detect a missing Pod.
+func (c *KubeClient) GetPod(ctx context.Context, namespace, name string) (*kubePod, error) {
+	var p kubePod
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(namespace), url.PathEscape(name))
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// ListServices lists the Services in a namespace.
+func (c *KubeClient) ListServices(ctx context.Context, namespace string) ([]kubeService, error) {
+	var list struct {
+		Items []kubeService `json:"items"`
+	}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/services", url.PathEscape(namespace))
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// GetConfigMap fetches a ConfigMap. Use isKubeNotFound to detect a missing ConfigMap.
+func (c *KubeClient) GetConfigMap(ctx context.Context, namespace, name string) (*kubeConfigMap, error) {
+	var cm kubeConfigMap
+	path := fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", url.PathEscape(namespace), url.PathEscape(name))
+	if err := c.do(ctx, http.MethodGet, path, "", nil, &cm); err != nil {
+		return nil, err
+	}
+	return &cm, nil
+}
+
+// PatchPodAnnotations merge-patches a Pod's annotations; a nil value removes
+// the annotation. If uid is set the patch only applies to that instance of
+// the Pod, not a later one with the same name.
+func (c *KubeClient) PatchPodAnnotations(ctx context.Context, namespace, name, uid string, annotations map[string]*string) error {
+	meta := map[string]any{"annotations": annotations}
+	if uid != "" {
+		meta["uid"] = uid
+	}
+	patch := map[string]any{"metadata": meta}
+	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", url.PathEscape(namespace), url.PathEscape(name))
+	return c.do(ctx, http.MethodPatch, path, "application/merge-patch+json", patch, nil)
+}
+
+func secretPath(namespace, name string) string {
+	p := fmt.Sprintf("/api/v1/namespaces/%s/secrets", url.PathEscape(namespace))
+	if name != "" {
+		p += "/" + url.PathEscape(name)
+	}
+	return p
+}
+
+// GetSecret fetches a Secret. Use isKubeNotFound to detect a missing Secret.
+func (c *KubeClient) GetSecret(ctx context.Context, namespace, name string) (*kubeSecret, error) {
+	var s kubeSecret
+	if err := c.do(ctx, http.MethodGet, secretPath(namespace, name), "", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CreateSecret creates a Secret in the given namespace.
+func (c *KubeClient) CreateSecret(ctx context.Context, s *kubeSecret) error {
+	s.APIVersion, s.Kind = "v1", "Secret"
+	return c.do(ctx, http.MethodPost, secretPath(s.Metadata.Namespace, ""), "", s, s)
+}
+
+// UpdateSecret replaces an existing Secret. The ResourceVersion from a prior
+// Get must be set so concurrent writers are detected.
+func (c *KubeClient) UpdateSecret(ctx context.Context, s *kubeSecret) error {
+	s.APIVersion, s.Kind = "v1", "Secret"
+	return c.do(ctx, http.MethodPut, secretPath(s.Metadata.Namespace, s.Metadata.Name), "", s, s)
+}
+
+// DeleteSecret deletes a Secret. Deleting a missing Secret is not an error.
+// If resourceVersion is set, the Secret is only deleted if it hasn't changed
+// since then; otherwise the API server returns a conflict.
+func (c *KubeClient) DeleteSecret(ctx context.Context, namespace, name, resourceVersion string) error {
+	var opts any
+	if resourceVersion != "" {
+		opts = map[string]any{"preconditions": map[string]string{"resourceVersion": resourceVersion}}
+	}
+	err := c.do(ctx, http.MethodDelete, secretPath(namespace, name), "", opts, nil)
+	if isKubeNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// CreateEvent records an Event in the given Event's namespace.
+func (c *KubeClient) CreateEvent(ctx context.Context, e *kubeEvent) error {
+	e.APIVersion, e.Kind = "v1", "Event"
+	path := fmt.Sprintf("/api/v1/namespaces/%s/events", url.PathEscape(e.Metadata.Namespace))
+	return c.do(ctx, http.MethodPost, path, "", e, nil)
+}
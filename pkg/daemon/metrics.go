@@ -0,0 +1,256 @@
+package daemon
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"tailscale.com/metrics"
+	"tailscale.com/tsweb/varz"
+	"tailscale.com/util/usermetric"
+)
+
+// metricsRegistry holds the daemon's own metrics. It is kept separate from the
+// global expvar registry, which tailscale.com internals also publish into.
+var metricsRegistry = new(expvar.Map).Init()
+
+// The "counter_"/"gauge_"/"histogram_" prefixes tell varz the Prometheus type; they are
+// stripped from the exported name.
+
+func newCounter(name string) *expvar.Int {
+	v := new(expvar.Int)
+	metricsRegistry.Set("counter_"+name, v)
+	return v
+}
+
+func newGauge(name string) *expvar.Int {
+	v := new(expvar.Int)
+	metricsRegistry.Set("gauge_"+name, v)
+	return v
+}
+
+func newGaugeFunc(name string, f func() any) {
+	metricsRegistry.Set("gauge_"+name, expvar.Func(f))
+}
+
+func newHistogram(name string, buckets []float64) *metrics.Histogram {
+	h := metrics.NewHistogram(buckets)
+	metricsRegistry.Set("histogram_"+name, h)
+	return h
+}
+
+func newLabeledCounter[T comparable](name string) *metrics.MultiLabelMap[T] {
+	m := &metrics.MultiLabelMap[T]{Type: "counter"}
+	metricsRegistry.Set("counter_"+name, m)
+	return m
+}
+
+// podLabels labels per-pod metrics.
+type podLabels struct {
+	Namespace string `prom:"namespace"`
+	Pod       string `prom:"pod"`
+}
+
+// Auth key rate limiting metrics. A request waited if it found every request
+// slot busy or had to wait out the minimum interval. The spacing is the
+// time between the starts of consecutive requests, minimum interval plus
+// jitter, for requests the interval held back.
+var (
+	metricAuthKeyWaitSeconds    = newHistogram("tscni_authkey_wait_seconds", []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30})
+	metricAuthKeySpacingSeconds = newHistogram("tscni_authkey_spacing_seconds", []float64{0.05, 0.1, 0.15, 0.2, 0.3, 0.5, 1, 2.5, 5})
+	metricAuthKeyInflight       = newGauge("tscni_authkey_inflight")
+	metricAuthKeyWaited         = newCounter("tscni_authkey_requests_waited_total")
+	metricAuthKeyImmediate      = newCounter("tscni_authkey_requests_immediate_total")
+)
+
+// authKeyFailureLabels labels auth key creation failures. Reason is one of
+// the authKeyFailureReason values.
+type authKeyFailureLabels struct {
+	Namespace string `prom:"namespace"`
+	Reason    string `prom:"reason"`
+}
+
+// metricAuthKeyFailures counts failed CreateAuthKey calls by the pod's
+// namespace and why they failed.
+var metricAuthKeyFailures = newLabeledCounter[authKeyFailureLabels]("tscni_authkey_failures_total")
+
+// Device deletion queue metrics.
+var (
+	metricDeviceDeleteQueueDepth = newGauge("tscni_device_delete_queue_depth")
+	metricDeviceDeletes          = newCounter("tscni_device_deletes_total")
+	metricDeviceDeleteFailures   = newCounter("tscni_device_delete_failures_total")
+)
+
+// Node path metrics, sampled by PodManager.RunPathMetrics. Nodes without
+// recently active peers are in neither gauge.
+var (
+	metricNodesDirect   = newGauge("tscni_nodes_direct")
+	metricNodesDERPOnly = newGauge("tscni_nodes_derp_only")
+)
+
+// Handshake watch metrics, updated by PodManager.RunHandshakeWatch. A node
+// is stale if it has active peers but hasn't completed a WireGuard
+// handshake with any of them within the configured timeout.
+var (
+	metricNodesHandshakeStale = newGauge("tscni_nodes_handshake_stale")
+	metricStaleReattaches     = newCounter("tscni_stale_reattaches_total")
+)
+
+// Key expiry metrics, updated by PodManager.RunKeyExpiryWatch. A node is
+// expiring if its node key expires within the renewal window, or already
+// has.
+var (
+	metricNodesKeyExpiring     = newGauge("tscni_nodes_key_expiring")
+	metricKeyExpiryRenewals    = newCounter("tscni_key_expiry_renewals_total")
+	metricKeyExpiryRenewFailed = newCounter("tscni_key_expiry_renewal_failures_total")
+)
+
+// Warm pool metrics. A miss is an ADD that could have used a pooled node
+// but found the pool empty; pods that can't use one count as neither.
+var (
+	metricWarmPoolReady  = newGauge("tscni_warm_pool_ready")
+	metricWarmPoolHits   = newCounter("tscni_warm_pool_hits_total")
+	metricWarmPoolMisses = newCounter("tscni_warm_pool_misses_total")
+)
+
+// Pod state directory metrics, updated by PodManager.RunStateSweep. The
+// directories and bytes are of the state left after the sweep.
+var (
+	metricStatePodDirs     = newGauge("tscni_state_pod_dirs")
+	metricStateDirBytes    = newGauge("tscni_state_dir_bytes")
+	metricStateDirsRemoved = newCounter("tscni_state_dirs_removed_total")
+)
+
+// Attach latency breakdown of pods given a new node, as logged for each
+// attach: minting the auth key, from starting the node until control has
+// it running, and from then until it has an IPv4 address.
+var (
+	metricAttachAuthKeySeconds = newHistogram("tscni_attach_authkey_seconds", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60})
+	metricAttachRunningSeconds = newHistogram("tscni_attach_running_seconds", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60})
+	metricAttachIPSeconds      = newHistogram("tscni_attach_ip_seconds", []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60})
+)
+
+// metricNodesNeedApproval counts nodes that failed to come up because
+// control held them for an admin's approval.
+var metricNodesNeedApproval = newCounter("tscni_node_needs_approval_total")
+
+// metricHostnamesRenamed counts pods whose node control named other than
+// the hostname it asked for, because another device already had it.
+var metricHostnamesRenamed = newCounter("tscni_hostname_renamed_total")
+
+// metricPodIPChanges counts pods whose node came back with a different
+// Tailscale IPv4 address when recovered or reattached.
+var metricPodIPChanges = newCounter("tscni_pod_ip_changes_total")
+
+// Pod event watchers, subscribed with the Watch RPC. A watcher is dropped
+// if it falls too far behind.
+var (
+	metricPodWatchers        = newGauge("tscni_pod_watchers")
+	metricPodWatchersDropped = newCounter("tscni_pod_watchers_dropped_total")
+)
+
+// metricManagedPods is the number of pods with a running Tailscale node.
+var metricManagedPods = newGauge("tscni_managed_pods")
+
+// Per-pod WireGuard traffic, sampled by PodManager.RunTrafficMetrics when
+// enabled. Each pod adds a series to each, so they are off by default.
+var (
+	metricPodTxBytes   = newLabeledCounter[podLabels]("tscni_pod_tx_bytes")
+	metricPodRxBytes   = newLabeledCounter[podLabels]("tscni_pod_rx_bytes")
+	metricPodTxPackets = newLabeledCounter[podLabels]("tscni_pod_tx_packets")
+	metricPodRxPackets = newLabeledCounter[podLabels]("tscni_pod_rx_packets")
+)
+
+// podTraffic is what a pod's node has sent to and received from its peers
+// over WireGuard, over all paths (direct, DERP and peer relay).
+type podTraffic struct {
+	TxBytes, RxBytes     int64
+	TxPackets, RxPackets int64
+}
+
+// readPodTraffic reads a node's traffic from its user metrics. The
+// registry can only be read in Prometheus text form.
+func readPodTraffic(reg *usermetric.Registry) podTraffic {
+	rec := httptest.NewRecorder()
+	reg.Handler(rec, nil)
+	return parsePodTraffic(rec.Body.String())
+}
+
+// parsePodTraffic sums the magicsock traffic counters in Prometheus text.
+func parsePodTraffic(text string) podTraffic {
+	var t podTraffic
+	for line := range strings.Lines(text) {
+		f := strings.Fields(line)
+		if len(f) != 2 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(f[0], "{")
+		v, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "tailscaled_outbound_bytes_total":
+			t.TxBytes += v
+		case "tailscaled_inbound_bytes_total":
+			t.RxBytes += v
+		case "tailscaled_outbound_packets_total":
+			t.TxPackets += v
+		case "tailscaled_inbound_packets_total":
+			t.RxPackets += v
+		}
+	}
+	return t
+}
+
+// setPodTrafficMetrics sets the per-pod traffic metrics to traffic,
+// removing the series of pods not in it.
+func setPodTrafficMetrics(traffic map[podLabels]podTraffic) {
+	for _, m := range []*metrics.MultiLabelMap[podLabels]{metricPodTxBytes, metricPodRxBytes, metricPodTxPackets, metricPodRxPackets} {
+		var stale []podLabels
+		m.Do(func(kv metrics.KeyValue[podLabels]) {
+			if _, ok := traffic[kv.Key]; !ok {
+				stale = append(stale, kv.Key)
+			}
+		})
+		for _, l := range stale {
+			m.Delete(l)
+		}
+	}
+	for l, t := range traffic {
+		metricPodTxBytes.SetInt(l, t.TxBytes)
+		metricPodRxBytes.SetInt(l, t.RxBytes)
+		metricPodTxPackets.SetInt(l, t.TxPackets)
+		metricPodRxPackets.SetInt(l, t.RxPackets)
+	}
+}
+
+// Memory metrics, computed on scrape. All pods share one Go heap, so the
+// per-pod figure is the daemon's memory divided by the number of pods, not
+// a measurement of any one pod.
+func init() {
+	newGaugeFunc("tscni_memory_bytes", func() any { return int64(daemonMemory()) })
+	newGaugeFunc("tscni_memory_per_pod_bytes", func() any {
+		pods := metricManagedPods.Value()
+		if pods == 0 {
+			return int64(0)
+		}
+		return int64(daemonMemory()) / pods
+	})
+}
+
+// daemonMemory returns the memory the Go runtime holds from the OS, less
+// what it has already returned.
+func daemonMemory() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys - ms.HeapReleased
+}
+
+// MetricsHandler serves the daemon's metrics in Prometheus text format.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(varz.ExpvarDoHandler(metricsRegistry.Do))
+}
@@ -0,0 +1,71 @@
+package daemon
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tailscale.com/util/usermetric"
+)
+
+func TestReadPodTraffic(t *testing.T) {
+	type pathLabel struct {
+		Path string
+	}
+	reg := new(usermetric.Registry)
+	for name, byPath := range map[string]map[string]int64{
+		"tailscaled_outbound_bytes_total":   {"direct_ipv4": 1000, "derp": 500},
+		"tailscaled_inbound_bytes_total":    {"direct_ipv4": 2000},
+		"tailscaled_outbound_packets_total": {"direct_ipv4": 10, "derp": 5},
+		"tailscaled_inbound_packets_total":  {"direct_ipv6": 20},
+		"tailscaled_other_total":            {"direct_ipv4": 99},
+	} {
+		m := usermetric.NewMultiLabelMapWithRegistry[pathLabel](reg, name, "counter", "")
+		for path, v := range byPath {
+			m.Add(pathLabel{path}, v)
+		}
+	}
+
+	got := readPodTraffic(reg)
+	want := podTraffic{TxBytes: 1500, RxBytes: 2000, TxPackets: 15, RxPackets: 20}
+	if got != want {
+		t.Errorf("readPodTraffic() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSetPodTrafficMetrics(t *testing.T) {
+	web := podLabels{Namespace: "default", Pod: "web-0"}
+	db := podLabels{Namespace: "data", Pod: "db-0"}
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	setPodTrafficMetrics(map[podLabels]podTraffic{
+		web: {TxBytes: 100, RxBytes: 200, TxPackets: 1, RxPackets: 2},
+		db:  {TxBytes: 300},
+	})
+	out := scrape()
+	for _, line := range []string{
+		`tscni_pod_tx_bytes{namespace="default",pod="web-0"} 100`,
+		`tscni_pod_rx_packets{namespace="default",pod="web-0"} 2`,
+		`tscni_pod_tx_bytes{namespace="data",pod="db-0"} 300`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics missing %q", line)
+		}
+	}
+
+	// A pod that went away loses its series
+	setPodTrafficMetrics(map[podLabels]podTraffic{web: {TxBytes: 150}})
+	out = scrape()
+	if strings.Contains(out, `pod="db-0"`) {
+		t.Errorf("metrics still have series for a removed pod")
+	}
+	if !strings.Contains(out, `tscni_pod_tx_bytes{namespace="default",pod="web-0"} 150`+"\n") {
+		t.Errorf("metrics not updated for a remaining pod")
+	}
+
+	setPodTrafficMetrics(nil)
+}
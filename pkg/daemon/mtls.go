@@ -0,0 +1,80 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// LoadServerTLS builds the TLS config for the gRPC TCP listener from PEM
+// files: the server's certificate and key, and the CA that client
+// certificates must chain to. Clients without a valid certificate are
+// rejected during the handshake.
+func LoadServerTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading server certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates in client CA %s", caFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// listenerTransport is a server-side TransportCredentials for a gRPC server
+// serving both the Unix socket and the TCP listener. grpc.Creds applies to
+// every listener, so it picks the credentials by connection type: unix for
+// the socket, tcp (mTLS) for anything else.
+type listenerTransport struct {
+	unix credentials.TransportCredentials
+	tcp  credentials.TransportCredentials
+}
+
+func (listenerTransport) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("listener transport: client handshake not supported")
+}
+
+func (t listenerTransport) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if _, ok := conn.(*net.UnixConn); ok {
+		return t.unix.ServerHandshake(conn)
+	}
+	return t.tcp.ServerHandshake(conn)
+}
+
+func (t listenerTransport) Info() credentials.ProtocolInfo { return t.tcp.Info() }
+
+func (t listenerTransport) Clone() credentials.TransportCredentials {
+	return listenerTransport{unix: t.unix.Clone(), tcp: t.tcp.Clone()}
+}
+
+func (listenerTransport) OverrideServerName(string) error { return nil }
+
+// newListenerTransport returns the credentials for a server with a TCP
+// listener. Unix socket callers get peer credentials if peerCred is set
+// and are otherwise let through as before.
+func newListenerTransport(tlsConfig *tls.Config, peerCred bool) credentials.TransportCredentials {
+	var unix credentials.TransportCredentials = insecure.NewCredentials()
+	if peerCred {
+		unix = peerCredTransport{}
+	}
+	return listenerTransport{unix: unix, tcp: credentials.NewTLS(tlsConfig)}
+}
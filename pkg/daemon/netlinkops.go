@@ -0,0 +1,34 @@
+//go:build linux
+
+package daemon
+
+import "github.com/vishvananda/netlink"
+
+// netlinkOps is the part of the netlink API that sets up and tears down
+// pods' veths, addresses, routes and rules. The PodManager takes it as a
+// dependency so that code can be tested against a fake, without root or
+// real interfaces.
+//
+// *netlink.Handle implements it. A zero Handle, like netlink's package
+// functions, works in the netns of the calling thread, so it can be used
+// inside ns.NetNS.Do.
+type netlinkOps interface {
+	LinkByName(name string) (netlink.Link, error)
+	LinkAdd(link netlink.Link) error
+	LinkDel(link netlink.Link) error
+	LinkSetUp(link netlink.Link) error
+	LinkSetNsFd(link netlink.Link, fd int) error
+	AddrAdd(link netlink.Link, addr *netlink.Addr) error
+	AddrDel(link netlink.Link, addr *netlink.Addr) error
+	AddrList(link netlink.Link, family int) ([]netlink.Addr, error)
+	RouteAdd(route *netlink.Route) error
+	RouteDel(route *netlink.Route) error
+	RouteReplace(route *netlink.Route) error
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	RuleList(family int) ([]netlink.Rule, error)
+	RuleAdd(rule *netlink.Rule) error
+	RuleDel(rule *netlink.Rule) error
+}
+
+// hostNetlink is the kernel's netlink, in the calling thread's netns.
+var hostNetlink netlinkOps = &netlink.Handle{}
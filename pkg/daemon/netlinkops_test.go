@@ -0,0 +1,234 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// fakeNetlink is an in-memory netlinkOps for a single netns. Like the
+// kernel, it refuses to add a route or address that is already there or to
+// delete one that isn't, and deleting a link takes its addresses and routes
+// with it.
+type fakeNetlink struct {
+	links     map[string]netlink.Link
+	addrs     map[string][]netip.Prefix // by link name
+	routes    []netlink.Route
+	rules     []netlink.Rule
+	nextIndex int
+}
+
+func newFakeNetlink() *fakeNetlink {
+	return &fakeNetlink{
+		links:     make(map[string]netlink.Link),
+		addrs:     make(map[string][]netip.Prefix),
+		nextIndex: 1,
+	}
+}
+
+// addLink adds link and returns its index.
+func (f *fakeNetlink) addLink(link netlink.Link) int {
+	if err := f.LinkAdd(link); err != nil {
+		panic(err)
+	}
+	return link.Attrs().Index
+}
+
+// hasRoute reports whether table (0 for main) has a route to dst via the
+// link at index.
+func (f *fakeNetlink) hasRoute(table int, dst string, index int) bool {
+	i := f.findRoute(&netlink.Route{Table: table, Dst: prefixToIPNet(netip.MustParsePrefix(dst)), LinkIndex: index})
+	return i >= 0
+}
+
+// tableRoutes returns the number of routes in table.
+func (f *fakeNetlink) tableRoutes(table int) int {
+	routes, _ := f.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{Table: table}, netlink.RT_FILTER_TABLE)
+	return len(routes)
+}
+
+func (f *fakeNetlink) LinkByName(name string) (netlink.Link, error) {
+	link, ok := f.links[name]
+	if !ok {
+		return nil, netlink.LinkNotFoundError{}
+	}
+	return link, nil
+}
+
+func (f *fakeNetlink) LinkAdd(link netlink.Link) error {
+	attrs := link.Attrs()
+	if _, ok := f.links[attrs.Name]; ok {
+		return unix.EEXIST
+	}
+	attrs.Index = f.nextIndex
+	f.nextIndex++
+	f.links[attrs.Name] = link
+	if veth, ok := link.(*netlink.Veth); ok && veth.PeerName != "" {
+		f.addLink(&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: veth.PeerName}, PeerName: attrs.Name})
+	}
+	return nil
+}
+
+func (f *fakeNetlink) LinkDel(link netlink.Link) error {
+	name := link.Attrs().Name
+	link, ok := f.links[name]
+	if !ok {
+		return netlink.LinkNotFoundError{}
+	}
+	delete(f.links, name)
+	delete(f.addrs, name)
+	index := link.Attrs().Index
+	f.routes = slices.DeleteFunc(f.routes, func(r netlink.Route) bool { return r.LinkIndex == index })
+	if veth, ok := link.(*netlink.Veth); ok {
+		if peer, ok := f.links[veth.PeerName]; ok {
+			f.LinkDel(peer)
+		}
+	}
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetUp(link netlink.Link) error {
+	link, err := f.LinkByName(link.Attrs().Name)
+	if err != nil {
+		return err
+	}
+	link.Attrs().Flags |= net.FlagUp
+	return nil
+}
+
+func (f *fakeNetlink) LinkSetNsFd(link netlink.Link, fd int) error {
+	_, err := f.LinkByName(link.Attrs().Name)
+	return err
+}
+
+func (f *fakeNetlink) AddrAdd(link netlink.Link, addr *netlink.Addr) error {
+	name := link.Attrs().Name
+	if _, err := f.LinkByName(name); err != nil {
+		return err
+	}
+	prefix := ipNetToPrefix(addr.IPNet)
+	if slices.Contains(f.addrs[name], prefix) {
+		return unix.EEXIST
+	}
+	f.addrs[name] = append(f.addrs[name], prefix)
+	return nil
+}
+
+func (f *fakeNetlink) AddrDel(link netlink.Link, addr *netlink.Addr) error {
+	name := link.Attrs().Name
+	i := slices.Index(f.addrs[name], ipNetToPrefix(addr.IPNet))
+	if i < 0 {
+		return unix.EADDRNOTAVAIL
+	}
+	f.addrs[name] = slices.Delete(f.addrs[name], i, i+1)
+	return nil
+}
+
+func (f *fakeNetlink) AddrList(link netlink.Link, family int) ([]netlink.Addr, error) {
+	var addrs []netlink.Addr
+	for _, prefix := range f.addrs[link.Attrs().Name] {
+		if family == netlink.FAMILY_V4 && !prefix.Addr().Is4() || family == netlink.FAMILY_V6 && !prefix.Addr().Is6() {
+			continue
+		}
+		addrs = append(addrs, netlink.Addr{IPNet: prefixToIPNet(prefix)})
+	}
+	return addrs, nil
+}
+
+// routeTable returns the table a route is in: main if it doesn't say.
+func routeTable(r *netlink.Route) int {
+	if r.Table == 0 {
+		return unix.RT_TABLE_MAIN
+	}
+	return r.Table
+}
+
+// findRoute returns the index of the route the kernel would take r to mean:
+// one to the same destination in the same table and, if r has one, via the
+// same link. It returns -1 if there is none.
+func (f *fakeNetlink) findRoute(r *netlink.Route) int {
+	return slices.IndexFunc(f.routes, func(have netlink.Route) bool {
+		return routeTable(&have) == routeTable(r) &&
+			have.Dst.String() == r.Dst.String() &&
+			(r.LinkIndex == 0 || have.LinkIndex == r.LinkIndex)
+	})
+}
+
+func (f *fakeNetlink) RouteAdd(route *netlink.Route) error {
+	if f.findRoute(&netlink.Route{Table: route.Table, Dst: route.Dst}) >= 0 {
+		return unix.EEXIST
+	}
+	r := *route
+	r.Table = routeTable(route)
+	f.routes = append(f.routes, r)
+	return nil
+}
+
+func (f *fakeNetlink) RouteDel(route *netlink.Route) error {
+	i := f.findRoute(route)
+	if i < 0 {
+		return unix.ESRCH
+	}
+	f.routes = slices.Delete(f.routes, i, i+1)
+	return nil
+}
+
+func (f *fakeNetlink) RouteReplace(route *netlink.Route) error {
+	if i := f.findRoute(&netlink.Route{Table: route.Table, Dst: route.Dst}); i >= 0 {
+		f.routes = slices.Delete(f.routes, i, i+1)
+	}
+	return f.RouteAdd(route)
+}
+
+func (f *fakeNetlink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, r := range f.routes {
+		if family == netlink.FAMILY_V4 && r.Dst.IP.To4() == nil || family == netlink.FAMILY_V6 && r.Dst.IP.To4() != nil {
+			continue
+		}
+		if filterMask&netlink.RT_FILTER_TABLE != 0 && filter.Table != unix.RT_TABLE_UNSPEC && r.Table != routeTable(filter) {
+			continue
+		}
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+func (f *fakeNetlink) RuleList(family int) ([]netlink.Rule, error) {
+	var rules []netlink.Rule
+	for _, r := range f.rules {
+		if r.Family == family {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func (f *fakeNetlink) RuleAdd(rule *netlink.Rule) error {
+	f.rules = append(f.rules, *rule)
+	return nil
+}
+
+func (f *fakeNetlink) RuleDel(rule *netlink.Rule) error {
+	i := slices.IndexFunc(f.rules, func(have netlink.Rule) bool {
+		return have.Family == rule.Family && have.Priority == rule.Priority && have.Table == rule.Table &&
+			have.IifName == rule.IifName && have.Src.String() == rule.Src.String()
+	})
+	if i < 0 {
+		return unix.ENOENT
+	}
+	f.rules = slices.Delete(f.rules, i, i+1)
+	return nil
+}
+
+// ipNetToPrefix converts n, which must be valid, to a netip.Prefix.
+func ipNetToPrefix(n *net.IPNet) netip.Prefix {
+	addr, _ := netip.AddrFromSlice(n.IP)
+	ones, _ := n.Mask.Size()
+	return netip.PrefixFrom(addr.Unmap(), ones)
+}
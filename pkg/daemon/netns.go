@@ -3,49 +3,264 @@
 package daemon
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
-// configureTailscaleRoutes sets up routing for the Tailscale TUN device.
-// This is called inside the pod network namespace.
-func configureTailscaleRoutes(ifName string, tailscaleIP netip.Addr) error {
-	// Get the TUN interface
-	link, err := netlink.LinkByName(ifName)
+// A link that was just created, or moved between namespaces, can briefly be
+// missing from LinkByName on a busy node. linkByName tries linkLookupAttempts
+// times, linkLookupDelay apart, before giving up on it.
+const (
+	linkLookupAttempts = 5
+	linkLookupDelay    = 20 * time.Millisecond
+)
+
+// procNetnsPath matches /proc/<pid>/ns/net and /proc/<pid>/task/<tid>/ns/net.
+var procNetnsPath = regexp.MustCompile(`^/proc/[^/]+/(task/[^/]+/)?ns/net$`)
+
+// errHostNetwork is returned by AddPod for pods in the host's netns
+// (hostNetwork: true). Their Tailscale interface, addresses and routes
+// would be the node's own, and tearing them down would break the node.
+var errHostNetwork = errors.New("pod is in the host network namespace")
+
+// netnsID identifies a network namespace by its nsfs inode, which every
+// path to it shares.
+type netnsID struct {
+	dev, ino uint64
+}
+
+// statNetns returns the ID of the netns at path, a bind mount such as
+// /var/run/netns/<name> or a /proc/<pid>/ns/net link.
+func statNetns(path string) (netnsID, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return netnsID{}, err
+	}
+	return netnsID{dev: uint64(st.Dev), ino: st.Ino}, nil
+}
+
+// isHostNetns reports whether netnsPath is the host's netns. A path that
+// can't be read is not; the attach reports it.
+func (pm *PodManager) isHostNetns(netnsPath string) bool {
+	if pm.hostNetns == (netnsID{}) {
+		return false
+	}
+	id, err := statNetns(netnsPath)
+	return err == nil && id == pm.hostNetns
+}
+
+// resolveNetns returns the canonical form of a netns path, which is what
+// metadata stores and recovery checks. Symlinks such as /var/run -> /run
+// are resolved, so the path doesn't depend on which link the runtime
+// happened to pass. /proc/<pid>/ns/net forms are magic links to the
+// namespace itself rather than to a path, so they are only cleaned.
+func resolveNetns(netnsPath string) (string, error) {
+	cleaned := filepath.Clean(netnsPath)
+	if procNetnsPath.MatchString(cleaned) {
+		_, err := os.Stat(cleaned)
+		return cleaned, err
+	}
+	resolved, err := filepath.EvalSymlinks(cleaned)
 	if err != nil {
-		return fmt.Errorf("getting interface %s: %w", ifName, err)
+		return cleaned, err
 	}
+	return resolved, nil
+}
 
-	// Assign Tailscale IP to the interface (/32 for point-to-point)
-	addr := &netlink.Addr{
-		IPNet: &net.IPNet{
-			IP:   tailscaleIP.AsSlice(),
-			Mask: net.CIDRMask(32, 32),
-		},
+// canonicalNetns is resolveNetns for a path that may no longer exist: if it
+// can't be resolved it is returned as is.
+func canonicalNetns(netnsPath string) string {
+	if resolved, err := resolveNetns(netnsPath); err == nil {
+		return resolved
 	}
-	if err := netlink.AddrAdd(link, addr); err != nil {
-		return fmt.Errorf("adding IP %s to %s: %w", tailscaleIP, ifName, err)
+	return netnsPath
+}
+
+// linkByName is netlink.LinkByName for a link that should exist by now,
+// riding out netlink propagation delays. It is called in whichever netns the
+// link is expected in.
+func linkByName(name string) (netlink.Link, error) {
+	return waitForLink(netlink.LinkByName, name, linkLookupAttempts, linkLookupDelay)
+}
+
+// waitForLink calls lookup until it finds the link, at most attempts times,
+// sleeping delay in between. Errors other than the link not being found are
+// returned at once.
+func waitForLink(lookup func(string) (netlink.Link, error), name string, attempts int, delay time.Duration) (netlink.Link, error) {
+	for attempt := 1; ; attempt++ {
+		link, err := lookup(name)
+		var notFound netlink.LinkNotFoundError
+		if err == nil || !errors.As(err, &notFound) || attempt >= attempts {
+			return link, err
+		}
+		time.Sleep(delay)
 	}
+}
 
-	// Bring up the interface (TUN should already be up, but be safe)
-	if err := netlink.LinkSetUp(link); err != nil {
-		return fmt.Errorf("bringing up %s: %w", ifName, err)
+// removeStaleLink deletes the link named name from the current netns, if
+// there is one, so that the pod's Tailscale interface can take the name.
+// It is called in the pod's netns when the pod has no working interface,
+// so a link there is one an earlier attach of the container left behind
+// when it failed part-way or the daemon died. Only veths and TUNs, which
+// is what an attach leaves, are deleted: anything else belongs to another
+// plugin and is an error. Deleting a veth deletes its host end too.
+func removeStaleLink(name string) error {
+	return removeStaleLinkWith(netlink.LinkByName, netlink.LinkDel, name)
+}
+
+// removeStaleLinkWith is removeStaleLink with the netlink calls passed in.
+func removeStaleLinkWith(lookup func(string) (netlink.Link, error), del func(netlink.Link) error, name string) error {
+	link, err := lookup(name)
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("looking up %s: %w", name, err)
 	}
+	switch link.Type() {
+	case "veth", "tuntap":
+	default:
+		return fmt.Errorf("pod already has an interface %s, a %s the daemon didn't create", name, link.Type())
+	}
+	log.Printf("Removing %s %s left in the pod by an earlier attach", link.Type(), name)
+	if err := del(link); err != nil {
+		return fmt.Errorf("removing leftover %s: %w", name, err)
+	}
+	return nil
+}
 
-	// Add route for Tailscale CGNAT range (100.64.0.0/10)
-	// This ensures traffic to other Tailscale nodes goes through this interface
-	_, tailscaleCIDR, _ := net.ParseCIDR("100.64.0.0/10")
-	tailscaleRoute := &netlink.Route{
-		LinkIndex: link.Attrs().Index,
-		Dst:       tailscaleCIDR,
+// configureTailscaleRoutes gives the pod's Tailscale interface its
+// Tailscale addresses and routes routes through it. This is called inside
+// the pod network namespace. hostMAC is the MAC of the host end of the veth.
+//
+// IPv6 routes always go via podGatewayIPv6, which resolves statically to
+// hostMAC, since the host veth doesn't answer neighbor solicitations for
+// tailnet addresses. IPv4 routes do the same in netstack routing mode; in
+// kernel mode the host veth answers ARP for them (proxy ARP). IPv6 routes
+// are skipped if the node has no IPv6 address.
+func configureTailscaleRoutes(link netlink.Link, hostMAC net.HardwareAddr, ipv4, ipv6 netip.Addr, routes []netip.Prefix, routingMode string) error {
+	if err := addTailscaleAddrs(link, ipv4, ipv6); err != nil {
+		return err
+	}
+
+	// Without proxy ARP on the host veth, route IPv4 via a gateway that
+	// resolves statically to the host veth
+	gatewayIPv4 := routingMode == RoutingModeNetstack
+	gateways := []netip.Addr{podGatewayIPv6}
+	if gatewayIPv4 {
+		gateways = append(gateways, podGatewayIPv4)
+	}
+	for _, gw := range gateways {
+		family := netlink.FAMILY_V4
+		if gw.Is6() {
+			if !ipv6.IsValid() {
+				continue
+			}
+			family = netlink.FAMILY_V6
+		}
+		neigh := &netlink.Neigh{
+			LinkIndex:    link.Attrs().Index,
+			Family:       family,
+			State:        netlink.NUD_PERMANENT,
+			IP:           gw.AsSlice(),
+			HardwareAddr: hostMAC,
+		}
+		if err := netlink.NeighAdd(neigh); err != nil {
+			return fmt.Errorf("adding gateway neighbor %s: %w", gw, err)
+		}
+	}
+
+	// Route Tailscale ranges via this interface
+	for _, prefix := range routes {
+		if prefix.Addr().Is6() && !ipv6.IsValid() {
+			log.Printf("Skipping Tailscale route %s: node has no IPv6 address", prefix)
+			continue
+		}
+		route := vethRoute(link.Attrs().Index, prefix, routingMode)
+		if err := netlink.RouteAdd(route); err != nil {
+			return fmt.Errorf("adding Tailscale route %s: %w", prefix, err)
+		}
+	}
+
+	return nil
+}
+
+// vethRoute is the route for prefix via a pod's veth, through the gateway
+// configureTailscaleRoutes set up for its family and routing mode, if any.
+func vethRoute(linkIndex int, prefix netip.Prefix, routingMode string) *netlink.Route {
+	route := &netlink.Route{
+		LinkIndex: linkIndex,
+		Dst:       prefixToIPNet(prefix),
 		Scope:     netlink.SCOPE_LINK,
 	}
-	if err := netlink.RouteAdd(tailscaleRoute); err != nil {
-		return fmt.Errorf("adding Tailscale route: %w", err)
+	switch {
+	case prefix.Addr().Is6():
+		route.Gw = podGatewayIPv6.AsSlice()
+		route.Scope = netlink.SCOPE_UNIVERSE
+	case routingMode == RoutingModeNetstack:
+		route.Gw = podGatewayIPv4.AsSlice()
+		route.Flags = int(netlink.FLAG_ONLINK)
+		route.Scope = netlink.SCOPE_UNIVERSE
+	}
+	return route
+}
+
+// addTailscaleAddrs assigns a node's Tailscale IPs to the pod's interface
+// (/32 and /128, point-to-point) and brings it up. The IPv6 address skips
+// duplicate address detection, which would leave it unusable for a second
+// or so and can't find a duplicate here anyway.
+func addTailscaleAddrs(link netlink.Link, ipv4, ipv6 netip.Addr) error {
+	ifName := link.Attrs().Name
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		addr := &netlink.Addr{IPNet: prefixToIPNet(netip.PrefixFrom(ip, ip.BitLen()))}
+		if ip.Is6() {
+			addr.Flags = unix.IFA_F_NODAD
+		}
+		if err := netlink.AddrAdd(link, addr); err != nil {
+			return fmt.Errorf("adding IP %s to %s: %w", ip, ifName, err)
+		}
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("bringing up %s: %w", ifName, err)
 	}
+	return nil
+}
 
+// configurePodTUN is configureTailscaleRoutes for a TUN moved into the pod
+// (-tun-in-pod). A TUN has no link layer, so routes point straight at it:
+// no gateway neighbors or proxy ARP are needed.
+func configurePodTUN(link netlink.Link, ipv4, ipv6 netip.Addr, routes []netip.Prefix) error {
+	if err := addTailscaleAddrs(link, ipv4, ipv6); err != nil {
+		return err
+	}
+	for _, prefix := range routes {
+		if prefix.Addr().Is6() && !ipv6.IsValid() {
+			log.Printf("Skipping Tailscale route %s: node has no IPv6 address", prefix)
+			continue
+		}
+		route := &netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Dst:       prefixToIPNet(prefix),
+			Scope:     netlink.SCOPE_LINK,
+		}
+		if err := netlink.RouteAdd(route); err != nil {
+			return fmt.Errorf("adding Tailscale route %s: %w", prefix, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,191 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+func TestResolveNetns(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "run", "netns", "cni-1234")
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// /var/run -> /run, as on most distributions
+	if err := os.MkdirAll(filepath.Join(dir, "var"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "run"), filepath.Join(dir, "var", "run")); err != nil {
+		t.Fatal(err)
+	}
+	// The temp dir may itself be behind a symlink
+	want, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	procNet := fmt.Sprintf("/proc/%d/ns/net", os.Getpid())
+	procTaskNet := fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), os.Getpid())
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", path: target, want: want},
+		{name: "through symlink", path: filepath.Join(dir, "var", "run", "netns", "cni-1234"), want: want},
+		{name: "unclean", path: filepath.Join(dir, "var", "run", "netns") + "/../netns//cni-1234", want: want},
+		{name: "proc", path: procNet, want: procNet},
+		{name: "proc task", path: procTaskNet, want: procTaskNet},
+		{name: "proc unclean", path: fmt.Sprintf("/proc/%d//ns/./net", os.Getpid()), want: procNet},
+		{name: "missing", path: filepath.Join(dir, "var", "run", "netns", "cni-gone"), wantErr: true},
+		{name: "missing proc", path: "/proc/999999999/ns/net", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveNetns(tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveNetns(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("resolveNetns(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+			if exists := netnsExists(tt.path); exists == tt.wantErr {
+				t.Errorf("netnsExists(%q) = %v, want %v", tt.path, exists, !tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForLink(t *testing.T) {
+	found := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "vethabc"}}
+	errDump := errors.New("netlink dump interrupted")
+
+	tests := []struct {
+		name      string
+		results   []error // one per lookup; nil finds the link
+		wantCalls int
+		wantErr   error
+	}{
+		{"found at once", []error{nil}, 1, nil},
+		{"found after propagating", []error{netlink.LinkNotFoundError{}, netlink.LinkNotFoundError{}, nil}, 3, nil},
+		{"never found", []error{netlink.LinkNotFoundError{}, netlink.LinkNotFoundError{}, netlink.LinkNotFoundError{}, nil}, 3, netlink.LinkNotFoundError{}},
+		{"other error", []error{errDump, nil}, 1, errDump},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			lookup := func(name string) (netlink.Link, error) {
+				err := tt.results[calls]
+				calls++
+				if err != nil {
+					return nil, err
+				}
+				return found, nil
+			}
+			link, err := waitForLink(lookup, "vethabc", 3, time.Millisecond)
+			if calls != tt.wantCalls {
+				t.Errorf("lookup called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil {
+				if err != nil || link != found {
+					t.Errorf("waitForLink() = %v, %T, want the link", link, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("waitForLink() error = %T, want %T", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoveStaleLink(t *testing.T) {
+	attrs := netlink.LinkAttrs{Name: "ts0"}
+	errDump := errors.New("netlink dump interrupted")
+	tests := []struct {
+		name        string
+		link        netlink.Link
+		lookupErr   error
+		wantDeleted bool
+		wantErr     bool
+	}{
+		{"none", nil, netlink.LinkNotFoundError{}, false, false},
+		{"leftover veth", &netlink.Veth{LinkAttrs: attrs}, nil, true, false},
+		{"leftover TUN", &netlink.Tuntap{LinkAttrs: attrs}, nil, true, false},
+		{"another plugin's", &netlink.Dummy{LinkAttrs: attrs}, nil, false, true},
+		{"lookup error", nil, errDump, false, true},
+	}
+	for _, tt := range tests {
+		lookup := func(name string) (netlink.Link, error) {
+			if name != "ts0" {
+				t.Fatalf("lookup(%q), want ts0", name)
+			}
+			return tt.link, tt.lookupErr
+		}
+		var deleted netlink.Link
+		del := func(l netlink.Link) error {
+			deleted = l
+			return nil
+		}
+		err := removeStaleLinkWith(lookup, del, "ts0")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("removeStaleLink(%s) error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if (deleted != nil) != tt.wantDeleted || (deleted != nil && deleted != tt.link) {
+			t.Errorf("removeStaleLink(%s) deleted %v, want deleted %v", tt.name, deleted, tt.wantDeleted)
+		}
+	}
+}
+
+func TestIsHostNetns(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir(), ClusterName: "prod"}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	if pm.hostNetns == (netnsID{}) {
+		t.Skip("can't read /proc/self/ns/net")
+	}
+
+	notNetns := filepath.Join(t.TempDir(), "cni-1234")
+	if err := os.WriteFile(notNetns, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/proc/self/ns/net", true},
+		{"/proc/thread-self/ns/net", true},
+		{"/proc/self/ns/uts", false}, // another namespace's inode
+		{notNetns, false},
+		{"/var/run/netns/no-such-netns", false},
+	}
+	for _, tt := range tests {
+		if got := pm.isHostNetns(tt.path); got != tt.want {
+			t.Errorf("isHostNetns(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// A pod on the host network is turned away before it takes an attach slot
+	_, err = pm.AddPod(context.Background(), "c1", "/proc/self/ns/net", "ts0", "web-0", "default", "", "", nil, "")
+	if !errors.Is(err, errHostNetwork) {
+		t.Errorf("AddPod() in the host netns error = %v, want errHostNetwork", err)
+	}
+	if len(pm.attaching) != 0 || len(pm.servers) != 0 {
+		t.Errorf("AddPod() in the host netns left %d attaching and %d servers", len(pm.attaching), len(pm.servers))
+	}
+}
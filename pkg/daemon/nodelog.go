@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"tailscale.com/types/logger"
+)
+
+// Node log levels, for the log lines of pods' Tailscale nodes.
+const (
+	// NodeLogLevelDebug forwards every line.
+	NodeLogLevelDebug = "debug"
+	// NodeLogLevelInfo drops verbose ("[v1]", "[v2]") lines and routine
+	// DERP connection chatter, unless they report an error.
+	NodeLogLevelInfo = "info"
+)
+
+// ValidateNodeLogLevel checks a node log level.
+func ValidateNodeLogLevel(level string) error {
+	switch level {
+	case NodeLogLevelDebug, NodeLogLevelInfo:
+		return nil
+	}
+	return fmt.Errorf("unknown node log level %q (want %q or %q)", level, NodeLogLevelDebug, NodeLogLevelInfo)
+}
+
+// nodeLogf returns the logf for a pod's node, which prefixes each line with
+// the node's hostname and forwards it to the daemon log if level lets it
+// through. With quiet set, only lines that look like errors are forwarded.
+func nodeLogf(hostname, level string, quiet bool) logger.Logf {
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if !keepNodeLog(format, msg, level, quiet) {
+			return
+		}
+		log.Printf("[ts:%s] %s", hostname, msg)
+	}
+}
+
+// swapLogf is a node's logf that can be swapped for another, so that a warm
+// pool node logs under its pod's hostname once a pod takes it.
+type swapLogf struct {
+	logf atomic.Pointer[logger.Logf]
+}
+
+func newSwapLogf(logf logger.Logf) *swapLogf {
+	s := new(swapLogf)
+	s.logf.Store(&logf)
+	return s
+}
+
+// Logf logs through the current logf.
+func (s *swapLogf) Logf(format string, args ...any) {
+	(*s.logf.Load())(format, args...)
+}
+
+// swap makes logf the current logf.
+func (s *swapLogf) swap(logf logger.Logf) {
+	s.logf.Store(&logf)
+}
+
+// keepNodeLog reports whether a node log line, formatted as msg from
+// format, is forwarded.
+func keepNodeLog(format, msg, level string, quiet bool) bool {
+	if isErrorLog(msg) {
+		return true
+	}
+	if quiet {
+		return false
+	}
+	if level != NodeLogLevelInfo {
+		return true
+	}
+	// Tailscale marks verbose lines in the format string itself
+	if strings.HasPrefix(format, "[v1] ") || strings.HasPrefix(format, "[v2] ") {
+		return false
+	}
+	return !strings.Contains(strings.ToLower(msg), "derp")
+}
+
+// isErrorLog reports whether a node log line looks like it reports a
+// failure. Tailscale's logs have no levels, so this goes by wording.
+func isErrorLog(msg string) bool {
+	lower := strings.ToLower(msg)
+	for _, word := range []string{"error", "fail", "panic"} {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeepNodeLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		args   []any
+		level  string
+		quiet  bool
+		want   bool
+	}{
+		{name: "debug keeps verbose", format: "[v1] magicsock: disco: %v", args: []any{"ping"}, level: NodeLogLevelDebug, want: true},
+		{name: "info drops verbose", format: "[v1] magicsock: disco: %v", args: []any{"ping"}, level: NodeLogLevelInfo, want: false},
+		{name: "info drops v2", format: "[v2] wg: %v", args: []any{"handshake"}, level: NodeLogLevelInfo, want: false},
+		{name: "info drops DERP chatter", format: "magicsock: adding connection to derp-%d for %v", args: []any{1, "home-keep-alive"}, level: NodeLogLevelInfo, want: false},
+		{name: "info keeps DERP errors", format: "derphttp.Client.Connect: %v", args: []any{"dial failed"}, level: NodeLogLevelInfo, want: true},
+		{name: "info keeps other lines", format: "control: NetInfo: %v", args: []any{"..."}, level: NodeLogLevelInfo, want: true},
+		{name: "quiet drops lines", format: "control: NetInfo: %v", args: []any{"..."}, level: NodeLogLevelDebug, quiet: true, want: false},
+		{name: "quiet keeps errors", format: "control: %v", args: []any{"map response error: EOF"}, level: NodeLogLevelDebug, quiet: true, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := fmt.Sprintf(tt.format, tt.args...)
+			if got := keepNodeLog(tt.format, msg, tt.level, tt.quiet); got != tt.want {
+				t.Errorf("keepNodeLog(%q, %q, %v) = %v, want %v", msg, tt.level, tt.quiet, got, tt.want)
+			}
+		})
+	}
+}
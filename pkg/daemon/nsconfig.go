@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// namespaceConfigPollInterval is how often the namespace config ConfigMap is
+// re-read. Changes apply to pods added (or re-added) after the next poll.
+const namespaceConfigPollInterval = 30 * time.Second
+
+// errNamespaceDisabled is returned by AddPod for pods in a namespace whose
+// defaults disable Tailscale.
+var errNamespaceDisabled = errors.New("tailscale is disabled for namespace")
+
+// NamespaceDefaults are defaults for every pod in a Kubernetes namespace.
+// Pod annotations override them; they override the daemon's flags.
+type NamespaceDefaults struct {
+	// Enabled is false to keep the namespace's pods off the tailnet.
+	// Unset means enabled.
+	Enabled *bool `json:"enabled,omitempty"`
+
+	// Tags replace the daemon's tags for the namespace's pods.
+	Tags []string `json:"tags,omitempty"`
+
+	// HostnameTemplate is a text/template for the namespace's pod hostnames,
+	// e.g. "{{.Namespace}}-{{.PodName}}". See hostnameTemplateData for fields.
+	HostnameTemplate string `json:"hostnameTemplate,omitempty"`
+
+	hostnameTemplate *template.Template
+}
+
+// enabled reports whether pods in the namespace get a Tailscale node.
+func (d NamespaceDefaults) enabled() bool {
+	return d.Enabled == nil || *d.Enabled
+}
+
+// parseNamespaceDefaults parses the namespace config ConfigMap's data. Each
+// key is a namespace and each value a JSON-encoded NamespaceDefaults.
+func parseNamespaceDefaults(data map[string]string) (map[string]NamespaceDefaults, error) {
+	defaults := make(map[string]NamespaceDefaults, len(data))
+	for ns, raw := range data {
+		var d NamespaceDefaults
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&d); err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		for _, tag := range d.Tags {
+			if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+				return nil, fmt.Errorf("namespace %s: %q is not a tag", ns, tag)
+			}
+		}
+		if d.HostnameTemplate != "" {
+			tmpl, err := ParseHostnameTemplate(d.HostnameTemplate)
+			if err != nil {
+				return nil, fmt.Errorf("namespace %s: hostname template: %w", ns, err)
+			}
+			d.hostnameTemplate = tmpl
+		}
+		defaults[ns] = d
+	}
+	return defaults, nil
+}
+
+// NamespaceConfig holds per-namespace defaults read from a ConfigMap and
+// keeps them current by polling it. A nil *NamespaceConfig has no defaults.
+type NamespaceConfig struct {
+	kube      *KubeClient
+	namespace string
+	name      string
+
+	mu              sync.RWMutex
+	resourceVersion string
+	defaults        map[string]NamespaceDefaults
+}
+
+// NewNamespaceConfig returns a NamespaceConfig for the ConfigMap
+// namespace/name. Call Load or Run to read it.
+func NewNamespaceConfig(kube *KubeClient, namespace, name string) *NamespaceConfig {
+	return &NamespaceConfig{kube: kube, namespace: namespace, name: name}
+}
+
+// Get returns the defaults for a namespace; the zero value if it has none.
+func (c *NamespaceConfig) Get(namespace string) NamespaceDefaults {
+	if c == nil {
+		return NamespaceDefaults{}
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.defaults[namespace]
+}
+
+// Load reads the ConfigMap once. A missing ConfigMap clears all defaults.
+// If the ConfigMap is invalid the previous defaults are kept.
+func (c *NamespaceConfig) Load(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+
+	cm, err := c.kube.GetConfigMap(ctx, c.namespace, c.name)
+	if isKubeNotFound(err) {
+		c.set("", nil)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting ConfigMap %s/%s: %w", c.namespace, c.name, err)
+	}
+
+	c.mu.RLock()
+	unchanged := cm.Metadata.ResourceVersion != "" && cm.Metadata.ResourceVersion == c.resourceVersion
+	c.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	defaults, err := parseNamespaceDefaults(cm.Data)
+	if err != nil {
+		return fmt.Errorf("ConfigMap %s/%s: %w", c.namespace, c.name, err)
+	}
+	c.set(cm.Metadata.ResourceVersion, defaults)
+	log.Printf("Loaded namespace defaults for %d namespaces from ConfigMap %s/%s", len(defaults), c.namespace, c.name)
+	return nil
+}
+
+func (c *NamespaceConfig) set(resourceVersion string, defaults map[string]NamespaceDefaults) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resourceVersion = resourceVersion
+	c.defaults = defaults
+}
+
+// Run reloads the ConfigMap every namespaceConfigPollInterval until ctx is done.
+func (c *NamespaceConfig) Run(ctx context.Context) {
+	ticker := time.NewTicker(namespaceConfigPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Load(ctx); err != nil {
+				log.Printf("Warning: keeping previous namespace defaults: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNamespaceDefaults(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name    string
+		data    map[string]string
+		want    map[string]NamespaceDefaults
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			want: map[string]NamespaceDefaults{},
+		},
+		{
+			name: "tags and enabled",
+			data: map[string]string{
+				"payments": `{"tags": ["tag:payments"]}`,
+				"scratch":  `{"enabled": false}`,
+			},
+			want: map[string]NamespaceDefaults{
+				"payments": {Tags: []string{"tag:payments"}},
+				"scratch":  {Enabled: &disabled},
+			},
+		},
+		{
+			name:    "invalid JSON",
+			data:    map[string]string{"payments": `tags: [tag:payments]`},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    map[string]string{"payments": `{"tag": ["tag:payments"]}`},
+			wantErr: true,
+		},
+		{
+			name:    "tag without prefix",
+			data:    map[string]string{"payments": `{"tags": ["payments"]}`},
+			wantErr: true,
+		},
+		{
+			name:    "bad hostname template",
+			data:    map[string]string{"payments": `{"hostnameTemplate": "{{.Nmespace}}"}`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNamespaceDefaults(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNamespaceDefaults() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseNamespaceDefaults() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNamespaceDefaults_HostnameTemplate(t *testing.T) {
+	got, err := parseNamespaceDefaults(map[string]string{
+		"payments": `{"hostnameTemplate": "{{.Namespace}}-{{.PodName}}"}`,
+	})
+	if err != nil {
+		t.Fatalf("parseNamespaceDefaults() error = %v", err)
+	}
+	if got["payments"].hostnameTemplate == nil {
+		t.Errorf("hostname template not parsed")
+	}
+}
+
+func TestNamespaceDefaultsEnabled(t *testing.T) {
+	enabled, disabled := true, false
+	if !(NamespaceDefaults{}).enabled() {
+		t.Errorf("unset Enabled should mean enabled")
+	}
+	if !(NamespaceDefaults{Enabled: &enabled}).enabled() {
+		t.Errorf("Enabled=true should mean enabled")
+	}
+	if (NamespaceDefaults{Enabled: &disabled}).enabled() {
+		t.Errorf("Enabled=false should mean disabled")
+	}
+}
+
+func TestNamespaceConfigGet_Nil(t *testing.T) {
+	var c *NamespaceConfig
+	if got := c.Get("default"); !reflect.DeepEqual(got, NamespaceDefaults{}) {
+		t.Errorf("nil NamespaceConfig Get() = %+v, want zero value", got)
+	}
+}
+
+func TestWithNamespaceDefaults(t *testing.T) {
+	tmpl, err := ParseHostnameTemplate("{{.Namespace}}-{{.PodName}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns := NamespaceDefaults{Tags: []string{"tag:ns"}, hostnameTemplate: tmpl}
+
+	// Namespace defaults fill in what the annotations left unset
+	got := PodConfig{DERPRegion: 3}.withNamespaceDefaults(ns)
+	if !reflect.DeepEqual(got.Tags, []string{"tag:ns"}) || got.hostnameTemplate != tmpl || got.DERPRegion != 3 {
+		t.Errorf("withNamespaceDefaults() = %+v", got)
+	}
+
+	// Annotations win
+	got = PodConfig{Hostname: "web", Tags: []string{"tag:pod"}}.withNamespaceDefaults(ns)
+	if !reflect.DeepEqual(got.Tags, []string{"tag:pod"}) || got.hostnameTemplate != nil {
+		t.Errorf("withNamespaceDefaults() overrode annotations: %+v", got)
+	}
+}
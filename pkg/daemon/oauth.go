@@ -4,23 +4,53 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"os"
+	"strings"
 	"sync"
 	"time"
 )
 
 const (
-	// maxConcurrentAuthKeys limits concurrent auth key API requests to prevent
-	// thundering herd when many pods start simultaneously.
-	maxConcurrentAuthKeys = 5
-
-	// authKeyMinInterval is the minimum time between auth key requests.
-	// This prevents burst requests from overwhelming the Tailscale API.
-	authKeyMinInterval = 100 * time.Millisecond
+	// defaultMaxConcurrentAuthKeys limits concurrent auth key API requests to
+	// prevent thundering herd when many pods start simultaneously.
+	defaultMaxConcurrentAuthKeys = 5
+
+	// defaultAuthKeyMinInterval is the minimum time between auth key
+	// requests. This prevents burst requests from overwhelming the
+	// Tailscale API.
+	defaultAuthKeyMinInterval = 100 * time.Millisecond
+
+	// maxConcurrentDeviceDeletes limits concurrent device deletion API requests
+	// so that mass pod teardown (e.g. a namespace delete) doesn't flood the API.
+	maxConcurrentDeviceDeletes = 5
+
+	// deviceDeleteMinInterval is the minimum time between device deletion requests.
+	deviceDeleteMinInterval = 100 * time.Millisecond
+
+	// maxDeviceDeleteAttempts is how many times a failed deletion is retried
+	// before the device is left for manual cleanup.
+	maxDeviceDeleteAttempts = 3
+
+	// clientSecretPollInterval is how often WatchClientSecretFile rereads
+	// the client secret file.
+	clientSecretPollInterval = 10 * time.Second
+
+	// clientSecretRefPollInterval is how often WatchClientSecretRef
+	// refetches the client secret's Secret. Every node's daemon polls the
+	// API server, so it is slower than polling a file.
+	clientSecretRefPollInterval = time.Minute
+
+	// policyTagsTTL is how long the tags declared in the tailnet policy are
+	// cached, including a failure to fetch them.
+	policyTagsTTL = 5 * time.Minute
 )
 
 // OAuthManager handles Tailscale OAuth authentication and auth key creation.
@@ -36,8 +66,28 @@ type OAuthManager struct {
 	tokenExpiry time.Time
 
 	// Rate limiting for auth key creation
-	authKeySem  chan struct{} // Semaphore for concurrent requests
-	lastAuthKey time.Time     // Time of last auth key request
+	authKeySem         chan struct{} // Semaphore for concurrent requests
+	authKeyMinInterval time.Duration
+	authKeyJitter      time.Duration // up to this much is added to each interval
+	lastAuthKey        time.Time     // Start of the latest auth key request, which may be reserved ahead
+
+	// Tags declared in the tailnet policy's tagOwners, for checking pods'
+	// tags before asking for a key. nil if they couldn't be fetched, in
+	// which case tags aren't checked.
+	policyMu      sync.Mutex
+	policyTags    map[string]bool
+	policyFetched time.Time
+
+	// Device deletion queue. A device already queued or in flight is not
+	// queued again, so repeated DELs for a pod coalesce into one API call.
+	deleteMu      sync.Mutex
+	deleteQueue   []string       // device IDs waiting to be deleted
+	deletePending map[string]int // device ID -> attempts made; queued or in flight
+	deleteWake    chan struct{}  // signals the deleter that the queue is non-empty
+	deleteSem     chan struct{}  // Semaphore for concurrent requests
+	deleteStarted bool
+
+	failures *failureRing // recent CreateAuthKey failures
 
 	httpClient *http.Client
 }
@@ -51,12 +101,171 @@ func NewOAuthManager(clientID, clientSecret string, tags []string, authKeyTTL ti
 	return &OAuthManager{
 		clientID:     clientID,
 		clientSecret: clientSecret,
-		baseURL:      "https://api.tailscale.com",
+		baseURL:      DefaultAPIBaseURL,
 		tags:         tags,
 		authKeyTTL:   authKeyTTL,
-		authKeySem:   make(chan struct{}, maxConcurrentAuthKeys),
+		authKeySem:   make(chan struct{}, defaultMaxConcurrentAuthKeys),
 		httpClient:   &http.Client{Timeout: 30 * time.Second},
+
+		deletePending: make(map[string]int),
+		deleteWake:    make(chan struct{}, 1),
+		deleteSem:     make(chan struct{}, maxConcurrentDeviceDeletes),
+
+		failures: newFailureRing(recentAuthKeyFailures),
+
+		authKeyMinInterval: defaultAuthKeyMinInterval,
+	}
+}
+
+// SetAuthKeyRateLimit replaces the default auth key rate limit: at most
+// maxConcurrent requests in flight, each started at least minInterval
+// after the previous one, plus a random delay of up to jitter so that a
+// burst of pods doesn't reach the API as an evenly spaced train. It must
+// be called before the first CreateAuthKey.
+func (m *OAuthManager) SetAuthKeyRateLimit(maxConcurrent int, minInterval, jitter time.Duration) error {
+	if maxConcurrent < 1 {
+		return fmt.Errorf("auth key concurrency %d is less than 1", maxConcurrent)
+	}
+	if minInterval < 0 || jitter < 0 {
+		return fmt.Errorf("auth key interval %s and jitter %s must not be negative", minInterval, jitter)
+	}
+	m.authKeySem = make(chan struct{}, maxConcurrent)
+	m.authKeyMinInterval = minInterval
+	m.authKeyJitter = jitter
+	return nil
+}
+
+// DefaultAPIBaseURL is the Tailscale API an OAuthManager uses unless told
+// otherwise.
+const DefaultAPIBaseURL = "https://api.tailscale.com"
+
+// SetAPIBaseURL points the OAuthManager at another Tailscale API, such as a
+// proxy in front of it, in place of DefaultAPIBaseURL. The URL must be
+// https, and may have a path that API paths are appended to. It must be
+// called before the OAuthManager is first used.
+func (m *OAuthManager) SetAPIBaseURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("parsing API base URL: %w", err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("API base URL %q is not an https URL with a host", rawURL)
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("API base URL %q must not have credentials, a query or a fragment", rawURL)
+	}
+	m.baseURL = strings.TrimSuffix(u.String(), "/")
+	return nil
+}
+
+// ReadClientSecretFile reads an OAuth client secret from a file, such as a
+// key of a mounted Kubernetes Secret.
+func ReadClientSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading OAuth client secret: %w", err)
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("OAuth client secret file %s is empty", path)
+	}
+	return secret, nil
+}
+
+// ClientSecretRef names the key of a Kubernetes Secret holding the OAuth
+// client secret, for the daemon to fetch itself rather than have it in its
+// environment.
+type ClientSecretRef struct {
+	Namespace string
+	Name      string
+	Key       string
+}
+
+func (r ClientSecretRef) String() string {
+	return fmt.Sprintf("secret %s/%s key %s", r.Namespace, r.Name, r.Key)
+}
+
+// ReadClientSecretRef fetches an OAuth client secret from a Secret.
+func ReadClientSecretRef(ctx context.Context, client *KubeClient, ref ClientSecretRef) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	s, err := client.GetSecret(ctx, ref.Namespace, ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("reading OAuth client secret from %s: %w", ref, err)
 	}
+	secret := strings.TrimSpace(string(s.Data[ref.Key]))
+	if secret == "" {
+		return "", fmt.Errorf("OAuth client secret in %s is missing or empty", ref)
+	}
+	return secret, nil
+}
+
+// SetClientSecret replaces the OAuth client secret and reports whether it
+// changed. A changed secret drops the cached access token, so the next
+// request authenticates with the new one.
+func (m *OAuthManager) SetClientSecret(secret string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if secret == m.clientSecret {
+		return false
+	}
+	m.clientSecret = secret
+	m.accessToken = ""
+	m.tokenExpiry = time.Time{}
+	return true
+}
+
+// WatchClientSecretFile rereads the client secret from path every
+// clientSecretPollInterval until ctx is done, and switches to it when it
+// changes. Kubernetes updates a mounted Secret by swapping a symlink to a
+// new directory, so the file is polled rather than watched.
+func (m *OAuthManager) WatchClientSecretFile(ctx context.Context, path string) {
+	m.watchClientSecret(ctx, path, clientSecretPollInterval, func() (string, error) {
+		return ReadClientSecretFile(path)
+	})
+}
+
+// WatchClientSecretRef refetches the client secret from ref every
+// clientSecretRefPollInterval until ctx is done, and switches to it when it
+// changes.
+func (m *OAuthManager) WatchClientSecretRef(ctx context.Context, client *KubeClient, ref ClientSecretRef) {
+	m.watchClientSecret(ctx, ref.String(), clientSecretRefPollInterval, func() (string, error) {
+		return ReadClientSecretRef(ctx, client, ref)
+	})
+}
+
+// watchClientSecret calls read every interval until ctx is done and uses
+// the secret it returns from then on. A failed read keeps the previous
+// secret.
+func (m *OAuthManager) watchClientSecret(ctx context.Context, source string, interval time.Duration, read func() (string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			secret, err := read()
+			if err != nil {
+				log.Printf("Warning: keeping previous OAuth client secret: %v", err)
+				continue
+			}
+			if m.SetClientSecret(secret) {
+				log.Printf("OAuth client secret in %s changed, using the new secret", source)
+			}
+		}
+	}
+}
+
+// apiError is returned for non-2xx responses from the Tailscale API.
+type apiError struct {
+	Op         string // the request that failed, e.g. "auth key request"
+	StatusCode int
+	Body       string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s failed with status %d: %s", e.Op, e.StatusCode, e.Body)
 }
 
 // tokenResponse represents the OAuth token response from Tailscale.
@@ -123,7 +332,7 @@ func (m *OAuthManager) getAccessToken(ctx context.Context) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("token request failed with status %d: %s", resp.StatusCode, string(body))
+		return "", &apiError{Op: "token request", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var tokenResp tokenResponse
@@ -137,81 +346,560 @@ func (m *OAuthManager) getAccessToken(ctx context.Context) (string, error) {
 	return m.accessToken, nil
 }
 
-// CreateAuthKey creates a new ephemeral, preauthorized auth key for a pod.
+// CreateAuthKey creates a new single-use auth key for a pod. The key carries
+// tags, or the manager's tags if tags is empty, and profile's capabilities;
+// a nil profile means a preauthorized, non-ephemeral key.
 // Rate-limited to prevent overwhelming the Tailscale API during burst pod creation.
-func (m *OAuthManager) CreateAuthKey(ctx context.Context, podName, namespace string) (string, error) {
+// Failures are counted by namespace and reason and kept for RecentFailures.
+func (m *OAuthManager) CreateAuthKey(ctx context.Context, podName, namespace string, tags []string, profile *KeyProfile) (key string, err error) {
+	defer func() {
+		if err != nil {
+			m.recordAuthKeyFailure(podName, namespace, err)
+		}
+	}()
+	if len(tags) == 0 {
+		tags = m.tags
+	}
+	if err := m.checkTags(ctx, tags, false); err != nil {
+		return "", err
+	}
+
+	release, err := m.acquireAuthKeySlot(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	keyResp, err := m.createAuthKey(ctx, fmt.Sprintf("tailscale-cni %s %s", namespace, podName), tags, profile)
+	if err != nil {
+		// The policy may have changed since it was cached; if a tag was
+		// dropped from it, say so rather than returning the API's 400
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			if tagErr := m.checkTags(ctx, tags, true); tagErr != nil {
+				return "", tagErr
+			}
+		}
+		return "", err
+	}
+	return keyResp.Key, nil
+}
+
+// checkTags returns errTagNotPermitted if any of tags isn't declared in the
+// tailnet policy's tagOwners; the API refuses keys with such tags. The
+// policy is fetched at most once per policyTagsTTL, or now if refresh is
+// set. Tags aren't checked if the policy can't be read, e.g. because the
+// OAuth client lacks the policy_file:read scope.
+//
+// The API doesn't say which tags the OAuth client owns, so a declared tag
+// the client doesn't own still fails at key creation.
+func (m *OAuthManager) checkTags(ctx context.Context, tags []string, refresh bool) error {
+	m.policyMu.Lock()
+	defer m.policyMu.Unlock()
+
+	if refresh || time.Since(m.policyFetched) > policyTagsTTL {
+		declared, err := m.fetchPolicyTags(ctx)
+		if err != nil {
+			log.Printf("Warning: not checking tags against the tailnet policy: %v", err)
+		}
+		m.policyTags, m.policyFetched = declared, time.Now()
+	}
+	if m.policyTags == nil {
+		return nil
+	}
+	for _, tag := range tags {
+		if !m.policyTags[tag] {
+			return fmt.Errorf("%w: tag %s not permitted by ACL (it has no tagOwners entry)", errTagNotPermitted, tag)
+		}
+	}
+	return nil
+}
+
+// policyResponse is the part of the tailnet policy file checkTags uses.
+type policyResponse struct {
+	TagOwners map[string][]string `json:"tagOwners"`
+}
+
+// fetchPolicyTags returns the tags declared in the tailnet policy.
+func (m *OAuthManager) fetchPolicyTags(ctx context.Context) (map[string]bool, error) {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", m.baseURL+"/api/v2/tailnet/-/acl", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating policy request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	// Plain JSON rather than the HuJSON the policy is written in
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &apiError{Op: "policy request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var policy policyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("decoding policy: %w", err)
+	}
+	declared := make(map[string]bool, len(policy.TagOwners))
+	for tag := range policy.TagOwners {
+		declared[tag] = true
+	}
+	return declared, nil
+}
+
+// acquireAuthKeySlot waits for one of the request slots and for the
+// minimum interval, plus jitter, since the previous request, and records
+// how long that took. Call release when the request is done.
+func (m *OAuthManager) acquireAuthKeySlot(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	waited := false
+	defer func() {
+		metricAuthKeyWaitSeconds.Observe(time.Since(start).Seconds())
+		if waited {
+			metricAuthKeyWaited.Add(1)
+		} else {
+			metricAuthKeyImmediate.Add(1)
+		}
+	}()
+
 	// Acquire semaphore slot (limits concurrent requests)
 	select {
 	case m.authKeySem <- struct{}{}:
-		defer func() { <-m.authKeySem }()
-	case <-ctx.Done():
-		return "", ctx.Err()
+	default:
+		waited = true
+		select {
+		case m.authKeySem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	metricAuthKeyInflight.Add(1)
+	release = func() {
+		metricAuthKeyInflight.Add(-1)
+		<-m.authKeySem
 	}
 
-	// Enforce minimum interval between requests
+	// Enforce minimum interval between requests. Each request reserves its
+	// start time, so concurrent waiters queue up behind one another rather
+	// than all going when the previous request's interval is up.
 	m.mu.Lock()
-	elapsed := time.Since(m.lastAuthKey)
-	if elapsed < authKeyMinInterval {
-		wait := authKeyMinInterval - elapsed
-		m.mu.Unlock()
+	now := time.Now()
+	prev := m.lastAuthKey
+	at := prev.Add(m.authKeySpacing())
+	if at.Before(now) {
+		at = now
+	}
+	m.lastAuthKey = at
+	m.mu.Unlock()
+
+	if wait := at.Sub(now); wait > 0 {
+		waited = true
+		metricAuthKeySpacingSeconds.Observe(at.Sub(prev).Seconds())
 		log.Printf("Rate limiting auth key request, waiting %v", wait)
 		select {
 		case <-time.After(wait):
 		case <-ctx.Done():
-			return "", ctx.Err()
+			release()
+			return nil, ctx.Err()
 		}
-		m.mu.Lock()
 	}
-	m.lastAuthKey = time.Now()
-	m.mu.Unlock()
+	return release, nil
+}
+
+// authKeySpacing returns the time to leave between the starts of two auth
+// key requests: the minimum interval plus a random part of the jitter.
+func (m *OAuthManager) authKeySpacing() time.Duration {
+	if m.authKeyJitter <= 0 {
+		return m.authKeyMinInterval
+	}
+	return m.authKeyMinInterval + rand.N(m.authKeyJitter)
+}
+
+// maxAuthKeyDescription is the longest auth key description the Tailscale
+// API accepts.
+const maxAuthKeyDescription = 50
+
+// authKeyDescription makes s a description the Tailscale API accepts: at
+// most maxAuthKeyDescription letters, digits, spaces and hyphens. Anything
+// else, such as the dots and underscores pod names and namespaces may
+// have, or control characters, becomes a hyphen.
+func authKeyDescription(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if b.Len() == maxAuthKeyDescription {
+			break
+		}
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == ' ', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
 
+// createAuthKey creates an auth key with the given description, cut down
+// to what the API accepts, tags and profile (nil for the defaults),
+// without rate limiting.
+func (m *OAuthManager) createAuthKey(ctx context.Context, description string, tags []string, profile *KeyProfile) (*authKeyResponse, error) {
 	token, err := m.getAccessToken(ctx)
 	if err != nil {
-		return "", fmt.Errorf("getting access token: %w", err)
+		return nil, fmt.Errorf("getting access token: %w", err)
 	}
 
+	create := authKeyCreate{
+		Reusable:      false,
+		Ephemeral:     false, // Non-ephemeral for recovery support
+		Preauthorized: true,
+		Tags:          tags,
+	}
+	expiry := m.authKeyTTL
+	if profile != nil {
+		create.Ephemeral = profile.Ephemeral
+		create.Preauthorized = profile.preauthorized()
+		if profile.expiry > 0 {
+			expiry = profile.expiry
+		}
+	}
 	keyReq := authKeyRequest{
 		Capabilities: authKeyCapabilities{
-			Devices: authKeyDevices{
-				Create: authKeyCreate{
-					Reusable:      false,
-					Ephemeral:     false, // Non-ephemeral for recovery support
-					Preauthorized: true,
-					Tags:          m.tags,
-				},
-			},
+			Devices: authKeyDevices{Create: create},
 		},
-		ExpirySeconds: int(m.authKeyTTL.Seconds()),
-		Description:   fmt.Sprintf("tailscale-cni %s %s", namespace, podName),
+		ExpirySeconds: int(expiry.Seconds()),
+		Description:   authKeyDescription(description),
 	}
 
 	body, err := json.Marshal(keyReq)
 	if err != nil {
-		return "", fmt.Errorf("marshaling auth key request: %w", err)
+		return nil, fmt.Errorf("marshaling auth key request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/v2/tailnet/-/keys", bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("creating auth key request: %w", err)
+		return nil, fmt.Errorf("creating auth key request: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := m.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("requesting auth key: %w", err)
+		return nil, fmt.Errorf("requesting auth key: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("auth key request failed with status %d: %s", resp.StatusCode, string(respBody))
+		return nil, &apiError{Op: "auth key request", StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
 	var keyResp authKeyResponse
 	if err := json.NewDecoder(resp.Body).Decode(&keyResp); err != nil {
-		return "", fmt.Errorf("decoding auth key response: %w", err)
+		return nil, fmt.Errorf("decoding auth key response: %w", err)
 	}
 
-	return keyResp.Key, nil
+	return &keyResp, nil
+}
+
+// deleteAuthKey revokes an auth key by ID.
+func (m *OAuthManager) deleteAuthKey(ctx context.Context, keyID string) error {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", m.baseURL+"/api/v2/tailnet/-/keys/"+url.PathEscape(keyID), nil)
+	if err != nil {
+		return fmt.Errorf("creating auth key delete request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting auth key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &apiError{Op: "auth key delete request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+// Validate checks that the OAuth credentials work and may mint auth keys
+// with the manager's tags, by creating a throwaway key and revoking it
+// straight away. The API rejects keys with tags the OAuth client doesn't
+// own under the tailnet policy's tagOwners, so this also checks the tags.
+func (m *OAuthManager) Validate(ctx context.Context) error {
+	if _, err := m.getAccessToken(ctx); err != nil {
+		return fmt.Errorf("exchanging OAuth credentials for a token: %w", err)
+	}
+
+	key, err := m.createAuthKey(ctx, "tailscale-cni validation - revoked immediately", m.tags, nil)
+	if err != nil {
+		return fmt.Errorf("creating auth key with tags %v (the OAuth client needs the auth keys scope and must own the tags): %w", m.tags, err)
+	}
+
+	if err := m.deleteAuthKey(ctx, key.ID); err != nil {
+		return fmt.Errorf("revoking validation auth key %s: %w", key.ID, err)
+	}
+	return nil
+}
+
+// QueueDeviceDeletion schedules a device to be removed from the tailnet.
+// Deletions run in the background, rate-limited like auth key creation.
+func (m *OAuthManager) QueueDeviceDeletion(deviceID string) {
+	m.deleteMu.Lock()
+	defer m.deleteMu.Unlock()
+
+	if _, ok := m.deletePending[deviceID]; ok {
+		return
+	}
+	m.deletePending[deviceID] = 0
+	m.deleteQueue = append(m.deleteQueue, deviceID)
+	metricDeviceDeleteQueueDepth.Set(int64(len(m.deletePending)))
+
+	if !m.deleteStarted {
+		m.deleteStarted = true
+		go m.runDeviceDeletes()
+	}
+	select {
+	case m.deleteWake <- struct{}{}:
+	default:
+	}
+}
+
+// FlushDeviceDeletions waits for queued device deletions to finish, or for
+// ctx to be done. It returns an error naming how many were left undone.
+func (m *OAuthManager) FlushDeviceDeletions(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		m.deleteMu.Lock()
+		remaining := len(m.deletePending)
+		m.deleteMu.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return fmt.Errorf("%d device deletions still pending: %w", remaining, ctx.Err())
+		}
+	}
+}
+
+// runDeviceDeletes drains the deletion queue, starting at most one request per
+// deviceDeleteMinInterval with at most maxConcurrentDeviceDeletes in flight.
+func (m *OAuthManager) runDeviceDeletes() {
+	var last time.Time
+	for range m.deleteWake {
+		for {
+			m.deleteMu.Lock()
+			if len(m.deleteQueue) == 0 {
+				m.deleteMu.Unlock()
+				break
+			}
+			deviceID := m.deleteQueue[0]
+			m.deleteQueue = m.deleteQueue[1:]
+			m.deleteMu.Unlock()
+
+			m.deleteSem <- struct{}{}
+			if wait := deviceDeleteMinInterval - time.Since(last); wait > 0 {
+				time.Sleep(wait)
+			}
+			last = time.Now()
+
+			go func() {
+				defer func() { <-m.deleteSem }()
+				m.processDeviceDeletion(deviceID)
+			}()
+		}
+	}
+}
+
+// processDeviceDeletion makes one deletion attempt, requeueing the device on
+// failure until maxDeviceDeleteAttempts is reached.
+func (m *OAuthManager) processDeviceDeletion(deviceID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := m.deleteDevice(ctx, deviceID)
+	cancel()
+
+	m.deleteMu.Lock()
+	defer m.deleteMu.Unlock()
+
+	if err != nil {
+		metricDeviceDeleteFailures.Add(1)
+		m.deletePending[deviceID]++
+		if m.deletePending[deviceID] < maxDeviceDeleteAttempts {
+			log.Printf("Failed to delete device %s, will retry: %v", deviceID, err)
+			m.deleteQueue = append(m.deleteQueue, deviceID)
+			select {
+			case m.deleteWake <- struct{}{}:
+			default:
+			}
+			return
+		}
+		log.Printf("Giving up deleting device %s after %d attempts: %v", deviceID, maxDeviceDeleteAttempts, err)
+	} else {
+		metricDeviceDeletes.Add(1)
+		log.Printf("Deleted device %s from tailnet", deviceID)
+	}
+	delete(m.deletePending, deviceID)
+	metricDeviceDeleteQueueDepth.Set(int64(len(m.deletePending)))
+}
+
+// deleteDevice removes a device from the tailnet. A device that no longer
+// exists is not an error.
+func (m *OAuthManager) deleteDevice(ctx context.Context, deviceID string) error {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", m.baseURL+"/api/v2/device/"+url.PathEscape(deviceID), nil)
+	if err != nil {
+		return fmt.Errorf("creating device delete request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting device: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &apiError{Op: "device delete request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+// Device is a tailnet device, as the devices API lists it.
+type Device struct {
+	ID                 string    `json:"nodeId"`
+	Hostname           string    `json:"hostname"`
+	Tags               []string  `json:"tags"`
+	ConnectedToControl bool      `json:"connectedToControl"`
+	LastSeen           time.Time `json:"lastSeen"`
+}
+
+// ListDevices returns the tailnet's tagged devices whose hostname starts
+// with hostnamePrefix. Devices without tags belong to users, not pods, and
+// are never returned, whatever their name.
+func (m *OAuthManager) ListDevices(ctx context.Context, hostnamePrefix string) ([]Device, error) {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting access token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", m.baseURL+"/api/v2/tailnet/-/devices", nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating device list request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("listing devices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, &apiError{Op: "device list request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+
+	var list struct {
+		Devices []Device `json:"devices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("decoding device list: %w", err)
+	}
+	var devices []Device
+	for _, d := range list.Devices {
+		if len(d.Tags) > 0 && strings.HasPrefix(d.Hostname, hostnamePrefix) {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// SetDeviceIPv4 changes a device's Tailscale IPv4 address. The API refuses
+// addresses outside the tailnet's range or already held by another device.
+func (m *OAuthManager) SetDeviceIPv4(ctx context.Context, deviceID string, ip netip.Addr) error {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]string{"ipv4": ip.String()})
+	if err != nil {
+		return fmt.Errorf("marshaling device IP request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/v2/device/"+url.PathEscape(deviceID)+"/ip", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating device IP request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("setting device IP: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &apiError{Op: "device IP request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+// DisableKeyExpiry turns off node key expiry for a device, so that it stays
+// on the tailnet without re-authenticating. The OAuth client needs the
+// devices write scope, as for deletion.
+func (m *OAuthManager) DisableKeyExpiry(ctx context.Context, deviceID string) error {
+	token, err := m.getAccessToken(ctx)
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+
+	body, err := json.Marshal(map[string]bool{"keyExpiryDisabled": true})
+	if err != nil {
+		return fmt.Errorf("marshaling device key request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.baseURL+"/api/v2/device/"+url.PathEscape(deviceID)+"/key", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating device key request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("disabling key expiry: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return &apiError{Op: "device key request", StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
 }
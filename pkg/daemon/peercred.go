@@ -0,0 +1,145 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerCredAuthInfo holds the credentials of the process at the other end
+// of a Unix socket connection.
+type peerCredAuthInfo struct {
+	credentials.CommonAuthInfo
+	Ucred *unix.Ucred
+}
+
+func (peerCredAuthInfo) AuthType() string { return "peercred" }
+
+// peerCredTransport is a server-side TransportCredentials that reads the
+// peer's credentials with SO_PEERCRED. It does not encrypt anything; the
+// connection stays a plain Unix socket.
+type peerCredTransport struct{}
+
+func (peerCredTransport) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("peercred: client handshake not supported")
+}
+
+func (peerCredTransport) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	cred, err := peerUcred(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, peerCredAuthInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity},
+		Ucred:          cred,
+	}, nil
+}
+
+// peerUcred reads the credentials of the process at the other end of a Unix
+// socket connection with SO_PEERCRED.
+func peerUcred(conn net.Conn) (*unix.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("peercred: not a Unix socket connection (%T)", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, fmt.Errorf("peercred: %w", err)
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, fmt.Errorf("peercred: %w", err)
+	}
+	if credErr != nil {
+		return nil, fmt.Errorf("peercred: reading SO_PEERCRED: %w", credErr)
+	}
+	return cred, nil
+}
+
+func (peerCredTransport) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "peercred"}
+}
+
+func (t peerCredTransport) Clone() credentials.TransportCredentials { return t }
+
+func (peerCredTransport) OverrideServerName(string) error { return nil }
+
+// uidAllowlistInterceptor rejects calls from processes whose UID is not in
+// allowed. It requires the server to use peerCredTransport. Calls over the
+// mTLS TCP listener are let through: their client certificate was already
+// verified in the handshake, and they have no UID.
+func uidAllowlistInterceptor(allowed []uint32) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkPeerUID(ctx, info.FullMethod, allowed); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// uidAllowlistStreamInterceptor is uidAllowlistInterceptor for streaming
+// calls.
+func uidAllowlistStreamInterceptor(allowed []uint32) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkPeerUID(ss.Context(), info.FullMethod, allowed); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkPeerUID returns an error status unless the caller of method is
+// allowed, as uidAllowlistInterceptor describes.
+func checkPeerUID(ctx context.Context, method string, allowed []uint32) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "peer credentials unavailable")
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+		return nil
+	}
+	authInfo, ok := p.AuthInfo.(peerCredAuthInfo)
+	if !ok || authInfo.Ucred == nil {
+		return status.Error(codes.Unauthenticated, "peer credentials unavailable")
+	}
+	if !slices.Contains(allowed, authInfo.Ucred.Uid) {
+		log.Printf("Rejected %s from uid=%d pid=%d", method, authInfo.Ucred.Uid, authInfo.Ucred.Pid)
+		return status.Errorf(codes.PermissionDenied, "uid %d is not allowed", authInfo.Ucred.Uid)
+	}
+	return nil
+}
+
+// ParseAllowedUIDs parses a comma-separated list of UIDs.
+// An empty string returns nil, which disables the check.
+func ParseAllowedUIDs(s string) ([]uint32, error) {
+	var uids []uint32
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UID %q", field)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	return uids, nil
+}
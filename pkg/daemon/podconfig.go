@@ -0,0 +1,639 @@
+package daemon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"tailscale.com/net/tsaddr"
+	"tailscale.com/util/dnsname"
+)
+
+// Pod annotations that customize a pod's Tailscale node.
+const (
+	// AnnotationAdvertiseClusterIP, if "true", has the pod's node advertise
+	// the ClusterIPs of the Services that select the pod as subnet routes.
+	AnnotationAdvertiseClusterIP = "tailscale.com/advertise-cluster-ip"
+
+	// AnnotationAttachTimeout overrides how long ADD waits for the pod's
+	// node to come up with a Tailscale IP, as a Go duration (e.g. "90s").
+	AnnotationAttachTimeout = "tailscale.com/attach-timeout"
+
+	// AnnotationDefaultRoute sets where the pod's default route goes:
+	// DefaultRoutePrimary (the default) leaves the primary CNI's in place,
+	// DefaultRouteTailscale sends it via the pod's Tailscale interface to
+	// the exit node in AnnotationExitNode (full tunnel).
+	AnnotationDefaultRoute = "tailscale.com/default-route"
+
+	// AnnotationDNSSearch lists DNS domains (comma-separated, e.g.
+	// "corp.internal") whose names the pod's MagicDNS resolver, 100.100.100.100,
+	// sends to the servers in AnnotationDNSServers.
+	AnnotationDNSSearch = "tailscale.com/dns-search"
+
+	// AnnotationDNSServers lists the nameservers (comma-separated IPs) for
+	// the domains in AnnotationDNSSearch.
+	AnnotationDNSServers = "tailscale.com/dns-servers"
+
+	// AnnotationDERPRegion pins the pod's home DERP region, by numeric region ID.
+	AnnotationDERPRegion = "tailscale.com/derp-region"
+
+	// AnnotationExitNode sets the pod's exit node, by Tailscale IP.
+	AnnotationExitNode = "tailscale.com/exit-node"
+
+	// AnnotationHostname overrides the pod's Tailscale hostname.
+	AnnotationHostname = "tailscale.com/hostname"
+
+	// AnnotationKeepIdentity, if "true", keeps the pod's state Secret and
+	// tailnet device when the pod is deleted, for the next pod of the same
+	// name, as a StatefulSet's replacement pod is, to take over: it comes
+	// up as the same node, with the same IP. It needs the k8s-secret state
+	// backend.
+	AnnotationKeepIdentity = "tailscale.com/keep-identity"
+
+	// AnnotationKeyProfile selects a key profile (-key-profiles) by name,
+	// setting the capabilities of the pod's auth key.
+	AnnotationKeyProfile = "tailscale.com/key-profile"
+
+	// AnnotationRequestIP requests a specific Tailscale IPv4 address for the
+	// pod, e.g. "100.80.0.10". The pod fails to start if it can't have it.
+	AnnotationRequestIP = "tailscale.com/request-ip"
+
+	// AnnotationTags overrides the daemon's tags for the pod (comma-separated,
+	// e.g. "tag:web,tag:prod"), or adds to them with TagMergeAppend. The
+	// OAuth client must own every tag.
+	AnnotationTags = "tailscale.com/tags"
+
+	// AnnotationTagsAppend adds tags to the ones the pod would otherwise
+	// get, from AnnotationTags, its key profile, its namespace or the
+	// daemon (comma-separated, e.g. "tag:plex").
+	AnnotationTagsAppend = "tailscale.com/tags-append"
+)
+
+// Tag merge modes select what AnnotationTags does to the tags the pod would
+// otherwise get.
+const (
+	// TagMergeReplace uses the annotation's tags instead.
+	TagMergeReplace = "replace"
+
+	// TagMergeAppend adds them, as AnnotationTagsAppend does.
+	TagMergeAppend = "append"
+)
+
+// ValidateTagMerge returns an error if mode is not a known tag merge mode.
+func ValidateTagMerge(mode string) error {
+	switch mode {
+	case TagMergeReplace, TagMergeAppend:
+		return nil
+	}
+	return fmt.Errorf("unknown tag merge mode %q (want %q or %q)", mode, TagMergeReplace, TagMergeAppend)
+}
+
+// Values of AnnotationDefaultRoute.
+const (
+	DefaultRoutePrimary   = "primary"
+	DefaultRouteTailscale = "tailscale"
+)
+
+// maxAttachTimeout caps AnnotationAttachTimeout at the CNI plugin's own
+// deadline for ADD; the plugin gives up on a longer wait anyway.
+const maxAttachTimeout = 120 * time.Second
+
+// PodConfig is per-pod configuration read from the pod's annotations.
+// The zero value means no overrides.
+type PodConfig struct {
+	// AdvertiseClusterIP advertises the ClusterIPs of the Services that
+	// select the pod as subnet routes.
+	AdvertiseClusterIP bool
+
+	// AttachTimeout is how long to wait for the node's Tailscale IP, at
+	// most maxAttachTimeout, or 0 for the daemon's default.
+	AttachTimeout time.Duration
+
+	// DERPRegion is the preferred home DERP region ID, or 0 to let
+	// Tailscale pick the nearest region.
+	DERPRegion int
+
+	// DNSSearch are the domains whose names the node's resolver sends to
+	// DNSServers instead of the tailnet's DNS settings. Both are set or
+	// neither is.
+	DNSSearch  []string
+	DNSServers []netip.Addr
+
+	// ExitNode is the Tailscale IP of the node's exit node, or the zero
+	// Addr for none.
+	ExitNode netip.Addr
+
+	// FullTunnel replaces the pod's default routes with ones via its
+	// Tailscale interface, to ExitNode.
+	FullTunnel bool
+
+	// Hostname is the requested Tailscale hostname, or "" for the default
+	// <cluster>-<namespace>-<pod>. It is sanitized before use.
+	Hostname string
+
+	// KeepIdentity keeps the pod's state and device for the next pod of
+	// the same name.
+	KeepIdentity bool
+
+	// KeyProfile names the key profile the pod's auth key is created
+	// with, or "" for the default capabilities.
+	KeyProfile string
+
+	// Tags are the requested Tailscale tags, or nil for the daemon's tags.
+	Tags []string
+
+	// TagsAppend are tags added to Tags, or to the daemon's tags if Tags
+	// is nil, by withAppendedTags.
+	TagsAppend []string
+
+	// RequestIP is the requested Tailscale IPv4 address, or the zero Addr
+	// to take whatever the tailnet assigns.
+	RequestIP netip.Addr
+
+	// hostnameTemplate builds the hostname when Hostname is unset.
+	// nil means the default <cluster>-<namespace>-<pod>.
+	hostnameTemplate *template.Template
+
+	// keyProfile is the profile KeyProfile names, set by withKeyProfile.
+	keyProfile *KeyProfile
+
+	// clusterIPRoutes are the routes AdvertiseClusterIP advertises, looked
+	// up when the node is created.
+	clusterIPRoutes []netip.Prefix
+}
+
+// withNamespaceDefaults fills in settings the pod's annotations left unset
+// from its namespace's defaults.
+func (c PodConfig) withNamespaceDefaults(d NamespaceDefaults) PodConfig {
+	if len(c.Tags) == 0 {
+		c.Tags = d.Tags
+	}
+	if c.Hostname == "" {
+		c.hostnameTemplate = d.hostnameTemplate
+	}
+	return c
+}
+
+// Hostname suffixes for keeping generated pod hostnames unique.
+const (
+	// HostnameSuffixNone uses generated hostnames as-is. Pods that generate
+	// the same name get Tailscale's own -1, -2, ... suffixes.
+	HostnameSuffixNone = ""
+
+	// HostnameSuffixUID appends a short hash of the pod's UID, which is
+	// stable for the pod's lifetime and unique across the cluster.
+	HostnameSuffixUID = "uid"
+)
+
+// uidSuffixLen is the number of hex characters of the UID hash used as a
+// hostname suffix.
+const uidSuffixLen = 6
+
+// ValidateHostnameSuffix returns an error if suffix is not a known hostname suffix.
+func ValidateHostnameSuffix(suffix string) error {
+	switch suffix {
+	case HostnameSuffixNone, HostnameSuffixUID:
+		return nil
+	}
+	return fmt.Errorf("unknown hostname suffix %q (want %q or empty)", suffix, HostnameSuffixUID)
+}
+
+// Routing modes select how packets get between a pod's interface and its
+// Tailscale node.
+const (
+	// RoutingModeKernel routes through the host kernel. The daemon enables
+	// forwarding on the pod's veth and TUN and proxy ARP on the host veth.
+	RoutingModeKernel = "kernel"
+
+	// RoutingModeNetstack writes no sysctls, for nodes where /proc/sys is
+	// read-only. The pod reaches the host veth through a static neighbor
+	// entry instead of proxy ARP, netstack handles subnet-routed traffic, and
+	// host forwarding is left as the node has it.
+	RoutingModeNetstack = "netstack"
+)
+
+// ValidateRoutingMode returns an error if mode is not a known routing mode.
+func ValidateRoutingMode(mode string) error {
+	switch mode {
+	case RoutingModeKernel, RoutingModeNetstack:
+		return nil
+	}
+	return fmt.Errorf("unknown routing mode %q (want %q or %q)", mode, RoutingModeKernel, RoutingModeNetstack)
+}
+
+// uidHostnameSuffix returns the hostname suffix for a pod UID.
+func uidHostnameSuffix(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return hex.EncodeToString(sum[:])[:uidSuffixLen]
+}
+
+// hostnameTemplateData is what a hostname template is executed with.
+type hostnameTemplateData struct {
+	Cluster      string
+	Namespace    string
+	PodName      string
+	CleanPodName string // PodName reduced to hostname-safe characters
+}
+
+// ParseHostnameTemplate parses a text/template hostname template, such as
+// "{{.Namespace}}-{{.PodName}}". The template is test-executed so references
+// to unknown fields are caught here rather than on a pod's first ADD.
+func ParseHostnameTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("hostname").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	sample := hostnameTemplateData{Cluster: "k8s", Namespace: "default", PodName: "pod", CleanPodName: "pod"}
+	if err := tmpl.Execute(&sb, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// executeHostnameTemplate renders a hostname template. The result still
+// needs sanitizing.
+func executeHostnameTemplate(tmpl *template.Template, data hostnameTemplateData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// parsePodConfig builds a PodConfig from pod annotations.
+// Unrelated annotations are ignored.
+func parsePodConfig(annotations map[string]string) (PodConfig, error) {
+	var cfg PodConfig
+	if v, ok := annotations[AnnotationAdvertiseClusterIP]; ok {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not a boolean", AnnotationAdvertiseClusterIP, v)
+		}
+		cfg.AdvertiseClusterIP = b
+	}
+	if v, ok := annotations[AnnotationAttachTimeout]; ok {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil || d <= 0 {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not a positive duration", AnnotationAttachTimeout, v)
+		}
+		cfg.AttachTimeout = min(d, maxAttachTimeout)
+	}
+	if v, ok := annotations[AnnotationDefaultRoute]; ok {
+		switch strings.TrimSpace(v) {
+		case DefaultRoutePrimary:
+		case DefaultRouteTailscale:
+			cfg.FullTunnel = true
+		default:
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not %q or %q", AnnotationDefaultRoute, v, DefaultRoutePrimary, DefaultRouteTailscale)
+		}
+	}
+	if v, ok := annotations[AnnotationDERPRegion]; ok {
+		region, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || region <= 0 {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not a DERP region ID", AnnotationDERPRegion, v)
+		}
+		cfg.DERPRegion = region
+	}
+	if v, ok := annotations[AnnotationDNSSearch]; ok {
+		for _, domain := range strings.Split(v, ",") {
+			domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+			if domain == "" {
+				continue
+			}
+			if _, err := dnsname.ToFQDN(domain); err != nil {
+				return PodConfig{}, fmt.Errorf("annotation %s: %q is not a DNS domain", AnnotationDNSSearch, domain)
+			}
+			cfg.DNSSearch = append(cfg.DNSSearch, strings.ToLower(domain))
+		}
+		if len(cfg.DNSSearch) == 0 {
+			return PodConfig{}, fmt.Errorf("annotation %s is empty", AnnotationDNSSearch)
+		}
+	}
+	if v, ok := annotations[AnnotationDNSServers]; ok {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			ip, err := netip.ParseAddr(s)
+			if err != nil || ip.Zone() != "" {
+				return PodConfig{}, fmt.Errorf("annotation %s: %q is not an IP address", AnnotationDNSServers, s)
+			}
+			cfg.DNSServers = append(cfg.DNSServers, ip)
+		}
+		if len(cfg.DNSServers) == 0 {
+			return PodConfig{}, fmt.Errorf("annotation %s is empty", AnnotationDNSServers)
+		}
+	}
+	// Servers for every name would take over the pod's resolution, and
+	// domains without servers have nowhere to go
+	if len(cfg.DNSServers) > 0 && len(cfg.DNSSearch) == 0 {
+		return PodConfig{}, fmt.Errorf("annotation %s needs domains in %s", AnnotationDNSServers, AnnotationDNSSearch)
+	}
+	if len(cfg.DNSSearch) > 0 && len(cfg.DNSServers) == 0 {
+		return PodConfig{}, fmt.Errorf("annotation %s needs servers in %s", AnnotationDNSSearch, AnnotationDNSServers)
+	}
+	if v, ok := annotations[AnnotationExitNode]; ok {
+		ip, err := netip.ParseAddr(strings.TrimSpace(v))
+		if err != nil || !tsaddr.IsTailscaleIP(ip) {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not a Tailscale IP", AnnotationExitNode, v)
+		}
+		cfg.ExitNode = ip
+	}
+	if cfg.FullTunnel && !cfg.ExitNode.IsValid() {
+		// Without an exit node, nothing on the tailnet carries the traffic
+		return PodConfig{}, fmt.Errorf("annotation %s: %q needs an exit node in %s", AnnotationDefaultRoute, DefaultRouteTailscale, AnnotationExitNode)
+	}
+	if v, ok := annotations[AnnotationHostname]; ok {
+		cfg.Hostname = strings.TrimSpace(v)
+		if cfg.Hostname == "" {
+			return PodConfig{}, fmt.Errorf("annotation %s is empty", AnnotationHostname)
+		}
+	}
+	if v, ok := annotations[AnnotationKeepIdentity]; ok {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not a boolean", AnnotationKeepIdentity, v)
+		}
+		cfg.KeepIdentity = b
+	}
+	if v, ok := annotations[AnnotationKeyProfile]; ok {
+		cfg.KeyProfile = strings.TrimSpace(v)
+		if cfg.KeyProfile == "" {
+			return PodConfig{}, fmt.Errorf("annotation %s is empty", AnnotationKeyProfile)
+		}
+	}
+	if v, ok := annotations[AnnotationRequestIP]; ok {
+		ip, err := netip.ParseAddr(strings.TrimSpace(v))
+		if err != nil || !ip.Is4() {
+			return PodConfig{}, fmt.Errorf("annotation %s: %q is not an IPv4 address", AnnotationRequestIP, v)
+		}
+		if !tsaddr.IsTailscaleIPv4(ip) || ip == tsaddr.TailscaleServiceIP() {
+			return PodConfig{}, fmt.Errorf("annotation %s: %s is not an assignable Tailscale address (want one in %s)", AnnotationRequestIP, ip, tsaddr.CGNATRange())
+		}
+		cfg.RequestIP = ip
+	}
+	if v, ok := annotations[AnnotationTags]; ok {
+		tags, err := parseTagsAnnotation(AnnotationTags, v)
+		if err != nil {
+			return PodConfig{}, err
+		}
+		cfg.Tags = tags
+	}
+	if v, ok := annotations[AnnotationTagsAppend]; ok {
+		tags, err := parseTagsAnnotation(AnnotationTagsAppend, v)
+		if err != nil {
+			return PodConfig{}, err
+		}
+		cfg.TagsAppend = tags
+	}
+	return cfg, nil
+}
+
+// parseTagsAnnotation parses the comma-separated tags in annotation name.
+func parseTagsAnnotation(name, v string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(v, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+			return nil, fmt.Errorf("annotation %s: %q is not a tag", name, tag)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("annotation %s is empty", name)
+	}
+	return tags, nil
+}
+
+// withTagMerge applies the daemon's tag merge mode: with TagMergeAppend, the
+// pod's AnnotationTags add to the tags it would otherwise get instead of
+// replacing them. Call it before filling in defaults.
+func (c PodConfig) withTagMerge(mode string) PodConfig {
+	if mode == TagMergeAppend && len(c.Tags) > 0 {
+		c.TagsAppend = slices.Concat(c.Tags, c.TagsAppend)
+		c.Tags = nil
+	}
+	return c
+}
+
+// withAppendedTags adds TagsAppend to the pod's tags, or to daemonTags if
+// it has none of its own, dropping duplicates. Call it after filling in
+// defaults.
+func (c PodConfig) withAppendedTags(daemonTags []string) PodConfig {
+	if len(c.TagsAppend) == 0 {
+		return c
+	}
+	base := c.Tags
+	if len(base) == 0 {
+		base = daemonTags
+	}
+	var tags []string
+	for _, tag := range slices.Concat(base, c.TagsAppend) {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	c.Tags = tags
+	return c
+}
+
+// getPodAnnotations returns a pod's annotations. Without a Kubernetes client
+// (the daemon isn't running in-cluster) it returns none. If podUID is set
+// and the pod by that name has another UID, the container's pod was deleted
+// and a new one created with the same name, as CronJobs and StatefulSets
+// do, and getPodAnnotations fails with errPodReplaced rather than return
+// the new pod's annotations.
+func getPodAnnotations(ctx context.Context, kube *KubeClient, namespace, podName, podUID string) (map[string]string, error) {
+	if kube == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	pod, err := kube.GetPod(ctx, namespace, podName)
+	if err != nil {
+		return nil, fmt.Errorf("getting pod %s/%s: %w", namespace, podName, err)
+	}
+	if podUID != "" && pod.Metadata.UID != podUID {
+		return nil, fmt.Errorf("%w: %s/%s has UID %s, container's pod had %s", errPodReplaced, namespace, podName, pod.Metadata.UID, podUID)
+	}
+	return pod.Metadata.Annotations, nil
+}
+
+// Reading a pod's annotations is tried annotationAttempts times, backing off
+// from annotationRetryDelay, within kubeRequestTimeout in all.
+const (
+	annotationAttempts   = 3
+	annotationRetryDelay = 200 * time.Millisecond
+)
+
+// annotationCacheSize bounds the pods podAnnotationCache remembers.
+const annotationCacheSize = 1024
+
+// podAnnotationCache remembers the annotations last read for each pod, by
+// UID, so an ADD during an API server outage can use them. Only pods whose
+// containers are ADDed again benefit; a new pod has nothing cached, and is
+// brought up with the daemon's defaults instead.
+type podAnnotationCache struct {
+	mu    sync.Mutex
+	byUID map[string]map[string]string
+}
+
+func newPodAnnotationCache() *podAnnotationCache {
+	return &podAnnotationCache{byUID: make(map[string]map[string]string)}
+}
+
+// read returns a pod's annotations as getPodAnnotations does, retrying
+// errors that may be transient. If every attempt fails it returns those
+// last read for podUID, if any, and otherwise the error.
+func (c *podAnnotationCache) read(ctx context.Context, kube *KubeClient, namespace, podName, podUID string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+
+	delay := annotationRetryDelay
+	var err error
+retry:
+	for attempt := 1; ; attempt++ {
+		var annotations map[string]string
+		if annotations, err = getPodAnnotations(ctx, kube, namespace, podName, podUID); err == nil {
+			c.put(podUID, annotations)
+			return annotations, nil
+		}
+		if attempt >= annotationAttempts || !kubeRetryable(err) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break retry
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	if errors.Is(err, errPodReplaced) {
+		return nil, err
+	}
+	if cached, ok := c.get(podUID); ok {
+		log.Printf("Warning: using cached annotations for pod %s/%s: %v", namespace, podName, err)
+		return cached, nil
+	}
+	return nil, err
+}
+
+// kubeRetryable reports whether a failed API request may succeed if
+// retried: it didn't get an answer, or the API server was overloaded or
+// failing.
+func kubeRetryable(err error) bool {
+	var apiErr *kubeAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return !errors.Is(err, errPodReplaced)
+}
+
+func (c *podAnnotationCache) get(podUID string) (map[string]string, bool) {
+	if podUID == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	annotations, ok := c.byUID[podUID]
+	return annotations, ok
+}
+
+// put remembers a pod's annotations. Once the cache is full, an arbitrary
+// pod is forgotten to make room.
+func (c *podAnnotationCache) put(podUID string, annotations map[string]string) {
+	if podUID == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.byUID[podUID]; !ok && len(c.byUID) >= annotationCacheSize {
+		for uid := range c.byUID {
+			delete(c.byUID, uid)
+			break
+		}
+	}
+	c.byUID[podUID] = maps.Clone(annotations)
+}
+
+// forget drops a deleted pod's annotations.
+func (c *podAnnotationCache) forget(podUID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.byUID, podUID)
+}
+
+// getClusterIPRoutes returns a route to each ClusterIP of the Services in
+// the pod's namespace that select it.
+func getClusterIPRoutes(ctx context.Context, kube *KubeClient, namespace, podName string) ([]netip.Prefix, error) {
+	if kube == nil {
+		return nil, fmt.Errorf("no Kubernetes API client")
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	pod, err := kube.GetPod(ctx, namespace, podName)
+	if err != nil {
+		return nil, fmt.Errorf("getting pod %s/%s: %w", namespace, podName, err)
+	}
+	services, err := kube.ListServices(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("listing services in %s: %w", namespace, err)
+	}
+	return clusterIPRoutes(services, pod.Metadata.Labels), nil
+}
+
+// clusterIPRoutes returns a host route to each ClusterIP of the services
+// whose selector matches labels, sorted. Services without a selector or a
+// ClusterIP (headless ones) are skipped.
+func clusterIPRoutes(services []kubeService, labels map[string]string) []netip.Prefix {
+	var routes []netip.Prefix
+	for _, svc := range services {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selected := true
+		for k, v := range svc.Spec.Selector {
+			if labels[k] != v {
+				selected = false
+				break
+			}
+		}
+		if !selected {
+			continue
+		}
+		ips := svc.Spec.ClusterIPs
+		if len(ips) == 0 {
+			ips = []string{svc.Spec.ClusterIP}
+		}
+		for _, s := range ips {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				continue // "None" or unset
+			}
+			route := netip.PrefixFrom(ip, ip.BitLen())
+			if !slices.Contains(routes, route) {
+				routes = append(routes, route)
+			}
+		}
+	}
+	slices.SortFunc(routes, func(a, b netip.Prefix) int { return a.Addr().Compare(b.Addr()) })
+	return routes
+}
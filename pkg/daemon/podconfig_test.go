@@ -0,0 +1,458 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePodConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        PodConfig
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+			want: PodConfig{},
+		},
+		{
+			name:        "unrelated annotations",
+			annotations: map[string]string{"example.com/foo": "bar"},
+			want:        PodConfig{},
+		},
+		{
+			name:        "advertise cluster IP",
+			annotations: map[string]string{AnnotationAdvertiseClusterIP: "true"},
+			want:        PodConfig{AdvertiseClusterIP: true},
+		},
+		{
+			name:        "advertise cluster IP not a boolean",
+			annotations: map[string]string{AnnotationAdvertiseClusterIP: "yes please"},
+			wantErr:     true,
+		},
+		{
+			name:        "derp region",
+			annotations: map[string]string{AnnotationDERPRegion: "12"},
+			want:        PodConfig{DERPRegion: 12},
+		},
+		{
+			name:        "derp region with spaces",
+			annotations: map[string]string{AnnotationDERPRegion: " 10 "},
+			want:        PodConfig{DERPRegion: 10},
+		},
+		{
+			name:        "derp region not a number",
+			annotations: map[string]string{AnnotationDERPRegion: "nyc"},
+			wantErr:     true,
+		},
+		{
+			name:        "derp region zero",
+			annotations: map[string]string{AnnotationDERPRegion: "0"},
+			wantErr:     true,
+		},
+		{
+			name:        "dns",
+			annotations: map[string]string{AnnotationDNSSearch: "Corp.Internal., lab.example.com", AnnotationDNSServers: "100.100.1.1, fd7a:115c:a1e0::53"},
+			want: PodConfig{
+				DNSSearch:  []string{"corp.internal", "lab.example.com"},
+				DNSServers: []netip.Addr{netip.MustParseAddr("100.100.1.1"), netip.MustParseAddr("fd7a:115c:a1e0::53")},
+			},
+		},
+		{
+			name:        "dns search not a domain",
+			annotations: map[string]string{AnnotationDNSSearch: "corp..internal", AnnotationDNSServers: "100.100.1.1"},
+			wantErr:     true,
+		},
+		{
+			name:        "dns server not an IP",
+			annotations: map[string]string{AnnotationDNSSearch: "corp.internal", AnnotationDNSServers: "ns1.corp.internal"},
+			wantErr:     true,
+		},
+		{
+			name:        "dns servers without domains",
+			annotations: map[string]string{AnnotationDNSServers: "100.100.1.1"},
+			wantErr:     true,
+		},
+		{
+			name:        "dns search without servers",
+			annotations: map[string]string{AnnotationDNSSearch: "corp.internal"},
+			wantErr:     true,
+		},
+		{
+			name:        "exit node",
+			annotations: map[string]string{AnnotationExitNode: "100.80.0.1"},
+			want:        PodConfig{ExitNode: netip.MustParseAddr("100.80.0.1")},
+		},
+		{
+			name:        "exit node not on the tailnet",
+			annotations: map[string]string{AnnotationExitNode: "10.0.0.1"},
+			wantErr:     true,
+		},
+		{
+			name:        "full tunnel",
+			annotations: map[string]string{AnnotationDefaultRoute: "tailscale", AnnotationExitNode: "fd7a:115c:a1e0::1"},
+			want:        PodConfig{ExitNode: netip.MustParseAddr("fd7a:115c:a1e0::1"), FullTunnel: true},
+		},
+		{
+			name:        "primary default route",
+			annotations: map[string]string{AnnotationDefaultRoute: "primary"},
+			want:        PodConfig{},
+		},
+		{
+			name:        "full tunnel without exit node",
+			annotations: map[string]string{AnnotationDefaultRoute: "tailscale"},
+			wantErr:     true,
+		},
+		{
+			name:        "unknown default route",
+			annotations: map[string]string{AnnotationDefaultRoute: "exit-node"},
+			wantErr:     true,
+		},
+		{
+			name:        "hostname",
+			annotations: map[string]string{AnnotationHostname: " web "},
+			want:        PodConfig{Hostname: "web"},
+		},
+		{
+			name:        "empty hostname",
+			annotations: map[string]string{AnnotationHostname: ""},
+			wantErr:     true,
+		},
+		{
+			name:        "keep identity",
+			annotations: map[string]string{AnnotationKeepIdentity: "true"},
+			want:        PodConfig{KeepIdentity: true},
+		},
+		{
+			name:        "keep identity not a boolean",
+			annotations: map[string]string{AnnotationKeepIdentity: "forever"},
+			wantErr:     true,
+		},
+		{
+			name:        "tags",
+			annotations: map[string]string{AnnotationTags: "tag:web, tag:prod,"},
+			want:        PodConfig{Tags: []string{"tag:web", "tag:prod"}},
+		},
+		{
+			name:        "tag without prefix",
+			annotations: map[string]string{AnnotationTags: "tag:web,prod"},
+			wantErr:     true,
+		},
+		{
+			name:        "empty tags",
+			annotations: map[string]string{AnnotationTags: " , "},
+			wantErr:     true,
+		},
+		{
+			name:        "appended tags",
+			annotations: map[string]string{AnnotationTagsAppend: "tag:plex"},
+			want:        PodConfig{TagsAppend: []string{"tag:plex"}},
+		},
+		{
+			name:        "appended tag without prefix",
+			annotations: map[string]string{AnnotationTagsAppend: "plex"},
+			wantErr:     true,
+		},
+		{
+			name:        "attach timeout",
+			annotations: map[string]string{AnnotationAttachTimeout: "90s"},
+			want:        PodConfig{AttachTimeout: 90 * time.Second},
+		},
+		{
+			name:        "attach timeout clamped",
+			annotations: map[string]string{AnnotationAttachTimeout: "10m"},
+			want:        PodConfig{AttachTimeout: maxAttachTimeout},
+		},
+		{
+			name:        "attach timeout not a duration",
+			annotations: map[string]string{AnnotationAttachTimeout: "90"},
+			wantErr:     true,
+		},
+		{
+			name:        "attach timeout zero",
+			annotations: map[string]string{AnnotationAttachTimeout: "0s"},
+			wantErr:     true,
+		},
+		{
+			name:        "request ip",
+			annotations: map[string]string{AnnotationRequestIP: "100.80.0.10"},
+			want:        PodConfig{RequestIP: netip.MustParseAddr("100.80.0.10")},
+		},
+		{
+			name:        "request ip not an address",
+			annotations: map[string]string{AnnotationRequestIP: "web"},
+			wantErr:     true,
+		},
+		{
+			name:        "request ip v6",
+			annotations: map[string]string{AnnotationRequestIP: "fd7a:115c:a1e0::1"},
+			wantErr:     true,
+		},
+		{
+			name:        "request ip outside cgnat",
+			annotations: map[string]string{AnnotationRequestIP: "10.0.0.1"},
+			wantErr:     true,
+		},
+		{
+			name:        "request ip quad100",
+			annotations: map[string]string{AnnotationRequestIP: "100.100.100.100"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePodConfig(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePodConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePodConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterIPRoutes(t *testing.T) {
+	service := func(selector map[string]string, clusterIP string, clusterIPs ...string) kubeService {
+		var s kubeService
+		s.Spec.Selector = selector
+		s.Spec.ClusterIP = clusterIP
+		s.Spec.ClusterIPs = clusterIPs
+		return s
+	}
+	services := []kubeService{
+		service(map[string]string{"app": "web"}, "10.96.0.20"),
+		service(map[string]string{"app": "web", "tier": "front"}, "10.96.0.10", "10.96.0.10", "fd00::10"),
+		service(map[string]string{"app": "db"}, "10.96.0.30"),
+		service(map[string]string{"app": "web"}, "None"),
+		service(nil, "10.96.0.40"),
+		service(map[string]string{"app": "web"}, "10.96.0.20"),
+	}
+	got := clusterIPRoutes(services, map[string]string{"app": "web", "tier": "front"})
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.96.0.10/32"),
+		netip.MustParsePrefix("10.96.0.20/32"),
+		netip.MustParsePrefix("fd00::10/128"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("clusterIPRoutes() = %v, want %v", got, want)
+	}
+	if got := clusterIPRoutes(services, map[string]string{"app": "other"}); got != nil {
+		t.Errorf("clusterIPRoutes() for an unselected pod = %v, want none", got)
+	}
+}
+
+func TestParseHostnameTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		data    hostnameTemplateData
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "namespace and pod",
+			text: "{{.Namespace}}-{{.PodName}}",
+			data: hostnameTemplateData{Namespace: "default", PodName: "web-0"},
+			want: "default-web-0",
+		},
+		{
+			name: "all fields",
+			text: "{{.Cluster}}.{{.Namespace}}.{{.CleanPodName}}",
+			data: hostnameTemplateData{Cluster: "prod", Namespace: "default", CleanPodName: "web-0"},
+			want: "prod.default.web-0",
+		},
+		{
+			name:    "parse error",
+			text:    "{{.Namespace",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			text:    "{{.Node}}-{{.PodName}}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseHostnameTemplate(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHostnameTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, err := executeHostnameTemplate(tmpl, tt.data)
+			if err != nil {
+				t.Fatalf("executeHostnameTemplate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("executeHostnameTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateHostnameSuffix(t *testing.T) {
+	for _, suffix := range []string{HostnameSuffixNone, HostnameSuffixUID} {
+		if err := ValidateHostnameSuffix(suffix); err != nil {
+			t.Errorf("ValidateHostnameSuffix(%q) error = %v", suffix, err)
+		}
+	}
+	if err := ValidateHostnameSuffix("random"); err == nil {
+		t.Errorf("ValidateHostnameSuffix(%q): want error", "random")
+	}
+}
+
+func TestValidateTagMerge(t *testing.T) {
+	for _, mode := range []string{TagMergeReplace, TagMergeAppend} {
+		if err := ValidateTagMerge(mode); err != nil {
+			t.Errorf("ValidateTagMerge(%q) error = %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"", "merge"} {
+		if err := ValidateTagMerge(mode); err == nil {
+			t.Errorf("ValidateTagMerge(%q): want error", mode)
+		}
+	}
+}
+
+func TestTagMerge(t *testing.T) {
+	daemonTags := []string{"tag:k8s-pod"}
+	tests := []struct {
+		name        string
+		mode        string
+		annotations map[string]string
+		nsTags      []string
+		want        []string
+	}{
+		{"no annotations", TagMergeReplace, nil, nil, nil},
+		{"replace", TagMergeReplace, map[string]string{AnnotationTags: "tag:plex"}, nil, []string{"tag:plex"}},
+		{"replace namespace tags", TagMergeReplace, map[string]string{AnnotationTags: "tag:plex"}, []string{"tag:media"}, []string{"tag:plex"}},
+		{"append", TagMergeAppend, map[string]string{AnnotationTags: "tag:plex"}, nil, []string{"tag:k8s-pod", "tag:plex"}},
+		{"append to namespace tags", TagMergeAppend, map[string]string{AnnotationTags: "tag:plex"}, []string{"tag:media"}, []string{"tag:media", "tag:plex"}},
+		{"append annotation", TagMergeReplace, map[string]string{AnnotationTagsAppend: "tag:plex"}, nil, []string{"tag:k8s-pod", "tag:plex"}},
+		{"append annotation to replaced tags", TagMergeReplace, map[string]string{AnnotationTags: "tag:web", AnnotationTagsAppend: "tag:plex"}, nil, []string{"tag:web", "tag:plex"}},
+		{"dedup", TagMergeAppend, map[string]string{AnnotationTags: "tag:plex,tag:k8s-pod", AnnotationTagsAppend: "tag:plex"}, nil, []string{"tag:k8s-pod", "tag:plex"}},
+	}
+	for _, tt := range tests {
+		cfg, err := parsePodConfig(tt.annotations)
+		if err != nil {
+			t.Fatalf("parsePodConfig(%s) error = %v", tt.name, err)
+		}
+		cfg = cfg.withTagMerge(tt.mode).withNamespaceDefaults(NamespaceDefaults{Tags: tt.nsTags}).withAppendedTags(daemonTags)
+		if !reflect.DeepEqual(cfg.Tags, tt.want) {
+			t.Errorf("%s: tags = %v, want %v", tt.name, cfg.Tags, tt.want)
+		}
+	}
+}
+
+func TestValidateRoutingMode(t *testing.T) {
+	for _, mode := range []string{RoutingModeKernel, RoutingModeNetstack} {
+		if err := ValidateRoutingMode(mode); err != nil {
+			t.Errorf("ValidateRoutingMode(%q) error = %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"", "userspace"} {
+		if err := ValidateRoutingMode(mode); err == nil {
+			t.Errorf("ValidateRoutingMode(%q): want error", mode)
+		}
+	}
+}
+
+func TestUIDHostnameSuffix(t *testing.T) {
+	a := uidHostnameSuffix("5f0c2a9e-1b3d-4c6e-8f7a-9b0c1d2e3f4a")
+	if len(a) != uidSuffixLen {
+		t.Errorf("uidHostnameSuffix() = %q, want %d characters", a, uidSuffixLen)
+	}
+	if a != uidHostnameSuffix("5f0c2a9e-1b3d-4c6e-8f7a-9b0c1d2e3f4a") {
+		t.Errorf("uidHostnameSuffix() not deterministic")
+	}
+	if a == uidHostnameSuffix("5f0c2a9e-1b3d-4c6e-8f7a-9b0c1d2e3f4b") {
+		t.Errorf("uidHostnameSuffix() same for different UIDs")
+	}
+}
+
+func TestGetPodAnnotations(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"metadata": {"name": "job-0", "uid": "uid-2", "annotations": {"tailscale.com/tags": "tag:batch"}}}`))
+	}))
+	defer srv.Close()
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kube := &KubeClient{baseURL: srv.URL, tokenPath: tokenPath, httpClient: srv.Client()}
+
+	for _, uid := range []string{"uid-2", ""} {
+		got, err := getPodAnnotations(context.Background(), kube, "default", "job-0", uid)
+		if err != nil || got["tailscale.com/tags"] != "tag:batch" {
+			t.Errorf("getPodAnnotations() with UID %q = %v, %v", uid, got, err)
+		}
+	}
+
+	// The pod was deleted and another created under its name
+	got, err := getPodAnnotations(context.Background(), kube, "default", "job-0", "uid-1")
+	if !errors.Is(err, errPodReplaced) || got != nil {
+		t.Errorf("getPodAnnotations() for a replaced pod = %v, %v; want errPodReplaced", got, err)
+	}
+}
+
+func TestPodAnnotationCache(t *testing.T) {
+	var calls, failures int
+	status := http.StatusServiceUnavailable
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if failures > 0 {
+			failures--
+			http.Error(w, "etcdserver: request timed out", status)
+			return
+		}
+		w.Write([]byte(`{"metadata": {"name": "web-0", "uid": "uid-1", "annotations": {"tailscale.com/tags": "tag:web"}}}`))
+	}))
+	defer srv.Close()
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kube := &KubeClient{baseURL: srv.URL, tokenPath: tokenPath, httpClient: srv.Client()}
+	cache := newPodAnnotationCache()
+
+	// A blip is retried
+	failures = 1
+	got, err := cache.read(context.Background(), kube, "default", "web-0", "uid-1")
+	if err != nil || got["tailscale.com/tags"] != "tag:web" || calls != 2 {
+		t.Fatalf("read() after a 503 = %v, %v in %d calls; want the annotations in 2", got, err, calls)
+	}
+
+	// An outage falls back to what was last read
+	calls, failures = 0, annotationAttempts
+	got, err = cache.read(context.Background(), kube, "default", "web-0", "uid-1")
+	if err != nil || got["tailscale.com/tags"] != "tag:web" || calls != annotationAttempts {
+		t.Errorf("read() during an outage = %v, %v in %d calls; want the cached annotations in %d", got, err, calls, annotationAttempts)
+	}
+
+	// A pod never read has nothing to fall back to
+	calls, failures = 0, annotationAttempts
+	if got, err = cache.read(context.Background(), kube, "default", "web-1", "uid-2"); err == nil {
+		t.Errorf("read() of an uncached pod during an outage = %v, want an error", got)
+	}
+
+	// Errors a retry can't fix aren't retried, and a deleted pod is forgotten
+	cache.forget("uid-1")
+	calls, failures, status = 0, 1, http.StatusForbidden
+	if got, err = cache.read(context.Background(), kube, "default", "web-0", "uid-1"); err == nil || calls != 1 {
+		t.Errorf("read() of a forgotten pod on a 403 = %v, %v in %d calls; want an error in 1", got, err, calls)
+	}
+}
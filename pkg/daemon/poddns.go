@@ -0,0 +1,94 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net/netip"
+
+	"tailscale.com/net/dns"
+	"tailscale.com/types/dnstype"
+	"tailscale.com/util/dnsname"
+	"tailscale.com/wgengine"
+	"tailscale.com/wgengine/router"
+	"tailscale.com/wgengine/wgcfg"
+)
+
+// podDNS is a pod's own split DNS: names under Search are resolved by
+// Servers. The zero value adds nothing to the tailnet's DNS settings.
+type podDNS struct {
+	Search  []string
+	Servers []netip.Addr
+}
+
+// podDNSFromMetadata returns the split DNS recorded in meta. Addresses
+// that don't parse are skipped.
+func podDNSFromMetadata(meta *PodMetadata) podDNS {
+	d := podDNS{Search: meta.DNSSearch}
+	for _, s := range meta.DNSServers {
+		if ip, err := netip.ParseAddr(s); err == nil {
+			d.Servers = append(d.Servers, ip)
+		}
+	}
+	return d
+}
+
+// apply returns cfg with a route for each of d's domains to d's servers,
+// replacing any the tailnet has for the same domain. The empty config a
+// LocalBackend sets when its node is down or its key has expired is left
+// empty.
+func (d podDNS) apply(cfg *dns.Config) *dns.Config {
+	if len(d.Search) == 0 || len(d.Servers) == 0 || cfg == nil || len(cfg.Hosts) == 0 && len(cfg.Routes) == 0 {
+		return cfg
+	}
+	resolvers := make([]*dnstype.Resolver, len(d.Servers))
+	for i, ip := range d.Servers {
+		resolvers[i] = &dnstype.Resolver{Addr: ip.String()}
+	}
+	cfg = cfg.Clone()
+	if cfg.Routes == nil {
+		cfg.Routes = make(map[dnsname.FQDN][]*dnstype.Resolver)
+	}
+	for _, domain := range d.Search {
+		fqdn, err := dnsname.ToFQDN(domain)
+		if err != nil {
+			continue // checked when the annotation was parsed
+		}
+		cfg.Routes[fqdn] = resolvers
+	}
+	return cfg
+}
+
+// podDNSEngine is a pod node's engine with the pod's split DNS added to
+// every DNS config its LocalBackend sets, which the LocalBackend rebuilds
+// from each netmap.
+type podDNSEngine struct {
+	wgengine.Engine
+	dns podDNS
+}
+
+// withPodDNS returns eng, adding d to its DNS configs if it has any
+// domains.
+func withPodDNS(eng wgengine.Engine, d podDNS) wgengine.Engine {
+	if len(d.Search) == 0 {
+		return eng
+	}
+	return &podDNSEngine{Engine: eng, dns: d}
+}
+
+func (e *podDNSEngine) Reconfig(cfg *wgcfg.Config, routerCfg *router.Config, dnsCfg *dns.Config) error {
+	return e.Engine.Reconfig(cfg, routerCfg, e.dns.apply(dnsCfg))
+}
+
+// podResolvConf is the OS side of a pod node's DNS. The daemon leaves the
+// pod's resolv.conf to the kubelet, so there's nothing to configure; it
+// only reports an empty base config, which has 100.100.100.100 answer the
+// names it has records or routes for and fail the rest, so that the pod's
+// resolver moves on to its next nameserver.
+type podResolvConf struct{}
+
+func (podResolvConf) SetDNS(dns.OSConfig) error { return nil }
+func (podResolvConf) SupportsSplitDNS() bool    { return false }
+func (podResolvConf) Close() error              { return nil }
+func (podResolvConf) GetBaseConfig() (dns.OSConfig, error) {
+	return dns.OSConfig{}, nil
+}
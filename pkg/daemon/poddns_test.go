@@ -0,0 +1,58 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/net/dns"
+	"tailscale.com/types/dnstype"
+	"tailscale.com/util/dnsname"
+)
+
+func TestPodDNSApply(t *testing.T) {
+	d := podDNS{
+		Search:  []string{"corp.internal", "ts.net"},
+		Servers: []netip.Addr{netip.MustParseAddr("100.100.1.1")},
+	}
+	tailnet := &dns.Config{
+		Routes: map[dnsname.FQDN][]*dnstype.Resolver{
+			"tailnet-1234.ts.net.": nil,
+			"ts.net.":              {{Addr: "100.64.0.53"}},
+		},
+		Hosts: map[dnsname.FQDN][]netip.Addr{
+			"web-0.tailnet-1234.ts.net.": {netip.MustParseAddr("100.64.0.1")},
+		},
+	}
+
+	got := d.apply(tailnet)
+	for domain, want := range map[dnsname.FQDN]string{
+		"corp.internal.":       "100.100.1.1",
+		"ts.net.":              "100.100.1.1", // the pod's route replaces the tailnet's
+		"tailnet-1234.ts.net.": "",            // MagicDNS is still answered locally
+	} {
+		resolvers, ok := got.Routes[domain]
+		var gotAddr string
+		if len(resolvers) > 0 {
+			gotAddr = resolvers[0].Addr
+		}
+		if !ok || gotAddr != want {
+			t.Errorf("route for %s = %v (found %v), want %q", domain, resolvers, ok, want)
+		}
+	}
+	if len(got.Hosts) != 1 {
+		t.Errorf("apply() hosts = %v, want the tailnet's", got.Hosts)
+	}
+	if _, ok := tailnet.Routes["corp.internal."]; ok || tailnet.Routes["ts.net."][0].Addr != "100.64.0.53" {
+		t.Errorf("apply() modified its argument: %v", tailnet.Routes)
+	}
+
+	// A node that's down gets no DNS at all
+	if got := d.apply(&dns.Config{}); len(got.Routes) != 0 {
+		t.Errorf("apply() to an empty config = %v, want it empty", got.Routes)
+	}
+	if got := (podDNS{}).apply(tailnet); got != tailnet {
+		t.Errorf("zero podDNS changed the config")
+	}
+}
@@ -3,19 +3,25 @@
 package daemon
 
 import (
+	"cmp"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"net/netip"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/containernetworking/plugins/pkg/ns"
@@ -24,13 +30,17 @@ import (
 	"tailscale.com/control/controlclient"
 	"tailscale.com/ipn"
 	"tailscale.com/ipn/ipnlocal"
+	"tailscale.com/ipn/ipnstate"
 	"tailscale.com/ipn/store"
 	"tailscale.com/net/netmon"
 	"tailscale.com/net/tsdial"
 	"tailscale.com/net/tstun"
+	"tailscale.com/tailcfg"
 	"tailscale.com/tsd"
+	"tailscale.com/types/key"
 	"tailscale.com/types/logid"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/eventbus"
 	"tailscale.com/wgengine"
 	"tailscale.com/wgengine/netstack"
 )
@@ -39,14 +49,247 @@ import (
 // Default veth MTU allows for standard 1500-byte ethernet minus WireGuard overhead.
 const defaultVethMTU = 1420
 
+// tailscaleIPTimeout bounds how long a new or recovered node has to come up
+// with a Tailscale IP; tailscaleIPPollInterval is how often it is checked.
+const (
+	tailscaleIPTimeout      = 60 * time.Second
+	tailscaleIPPollInterval = 500 * time.Millisecond
+)
+
+// A failed StartLoginInteractive is retried after loginRetryDelay, doubling
+// each time up to loginRetryMaxDelay.
+const (
+	loginRetryDelay    = time.Second
+	loginRetryMaxDelay = 8 * time.Second
+)
+
+// defaultPodIfName is the pod-side Tailscale interface when another plugin
+// already gave the pod its primary interface.
+const defaultPodIfName = "ts0"
+
+// podGatewayIPv4 is the next hop for Tailscale routes inside the pod in
+// netstack routing mode. It is never assigned to an interface; a permanent
+// neighbor entry in the pod maps it to the host veth's MAC.
+var podGatewayIPv4 = netip.MustParseAddr("169.254.1.1")
+
+// podGatewayIPv6 is the next hop for IPv6 Tailscale routes inside the pod,
+// in both routing modes. Like podGatewayIPv4, it only exists as a permanent
+// neighbor entry.
+var podGatewayIPv6 = netip.MustParseAddr("fe80::1")
+
+// defaultTailscaleRoutes are routed via the pod's Tailscale interface when the
+// CNI config doesn't narrow them: the whole Tailscale CGNAT range and the
+// Tailscale IPv6 ULA range.
+var defaultTailscaleRoutes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("fd7a:115c:a1e0::/48"),
+}
+
+// ParseTailscaleRoutes parses CIDR strings into prefixes, returning
+// defaultTailscaleRoutes if none are given.
+func ParseTailscaleRoutes(cidrs []string) ([]netip.Prefix, error) {
+	if len(cidrs) == 0 {
+		return defaultTailscaleRoutes, nil
+	}
+	routes := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		prefix, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Tailscale route %q: %w", c, err)
+		}
+		routes = append(routes, prefix.Masked())
+	}
+	return routes, nil
+}
+
+// prefixToIPNet converts a netip.Prefix to the *net.IPNet netlink expects.
+func prefixToIPNet(p netip.Prefix) *net.IPNet {
+	return &net.IPNet{
+		IP:   p.Addr().AsSlice(),
+		Mask: net.CIDRMask(p.Bits(), p.Addr().BitLen()),
+	}
+}
+
+// PodManagerConfig holds daemon-wide settings for a PodManager.
+type PodManagerConfig struct {
+	// StateDir is the root directory for per-pod metadata and state.
+	StateDir string
+	// ClusterName is used as the first component of pod hostnames.
+	ClusterName string
+	// HostnameTemplate builds pod hostnames instead of
+	// <cluster>-<namespace>-<pod>. Optional; see ParseHostnameTemplate.
+	HostnameTemplate *template.Template
+	// HostnameSuffix selects a suffix appended to generated hostnames to keep
+	// them unique (HostnameSuffixNone or HostnameSuffixUID).
+	HostnameSuffix string
+	// TagMerge selects whether AnnotationTags replaces or adds to the tags
+	// a pod would otherwise get (TagMergeReplace, the default, or
+	// TagMergeAppend).
+	TagMerge string
+	// StateBackend selects where Tailscale node state is stored
+	// (StateBackendFile or StateBackendKubeSecret). Defaults to StateBackendFile.
+	StateBackend string
+	// StateBackup selects a backup for file-backed state (StateBackupNone or
+	// StateBackupSecret).
+	StateBackup string
+	// StateKeys, if set, encrypt pods' Tailscale state at rest in either
+	// backend. State sealed with an older key, or not at all, is re-sealed
+	// with the current one when its pod is recovered. See LoadStateKeys.
+	StateKeys StateKeys
+	// Kube is the Kubernetes API client. Required for StateBackendKubeSecret
+	// and StateBackupSecret.
+	Kube *KubeClient
+	// RecoveryConcurrency bounds how many pods RecoverPods brings up at once.
+	// Defaults to defaultRecoveryConcurrency.
+	RecoveryConcurrency int
+	// TombstoneDir holds markers the CNI plugin writes for containers deleted
+	// while the daemon was unreachable. Processed by RecoverPods. Optional.
+	TombstoneDir string
+	// ManageIPForward enables IPv4 forwarding for each pod's veth and TUN.
+	ManageIPForward bool
+	// ManageProxyARP enables proxy ARP on each pod's host veth.
+	ManageProxyARP bool
+	// NamespaceConfig supplies per-namespace defaults. Optional.
+	NamespaceConfig *NamespaceConfig
+	// MaxPods caps the number of pods with a Tailscale node; AddPod rejects
+	// pods beyond it with errPodLimit. 0 means no limit.
+	MaxPods int
+	// MaxConcurrentAttach bounds how many pods AddPod brings up at once;
+	// further ADDs wait for a slot. Defaults to defaultMaxConcurrentAttach.
+	MaxConcurrentAttach int
+	// NodeLogLevel filters the log lines of pods' nodes (NodeLogLevelDebug
+	// or NodeLogLevelInfo). Defaults to NodeLogLevelDebug.
+	NodeLogLevel string
+	// QuietNodes drops pods' node log lines other than errors.
+	QuietNodes bool
+	// WireGuardPort, if set, is the first of the UDP ports pods' nodes
+	// listen on for WireGuard: each pod takes the lowest one free from
+	// here up. 0 leaves each node to pick a random port.
+	WireGuardPort uint16
+	// LoginAttempts is how many times a node's login is tried before its
+	// attach or recovery fails. Defaults to defaultLoginAttempts.
+	LoginAttempts int
+	// DERPMap replaces the DERP map from control for every pod, e.g. to use
+	// private relays. Optional; see LoadDERPMap.
+	DERPMap *tailcfg.DERPMap
+	// Events, if set, records Kubernetes Events on pods whose Tailscale IP
+	// changes when they are recovered or reattached.
+	Events *EventRecorder
+	// KeyProfiles are the key profiles pods can select with
+	// AnnotationKeyProfile, by name. Optional; see LoadKeyProfiles.
+	KeyProfiles map[string]*KeyProfile
+	// TailnetLockKey signs new pods' auth keys for a tailnet with tailnet lock
+	// enabled. The zero value disables signing.
+	TailnetLockKey key.NLPrivate
+	// RoutingMode is the routing mode for pods whose CNI config doesn't set
+	// one (RoutingModeKernel or RoutingModeNetstack). Defaults to
+	// RoutingModeKernel.
+	RoutingMode string
+	// TUNInPod moves each new pod's TUN into its netns as its Tailscale
+	// interface, instead of bridging to it from the host with a veth. No
+	// host forwarding or proxy ARP is needed, so routing modes don't apply.
+	// Recovered pods keep the mode they were attached with.
+	TUNInPod bool
+	// HandshakeStaleAfter is how long a node can go without a WireGuard
+	// handshake with any of its active peers before it counts as
+	// flatlined: CHECK fails for it and RunHandshakeWatch reattaches it.
+	// 0 disables both; otherwise it must be at least minHandshakeStaleAfter.
+	HandshakeStaleAfter time.Duration
+	// KeyRenewBefore is how long before a node's key expires that
+	// RunKeyExpiryWatch disables its key expiry, keeping it on the tailnet.
+	// 0 disables the watch.
+	KeyRenewBefore time.Duration
+	// DelDrain is how long DeletePod leaves a pod's node up, so connections
+	// in flight can finish, before taking it offline and shutting it down.
+	// 0 shuts it down at once.
+	DelDrain time.Duration
+	// StateDirTTL is how long RunStateSweep leaves a pod state directory
+	// that no node uses and whose netns is gone before removing it. 0
+	// leaves them.
+	StateDirTTL time.Duration
+	// WarmPoolSize is how many nodes RunWarmPool keeps logged in ahead of
+	// pods, so that an ADD only has to connect one to the pod. Pooled nodes
+	// are ephemeral and have the daemon's tags and routing mode; pods that
+	// set their own tags, key profile or routing mode get a node of their
+	// own. 0 disables the pool.
+	WarmPoolSize int
+}
+
+// defaultRecoveryConcurrency is the number of pods recovered in parallel on
+// daemon startup when not configured.
+const defaultRecoveryConcurrency = 8
+
+// defaultMaxConcurrentAttach is the number of pods AddPod brings up in
+// parallel when not configured.
+const defaultMaxConcurrentAttach = 16
+
+// minHandshakeStaleAfter is the shortest HandshakeStaleAfter allowed.
+// WireGuard renews a session's handshake every two minutes while it is in
+// use, so anything shorter would flag healthy nodes.
+const minHandshakeStaleAfter = 3 * time.Minute
+
+// defaultLoginAttempts is how many times a node's login is tried when not
+// configured.
+const defaultLoginAttempts = 3
+
 // PodManager manages Tailscale nodes for pods using LocalBackend + TUN.
 type PodManager struct {
-	stateDir    string
-	clusterName string
-	oauthMgr    *OAuthManager
-
-	mu      sync.RWMutex
-	servers map[string]*ManagedServer // containerID -> server
+	stateDir     string
+	clusterName  string
+	hostnameTmpl *template.Template
+	hostnameSfx  string
+	tagMerge     string
+	stateBackend string
+	stateBackup  string
+	stateKeys    StateKeys
+	hostNetns    netnsID // zero if it couldn't be read
+	kube         *KubeClient
+	annotations  *podAnnotationCache
+	authKeys     AuthKeyProvider
+	oauthMgr     *OAuthManager // authKeys, if it's an OAuthManager; nil without API access
+	nsConfig     *NamespaceConfig
+
+	recoveryConcurrency int
+	tombstoneDir        string
+	recovered           atomic.Bool // set once RecoverPods has run
+	recoveryReport      atomic.Pointer[RecoveryReport]
+
+	manageIPForward bool
+	manageProxyARP  bool
+	routingMode     string
+	tunInPod        bool
+	nodeLogLevel    string
+	quietNodes      bool
+	derpMap         *tailcfg.DERPMap
+	keyProfiles     map[string]*KeyProfile
+	events          *EventRecorder
+	watchers        podWatchers
+	tailnetLockKey  key.NLPrivate
+	sysctlMu        sync.Mutex
+	ipForwardPrev   string // ip_forward before we enabled it, "" if we didn't
+
+	maxPods       int
+	staleAfter    time.Duration // HandshakeStaleAfter, 0 if disabled
+	renewBefore   time.Duration // KeyRenewBefore, 0 if disabled
+	delDrain      time.Duration // DelDrain, 0 if disabled
+	stateDirTTL   time.Duration // StateDirTTL, 0 if disabled
+	attachSem     chan struct{} // bounds concurrent AddPod bring-ups
+	loginAttempts int           // tries at StartLoginInteractive per node start
+	wgBasePort    uint16        // first WireGuard port, 0 for random ports
+	pool          *warmPool
+
+	nl netlinkOps // hostNetlink, or a fake in tests
+
+	netMonMu  sync.Mutex
+	netMonBus *eventbus.Bus
+	netMon    *netmon.Monitor // shared by all pods, created on first use
+
+	mu        sync.RWMutex
+	servers     map[string]*ManagedServer          // containerID -> server
+	wgPorts     map[string]uint16                  // containerID -> WireGuard port, for pods running or starting
+	routeTables map[string]int                     // containerID -> routing table, for veth pods running or starting
+	attaching   map[string]chan struct{}           // containerID -> closed when its AddPod, reattach or DEL finishes
+	cancelAdd   map[string]context.CancelCauseFunc // containerID -> cancels its in-flight AddPod
 }
 
 // ManagedServer represents a Tailscale node managed for a pod.
@@ -54,16 +297,40 @@ type ManagedServer struct {
 	Backend       *ipnlocal.LocalBackend
 	Engine        wgengine.Engine
 	Sys           *tsd.System
-	NetMon        *netmon.Monitor
+	NetMon        *netmon.Monitor // shared with other pods; don't close
 	ContainerID   string
 	PodName       string
 	Namespace     string
+	PodUID        string
 	Hostname      string
+	DNSName       string // MagicDNS name when the node came up, "" if it had none
+	Renamed       string // hostname control gave the node instead of Hostname, "" if none
 	ClusterIP     string
-	HostVethName  string
+	HostVethName  string // "" for a TUN in the pod
+	PodIfName     string // pod-side interface name
+	NetnsPath     string // the pod's netns, as from canonicalNetns
 	TailscaleIPv4 netip.Addr
 	TailscaleIPv6 netip.Addr
+	Routes        []netip.Prefix // CIDRs routed via the pod's Tailscale interface
+	Advertised    []netip.Prefix // Service ClusterIP routes the node advertises
+	DeviceID      string         // stable node ID, used to delete the device on DEL
+	DERPRegion    int            // preferred home DERP region from annotations, 0 if unset
+	Tags          []string       // tags from annotations or namespace defaults, nil for the daemon's tags
+	RoutingMode   string         // RoutingModeKernel or RoutingModeNetstack
+	WireGuardPort uint16         // WireGuard listen port, 0 if random
+	TUNInPod      bool           // the TUN is the pod's interface, with no veth
+	RouteTableID  int            // host routing table for the pod's routes, 0 for a TUN in the pod
+	ExitNode      netip.Addr     // exit node from annotations, zero if none
+	FullTunnel    bool           // the pod's default routes go via its Tailscale interface
+	PrimaryRoutes []PrimaryRoute // default routes FullTunnel replaced, restored on DEL
+	DNS           podDNS         // split DNS from annotations, zero if none
+	KeepIdentity  bool           // the node's state and device outlive the pod
 	CreatedAt     time.Time
+
+	stopLinkChanges func()      // stops forwarding NetMon changes to Sys.Bus
+	tunDev          tun.Device  // the pod's TUN, owned by Engine
+	poolDir         string      // the node's state directory from the warm pool, if it came from there
+	unhealthy       atomic.Bool // the last health check failed; see noteHealth
 }
 
 // PodMetadata is persisted to disk for recovery.
@@ -71,37 +338,224 @@ type PodMetadata struct {
 	ContainerID   string    `json:"containerId"`
 	PodName       string    `json:"podName"`
 	Namespace     string    `json:"namespace"`
+	PodUID        string    `json:"podUid,omitempty"`
 	Hostname      string    `json:"hostname"`
+	DNSName       string    `json:"dnsName,omitempty"`
+	Renamed       string    `json:"renamed,omitempty"`
 	TailscaleIPv4 string    `json:"tailscaleIpv4"`
 	TailscaleIPv6 string    `json:"tailscaleIpv6"`
 	CreatedAt     time.Time `json:"createdAt"`
 	NetnsPath     string    `json:"netnsPath"`
 	HostVethName  string    `json:"hostVethName"`
+	PodIfName     string    `json:"podIfName,omitempty"`
 	ClusterIP     string    `json:"clusterIP"`
+	Routes        []string  `json:"routes,omitempty"`
+	Advertised    []string  `json:"advertisedRoutes,omitempty"`
+	DeviceID      string    `json:"deviceId,omitempty"`
+	DERPRegion    int       `json:"derpRegion,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	RoutingMode   string    `json:"routingMode,omitempty"`
+	WireGuardPort uint16    `json:"wireguardPort,omitempty"`
+	TUNInPod      bool      `json:"tunInPod,omitempty"`
+	RouteTableID  int       `json:"routeTableId,omitempty"`
+
+	ExitNode      string         `json:"exitNode,omitempty"`
+	FullTunnel    bool           `json:"fullTunnel,omitempty"`
+	PrimaryRoutes []PrimaryRoute `json:"primaryRoutes,omitempty"`
+	DNSSearch     []string       `json:"dnsSearch,omitempty"`
+	DNSServers    []string       `json:"dnsServers,omitempty"`
+	KeepIdentity  bool           `json:"keepIdentity,omitempty"`
 }
 
-// NewPodManager creates a new pod manager.
-func NewPodManager(stateDir, clusterName string, oauthMgr *OAuthManager) *PodManager {
-	return &PodManager{
-		stateDir:    stateDir,
-		clusterName: clusterName,
-		oauthMgr:    oauthMgr,
-		servers:     make(map[string]*ManagedServer),
+// stateOwner returns the pod m's state Secret is for.
+func (m *ManagedServer) stateOwner() stateOwner {
+	return stateOwner{UID: m.PodUID, Keep: m.KeepIdentity}
+}
+
+// stateOwner returns the pod meta's state Secret is for.
+func (meta *PodMetadata) stateOwner() stateOwner {
+	return stateOwner{UID: meta.PodUID, Keep: meta.KeepIdentity}
+}
+
+// prefs returns the prefs to bring meta's node back up with. Starting a
+// LocalBackend with them replaces its stored prefs, so they must carry
+// everything the node was created with. Values that don't parse, which
+// metadata written before they were recorded has none of, are left unset.
+func (meta *PodMetadata) prefs() *ipn.Prefs {
+	prefs := ipn.NewPrefs()
+	prefs.Hostname = meta.Hostname
+	prefs.WantRunning = true
+	prefs.ControlURL = ipn.DefaultControlURL
+	prefs.AdvertiseTags = meta.Tags
+	prefs.ExitNodeIP, _ = netip.ParseAddr(meta.ExitNode)
+	for _, s := range meta.Advertised {
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefs.AdvertiseRoutes = append(prefs.AdvertiseRoutes, prefix)
+		}
+	}
+	return prefs
+}
+
+// NewPodManager creates a new pod manager, whose pods' nodes log in with
+// keys from authKeys. Only an OAuthManager gives it the Tailscale API, to
+// delete pods' devices, renew their keys and so on; with any other
+// provider those are skipped, and the warm pool and key profiles, which
+// need keys with particular capabilities, can't be used.
+func NewPodManager(cfg PodManagerConfig, authKeys AuthKeyProvider) (*PodManager, error) {
+	if cfg.StateBackend == "" {
+		cfg.StateBackend = StateBackendFile
+	}
+	if err := ValidateStateBackend(cfg.StateBackend); err != nil {
+		return nil, err
+	}
+	if cfg.StateBackend == StateBackendKubeSecret && cfg.Kube == nil {
+		return nil, fmt.Errorf("state backend %q requires a Kubernetes client", cfg.StateBackend)
+	}
+	if err := ValidateStateBackup(cfg.StateBackup); err != nil {
+		return nil, err
+	}
+	if cfg.StateBackup != StateBackupNone {
+		if cfg.StateBackend != StateBackendFile {
+			return nil, fmt.Errorf("state backup %q only applies to state backend %q", cfg.StateBackup, StateBackendFile)
+		}
+		if cfg.Kube == nil {
+			return nil, fmt.Errorf("state backup %q requires a Kubernetes client", cfg.StateBackup)
+		}
+	}
+	if cfg.RecoveryConcurrency <= 0 {
+		cfg.RecoveryConcurrency = defaultRecoveryConcurrency
+	}
+	if cfg.MaxConcurrentAttach <= 0 {
+		cfg.MaxConcurrentAttach = defaultMaxConcurrentAttach
+	}
+	if cfg.NodeLogLevel == "" {
+		cfg.NodeLogLevel = NodeLogLevelDebug
+	}
+	if err := ValidateNodeLogLevel(cfg.NodeLogLevel); err != nil {
+		return nil, err
+	}
+	if cfg.LoginAttempts <= 0 {
+		cfg.LoginAttempts = defaultLoginAttempts
+	}
+	if cfg.RoutingMode == "" {
+		cfg.RoutingMode = RoutingModeKernel
 	}
+	if cfg.TagMerge == "" {
+		cfg.TagMerge = TagMergeReplace
+	}
+	if err := ValidateTagMerge(cfg.TagMerge); err != nil {
+		return nil, err
+	}
+	if err := ValidateRoutingMode(cfg.RoutingMode); err != nil {
+		return nil, err
+	}
+	if cfg.HandshakeStaleAfter < 0 || (cfg.HandshakeStaleAfter > 0 && cfg.HandshakeStaleAfter < minHandshakeStaleAfter) {
+		return nil, fmt.Errorf("handshake stale timeout %s is shorter than %s", cfg.HandshakeStaleAfter, minHandshakeStaleAfter)
+	}
+	if cfg.KeyRenewBefore < 0 {
+		return nil, fmt.Errorf("key renewal window %s is negative", cfg.KeyRenewBefore)
+	}
+	if cfg.DelDrain < 0 {
+		return nil, fmt.Errorf("delete drain period %s is negative", cfg.DelDrain)
+	}
+	if cfg.StateDirTTL < 0 {
+		return nil, fmt.Errorf("state directory TTL %s is negative", cfg.StateDirTTL)
+	}
+	if cfg.WarmPoolSize < 0 {
+		return nil, fmt.Errorf("warm pool size %d is negative", cfg.WarmPoolSize)
+	}
+	oauthMgr, _ := authKeys.(*OAuthManager)
+	if authKeys != nil && oauthMgr == nil {
+		if cfg.WarmPoolSize > 0 {
+			return nil, errors.New("the warm pool needs ephemeral keys from an OAuth client")
+		}
+		if len(cfg.KeyProfiles) > 0 {
+			return nil, errors.New("key profiles need an OAuth client to create keys with them")
+		}
+		cfg.KeyRenewBefore = 0 // there's no API to renew keys through
+	}
+	// The daemon runs with host networking, and no thread has entered a
+	// pod's netns yet
+	hostNetns, err := statNetns("/proc/self/ns/net")
+	if err != nil {
+		log.Printf("Warning: can't identify the host network namespace, so pods on the host network won't be detected: %v", err)
+	}
+	return &PodManager{
+		stateDir:            cfg.StateDir,
+		clusterName:         cfg.ClusterName,
+		hostnameTmpl:        cfg.HostnameTemplate,
+		hostnameSfx:         cfg.HostnameSuffix,
+		tagMerge:            cfg.TagMerge,
+		stateBackend:        cfg.StateBackend,
+		stateBackup:         cfg.StateBackup,
+		stateKeys:           cfg.StateKeys,
+		hostNetns:           hostNetns,
+		kube:                cfg.Kube,
+		annotations:         newPodAnnotationCache(),
+		authKeys:            authKeys,
+		oauthMgr:            oauthMgr,
+		nsConfig:            cfg.NamespaceConfig,
+		recoveryConcurrency: cfg.RecoveryConcurrency,
+		tombstoneDir:        cfg.TombstoneDir,
+		manageIPForward:     cfg.ManageIPForward,
+		manageProxyARP:      cfg.ManageProxyARP,
+		routingMode:         cfg.RoutingMode,
+		tunInPod:            cfg.TUNInPod,
+		derpMap:             cfg.DERPMap,
+		keyProfiles:         cfg.KeyProfiles,
+		events:              cfg.Events,
+		tailnetLockKey:      cfg.TailnetLockKey,
+		maxPods:             cfg.MaxPods,
+		staleAfter:          cfg.HandshakeStaleAfter,
+		renewBefore:         cfg.KeyRenewBefore,
+		delDrain:            cfg.DelDrain,
+		stateDirTTL:         cfg.StateDirTTL,
+		attachSem:           make(chan struct{}, cfg.MaxConcurrentAttach),
+		loginAttempts:       cfg.LoginAttempts,
+		wgBasePort:          cfg.WireGuardPort,
+		wgPorts:             make(map[string]uint16),
+		routeTables:         make(map[string]int),
+		pool:                &warmPool{size: cfg.WarmPoolSize, refill: make(chan struct{}, 1)},
+		nodeLogLevel:        cfg.NodeLogLevel,
+		quietNodes:          cfg.QuietNodes,
+		servers:             make(map[string]*ManagedServer),
+		attaching:           make(map[string]chan struct{}),
+		cancelAdd:           make(map[string]context.CancelCauseFunc),
+		nl:                  hostNetlink,
+	}, nil
 }
 
+// maxHostnameLen is the DNS label length limit.
+const maxHostnameLen = 63
+
 // sanitizeHostname converts a string to a valid Tailscale hostname.
 func sanitizeHostname(s string) string {
+	return sanitizeHostnameWithSuffix(s, "")
+}
+
+// sanitizeHostnameWithSuffix is like sanitizeHostname but appends
+// "-"+suffix, truncating the base so the suffix always survives the length
+// limit. suffix must already be valid in a hostname.
+func sanitizeHostnameWithSuffix(s, suffix string) string {
 	s = strings.ToLower(s)
 	re := regexp.MustCompile(`[^a-z0-9-]`)
 	s = re.ReplaceAllString(s, "-")
 	re = regexp.MustCompile(`-+`)
 	s = re.ReplaceAllString(s, "-")
 	s = strings.Trim(s, "-")
-	if len(s) > 63 {
-		s = s[:63]
+	if suffix == "" {
+		if len(s) > maxHostnameLen {
+			s = s[:maxHostnameLen]
+		}
+		return s
+	}
+	if maxBase := maxHostnameLen - len(suffix) - 1; len(s) > maxBase {
+		s = strings.TrimRight(s[:maxBase], "-")
+	}
+	if s == "" {
+		return suffix
 	}
-	return s
+	return s + "-" + suffix
 }
 
 // tunNameForContainer returns a TUN device name for the given container ID.
@@ -119,124 +573,603 @@ func tunNameForContainer(containerID string) string {
 //   - TUN device created in HOST namespace for wgengine
 //   - veth pair bridges pod namespace to host
 //   - Kernel IP forwarding routes between TUN and veth
-func (pm *PodManager) AddPod(ctx context.Context, containerID, netnsPath, ifName, podName, namespace, clusterIP string) (*ManagedServer, error) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+//
+// routes are the CIDRs routed via the pod's Tailscale interface; if empty,
+// defaultTailscaleRoutes is used.
+//
+// At most MaxConcurrentAttach pods are brought up at once; an ADD that
+// can't get a slot before ctx is done fails without side effects. pm.mu is
+// only held to reserve the container and to add its node once it is up,
+// so CheckPod, GetPod and ListPods answer while pods are being attached.
+//
+// Pod annotations override the namespace's defaults, which override the
+// daemon's settings. If the namespace's defaults disable Tailscale,
+// errNamespaceDisabled is returned and nothing is created, as is
+// errHostNetwork for a pod in the host's netns.
+//
+// If the container already has a node, a changed hostname, tags or DERP
+// region is applied to it in place. If its netns has changed, its veth (or
+// TUN, with TUNInPod) is moved into the new one, keeping the node and IP.
+func (pm *PodManager) AddPod(ctx context.Context, containerID, netnsPath, ifName, podName, namespace, podUID, clusterIP string, routes []netip.Prefix, routingMode string) (*ManagedServer, error) {
+	annotations, annErr := pm.annotations.read(ctx, pm.kube, namespace, podName, podUID)
+	if annErr != nil {
+		log.Printf("Warning: ignoring annotations for pod %s/%s: %v", namespace, podName, annErr)
+	}
+	podCfg, cfgErr := parsePodConfig(annotations)
+	podCfg = podCfg.withTagMerge(pm.tagMerge)
+	if cfgErr == nil {
+		podCfg, cfgErr = podCfg.withKeyProfile(pm.keyProfiles)
+	}
+	if cfgErr == nil && podCfg.KeepIdentity && pm.stateBackend != StateBackendKubeSecret {
+		// File-backed state can't follow the pod to another node
+		cfgErr = fmt.Errorf("annotation %s needs state backend %q", AnnotationKeepIdentity, StateBackendKubeSecret)
+	}
+	nsDefaults := pm.nsConfig.Get(namespace)
+	podCfg = podCfg.withNamespaceDefaults(nsDefaults)
+	podCfg = podCfg.withAppendedTags(pm.daemonTags())
+
+	for {
+		pm.mu.Lock()
+		if srv, ok := pm.servers[containerID]; ok {
+			// Hold off other ADDs, DELs and reattaches of the pod, as an
+			// attach does, but not reads: moving and reconciling it is I/O
+			done := make(chan struct{})
+			pm.attaching[containerID] = done
+			pm.mu.Unlock()
+			defer func() {
+				pm.mu.Lock()
+				delete(pm.attaching, containerID)
+				pm.mu.Unlock()
+				close(done)
+			}()
+			log.Printf("Pod %s/%s already exists with Tailscale IP %s", namespace, podName, srv.TailscaleIPv4)
+			// The runtime replaced the pod's netns; the old veth went with
+			// the old one
+			if newNetns := canonicalNetns(netnsPath); srv.NetnsPath != "" && newNetns != srv.NetnsPath {
+				move := pm.moveVethBridge
+				if srv.TUNInPod {
+					move = pm.movePodTUN
+				}
+				if err := move(srv, newNetns); err != nil {
+					return nil, fmt.Errorf("moving pod to new netns: %w", err)
+				}
+			}
+			// Without the current annotations we can't tell what changed
+			if annErr != nil || cfgErr != nil {
+				if cfgErr != nil {
+					log.Printf("Warning: not reconciling pod %s/%s: %v", namespace, podName, cfgErr)
+				}
+				return srv, nil
+			}
+			if err := pm.reconcilePod(srv, netnsPath, podCfg); err != nil {
+				log.Printf("Warning: failed to reconcile pod %s/%s: %v", namespace, podName, err)
+			}
+			return srv, nil
+		}
+		inflight, ok := pm.attaching[containerID]
+		if !ok {
+			break
+		}
+		pm.mu.Unlock()
 
-	if srv, ok := pm.servers[containerID]; ok {
-		log.Printf("Pod %s/%s already exists with Tailscale IP %s", namespace, podName, srv.TailscaleIPv4)
-		return srv, nil
+		// A concurrent ADD is bringing this container up; wait for it and look again
+		select {
+		case <-inflight:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for concurrent ADD of %s: %w", containerID, ctx.Err())
+		}
+	}
+	if pm.maxPods > 0 && pm.podCount() >= pm.maxPods {
+		pm.mu.Unlock()
+		return nil, fmt.Errorf("%w of %d", errPodLimit, pm.maxPods)
+	}
+	done := make(chan struct{})
+	pm.attaching[containerID] = done
+	// A DEL of the container cancels the attach instead of waiting for it
+	ctx, cancel := context.WithCancelCause(ctx)
+	pm.cancelAdd[containerID] = cancel
+	pm.mu.Unlock()
+	defer func() {
+		pm.mu.Lock()
+		delete(pm.attaching, containerID)
+		delete(pm.cancelAdd, containerID)
+		pm.mu.Unlock()
+		cancel(nil)
+		close(done)
+	}()
+
+	if errors.Is(annErr, errPodReplaced) {
+		// The other pod's annotations, tags included, aren't this one's
+		return nil, annErr
+	}
+	if cfgErr != nil {
+		return nil, fmt.Errorf("invalid pod config: %w", cfgErr)
+	}
+	if !nsDefaults.enabled() {
+		return nil, fmt.Errorf("%w %s", errNamespaceDisabled, namespace)
+	}
+	if pm.isHostNetns(netnsPath) {
+		return nil, fmt.Errorf("%w: %s/%s", errHostNetwork, namespace, podName)
+	}
+	if podCfg.AdvertiseClusterIP {
+		svcRoutes, err := getClusterIPRoutes(ctx, pm.kube, namespace, podName)
+		switch {
+		case err != nil:
+			log.Printf("Warning: not advertising ClusterIPs for pod %s/%s: %v", namespace, podName, err)
+		case len(svcRoutes) == 0:
+			log.Printf("Warning: no Service with a ClusterIP selects pod %s/%s, nothing to advertise", namespace, podName)
+		default:
+			log.Printf("Advertising ClusterIPs %v for pod %s/%s", svcRoutes, namespace, podName)
+		}
+		podCfg.clusterIPRoutes = svcRoutes
 	}
 
-	hostname := sanitizeHostname(fmt.Sprintf("%s-%s-%s", pm.clusterName, namespace, podName))
-	log.Printf("Creating Tailscale node for pod %s/%s with hostname %s", namespace, podName, hostname)
+	// Bound concurrent bring-ups; each holds a TUN, netstack and engine
+	select {
+	case pm.attachSem <- struct{}{}:
+		defer func() { <-pm.attachSem }()
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for an attach slot: %w", context.Cause(ctx))
+	}
 
-	// Get auth key
-	authKey, err := pm.oauthMgr.CreateAuthKey(ctx, podName, namespace)
+	managed, err := pm.attachPod(ctx, containerID, netnsPath, ifName, podName, namespace, podUID, clusterIP, routes, routingMode, podCfg)
 	if err != nil {
-		return nil, fmt.Errorf("creating auth key: %w", err)
+		if cause := context.Cause(ctx); errors.Is(cause, errDeletedDuringAdd) {
+			err = fmt.Errorf("%w: %v", cause, err)
+		}
+		pm.mu.Lock()
+		pm.releaseWireGuardPort(containerID)
+		pm.releaseRouteTable(containerID)
+		pm.mu.Unlock()
+		return nil, err
+	}
+
+	// The container is still marked as attaching, so nothing else touches
+	// its state directory until the deferred cleanup
+	if err := pm.saveMetadata(containerID, managed, netnsPath); err != nil {
+		log.Printf("Warning: failed to save metadata for %s: %v", containerID, err)
+	}
+
+	pm.mu.Lock()
+	pm.servers[containerID] = managed
+	metricManagedPods.Set(int64(len(pm.servers)))
+	pm.mu.Unlock()
+	pm.publish(newPodEvent(podAttached, managed))
+	return managed, nil
+}
+
+// podCount returns how many pods the daemon has or is attaching. A pod
+// being deleted, reattached or re-added is marked as attaching too, but
+// counts once. Caller must hold pm.mu.
+func (pm *PodManager) podCount() int {
+	n := len(pm.servers)
+	for containerID := range pm.attaching {
+		if _, ok := pm.servers[containerID]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// attachPod brings up a new Tailscale node for a pod and bridges it into
+// the pod's network namespace. It is called without pm.mu held.
+func (pm *PodManager) attachPod(ctx context.Context, containerID, netnsPath, ifName, podName, namespace, podUID, clusterIP string, routes []netip.Prefix, routingMode string, podCfg PodConfig) (*ManagedServer, error) {
+	if len(routes) == 0 {
+		routes = defaultTailscaleRoutes
+	}
+	if routingMode == "" {
+		routingMode = pm.routingMode
+	}
+	start := time.Now()
+	var routeTable int
+	if !pm.tunInPod {
+		var err error
+		if routeTable, err = pm.allocRouteTable(containerID, 0); err != nil {
+			return nil, err
+		}
 	}
-	log.Printf("Got auth key for %s/%s", namespace, podName)
 
+	// Fail before minting an auth key if the pod is already gone
+	if !netnsExists(netnsPath) {
+		return nil, fmt.Errorf("%w: %s", errNetnsGone, netnsPath)
+	}
+
+	hostname := pm.podHostname(namespace, podName, podUID, podCfg)
 	podStateDir := filepath.Join(pm.stateDir, "pods", containerID)
-	if err := os.MkdirAll(podStateDir, 0700); err != nil {
-		return nil, fmt.Errorf("creating state directory: %w", err)
+	logf := nodeLogf(hostname, pm.nodeLogLevel, pm.quietNodes)
+	owner := stateOwner{UID: podUID, Keep: podCfg.KeepIdentity}
+
+	// Log in and wait for a Tailscale IP, both within the attach timeout.
+	// ctx is the CNI request's, so a runtime that gives up on the ADD stops
+	// the wait too.
+	timeout := tailscaleIPTimeout
+	if podCfg.AttachTimeout > 0 {
+		timeout = podCfg.AttachTimeout
 	}
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-	logf := func(format string, args ...any) {
-		log.Printf("[ts:%s] %s", hostname, fmt.Sprintf(format, args...))
+	// A node from the warm pool has already logged in; it only needs the
+	// pod's hostname, state and settings
+	var stateStore ipn.StateStore
+	var err error
+	n := pm.takePoolNode(podCfg, routingMode)
+	if n != nil {
+		log.Printf("Giving warm pool node %s to pod %s/%s with hostname %s", n.id, namespace, podName, hostname)
+		stateStore, err = pm.claimPoolNode(ctx, logf, n, containerID, hostname, namespace, podName, podStateDir, owner, podCfg)
+		if err != nil {
+			n.close()
+			os.RemoveAll(n.varRoot)
+			os.RemoveAll(podStateDir)
+			pm.releasePod(namespace, podName, n.deviceID, owner)
+			return nil, fmt.Errorf("taking warm pool node: %w", err)
+		}
+	} else {
+		log.Printf("Creating Tailscale node for pod %s/%s with hostname %s", namespace, podName, hostname)
+		n, stateStore, err = pm.newPodNode(ctx, ctxWithTimeout, logf, containerID, hostname, namespace, podName, podStateDir, routingMode, owner, podCfg)
+		if err != nil {
+			return nil, err
+		}
 	}
+	lb := n.lb
+	tailscaleIPv4, tailscaleIPv6, deviceID, actualTunName := n.ipv4, n.ipv6, n.deviceID, n.tunName
 
-	// Create TUN device in HOST namespace
-	tunName := tunNameForContainer(containerID)
-	tunDev, actualTunName, err := tstun.New(logf, tunName)
-	if err != nil {
+	// discard tears the node down once it has failed to attach. It has
+	// registered by now, so its device and state Secret go too.
+	discard := func() {
+		n.close()
 		os.RemoveAll(podStateDir)
-		return nil, fmt.Errorf("creating TUN device: %w", err)
+		os.RemoveAll(n.varRoot)
+		pm.releasePod(namespace, podName, deviceID, owner)
 	}
-	log.Printf("Created TUN device %s in host namespace", actualTunName)
 
-	// Bring up the TUN interface at the kernel level
-	tunLink, err := netlink.LinkByName(actualTunName)
+	if podCfg.RequestIP.IsValid() && podCfg.RequestIP != tailscaleIPv4 {
+		if err := pm.requestPodIP(ctxWithTimeout, lb, deviceID, podCfg.RequestIP); err != nil {
+			discard()
+			return nil, fmt.Errorf("requested IP %s unavailable: %w", podCfg.RequestIP, err)
+		}
+		tailscaleIPv4 = podCfg.RequestIP
+	}
+
+	log.Printf("Pod %s/%s connected to Tailscale with IP %s", namespace, podName, tailscaleIPv4)
+	warnUnknownDERPRegion(lb, namespace, podName, podCfg.DERPRegion)
+
+	// Now connect the TUN to the pod namespace: moved into it, or bridged
+	// to it with a veth
+	var hostVethName string
+	if pm.tunInPod {
+		err = moveTUNToPod(netnsPath, actualTunName, ifName, tailscaleIPv4, tailscaleIPv6, routes)
+	} else {
+		hostVethName, err = pm.setupVethBridge(netnsPath, ifName, actualTunName, routeTable, tailscaleIPv4, tailscaleIPv6, defaultVethMTU, routes, routingMode)
+	}
 	if err != nil {
-		tunDev.Close()
+		discard()
+		if pm.tunInPod {
+			return nil, fmt.Errorf("moving TUN into pod: %w", err)
+		}
+		return nil, fmt.Errorf("setting up veth bridge: %w", err)
+	}
+
+	// With the pod's Tailscale interface up, take over its default routes
+	var primaryRoutes []PrimaryRoute
+	if podCfg.FullTunnel {
+		primaryRoutes, err = setupFullTunnel(netnsPath, ifName, hostVethName, actualTunName, routeTable, tailscaleIPv4, tailscaleIPv6, routingMode)
+		if err != nil {
+			if hostVethName != "" {
+				removeVethBridge(pm.nl, netnsPath, ifName, hostVethName, routeTable)
+			}
+			discard()
+			return nil, err
+		}
+	}
+
+	pm.backupState(ctx, stateStore, namespace, podName, owner)
+
+	// A warm pool node still has its pool hostname until control sees the
+	// pod's, so only a node of the pod's own can be checked
+	dnsName := magicDNSName(lb.StatusWithoutPeers())
+	var renamed string
+	if n.varRoot == podStateDir {
+		renamed = renamedHostname(hostname, dnsName)
+	}
+	if renamed != "" {
+		metricHostnamesRenamed.Add(1)
+		log.Printf("Warning: pod %s/%s requested hostname %s, but another device has it; control named it %s",
+			namespace, podName, hostname, renamed)
+	}
+
+	managed := &ManagedServer{
+		Backend:       lb,
+		Engine:        n.eng,
+		Sys:           n.sys,
+		NetMon:        n.netMon,
+		ContainerID:   containerID,
+		PodName:       podName,
+		Namespace:     namespace,
+		PodUID:        podUID,
+		Hostname:      hostname,
+		DNSName:       dnsName,
+		Renamed:       renamed,
+		ClusterIP:     clusterIP,
+		HostVethName:  hostVethName,
+		PodIfName:     ifName,
+		NetnsPath:     canonicalNetns(netnsPath),
+		TailscaleIPv4: tailscaleIPv4,
+		TailscaleIPv6: tailscaleIPv6,
+		Routes:        routes,
+		Advertised:    podCfg.clusterIPRoutes,
+		DeviceID:      deviceID,
+		DERPRegion:    podCfg.DERPRegion,
+		Tags:          podCfg.Tags,
+		RoutingMode:   routingMode,
+		WireGuardPort: n.wgPort,
+		TUNInPod:      pm.tunInPod,
+		RouteTableID:  routeTable,
+		ExitNode:      podCfg.ExitNode,
+		FullTunnel:    podCfg.FullTunnel,
+		PrimaryRoutes: primaryRoutes,
+		DNS:           podDNS{Search: podCfg.DNSSearch, Servers: podCfg.DNSServers},
+		KeepIdentity:  podCfg.KeepIdentity,
+		CreatedAt:     time.Now(),
+
+		stopLinkChanges: n.stopLinkChanges,
+		tunDev:          n.tunDev,
+	}
+	if n.varRoot != podStateDir {
+		managed.poolDir = n.varRoot
+	}
+
+	total := time.Since(start).Round(time.Millisecond)
+	if n.pool != nil {
+		log.Printf("Attach timing for pod %s/%s: warm pool node, total=%v", namespace, podName, total)
+	} else {
+		n.timing.observe()
+		log.Printf("Attach timing for pod %s/%s: auth_key=%v running=%v ip=%v total=%v", namespace, podName,
+			n.timing.authKey.Round(time.Millisecond), n.timing.running.Round(time.Millisecond), n.timing.ip.Round(time.Millisecond), total)
+	}
+	return managed, nil
+}
+
+// newPodNode creates a node for a pod, with an auth key minted under ctx,
+// and brings it up, logging in under loginCtx. The node's state directory
+// is podStateDir, removed again if the node fails to come up, and its state
+// is owner's.
+func (pm *PodManager) newPodNode(ctx, loginCtx context.Context, logf logger.Logf, containerID, hostname, namespace, podName, podStateDir, routingMode string, owner stateOwner, podCfg PodConfig) (*node, ipn.StateStore, error) {
+	// Moving the node to its IP is an API call, so fail before it registers
+	if podCfg.RequestIP.IsValid() && pm.oauthMgr == nil {
+		return nil, nil, fmt.Errorf("requested IP %s %w", podCfg.RequestIP, errNeedsOAuth)
+	}
+	keyStart := time.Now()
+	authKey, err := pm.newAuthKey(ctx, podName, namespace, podCfg.Tags, podCfg.keyProfile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating auth key: %w", err)
+	}
+	keyWait := time.Since(keyStart)
+	log.Printf("Got auth key for %s/%s", namespace, podName)
+
+	if err := os.MkdirAll(podStateDir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("creating state directory: %w", err)
+	}
+	// Persist node state (including node key) for recovery
+	if err := pm.claimState(ctx, namespace, podName, owner); err != nil {
 		os.RemoveAll(podStateDir)
-		return nil, fmt.Errorf("getting TUN link: %w", err)
+		return nil, nil, fmt.Errorf("claiming state: %w", err)
 	}
-	if err := netlink.LinkSetUp(tunLink); err != nil {
-		tunDev.Close()
+	stateStore, err := pm.openStateStore(logf, podStateDir, namespace, podName, owner)
+	if err != nil {
 		os.RemoveAll(podStateDir)
-		return nil, fmt.Errorf("bringing up TUN: %w", err)
+		return nil, nil, fmt.Errorf("creating state store: %w", err)
+	}
+
+	prefs := ipn.NewPrefs()
+	prefs.Hostname = hostname
+	prefs.WantRunning = true
+	prefs.ControlURL = ipn.DefaultControlURL
+	prefs.AdvertiseTags = podCfg.Tags
+	prefs.ExitNodeIP = podCfg.ExitNode
+	prefs.AdvertiseRoutes = podCfg.clusterIPRoutes
+
+	n, err := pm.startNode(loginCtx, logf, nodeSpec{
+		id:          containerID,
+		varRoot:     podStateDir,
+		store:       stateStore,
+		wgPort:      pm.allocWireGuardPort(containerID, 0),
+		routingMode: routingMode,
+		derpRegion:  podCfg.DERPRegion,
+		dns:         podDNS{Search: podCfg.DNSSearch, Servers: podCfg.DNSServers},
+		prefs:       prefs,
+		authKey:     authKey,
+		approval:    podCfg.keyProfile != nil && !podCfg.keyProfile.preauthorized(),
+		release: func(deviceID string) {
+			pm.releasePod(namespace, podName, deviceID, owner)
+		},
+	})
+	if err != nil {
+		os.RemoveAll(podStateDir)
+		return nil, nil, err
+	}
+	n.timing.authKey = keyWait
+	return n, stateStore, nil
+}
+
+// newAuthKey mints an auth key for a node, signed for tailnet lock if
+// the daemon has a tailnet lock key.
+func (pm *PodManager) newAuthKey(ctx context.Context, podName, namespace string, tags []string, profile *KeyProfile) (string, error) {
+	authKey, err := pm.authKeys.CreateAuthKey(ctx, podName, namespace, tags, profile)
+	if err != nil {
+		return "", err
+	}
+	if !pm.tailnetLockKey.IsZero() {
+		// The node signs its own node key with the credential when it registers
+		authKey, err = wrapAuthKey(authKey, pm.tailnetLockKey)
+		if err != nil {
+			return "", fmt.Errorf("signing auth key for tailnet lock: %w", err)
+		}
+	}
+	return authKey, nil
+}
+
+// daemonTags returns the tags of pods that don't set their own.
+func (pm *PodManager) daemonTags() []string {
+	if pm.oauthMgr == nil {
+		return nil
+	}
+	return pm.oauthMgr.tags
+}
+
+// nodeSpec is what startNode brings a node up with.
+type nodeSpec struct {
+	id          string // the pod's container ID, or a warm pool node's ID; names the TUN
+	varRoot     string // the node's state directory, which must exist
+	store       ipn.StateStore
+	wgPort      uint16
+	routingMode string
+	derpRegion  int    // home DERP region to prefer, 0 for none
+	dns         podDNS // the pod's split DNS
+	prefs       *ipn.Prefs
+	authKey     string
+	approval    bool                  // authKey isn't preauthorized, so wait for an admin to approve the node
+	release     func(deviceID string) // drops a node that registered but failed to come up; nil keeps it
+	tun         tun.Device            // a TUN to use instead of creating one, such as one reopened in a pod
+	reuseTUN    bool                  // reopen or replace a TUN already on the host instead of failing
+}
+
+// node is a Tailscale node brought up by startNode, not yet connected to a
+// pod.
+type node struct {
+	id              string
+	varRoot         string
+	lb              *ipnlocal.LocalBackend
+	eng             wgengine.Engine
+	sys             *tsd.System
+	netMon          *netmon.Monitor
+	nsImpl          *netstack.Impl
+	stopLinkChanges func()
+	tunDev          tun.Device
+	tunName         string
+	wgPort          uint16
+	ipv4, ipv6      netip.Addr
+	deviceID        string
+	timing          attachTiming
+
+	// Set for a warm pool node
+	pool     *poolStore
+	poolLogf *swapLogf
+}
+
+// attachTiming is where a new node's attach spent its time: minting its
+// auth key, from starting its LocalBackend until control had it running,
+// and from then until it had an IPv4 address. Telling them apart says
+// whether a slow attach waited on the Tailscale API, the control
+// handshake or the netmap.
+type attachTiming struct {
+	authKey, running, ip time.Duration
+}
+
+// observe records t in the attach timing histograms.
+func (t attachTiming) observe() {
+	metricAttachAuthKeySeconds.Observe(t.authKey.Seconds())
+	metricAttachRunningSeconds.Observe(t.running.Seconds())
+	metricAttachIPSeconds.Observe(t.ip.Seconds())
+}
+
+// close shuts the node down. Its TUN goes with the engine, or on its own
+// if startNode failed before the engine took it.
+func (n *node) close() {
+	if n.lb != nil {
+		n.lb.Shutdown()
+	}
+	if n.nsImpl != nil {
+		n.nsImpl.Close()
+	}
+	if n.eng != nil {
+		n.eng.Close()
+	} else if n.tunDev != nil {
+		n.tunDev.Close()
+	}
+	if n.stopLinkChanges != nil {
+		n.stopLinkChanges()
+	}
+}
+
+// startNode brings up a node: its TUN in the host namespace, engine,
+// netstack and LocalBackend, logged in with spec's auth key, or with the
+// node key in spec's store if it has none. It returns once the node has a
+// Tailscale IP or ctx is done; on failure everything it created is torn
+// down, spec.tun included.
+func (pm *PodManager) startNode(ctx context.Context, logf logger.Logf, spec nodeSpec) (_ *node, err error) {
+	n := &node{
+		id:      spec.id,
+		varRoot: spec.varRoot,
+		tunDev:  spec.tun,
+		wgPort:  spec.wgPort,
+	}
+	defer func() {
+		if err != nil {
+			n.close()
+		}
+	}()
+
+	if n.tunDev != nil {
+		if n.tunName, err = n.tunDev.Name(); err != nil {
+			return nil, fmt.Errorf("getting TUN name: %w", err)
+		}
+	} else if n.tunDev, n.tunName, err = pm.openHostTUN(logf, tunNameForContainer(spec.id), spec.reuseTUN); err != nil {
+		return nil, err
 	}
-	log.Printf("TUN device %s is now UP", actualTunName)
 
 	// Create system dependencies
-	sys := tsd.NewSystem()
+	n.sys = tsd.NewSystem()
+	sys := n.sys
 
 	dialer := &tsdial.Dialer{Logf: logf}
 	dialer.SetBus(sys.Bus.Get())
 	sys.Set(dialer)
 
-	netMon, err := netmon.New(sys.Bus.Get(), logf)
-	if err != nil {
-		tunDev.Close()
-		os.RemoveAll(podStateDir)
+	if n.netMon, err = pm.sharedNetMon(); err != nil {
 		return nil, fmt.Errorf("creating network monitor: %w", err)
 	}
-	sys.Set(netMon)
+	sys.Set(n.netMon)
+	n.stopLinkChanges = forwardLinkChanges(n.netMon, sys.Bus.Get())
 
 	// Create wgengine
 	eng, err := wgengine.NewUserspaceEngine(logf, wgengine.Config{
-		Tun:           tunDev,
+		Tun:           n.tunDev,
+		ListenPort:    spec.wgPort,
 		EventBus:      sys.Bus.Get(),
-		NetMon:        netMon,
+		NetMon:        n.netMon,
 		Dialer:        dialer,
 		SetSubsystem:  sys.Set,
 		ControlKnobs:  sys.ControlKnobs(),
 		HealthTracker: sys.HealthTracker.Get(),
 		Metrics:       sys.UserMetricsRegistry(),
+		DNS:           podResolvConf{},
 	})
 	if err != nil {
-		netMon.Close()
-		tunDev.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("creating wgengine: %w", err)
 	}
-	sys.Set(eng)
+	n.eng = withPodDNS(eng, spec.dns)
+	sys.Set(n.eng)
 	sys.HealthTracker.Get().SetMetricsRegistry(sys.UserMetricsRegistry())
 
-	// Create netstack (required but we'll use kernel routing)
-	nsImpl, err := netstack.Create(logf, sys.Tun.Get(), eng, sys.MagicSock.Get(), dialer, sys.DNSManager.Get(), sys.ProxyMapper())
+	// Create netstack (required; it only handles traffic in netstack routing mode)
+	nsImpl, err := netstack.Create(logf, sys.Tun.Get(), n.eng, sys.MagicSock.Get(), dialer, sys.DNSManager.Get(), sys.ProxyMapper())
 	if err != nil {
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("creating netstack: %w", err)
 	}
+	n.nsImpl = nsImpl
 	sys.Tun.Get().Start()
 	sys.Set(nsImpl)
 	nsImpl.ProcessLocalIPs = false
-	nsImpl.ProcessSubnets = false
+	// Netstack proxies traffic to advertised ClusterIPs from the host, so
+	// replies come back to this node, whichever node the Service's
+	// endpoints are on
+	nsImpl.ProcessSubnets = spec.routingMode == RoutingModeNetstack || len(spec.prefs.AdvertiseRoutes) > 0
 
-	// Use FileStore to persist node state (including node key) for recovery
-	stateStorePath := filepath.Join(podStateDir, "tailscale.state")
-	stateStore, err := store.NewFileStore(logf, stateStorePath)
-	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
-		return nil, fmt.Errorf("creating state store: %w", err)
-	}
-	sys.Set(stateStore)
+	sys.Set(spec.store)
 
 	logID, err := logid.NewPrivateID()
 	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("creating log ID: %w", err)
 	}
 
@@ -245,128 +1178,432 @@ func (pm *PodManager) AddPod(ctx context.Context, containerID, netnsPath, ifName
 	loginFlags := controlclient.LocalBackendStartKeyOSNeutral
 	lb, err := ipnlocal.NewLocalBackend(logf, logID.Public(), sys, loginFlags)
 	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("creating LocalBackend: %w", err)
 	}
-	lb.SetVarRoot(podStateDir)
+	n.lb = lb
+	lb.SetVarRoot(spec.varRoot)
+	if pm.derpMap != nil {
+		overrideDERPMap(lb, pm.derpMap)
+	}
 
 	if err := nsImpl.Start(lb); err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("starting netstack: %w", err)
 	}
 
-	prefs := ipn.NewPrefs()
-	prefs.Hostname = hostname
-	prefs.WantRunning = true
-	prefs.ControlURL = ipn.DefaultControlURL
+	if spec.derpRegion != 0 {
+		log.Printf("Pinning node %s to DERP region %d", spec.prefs.Hostname, spec.derpRegion)
+		lb.DebugForcePreferDERP(spec.derpRegion)
+	}
 
+	// Without an auth key, the node key in the state store logs in
+	started := time.Now()
 	if err := lb.Start(ipn.Options{
-		AuthKey:     authKey,
-		UpdatePrefs: prefs,
+		AuthKey:     spec.authKey,
+		UpdatePrefs: spec.prefs,
 	}); err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
 		return nil, fmt.Errorf("starting LocalBackend: %w", err)
 	}
 
 	// If state is NeedsLogin, kick off the login process
 	if st := lb.State(); st == ipn.NeedsLogin {
 		log.Printf("State is NeedsLogin, calling StartLoginInteractive")
-		if err := lb.StartLoginInteractive(ctx); err != nil {
-			lb.Shutdown()
-			nsImpl.Close()
-			eng.Close()
-			netMon.Close()
-			os.RemoveAll(podStateDir)
+		if err := startLogin(ctx, lb.StartLoginInteractive, lb.HealthTracker().Strings, pm.loginAttempts); err != nil {
 			return nil, fmt.Errorf("starting login: %w", err)
 		}
 	}
 
-	// Wait for Tailscale IP
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
+	var running time.Time
+	n.ipv4, n.ipv6, n.deviceID, err = waitForTailscaleIP(ctx, noteRunning(lb.Status, &running), spec.approval)
+	if err != nil {
+		// The node may have registered before the wait gave up; a retried
+		// ADD creates a new one, so this one would be left behind
+		if self := lb.Status().Self; self != nil && self.ID != "" && spec.release != nil {
+			spec.release(string(self.ID))
+		}
+		return nil, err
+	}
+	n.timing.running = running.Sub(started)
+	n.timing.ip = time.Since(running)
+	return n, nil
+}
+
+// noteRunning wraps status to set *running to when it first reports the
+// node running.
+func noteRunning(status func() *ipnstate.Status, running *time.Time) func() *ipnstate.Status {
+	return func() *ipnstate.Status {
+		st := status()
+		if running.IsZero() && st.BackendState == ipn.Running.String() {
+			*running = time.Now()
+		}
+		return st
+	}
+}
 
-	var tailscaleIPv4, tailscaleIPv6 netip.Addr
+// startLogin calls login, retrying failures with backoff until it has been
+// tried attempts times or ctx is done. If it never succeeds, the error
+// includes the node's health warnings, which usually say what's wrong.
+func startLogin(ctx context.Context, login func(context.Context) error, health func() []string, attempts int) error {
+	delay := loginRetryDelay
+	var err error
+	attempt := 1
+retry:
+	for ; ; attempt++ {
+		if err = login(ctx); err == nil {
+			return nil
+		}
+		if attempt >= attempts {
+			break
+		}
+		log.Printf("Login attempt %d of %d failed, retrying in %v: %v", attempt, attempts, delay, err)
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("%w (stopped retrying: %v)", err, ctx.Err())
+			break retry
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, loginRetryMaxDelay)
+	}
+
+	err = fmt.Errorf("%w (%d attempts)", err, attempt)
+	if warnings := health(); len(warnings) > 0 {
+		err = fmt.Errorf("%w; health: %s", err, strings.Join(warnings, "; "))
+	}
+	return err
+}
+
+// waitForTailscaleIP polls a node's status until it is running with an IPv4
+// address, and returns its addresses and device ID. It gives up when ctx is
+// done. A node that control holds for an admin's approval fails with
+// errNeedsApproval: at once, unless approval is set because its key wasn't
+// meant to be preauthorized, in which case it may still be approved in time.
+func waitForTailscaleIP(ctx context.Context, status func() *ipnstate.Status, approval bool) (ipv4, ipv6 netip.Addr, deviceID string, err error) {
 	for {
-		status := lb.Status()
-		if status.BackendState == "Running" && len(status.TailscaleIPs) > 0 {
-			for _, ip := range status.TailscaleIPs {
-				if ip.Is4() && !tailscaleIPv4.IsValid() {
-					tailscaleIPv4 = ip
-				} else if ip.Is6() && !tailscaleIPv6.IsValid() {
-					tailscaleIPv6 = ip
+		st := status()
+		needsApproval := st.BackendState == ipn.NeedsMachineAuth.String()
+		if needsApproval && !approval {
+			metricNodesNeedApproval.Add(1)
+			return netip.Addr{}, netip.Addr{}, "", errNeedsApproval
+		}
+		if st.BackendState == ipn.Running.String() {
+			for _, ip := range st.TailscaleIPs {
+				if ip.Is4() && !ipv4.IsValid() {
+					ipv4 = ip
+				} else if ip.Is6() && !ipv6.IsValid() {
+					ipv6 = ip
 				}
 			}
-			if tailscaleIPv4.IsValid() {
-				break
+			if ipv4.IsValid() {
+				if st.Self != nil {
+					deviceID = string(st.Self.ID)
+				}
+				return ipv4, ipv6, deviceID, nil
 			}
 		}
 
 		select {
-		case <-ctxWithTimeout.Done():
-			lb.Shutdown()
-			nsImpl.Close()
-			eng.Close()
-			netMon.Close()
-			os.RemoveAll(podStateDir)
-			return nil, fmt.Errorf("timeout waiting for Tailscale IP (state: %s)", status.BackendState)
-		case <-time.After(500 * time.Millisecond):
+		case <-ctx.Done():
+			if needsApproval {
+				metricNodesNeedApproval.Add(1)
+				return netip.Addr{}, netip.Addr{}, "", fmt.Errorf("waiting for Tailscale IP: %w (%v)", errNeedsApproval, ctx.Err())
+			}
+			return netip.Addr{}, netip.Addr{}, "", fmt.Errorf("waiting for Tailscale IP (state: %s): %w", st.BackendState, ctx.Err())
+		case <-time.After(tailscaleIPPollInterval):
 		}
 	}
+}
 
-	log.Printf("Pod %s/%s connected to Tailscale with IP %s", namespace, podName, tailscaleIPv4)
+// requestPodIP changes a newly registered node's IPv4 address to ip and waits
+// for the node to pick it up. Control only assigns addresses at registration,
+// so the node registers with whatever it was given and is then moved.
+func (pm *PodManager) requestPodIP(ctx context.Context, lb *ipnlocal.LocalBackend, deviceID string, ip netip.Addr) error {
+	if deviceID == "" {
+		return errors.New("node has no device ID")
+	}
+	if err := pm.oauthMgr.SetDeviceIPv4(ctx, deviceID, ip); err != nil {
+		return err
+	}
+	for {
+		if slices.Contains(lb.Status().TailscaleIPs, ip) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for node to take the address: %w", ctx.Err())
+		case <-time.After(tailscaleIPPollInterval):
+		}
+	}
+}
+
+// podHostname returns the Tailscale hostname for a pod: the hostname
+// annotation if set, then the namespace's hostname template, then the
+// daemon's, otherwise <cluster>-<namespace>-<pod>. Generated names get the
+// configured hostname suffix; the annotation is used as-is.
+func (pm *PodManager) podHostname(namespace, podName, podUID string, podCfg PodConfig) string {
+	if h := sanitizeHostname(podCfg.Hostname); h != "" {
+		return h
+	}
+	var suffix string
+	if pm.hostnameSfx == HostnameSuffixUID && podUID != "" {
+		suffix = uidHostnameSuffix(podUID)
+	}
+	tmpl := podCfg.hostnameTemplate
+	if tmpl == nil {
+		tmpl = pm.hostnameTmpl
+	}
+	if tmpl != nil {
+		h, err := executeHostnameTemplate(tmpl, hostnameTemplateData{
+			Cluster:      pm.clusterName,
+			Namespace:    namespace,
+			PodName:      podName,
+			CleanPodName: sanitizeHostname(podName),
+		})
+		if err != nil {
+			log.Printf("Warning: hostname template failed for pod %s/%s, using default: %v", namespace, podName, err)
+		} else if sanitizeHostname(h) != "" {
+			return sanitizeHostnameWithSuffix(h, suffix)
+		}
+	}
+	return sanitizeHostnameWithSuffix(fmt.Sprintf("%s-%s-%s", pm.clusterName, namespace, podName), suffix)
+}
+
+// reconcilePod applies changed annotations to a pod's running node.
+// Nothing is done if the hostname and DERP region are unchanged. Tags can't
+// be changed: control only applies them when a node logs in with a new key,
+// so a change is logged and left for the pod's next node. It is called
+// without pm.mu held, with the container marked as attaching; pm.mu is only
+// taken to update srv.
+func (pm *PodManager) reconcilePod(srv *ManagedServer, netnsPath string, podCfg PodConfig) error {
+	if !slices.Equal(podCfg.Tags, srv.Tags) {
+		log.Printf("Warning: pod %s/%s tags changed from %v to %v, but a node's tags are fixed when it registers; recreate the pod to apply them",
+			srv.Namespace, srv.PodName, srv.Tags, podCfg.Tags)
+	}
+	hostname := pm.podHostname(srv.Namespace, srv.PodName, srv.PodUID, podCfg)
+	if hostname == srv.Hostname && podCfg.DERPRegion == srv.DERPRegion {
+		return nil
+	}
+
+	if podCfg.DERPRegion != srv.DERPRegion {
+		log.Printf("Pod %s/%s DERP region changed: %d -> %d", srv.Namespace, srv.PodName, srv.DERPRegion, podCfg.DERPRegion)
+		srv.Backend.DebugForcePreferDERP(podCfg.DERPRegion)
+	}
+	if hostname != srv.Hostname {
+		log.Printf("Pod %s/%s hostname changed: %s -> %s", srv.Namespace, srv.PodName, srv.Hostname, hostname)
+		_, err := srv.Backend.EditPrefs(&ipn.MaskedPrefs{
+			Prefs:       ipn.Prefs{Hostname: hostname},
+			HostnameSet: true,
+		})
+		if err != nil {
+			return fmt.Errorf("updating prefs: %w", err)
+		}
+	}
 
-	// Now set up veth bridging to pod namespace
-	hostVethName, err := setupVethBridge(netnsPath, ifName, actualTunName, tailscaleIPv4, defaultVethMTU)
+	pm.mu.Lock()
+	srv.DERPRegion = podCfg.DERPRegion
+	if hostname != srv.Hostname {
+		srv.Hostname = hostname
+		srv.Renamed = ""
+	}
+	pm.mu.Unlock()
+	return pm.saveMetadata(srv.ContainerID, srv, netnsPath)
+}
+
+// warnUnknownDERPRegion logs a warning if a pinned DERP region isn't in the
+// tailnet's DERP map. Tailscale then falls back to the nearest region.
+func warnUnknownDERPRegion(lb *ipnlocal.LocalBackend, namespace, podName string, region int) {
+	if region == 0 {
+		return
+	}
+	nm := lb.NetMap()
+	if nm == nil || nm.DERPMap == nil {
+		return
+	}
+	if _, ok := nm.DERPMap.Regions[region]; !ok {
+		log.Printf("Warning: pod %s/%s requests DERP region %d, which is not in the DERP map", namespace, podName, region)
+	}
+}
+
+// magicDNSName returns a node's MagicDNS name, such as
+// web-0.tailnet-1234.ts.net, without the trailing dot. It is the name
+// control gave the node, which has a -1 or similar added if another device
+// had its hostname. It is "" if the node has no netmap yet.
+func magicDNSName(status *ipnstate.Status) string {
+	if status.Self == nil {
+		return ""
+	}
+	return strings.TrimSuffix(status.Self.DNSName, ".")
+}
+
+// MagicDNSName returns the node's current MagicDNS name, which follows
+// hostname changes, or the one it came up with if it has no netmap.
+func (m *ManagedServer) MagicDNSName() string {
+	if name := magicDNSName(m.Backend.StatusWithoutPeers()); name != "" {
+		return name
+	}
+	return m.DNSName
+}
+
+// renamedHostname returns the hostname in a node's MagicDNS name if control
+// gave it one other than the hostname it asked for, as when another device
+// already had that, or "" if it didn't or dnsName is "".
+func renamedHostname(requested, dnsName string) string {
+	if dnsName == "" {
+		return ""
+	}
+	got, _, _ := strings.Cut(dnsName, ".")
+	if strings.EqualFold(got, requested) {
+		return ""
+	}
+	return got
+}
+
+// TailnetHostname returns the node's hostname on the tailnet: the one
+// control gave it if it was renamed, Hostname otherwise.
+func (m *ManagedServer) TailnetHostname() string {
+	if m.Renamed != "" {
+		return m.Renamed
+	}
+	return m.Hostname
+}
+
+// HomeDERP returns the node's current home DERP region ID, or 0 if unknown.
+func (m *ManagedServer) HomeDERP() int {
+	nm := m.Backend.NetMap()
+	if nm == nil || !nm.SelfNode.Valid() {
+		return 0
+	}
+	return nm.SelfNode.HomeDERP()
+}
+
+// moveVethBridge moves a pod's veth bridge into netnsPath, for a pod whose
+// netns was replaced under the same container ID. The node, and so its IP,
+// is kept. The old veth is deleted with its host routes, if it wasn't
+// already gone with the old netns. It is called without pm.mu held, with
+// the container marked as attaching; pm.mu is only taken to update srv.
+func (pm *PodManager) moveVethBridge(srv *ManagedServer, netnsPath string) error {
+	log.Printf("Pod %s/%s netns changed: %s -> %s, moving veth bridge", srv.Namespace, srv.PodName, srv.NetnsPath, netnsPath)
+
+	if link, err := pm.nl.LinkByName(srv.HostVethName); err == nil {
+		if err := pm.nl.LinkDel(link); err != nil {
+			log.Printf("Warning: failed to delete old veth %s: %v", srv.HostVethName, err)
+		}
+	}
+	delPodRules(pm.nl, srv.HostVethName, 0)
+
+	tunName := tunNameForContainer(srv.ContainerID)
+	if srv.tunDev != nil {
+		if name, err := srv.tunDev.Name(); err == nil {
+			tunName = name
+		}
+	}
+	hostVethName, err := pm.setupVethBridge(netnsPath, srv.PodIfName, tunName, srv.RouteTableID, srv.TailscaleIPv4, srv.TailscaleIPv6, defaultVethMTU, srv.Routes, srv.RoutingMode)
 	if err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		os.RemoveAll(podStateDir)
-		return nil, fmt.Errorf("setting up veth bridge: %w", err)
+		return fmt.Errorf("setting up veth bridge: %w", err)
+	}
+	var primaryRoutes []PrimaryRoute
+	if srv.FullTunnel {
+		// The new netns has its own primary routes
+		primaryRoutes, err = setupFullTunnel(netnsPath, srv.PodIfName, hostVethName, tunName, srv.RouteTableID, srv.TailscaleIPv4, srv.TailscaleIPv6, srv.RoutingMode)
+	}
+	pm.mu.Lock()
+	srv.HostVethName = hostVethName
+	srv.NetnsPath = netnsPath
+	srv.PrimaryRoutes = primaryRoutes
+	pm.mu.Unlock()
+	if err != nil {
+		return err
 	}
 
-	managed := &ManagedServer{
-		Backend:       lb,
-		Engine:        eng,
-		Sys:           sys,
-		NetMon:        netMon,
-		ContainerID:   containerID,
-		PodName:       podName,
-		Namespace:     namespace,
-		Hostname:      hostname,
-		ClusterIP:     clusterIP,
-		HostVethName:  hostVethName,
-		TailscaleIPv4: tailscaleIPv4,
-		TailscaleIPv6: tailscaleIPv6,
-		CreatedAt:     time.Now(),
+	if err := pm.saveMetadata(srv.ContainerID, srv, netnsPath); err != nil {
+		log.Printf("Warning: failed to save metadata for %s: %v", srv.ContainerID, err)
 	}
+	return nil
+}
 
-	pm.servers[containerID] = managed
+// allocWireGuardPort returns the WireGuard listen port for a pod's node,
+// the lowest port from the configured base up that no other pod holds.
+// want, the port the pod had before a restart, is kept if it's still free,
+// so firewall rules and peers' endpoints stay valid. A pod that already has
+// a port keeps it. 0 means the node picks a random port: no base is
+// configured, or every port above it is taken.
+func (pm *PodManager) allocWireGuardPort(containerID string, want uint16) uint16 {
+	if pm.wgBasePort == 0 {
+		return 0
+	}
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if port, ok := pm.wgPorts[containerID]; ok {
+		return port
+	}
+	used := make(map[uint16]bool, len(pm.wgPorts))
+	for _, port := range pm.wgPorts {
+		used[port] = true
+	}
+	port := want
+	if port < pm.wgBasePort || used[port] {
+		for port = pm.wgBasePort; used[port]; port++ {
+			if port == math.MaxUint16 {
+				log.Printf("Warning: no free WireGuard port from %d up, pod %s gets a random one", pm.wgBasePort, containerID)
+				return 0
+			}
+		}
+	}
+	pm.wgPorts[containerID] = port
+	return port
+}
 
-	if err := pm.saveMetadata(containerID, managed, netnsPath); err != nil {
-		log.Printf("Warning: failed to save metadata for %s: %v", containerID, err)
+// releaseWireGuardPort frees a pod's WireGuard port. Caller must hold pm.mu.
+func (pm *PodManager) releaseWireGuardPort(containerID string) {
+	delete(pm.wgPorts, containerID)
+}
+
+// allocRouteTable returns the host routing table for a veth pod's routes
+// (see routePodViaTUN), the lowest from podTableBase up that no other pod
+// holds and that the host has no rules or routes in: those may be another
+// program's, or a pod's not yet recovered after a restart. want, the table
+// the pod had before a restart, is kept if no other pod holds it; what the
+// host has in it is the pod's own.
+func (pm *PodManager) allocRouteTable(containerID string, want int) (int, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if table, ok := pm.routeTables[containerID]; ok {
+		return table, nil
+	}
+	held := make(map[int]bool, len(pm.routeTables))
+	for _, table := range pm.routeTables {
+		held[table] = true
+	}
+	if isPodTable(want) && !held[want] {
+		pm.routeTables[containerID] = want
+		return want, nil
 	}
 
-	return managed, nil
+	used, err := hostRouteTables()
+	if err != nil {
+		return 0, fmt.Errorf("allocating routing table: %w", err)
+	}
+	for table := podTableBase; isPodTable(table); table++ {
+		if !held[table] && !used[table] {
+			pm.routeTables[containerID] = table
+			return table, nil
+		}
+	}
+	return 0, fmt.Errorf("allocating routing table: all %d from %#x are in use", podTables, podTableBase)
+}
+
+// releaseRouteTable frees a pod's routing table, once its rules and routes
+// are gone. Caller must hold pm.mu.
+func (pm *PodManager) releaseRouteTable(containerID string) {
+	delete(pm.routeTables, containerID)
 }
 
 // setupVethBridge creates veth pair and configures routing between TUN and pod.
-func setupVethBridge(netnsPath, podIfName, tunName string, tailscaleIP netip.Addr, mtu int) (string, error) {
-	podNS, err := ns.GetNS(netnsPath)
+// Each of routes is sent via the pod interface in the pod and via the TUN on the host.
+// ipv6 is the zero Addr if the node has no IPv6 address. If it fails once the
+// veth pair exists, the pair is removed again (see removeVethBridge).
+func (pm *PodManager) setupVethBridge(netnsPath, podIfName, tunName string, table int, ipv4, ipv6 netip.Addr, mtu int, routes []netip.Prefix, routingMode string) (_ string, err error) {
+	podNS, err := getPodNS(netnsPath)
 	if err != nil {
-		return "", fmt.Errorf("getting netns: %w", err)
+		return "", err
 	}
 	defer podNS.Close()
 
@@ -377,8 +1614,18 @@ func setupVethBridge(netnsPath, podIfName, tunName string, tailscaleIP netip.Add
 	}
 	hostVethName := "veth" + hex.EncodeToString(randBytes[:])
 
+	var created bool
+	defer func() {
+		if err != nil && created {
+			removeVethBridge(pm.nl, netnsPath, podIfName, hostVethName, table)
+		}
+	}()
+
 	// Create veth pair in pod namespace
 	err = podNS.Do(func(hostNS ns.NetNS) error {
+		if err := removeStaleLink(podIfName); err != nil {
+			return err
+		}
 		veth := &netlink.Veth{
 			LinkAttrs: netlink.LinkAttrs{
 				Name: podIfName,
@@ -387,163 +1634,641 @@ func setupVethBridge(netnsPath, podIfName, tunName string, tailscaleIP netip.Add
 			PeerName: hostVethName,
 		}
 
-		if err := netlink.LinkAdd(veth); err != nil {
+		if err := pm.nl.LinkAdd(veth); err != nil {
 			return fmt.Errorf("creating veth pair: %w", err)
 		}
+		created = true
 
 		// Get interfaces
-		podLink, err := netlink.LinkByName(podIfName)
+		podLink, err := linkByName(podIfName)
 		if err != nil {
 			return fmt.Errorf("getting pod interface: %w", err)
 		}
 
-		hostLink, err := netlink.LinkByName(hostVethName)
+		if err := checkRouteConflicts(podLink.Attrs().Index, routes); err != nil {
+			return err
+		}
+
+		hostLink, err := linkByName(hostVethName)
 		if err != nil {
 			return fmt.Errorf("getting host interface: %w", err)
 		}
+		hostMAC := hostLink.Attrs().HardwareAddr
 
 		// Move host veth to host namespace
-		if err := netlink.LinkSetNsFd(hostLink, int(hostNS.Fd())); err != nil {
+		if err := pm.nl.LinkSetNsFd(hostLink, int(hostNS.Fd())); err != nil {
 			return fmt.Errorf("moving host veth: %w", err)
 		}
 
-		// Configure pod interface with Tailscale IP
-		addr := &netlink.Addr{
-			IPNet: &net.IPNet{
-				IP:   tailscaleIP.AsSlice(),
-				Mask: net.CIDRMask(32, 32),
-			},
-		}
-		if err := netlink.AddrAdd(podLink, addr); err != nil {
-			return fmt.Errorf("adding IP to pod interface: %w", err)
-		}
-
-		if err := netlink.LinkSetUp(podLink); err != nil {
-			return fmt.Errorf("bringing up pod interface: %w", err)
-		}
-
-		// Route Tailscale CGNAT range via this interface
-		_, tailscaleCIDR, _ := net.ParseCIDR("100.64.0.0/10")
-		route := &netlink.Route{
-			LinkIndex: podLink.Attrs().Index,
-			Dst:       tailscaleCIDR,
-			Scope:     netlink.SCOPE_LINK,
-		}
-		if err := netlink.RouteAdd(route); err != nil {
-			return fmt.Errorf("adding Tailscale route: %w", err)
-		}
-
-		return nil
+		return configureTailscaleRoutes(podLink, hostMAC, ipv4, ipv6, routes, routingMode)
 	})
 	if err != nil {
 		return "", err
 	}
 
-	// Configure host side
-	hostLink, err := netlink.LinkByName(hostVethName)
+	// Configure host side, once the moved veth shows up here
+	hostLink, err := linkByName(hostVethName)
 	if err != nil {
 		return "", fmt.Errorf("getting host veth: %w", err)
 	}
 
-	if err := netlink.LinkSetUp(hostLink); err != nil {
+	if err := pm.nl.LinkSetUp(hostLink); err != nil {
 		return "", fmt.Errorf("bringing up host veth: %w", err)
 	}
 
-	// Route to pod's Tailscale IP via host veth
-	podRoute := &netlink.Route{
-		LinkIndex: hostLink.Attrs().Index,
-		Dst: &net.IPNet{
-			IP:   tailscaleIP.AsSlice(),
-			Mask: net.CIDRMask(32, 32),
-		},
-		Scope: netlink.SCOPE_LINK,
+	// Route to pod's Tailscale IPs via host veth
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		podRoute := &netlink.Route{
+			LinkIndex: hostLink.Attrs().Index,
+			Dst:       prefixToIPNet(netip.PrefixFrom(ip, ip.BitLen())),
+			Scope:     netlink.SCOPE_LINK,
+		}
+		if err := pm.nl.RouteAdd(podRoute); err != nil {
+			log.Printf("Warning: failed to add route to pod: %v", err)
+		}
 	}
-	if err := netlink.RouteAdd(podRoute); err != nil {
-		log.Printf("Warning: failed to add route to pod: %v", err)
+	if ipv6.IsValid() {
+		warnIPv6Forwarding()
 	}
 
-	// Enable proxy ARP on host veth so it responds to ARP for Tailscale IPs
-	proxyArpPath := fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/proxy_arp", hostVethName)
-	if err := os.WriteFile(proxyArpPath, []byte("1"), 0644); err != nil {
-		log.Printf("Warning: failed to enable proxy ARP: %v", err)
+	if routingMode != RoutingModeNetstack {
+		// Enable proxy ARP on host veth so it responds to ARP for Tailscale IPs
+		pm.enableProxyARP(hostVethName)
+
+		// Forward between the veth and the TUN
+		pm.enableForwarding(hostVethName, tunName)
 	}
 
-	// Enable IP forwarding
-	if err := os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
-		log.Printf("Warning: failed to enable IP forwarding: %v", err)
+	// Send the pod's traffic for Tailscale ranges, arriving on the veth, to
+	// its own TUN
+	if err := routePodViaTUN(pm.nl, hostVethName, tunName, table, ipv4, ipv6, routes); err != nil {
+		return "", err
 	}
 
-	// Add route for Tailscale CGNAT range to go via TUN
-	// This allows traffic from pod (arriving via veth) to be forwarded to TUN
-	tunLink, err := netlink.LinkByName(tunName)
+	log.Printf("Set up veth bridge: %s <-> %s (TUN: %s)", podIfName, hostVethName, tunName)
+
+	return hostVethName, nil
+}
+
+// removeVethBridge deletes a pod's veth pair, from whichever end can still be
+// found, and with it the pair's addresses, routes and per-interface sysctls
+// on both sides. The host veth's rules and routing table are flushed, as
+// routePodViaTUN may have filled the table before adding the rules.
+func removeVethBridge(nl netlinkOps, netnsPath, podIfName, hostVethName string, table int) {
+	if podNS, err := getPodNS(netnsPath); err == nil {
+		podNS.Do(func(ns.NetNS) error {
+			if link, err := nl.LinkByName(podIfName); err == nil {
+				if err := nl.LinkDel(link); err != nil {
+					log.Printf("Warning: failed to delete pod veth %s: %v", podIfName, err)
+				}
+			}
+			return nil
+		})
+		podNS.Close()
+	}
+	// Normally gone with its peer by now
+	if link, err := nl.LinkByName(hostVethName); err == nil {
+		if err := nl.LinkDel(link); err != nil {
+			log.Printf("Warning: failed to delete veth %s: %v", hostVethName, err)
+		}
+	}
+	delPodRules(nl, hostVethName, 0)
+	if isPodTable(table) {
+		flushPodTable(nl, table)
+	}
+}
+
+// checkRouteConflicts checks the routes of the current netns, other than
+// those of interface skip, against the Tailscale routes. Another interface's
+// routes can shadow them, which is only logged; an identical one would also
+// make adding ours fail, so it is an error.
+func checkRouteConflicts(skip int, routes []netip.Prefix) error {
+	existing, err := podRoutePrefixes(skip)
 	if err != nil {
-		return "", fmt.Errorf("getting TUN link for routing: %w", err)
+		return err
 	}
-	_, tailscaleCIDR, _ := net.ParseCIDR("100.64.0.0/10")
-	tunRoute := &netlink.Route{
-		LinkIndex: tunLink.Attrs().Index,
-		Dst:       tailscaleCIDR,
-		Scope:     netlink.SCOPE_LINK,
+	for _, c := range findRouteConflicts(existing, routes) {
+		if c.Existing == c.Route {
+			return fmt.Errorf("pod already has a route for %s from another interface; leave it out of tailscaleRoutes in the CNI config", c.Route)
+		}
+		log.Printf("Warning: pod route %s overlaps Tailscale route %s; traffic to %s will not use Tailscale", c.Existing, c.Route, c.Existing)
 	}
-	if err := netlink.RouteAdd(tunRoute); err != nil {
-		// Might already exist from a previous pod
-		log.Printf("Note: adding Tailscale route to TUN: %v", err)
+	return nil
+}
+
+// routeConflict is an existing route in a pod that overlaps a Tailscale
+// route and is at least as specific, so the kernel picks it for some or all
+// of the Tailscale route's addresses.
+type routeConflict struct {
+	Route    netip.Prefix // the Tailscale route
+	Existing netip.Prefix
+}
+
+// findRouteConflicts returns the existing routes that would take traffic
+// away from routes. Less specific routes, like the default route, are not
+// conflicts: the Tailscale route wins by longest prefix match.
+func findRouteConflicts(existing, routes []netip.Prefix) []routeConflict {
+	var conflicts []routeConflict
+	for _, r := range routes {
+		for _, e := range existing {
+			if e.Overlaps(r) && e.Bits() >= r.Bits() {
+				conflicts = append(conflicts, routeConflict{Route: r, Existing: e})
+			}
+		}
 	}
+	return conflicts
+}
 
-	log.Printf("Set up veth bridge: %s <-> %s (TUN: %s)", podIfName, hostVethName, tunName)
+// podRoutePrefixes returns the destinations of the main table's routes in
+// the current network namespace, except those on the link with index skip.
+func podRoutePrefixes(skip int) ([]netip.Prefix, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("listing pod routes: %w", err)
+	}
+	var prefixes []netip.Prefix
+	for _, r := range routes {
+		if r.LinkIndex == skip || r.Dst == nil {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(r.Dst.IP)
+		if !ok {
+			continue
+		}
+		ones, _ := r.Dst.Mask.Size()
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), ones))
+	}
+	return prefixes, nil
+}
 
-	return hostVethName, nil
+// DeletePod removes a pod's Tailscale node. If the pod is still being
+// added, the ADD is canceled, tearing down what it had brought up; a
+// reattach or another DEL in flight is waited for, for as long as ctx
+// allows. A container with no running node (lost in a crash or a partial
+// recovery) still has whatever it left on the host removed. With DelDrain
+// set, the node is drained first, for no longer than ctx allows.
+//
+// The node is torn down without pm.mu held, so ADDs and DELs of other
+// containers aren't held up by it.
+func (pm *PodManager) DeletePod(ctx context.Context, containerID string) error {
+	return pm.deletePod(ctx, containerID, pm.delDrain)
 }
 
-// DeletePod removes a pod's Tailscale node.
-func (pm *PodManager) DeletePod(containerID string) error {
+// deletePod is DeletePod, draining the node for drain first if positive.
+func (pm *PodManager) deletePod(ctx context.Context, containerID string, drain time.Duration) error {
 	pm.mu.Lock()
-	defer pm.mu.Unlock()
+	for {
+		inflight, ok := pm.attaching[containerID]
+		if !ok {
+			break
+		}
+		// The runtime has given up on the pod; an ADD would only bring up
+		// a node for this DEL to tear down
+		if cancel, ok := pm.cancelAdd[containerID]; ok {
+			log.Printf("Canceling in-flight ADD of container %s", containerID)
+			cancel(errDeletedDuringAdd)
+		}
+		pm.mu.Unlock()
+		select {
+		case <-inflight:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for in-flight attach of %s: %w", containerID, ctx.Err())
+		}
+		pm.mu.Lock()
+	}
 
 	managed, ok := pm.servers[containerID]
 	if !ok {
-		log.Printf("Pod %s not found, already cleaned up", containerID)
+		pm.mu.Unlock()
+		pm.cleanupUnmanagedPod(containerID)
 		return nil
 	}
+	// Hold off other ADDs, DELs and reattaches of the pod, as an attach does
+	done := make(chan struct{})
+	pm.attaching[containerID] = done
+	pm.mu.Unlock()
+	defer func() {
+		pm.mu.Lock()
+		delete(pm.attaching, containerID)
+		pm.releaseWireGuardPort(containerID)
+		pm.releaseRouteTable(containerID)
+		remaining := len(pm.servers) + len(pm.attaching)
+		pm.mu.Unlock()
+		close(done)
+		pm.restoreGlobalForwarding(remaining)
+	}()
+
+	if drain > 0 {
+		pm.drainPod(ctx, managed, drain)
+	}
+	pm.mu.Lock()
+	delete(pm.servers, containerID)
+	metricManagedPods.Set(int64(len(pm.servers)))
+	pm.mu.Unlock()
 
 	log.Printf("Deleting Tailscale node for pod %s/%s", managed.Namespace, managed.PodName)
 
 	managed.Backend.Shutdown()
 	managed.Engine.Close()
-	if managed.NetMon != nil {
-		managed.NetMon.Close()
-	}
+	managed.stopLinkChanges()
 
 	// Clean up host veth (pod side gets cleaned up with namespace)
 	if managed.HostVethName != "" {
-		if link, err := netlink.LinkByName(managed.HostVethName); err == nil {
-			netlink.LinkDel(link)
+		if link, err := pm.nl.LinkByName(managed.HostVethName); err == nil {
+			pm.nl.LinkDel(link)
+		}
+		delPodRules(pm.nl, managed.HostVethName, 0)
+	}
+	if managed.FullTunnel {
+		// The pod may outlive the DEL, as when a runtime retries a failed ADD
+		if err := restorePrimaryRoutes(managed.NetnsPath, managed.PodIfName, managed.PrimaryRoutes); err != nil && !errors.Is(err, errNetnsGone) {
+			log.Printf("Warning: failed to restore default routes of pod %s/%s: %v", managed.Namespace, managed.PodName, err)
 		}
 	}
 
 	podStateDir := filepath.Join(pm.stateDir, "pods", containerID)
 	os.RemoveAll(podStateDir)
-
-	delete(pm.servers, containerID)
+	if managed.poolDir != "" {
+		os.RemoveAll(managed.poolDir)
+	}
+	pm.releasePod(managed.Namespace, managed.PodName, managed.DeviceID, managed.stateOwner())
+	pm.annotations.forget(managed.PodUID)
+	pm.publish(newPodEvent(podDetached, managed))
 	return nil
 }
 
-// CheckPod verifies a pod's Tailscale connection is healthy.
+// drainPod gives a pod's connections drain, or until ctx is done, to
+// finish, then takes its node offline. Stopping the node drops its peers,
+// so it stays up until then.
+func (pm *PodManager) drainPod(ctx context.Context, managed *ManagedServer, drain time.Duration) {
+	log.Printf("Draining Tailscale node for pod %s/%s for up to %s", managed.Namespace, managed.PodName, drain)
+	if err := waitDrain(ctx, drain); err != nil {
+		log.Printf("Warning: drain of pod %s/%s cut short: %v", managed.Namespace, managed.PodName, err)
+	}
+	managed.takeOffline()
+}
+
+// waitDrain waits for d, or until ctx is done, returning ctx's error if so.
+func waitDrain(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// takeOffline sets the node's WantRunning to false, which disconnects it
+// from control, and so tells its peers that it's gone rather than leaving
+// them to notice it stopped answering.
+func (m *ManagedServer) takeOffline() {
+	_, err := m.Backend.EditPrefs(&ipn.MaskedPrefs{
+		Prefs:          ipn.Prefs{WantRunning: false},
+		WantRunningSet: true,
+	})
+	if err != nil {
+		log.Printf("Warning: failed to take pod %s/%s offline: %v", m.Namespace, m.PodName, err)
+	}
+}
+
+// ReattachPod shuts down a pod's Tailscale node and starts it again from its
+// persisted state, the way recovery does after a daemon restart, for a node
+// that has wedged. The node keeps its key, and so its IP. The pod's netns
+// and veth are reused; only the host routes to the new TUN are redone.
+// A concurrent DEL waits for the reattach to finish.
+//
+// If the node can't be started again the pod is left without one; its
+// state stays on disk, so a DEL or daemon restart still cleans it up.
+func (pm *PodManager) ReattachPod(ctx context.Context, containerID string) (*ManagedServer, error) {
+	pm.mu.Lock()
+	for {
+		inflight, ok := pm.attaching[containerID]
+		if !ok {
+			break
+		}
+		pm.mu.Unlock()
+		select {
+		case <-inflight:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		pm.mu.Lock()
+	}
+	old, ok := pm.servers[containerID]
+	if !ok {
+		pm.mu.Unlock()
+		return nil, fmt.Errorf("%w %s", errPodNotFound, containerID)
+	}
+	done := make(chan struct{})
+	pm.attaching[containerID] = done
+	pm.mu.Unlock()
+
+	defer func() {
+		pm.mu.Lock()
+		delete(pm.attaching, containerID)
+		metricManagedPods.Set(int64(len(pm.servers)))
+		pm.mu.Unlock()
+		close(done)
+	}()
+
+	meta, err := pm.loadMetadata(containerID)
+	if err != nil {
+		return nil, fmt.Errorf("loading metadata: %w", err)
+	}
+
+	log.Printf("Reattaching pod %s/%s (container %s)", old.Namespace, old.PodName, containerID)
+
+	// Closing the engine also closes the TUN, taking its routes with it
+	old.Backend.Shutdown()
+	old.Engine.Close()
+	old.stopLinkChanges()
+
+	managed, err := pm.recoverPodBackend(ctx, containerID, meta, old.TailscaleIPv4)
+
+	pm.mu.Lock()
+	if err != nil {
+		delete(pm.servers, containerID)
+		pm.releaseWireGuardPort(containerID)
+		pm.releaseRouteTable(containerID)
+	} else {
+		pm.servers[containerID] = managed
+	}
+	pm.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("restarting node: %w", err)
+	}
+	if old.poolDir != "" {
+		// The new node's state directory is the pod's own
+		os.RemoveAll(old.poolDir)
+	}
+
+	if managed.TailscaleIPv4 != old.TailscaleIPv4 {
+		log.Printf("Updating persisted metadata with new IP %s", managed.TailscaleIPv4)
+		if err := pm.saveMetadata(containerID, managed, meta.NetnsPath); err != nil {
+			log.Printf("Warning: failed to update metadata: %v", err)
+		}
+	}
+
+	log.Printf("Reattached pod %s/%s with IP %s", managed.Namespace, managed.PodName, managed.TailscaleIPv4)
+	return managed, nil
+}
+
+// StaleContainers returns the containers, not in valid, that have a running
+// node or state on disk. Containers being attached are never stale: their
+// ADD may have started after the runtime listed its attachments.
+func (pm *PodManager) StaleContainers(valid map[string]bool) []string {
+	known := make(map[string]bool)
+	if entries, err := os.ReadDir(filepath.Join(pm.stateDir, "pods")); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				known[entry.Name()] = true
+			}
+		}
+	}
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	for containerID := range pm.servers {
+		known[containerID] = true
+	}
+	var stale []string
+	for containerID := range known {
+		if _, attaching := pm.attaching[containerID]; attaching || valid[containerID] {
+			continue
+		}
+		stale = append(stale, containerID)
+	}
+	slices.Sort(stale)
+	return stale
+}
+
+// CheckPod verifies a pod's Tailscale connection is healthy: its node is
+// running (see checkStatus), and its interfaces and routes are in place
+// (see checkDatapath). pm.mu is only held to look the pod up, not for the
+// checks: they are I/O.
 func (pm *PodManager) CheckPod(containerID string) (bool, string, error) {
 	pm.mu.RLock()
-	defer pm.mu.RUnlock()
-
 	managed, ok := pm.servers[containerID]
+	var dp datapath
+	if ok {
+		dp = managed.datapath()
+	}
+	pm.mu.RUnlock()
 	if !ok {
 		return false, "pod not found", nil
 	}
 
-	status := managed.Backend.Status()
+	healthy, message := checkStatus(managed.Backend.Status(), pm.staleAfter, time.Now())
+	// A running node is no use to a pod whose interfaces or routes are gone
+	if healthy {
+		if problems := pm.checkDatapath(dp); len(problems) > 0 {
+			healthy, message = false, "datapath broken: "+strings.Join(problems, "; ")
+		}
+	}
+	pm.noteHealth(managed, healthy, message)
+	return healthy, message, nil
+}
+
+// checkStatus judges a node's health from its status, for CheckPod. A
+// node the local backend thinks is running can still be cut off: control
+// may have expired its key, or it may have lost its connection to control.
+// The first fails the check. The second is only noted, since the node
+// keeps working on its last netmap while it reconnects.
+func checkStatus(status *ipnstate.Status, staleAfter time.Duration, now time.Time) (bool, string) {
 	if status.BackendState != "Running" {
-		return false, fmt.Sprintf("backend state is %s", status.BackendState), nil
+		return false, fmt.Sprintf("backend state is %s", status.BackendState)
+	}
+	if status.Self != nil && status.Self.Expired {
+		return false, "control plane reports the node's key as expired"
 	}
+	if age, ok := handshakeAge(status, now); ok && staleAfter > 0 && age > staleAfter {
+		return false, fmt.Sprintf("no WireGuard handshake with any active peer for %s", age.Round(time.Second))
+	}
+	if status.Self != nil && !status.Self.Online {
+		return true, "healthy, but not connected to the control plane"
+	}
+	return true, "healthy"
+}
 
-	return true, "healthy", nil
+// Paths a node's traffic takes to its peers, as reported by nodePath.
+const (
+	pathIdle     = "idle"      // no recently active peers
+	pathDirect   = "direct"    // at least one active peer over UDP
+	pathDERPOnly = "derp-only" // every active peer relayed through DERP
+)
+
+// pathMetricsInterval is how often node paths are sampled for metrics.
+const pathMetricsInterval = 30 * time.Second
+
+// nodePath classifies how a node reaches its recently active peers.
+// Peer relays count as direct: they're UDP, not DERP.
+func nodePath(status *ipnstate.Status) string {
+	path := pathIdle
+	for _, peer := range status.Peer {
+		if !peer.Active {
+			continue
+		}
+		if peer.CurAddr != "" || peer.PeerRelay != "" {
+			return pathDirect
+		}
+		if peer.Relay != "" {
+			path = pathDERPOnly
+		}
+	}
+	return path
+}
+
+// RunPathMetrics updates the direct/DERP-only node gauges every
+// pathMetricsInterval until ctx is done.
+func (pm *PodManager) RunPathMetrics(ctx context.Context) {
+	ticker := time.NewTicker(pathMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.updatePathMetrics()
+		}
+	}
+}
+
+func (pm *PodManager) updatePathMetrics() {
+	// Snapshot the backends so a slow AddPod doesn't stall sampling
+	pm.mu.RLock()
+	backends := make([]*ipnlocal.LocalBackend, 0, len(pm.servers))
+	for _, srv := range pm.servers {
+		backends = append(backends, srv.Backend)
+	}
+	pm.mu.RUnlock()
+
+	var direct, derpOnly int64
+	for _, lb := range backends {
+		switch nodePath(lb.Status()) {
+		case pathDirect:
+			direct++
+		case pathDERPOnly:
+			derpOnly++
+		}
+	}
+	metricNodesDirect.Set(direct)
+	metricNodesDERPOnly.Set(derpOnly)
+}
+
+// handshakeWatchInterval is how often RunHandshakeWatch checks nodes.
+const handshakeWatchInterval = 30 * time.Second
+
+// handshakeAge returns how long ago a node last completed a WireGuard
+// handshake with any of its recently active peers. ok is false if it has
+// no active peer it has completed one with: an idle node has no reason to
+// handshake, so its age says nothing about its sessions.
+func handshakeAge(status *ipnstate.Status, now time.Time) (age time.Duration, ok bool) {
+	var latest time.Time
+	for _, peer := range status.Peer {
+		if peer.Active && peer.LastHandshake.After(latest) {
+			latest = peer.LastHandshake
+		}
+	}
+	if latest.IsZero() {
+		return 0, false
+	}
+	return now.Sub(latest), true
+}
+
+// HandshakeAge returns handshakeAge for the node now.
+func (m *ManagedServer) HandshakeAge() (time.Duration, bool) {
+	return handshakeAge(m.Backend.Status(), time.Now())
+}
+
+// RunHandshakeWatch reattaches nodes whose WireGuard sessions have all gone
+// stale, checking every handshakeWatchInterval until ctx is done. Such a
+// node is effectively disconnected even though its backend still says
+// Running. It does nothing if HandshakeStaleAfter is 0.
+func (pm *PodManager) RunHandshakeWatch(ctx context.Context) {
+	if pm.staleAfter == 0 {
+		return
+	}
+	ticker := time.NewTicker(handshakeWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.reattachStalePods(ctx)
+		}
+	}
+}
+
+// reattachStalePods reattaches, one at a time, every node with no handshake
+// within pm.staleAfter. A reattached node starts with no handshakes, so it
+// isn't reattached again until it has had one and that has gone stale.
+func (pm *PodManager) reattachStalePods(ctx context.Context) {
+	pm.mu.RLock()
+	servers := make([]*ManagedServer, 0, len(pm.servers))
+	for _, srv := range pm.servers {
+		servers = append(servers, srv)
+	}
+	pm.mu.RUnlock()
+
+	var stale []*ManagedServer
+	for _, srv := range servers {
+		if age, ok := srv.HandshakeAge(); ok && age > pm.staleAfter {
+			log.Printf("Pod %s/%s has had no WireGuard handshake with an active peer for %s, reattaching",
+				srv.Namespace, srv.PodName, age.Round(time.Second))
+			pm.noteHealth(srv, false, fmt.Sprintf("no WireGuard handshake with any active peer for %s", age.Round(time.Second)))
+			stale = append(stale, srv)
+		}
+	}
+	metricNodesHandshakeStale.Set(int64(len(stale)))
+
+	for _, srv := range stale {
+		if ctx.Err() != nil {
+			return
+		}
+		metricStaleReattaches.Add(1)
+		if _, err := pm.ReattachPod(ctx, srv.ContainerID); err != nil {
+			log.Printf("Warning: failed to reattach stale pod %s/%s: %v", srv.Namespace, srv.PodName, err)
+		}
+	}
+}
+
+// trafficMetricsInterval is how often per-pod traffic is sampled for metrics.
+const trafficMetricsInterval = 30 * time.Second
+
+// RunTrafficMetrics updates the per-pod traffic counters every
+// trafficMetricsInterval until ctx is done.
+func (pm *PodManager) RunTrafficMetrics(ctx context.Context) {
+	ticker := time.NewTicker(trafficMetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.updateTrafficMetrics()
+		}
+	}
+}
+
+func (pm *PodManager) updateTrafficMetrics() {
+	pm.mu.RLock()
+	systems := make(map[podLabels]*tsd.System, len(pm.servers))
+	for _, srv := range pm.servers {
+		systems[podLabels{Namespace: srv.Namespace, Pod: srv.PodName}] = srv.Sys
+	}
+	pm.mu.RUnlock()
+
+	traffic := make(map[podLabels]podTraffic, len(systems))
+	for l, sys := range systems {
+		traffic[l] = readPodTraffic(sys.UserMetricsRegistry())
+	}
+	setPodTrafficMetrics(traffic)
 }
 
 // GetPod returns the managed server for a container ID.
@@ -566,30 +2291,223 @@ func (pm *PodManager) GetPodByName(namespace, name string) (*ManagedServer, bool
 	return nil, false
 }
 
+// ListPods returns the managed servers of every running pod, sorted by
+// namespace and name.
+func (pm *PodManager) ListPods() []*ManagedServer {
+	pm.mu.RLock()
+	servers := make([]*ManagedServer, 0, len(pm.servers))
+	for _, srv := range pm.servers {
+		servers = append(servers, srv)
+	}
+	pm.mu.RUnlock()
+	slices.SortFunc(servers, func(a, b *ManagedServer) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PodName, b.PodName))
+	})
+	return servers
+}
+
 // saveMetadata persists pod metadata to disk.
 func (pm *PodManager) saveMetadata(containerID string, managed *ManagedServer, netnsPath string) error {
+	// Store the path recovery will be able to check, not the runtime's
+	// spelling of it
+	netnsPath = canonicalNetns(netnsPath)
+
 	meta := PodMetadata{
 		ContainerID:   managed.ContainerID,
 		PodName:       managed.PodName,
 		Namespace:     managed.Namespace,
+		PodUID:        managed.PodUID,
 		Hostname:      managed.Hostname,
+		DNSName:       managed.DNSName,
+		Renamed:       managed.Renamed,
 		TailscaleIPv4: managed.TailscaleIPv4.String(),
 		CreatedAt:     managed.CreatedAt,
 		NetnsPath:     netnsPath,
 		HostVethName:  managed.HostVethName,
+		PodIfName:     managed.PodIfName,
 		ClusterIP:     managed.ClusterIP,
+		DeviceID:      managed.DeviceID,
+		DERPRegion:    managed.DERPRegion,
+		Tags:          managed.Tags,
+		RoutingMode:   managed.RoutingMode,
+		WireGuardPort: managed.WireGuardPort,
+		TUNInPod:      managed.TUNInPod,
+		RouteTableID:  managed.RouteTableID,
+		FullTunnel:    managed.FullTunnel,
+		PrimaryRoutes: managed.PrimaryRoutes,
+		DNSSearch:     managed.DNS.Search,
+		KeepIdentity:  managed.KeepIdentity,
+	}
+	if managed.ExitNode.IsValid() {
+		meta.ExitNode = managed.ExitNode.String()
+	}
+	for _, ip := range managed.DNS.Servers {
+		meta.DNSServers = append(meta.DNSServers, ip.String())
+	}
+	for _, prefix := range managed.Routes {
+		meta.Routes = append(meta.Routes, prefix.String())
+	}
+	for _, prefix := range managed.Advertised {
+		meta.Advertised = append(meta.Advertised, prefix.String())
 	}
 	if managed.TailscaleIPv6.IsValid() {
 		meta.TailscaleIPv6 = managed.TailscaleIPv6.String()
 	}
 
-	data, err := json.MarshalIndent(meta, "", "  ")
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	metaPath := filepath.Join(pm.stateDir, "pods", containerID, "metadata.json")
+	return os.WriteFile(metaPath, data, 0600)
+}
+
+// openStateStore returns the Tailscale state store of owner, a pod,
+// according to the configured state backend, encrypted if the daemon has
+// state keys.
+func (pm *PodManager) openStateStore(logf logger.Logf, podStateDir, namespace, podName string, owner stateOwner) (ipn.StateStore, error) {
+	var st ipn.StateStore
+	var err error
+	if pm.stateBackend == StateBackendKubeSecret {
+		st, err = newKubeSecretStore(pm.kube, namespace, stateSecretName(podName), owner)
+	} else {
+		st, err = store.NewFileStore(logf, filepath.Join(podStateDir, "tailscale.state"))
+	}
+	if err != nil || pm.stateKeys == nil {
+		return st, err
+	}
+
+	es := &encryptedStore{st: st, keys: pm.stateKeys}
+	n, err := es.reencrypt()
+	if err != nil {
+		return nil, fmt.Errorf("re-encrypting state: %w", err)
+	}
+	if n > 0 {
+		log.Printf("Re-encrypted %d state values of pod %s/%s with key %s", n, namespace, podName, pm.stateKeys.ID())
+	}
+	return es, nil
+}
+
+// claimState makes the pod's state Secret, if the k8s-secret backend has
+// one for a pod of its name, owner's.
+func (pm *PodManager) claimState(ctx context.Context, namespace, podName string, owner stateOwner) error {
+	if pm.stateBackend != StateBackendKubeSecret {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	prev, err := claimStateSecret(ctx, pm.kube, namespace, stateSecretName(podName), owner)
+	if err != nil {
+		return err
+	}
+	if prev != "" && prev != owner.UID {
+		log.Printf("Pod %s/%s (UID %s) took over the state of the previous pod of its name (UID %s)", namespace, podName, owner.UID, prev)
+	}
+	return nil
+}
+
+// hasPersistedState reports whether a pod has Tailscale state to recover
+// from. A state Secret another pod has taken over isn't the pod's.
+func (pm *PodManager) hasPersistedState(containerID string, meta *PodMetadata) (bool, error) {
+	if pm.stateBackend == StateBackendKubeSecret {
+		ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+		defer cancel()
+		secret, err := pm.kube.GetSecret(ctx, meta.Namespace, stateSecretName(meta.PodName))
+		if isKubeNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !ownedBy(secret, meta.PodUID) {
+			log.Printf("State of pod %s/%s was taken over by pod UID %s", meta.Namespace, meta.PodName, secret.Metadata.Annotations[stateOwnerAnnotation])
+			return false, nil
+		}
+		return len(secret.Data) > 0, nil
+	}
+
+	stateStorePath := filepath.Join(pm.stateDir, "pods", containerID, "tailscale.state")
+	_, err := os.Stat(stateStorePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// backupState copies a new pod's file-backed state to its state Secret, if
+// state backups are on. A failed backup only loses the chance to restore the
+// state later, so it doesn't fail the pod.
+func (pm *PodManager) backupState(ctx context.Context, st ipn.StateStore, namespace, podName string, owner stateOwner) {
+	if pm.stateBackup != StateBackupSecret {
+		return
+	}
+	// Encrypted state is backed up as it is on disk
+	if es, ok := st.(*encryptedStore); ok {
+		st = es.st
+	}
+	fileStore, ok := st.(store.ExportableStore)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+	name := stateSecretName(podName)
+	if err := backupState(ctx, pm.kube, namespace, name, owner, fileStore); err != nil {
+		log.Printf("Warning: failed to back up state for pod %s/%s to secret %s: %v", namespace, podName, name, err)
+	}
+}
+
+// restoreState restores a pod's missing state file from its state Secret,
+// if state backups are on. It returns false if there was no backup.
+func (pm *PodManager) restoreState(containerID string, meta *PodMetadata) (bool, error) {
+	if pm.stateBackup != StateBackupSecret {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+	stateStorePath := filepath.Join(pm.stateDir, "pods", containerID, "tailscale.state")
+	return restoreState(ctx, pm.kube, meta.Namespace, stateSecretName(meta.PodName), meta.PodUID, stateStorePath)
+}
+
+// deleteState removes state held outside the pod's state directory: the
+// Secret of the k8s-secret backend or of state backups, unless another pod
+// of the same name has taken it over. The file backend's state is removed
+// along with the state directory. It reports whether the Secret was still
+// the pod's, or there was none; if the Secret can't be read it assumes not.
+func (pm *PodManager) deleteState(namespace, podName, podUID string) bool {
+	if pm.stateBackend != StateBackendKubeSecret && pm.stateBackup != StateBackupSecret {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+	name := stateSecretName(podName)
+	owned, err := deleteStateSecret(ctx, pm.kube, namespace, name, podUID)
 	if err != nil {
-		return err
+		log.Printf("Warning: failed to delete state secret %s/%s: %v", namespace, name, err)
+	} else if !owned {
+		log.Printf("Keeping state secret %s/%s, taken over by another pod of the same name", namespace, name)
 	}
+	return owned
+}
 
-	metaPath := filepath.Join(pm.stateDir, "pods", containerID, "metadata.json")
-	return os.WriteFile(metaPath, data, 0600)
+// releasePod removes what a deleted pod, owner, holds beyond this node: its
+// state Secret, if any, and its device on the tailnet. A pod that keeps its
+// identity keeps both. Once another pod of the same name has taken over the
+// Secret, the Secret is left alone, and under the k8s-secret backend so is
+// the device, which is the other pod's node now. Device deletion is queued
+// so mass teardowns don't flood the Tailscale API.
+func (pm *PodManager) releasePod(namespace, podName, deviceID string, owner stateOwner) {
+	if owner.Keep {
+		log.Printf("Keeping the state and device of pod %s/%s for the next pod of its name", namespace, podName)
+		return
+	}
+	if !pm.deleteState(namespace, podName, owner.UID) && pm.stateBackend == StateBackendKubeSecret {
+		return
+	}
+	if deviceID != "" && pm.oauthMgr != nil {
+		pm.oauthMgr.QueueDeviceDeletion(deviceID)
+	}
 }
 
 // netnsExists checks if a network namespace path is still valid.
@@ -597,28 +2515,46 @@ func netnsExists(netnsPath string) bool {
 	if netnsPath == "" {
 		return false
 	}
-	_, err := os.Stat(netnsPath)
+	_, err := resolveNetns(netnsPath)
 	return err == nil
 }
 
-// getOrCreateTUN returns a new TUN device, deleting any existing one first.
-func (pm *PodManager) getOrCreateTUN(logf logger.Logf, tunName string) (tun.Device, string, error) {
-	// Check if TUN device already exists and delete it
-	// (we can't reuse the file descriptor from a previous daemon run)
+// openHostTUN creates the TUN device tunName in the host namespace and
+// brings it up. If one already exists, it fails with errTUNCollision unless
+// reuse is set, in which case a TUN preserved by the previous daemon
+// (Preserve) is reopened, keeping its routes, and anything else is deleted
+// and recreated.
+func (pm *PodManager) openHostTUN(logf logger.Logf, tunName string, reuse bool) (tun.Device, string, error) {
+	var tunDev tun.Device
+	var actualTunName string
 	if link, err := netlink.LinkByName(tunName); err == nil {
-		log.Printf("Deleting existing TUN device %s", tunName)
-		if err := netlink.LinkDel(link); err != nil {
-			return nil, "", fmt.Errorf("deleting existing TUN: %w", err)
+		if !reuse {
+			return nil, "", fmt.Errorf("creating TUN device: %w: %s", errTUNCollision, tunName)
+		}
+		tunDev, actualTunName, err = tstun.New(logf, tunName)
+		if err == nil {
+			if err := setTUNPersist(tunDev, false); err != nil {
+				log.Printf("Warning: failed to clear persistence on TUN %s: %v", tunName, err)
+			}
+			log.Printf("Reattached to preserved TUN device %s", actualTunName)
+		} else {
+			log.Printf("Deleting existing TUN device %s", tunName)
+			if err := netlink.LinkDel(link); err != nil {
+				return nil, "", fmt.Errorf("deleting existing TUN: %w", err)
+			}
 		}
 	}
 
-	// Create fresh TUN device
-	tunDev, actualTunName, err := tstun.New(logf, tunName)
-	if err != nil {
-		return nil, "", fmt.Errorf("creating TUN device: %w", err)
+	if tunDev == nil {
+		var err error
+		tunDev, actualTunName, err = tstun.New(logf, tunName)
+		if err != nil {
+			return nil, "", fmt.Errorf("creating TUN device: %w", err)
+		}
+		log.Printf("Created TUN device %s in host namespace", actualTunName)
 	}
 
-	// Bring it up
+	// Bring up the TUN interface at the kernel level
 	tunLink, err := netlink.LinkByName(actualTunName)
 	if err != nil {
 		tunDev.Close()
@@ -628,52 +2564,41 @@ func (pm *PodManager) getOrCreateTUN(logf logger.Logf, tunName string) (tun.Devi
 		tunDev.Close()
 		return nil, "", fmt.Errorf("bringing up TUN: %w", err)
 	}
+	log.Printf("TUN device %s is now UP", actualTunName)
 
 	return tunDev, actualTunName, nil
 }
 
 // ensureRoutes verifies and fixes routes for an existing veth setup.
-func (pm *PodManager) ensureRoutes(tunName, vethName string, tailscaleIP netip.Addr) error {
-	// Route to pod's Tailscale IP via veth
-	vethLink, err := netlink.LinkByName(vethName)
+func (pm *PodManager) ensureRoutes(tunName, vethName string, table int, ipv4, ipv6 netip.Addr, routes []netip.Prefix) error {
+	// Route to pod's Tailscale IPs via veth
+	vethLink, err := pm.nl.LinkByName(vethName)
 	if err != nil {
 		return fmt.Errorf("getting veth: %w", err)
 	}
 
-	podRoute := &netlink.Route{
-		LinkIndex: vethLink.Attrs().Index,
-		Dst: &net.IPNet{
-			IP:   tailscaleIP.AsSlice(),
-			Mask: net.CIDRMask(32, 32),
-		},
-		Scope: netlink.SCOPE_LINK,
-	}
-	// RouteReplace is idempotent for existing routes
-	if err := netlink.RouteReplace(podRoute); err != nil {
-		log.Printf("Warning: failed to replace pod route: %v", err)
-	}
-
-	// Route for Tailscale CGNAT to TUN
-	tunLink, err := netlink.LinkByName(tunName)
-	if err != nil {
-		return fmt.Errorf("getting TUN: %w", err)
-	}
-	_, tailscaleCIDR, _ := net.ParseCIDR("100.64.0.0/10")
-	tunRoute := &netlink.Route{
-		LinkIndex: tunLink.Attrs().Index,
-		Dst:       tailscaleCIDR,
-		Scope:     netlink.SCOPE_LINK,
-	}
-	if err := netlink.RouteReplace(tunRoute); err != nil {
-		log.Printf("Warning: failed to replace TUN route: %v", err)
+	for _, ip := range []netip.Addr{ipv4, ipv6} {
+		if !ip.IsValid() {
+			continue
+		}
+		podRoute := &netlink.Route{
+			LinkIndex: vethLink.Attrs().Index,
+			Dst:       prefixToIPNet(netip.PrefixFrom(ip, ip.BitLen())),
+			Scope:     netlink.SCOPE_LINK,
+		}
+		// RouteReplace is idempotent for existing routes
+		if err := pm.nl.RouteReplace(podRoute); err != nil {
+			log.Printf("Warning: failed to replace pod route: %v", err)
+		}
 	}
 
-	return nil
+	// Routes for Tailscale ranges to the pod's TUN, which may be new
+	return routePodViaTUN(pm.nl, vethName, tunName, table, ipv4, ipv6, routes)
 }
 
 // updatePodIP updates the pod's interface IP when Tailscale assigns a different IP on recovery.
-// This modifies the pod's ts0 interface in-place without restarting the pod.
-func (pm *PodManager) updatePodIP(netnsPath string, oldIP, newIP netip.Addr) error {
+// This modifies the pod's Tailscale interface in-place without restarting the pod.
+func (pm *PodManager) updatePodIP(netnsPath, podIfName string, oldIP, newIP netip.Addr) error {
 	if oldIP == newIP {
 		return nil // No change needed
 	}
@@ -685,40 +2610,46 @@ func (pm *PodManager) updatePodIP(netnsPath string, oldIP, newIP netip.Addr) err
 	defer podNS.Close()
 
 	err = podNS.Do(func(_ ns.NetNS) error {
-		// Find the pod's Tailscale interface (ts0)
-		podLink, err := netlink.LinkByName("ts0")
-		if err != nil {
-			return fmt.Errorf("getting ts0 interface: %w", err)
-		}
+		return replacePodAddr(pm.nl, podIfName, oldIP, newIP)
+	})
 
-		// Remove the old IP
-		oldAddr := &netlink.Addr{
-			IPNet: &net.IPNet{
-				IP:   oldIP.AsSlice(),
-				Mask: net.CIDRMask(32, 32),
-			},
-		}
-		if err := netlink.AddrDel(podLink, oldAddr); err != nil {
-			// Log but continue - might already be gone
-			log.Printf("Note: failed to remove old IP %s from ts0: %v", oldIP, err)
-		}
+	return err
+}
 
-		// Add the new IP
-		newAddr := &netlink.Addr{
-			IPNet: &net.IPNet{
-				IP:   newIP.AsSlice(),
-				Mask: net.CIDRMask(32, 32),
-			},
-		}
-		if err := netlink.AddrAdd(podLink, newAddr); err != nil {
-			return fmt.Errorf("adding new IP %s to ts0: %w", newIP, err)
-		}
+// replacePodAddr swaps oldIP for newIP on the pod's Tailscale interface,
+// podIfName, in the current netns.
+func replacePodAddr(nl netlinkOps, podIfName string, oldIP, newIP netip.Addr) error {
+	// Find the pod's Tailscale interface
+	podLink, err := nl.LinkByName(podIfName)
+	if err != nil {
+		return fmt.Errorf("getting %s interface: %w", podIfName, err)
+	}
 
-		log.Printf("Updated pod interface ts0: %s -> %s", oldIP, newIP)
-		return nil
-	})
+	// Remove the old IP
+	oldAddr := &netlink.Addr{
+		IPNet: &net.IPNet{
+			IP:   oldIP.AsSlice(),
+			Mask: net.CIDRMask(32, 32),
+		},
+	}
+	if err := nl.AddrDel(podLink, oldAddr); err != nil {
+		// Log but continue - might already be gone
+		log.Printf("Note: failed to remove old IP %s from %s: %v", oldIP, podIfName, err)
+	}
 
-	return err
+	// Add the new IP
+	newAddr := &netlink.Addr{
+		IPNet: &net.IPNet{
+			IP:   newIP.AsSlice(),
+			Mask: net.CIDRMask(32, 32),
+		},
+	}
+	if err := nl.AddrAdd(podLink, newAddr); err != nil {
+		return fmt.Errorf("adding new IP %s to %s: %w", newIP, podIfName, err)
+	}
+
+	log.Printf("Updated pod interface %s: %s -> %s", podIfName, oldIP, newIP)
+	return nil
 }
 
 // updateHostRoute updates the host-side route to the pod when its IP changes.
@@ -727,7 +2658,7 @@ func (pm *PodManager) updateHostRoute(vethName string, oldIP, newIP netip.Addr)
 		return nil // No change needed
 	}
 
-	vethLink, err := netlink.LinkByName(vethName)
+	vethLink, err := pm.nl.LinkByName(vethName)
 	if err != nil {
 		return fmt.Errorf("getting veth %s: %w", vethName, err)
 	}
@@ -741,7 +2672,7 @@ func (pm *PodManager) updateHostRoute(vethName string, oldIP, newIP netip.Addr)
 		},
 		Scope: netlink.SCOPE_LINK,
 	}
-	if err := netlink.RouteDel(oldRoute); err != nil {
+	if err := pm.nl.RouteDel(oldRoute); err != nil {
 		log.Printf("Note: failed to delete old route to %s: %v", oldIP, err)
 	}
 
@@ -754,7 +2685,7 @@ func (pm *PodManager) updateHostRoute(vethName string, oldIP, newIP netip.Addr)
 		},
 		Scope: netlink.SCOPE_LINK,
 	}
-	if err := netlink.RouteAdd(newRoute); err != nil {
+	if err := pm.nl.RouteAdd(newRoute); err != nil {
 		return fmt.Errorf("adding route to %s: %w", newIP, err)
 	}
 
@@ -763,13 +2694,13 @@ func (pm *PodManager) updateHostRoute(vethName string, oldIP, newIP netip.Addr)
 }
 
 // reconnectVethBridge verifies and reconnects the veth bridge.
-func (pm *PodManager) reconnectVethBridge(netnsPath, tunName, existingVethName string, tailscaleIP netip.Addr) (string, error) {
+func (pm *PodManager) reconnectVethBridge(netnsPath, podIfName, tunName, existingVethName string, table int, ipv4, ipv6 netip.Addr, routes []netip.Prefix, routingMode string) (string, error) {
 	// Check if existing veth still exists on host side
 	if existingVethName != "" {
-		if _, err := netlink.LinkByName(existingVethName); err == nil {
+		if _, err := linkByName(existingVethName); err == nil {
 			// Veth exists - just ensure routes are correct
 			log.Printf("Reusing existing veth %s", existingVethName)
-			if err := pm.ensureRoutes(tunName, existingVethName, tailscaleIP); err != nil {
+			if err := pm.ensureRoutes(tunName, existingVethName, table, ipv4, ipv6, routes); err != nil {
 				log.Printf("Warning: failed to verify routes: %v", err)
 			}
 			return existingVethName, nil
@@ -778,28 +2709,29 @@ func (pm *PodManager) reconnectVethBridge(netnsPath, tunName, existingVethName s
 
 	// Veth doesn't exist - need to recreate
 	log.Printf("Veth %s not found, recreating veth bridge", existingVethName)
-	return setupVethBridge(netnsPath, "ts0", tunName, tailscaleIP, defaultVethMTU)
+	return pm.setupVethBridge(netnsPath, podIfName, tunName, table, ipv4, ipv6, defaultVethMTU, routes, routingMode)
 }
 
 // cleanupOrphanedPod removes resources for a pod that no longer exists.
-// Must be called with pm.mu held.
+// It only touches kernel and on-disk resources, so pm.mu need not be held.
 func (pm *PodManager) cleanupOrphanedPod(containerID, hostVethName string) {
 	log.Printf("Cleaning up orphaned pod %s", containerID)
 
 	// Delete TUN device
 	tunName := tunNameForContainer(containerID)
-	if link, err := netlink.LinkByName(tunName); err == nil {
-		if err := netlink.LinkDel(link); err != nil {
+	if link, err := pm.nl.LinkByName(tunName); err == nil {
+		if err := pm.nl.LinkDel(link); err != nil {
 			log.Printf("Warning: failed to delete TUN %s: %v", tunName, err)
 		} else {
 			log.Printf("Deleted orphaned TUN %s", tunName)
 		}
 	}
 
-	// Delete host veth
+	// Delete host veth and its rules
 	if hostVethName != "" {
-		if link, err := netlink.LinkByName(hostVethName); err == nil {
-			if err := netlink.LinkDel(link); err != nil {
+		delPodRules(pm.nl, hostVethName, 0)
+		if link, err := pm.nl.LinkByName(hostVethName); err == nil {
+			if err := pm.nl.LinkDel(link); err != nil {
 				log.Printf("Warning: failed to delete veth %s: %v", hostVethName, err)
 			} else {
 				log.Printf("Deleted orphaned veth %s", hostVethName)
@@ -812,13 +2744,46 @@ func (pm *PodManager) cleanupOrphanedPod(containerID, hostVethName string) {
 	if err := os.RemoveAll(podStateDir); err != nil {
 		log.Printf("Warning: failed to remove state dir %s: %v", podStateDir, err)
 	}
+
+	pm.mu.RLock()
+	remaining := len(pm.servers) + len(pm.attaching)
+	pm.mu.RUnlock()
+	pm.restoreGlobalForwarding(remaining)
+}
+
+// cleanupUnmanagedPod removes what's left of a container without a running
+// node: its TUN, host veth and state directory, and, if metadata.json is
+// still there, its state Secret and tailnet device. pm.mu must not be held.
+func (pm *PodManager) cleanupUnmanagedPod(containerID string) {
+	meta, err := pm.loadMetadata(containerID)
+	if err != nil {
+		_, linkErr := netlink.LinkByName(tunNameForContainer(containerID))
+		_, statErr := os.Stat(filepath.Join(pm.stateDir, "pods", containerID))
+		if linkErr != nil && os.IsNotExist(statErr) {
+			log.Printf("Pod %s not found, already cleaned up", containerID)
+			return
+		}
+	}
+
+	vethName := ""
+	if meta != nil {
+		vethName = meta.HostVethName
+		pm.releasePod(meta.Namespace, meta.PodName, meta.DeviceID, meta.stateOwner())
+	}
+	pm.cleanupOrphanedPod(containerID, vethName)
 }
 
-// CleanupOrphanedResources scans for TUN devices not associated with known pods.
+// CleanupOrphanedResources scans for TUN devices not associated with known
+// pods, and removes the previous daemon's warm pool state directories. It
+// must run before RunWarmPool.
 func (pm *PodManager) CleanupOrphanedResources() {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	// Pool nodes don't outlive the daemon, and pods that took one were
+	// recovered into their own state directories
+	os.RemoveAll(filepath.Join(pm.stateDir, "pool"))
+
 	log.Printf("Scanning for orphaned network resources...")
 
 	// Build set of known TUN names
@@ -826,6 +2791,9 @@ func (pm *PodManager) CleanupOrphanedResources() {
 	for containerID := range pm.servers {
 		knownTUNs[tunNameForContainer(containerID)] = true
 	}
+	for containerID := range pm.attaching {
+		knownTUNs[tunNameForContainer(containerID)] = true
+	}
 
 	// Enumerate all network interfaces
 	links, err := netlink.LinkList()
@@ -868,178 +2836,133 @@ func (pm *PodManager) loadMetadata(containerID string) (*PodMetadata, error) {
 // This preserves the node key, ensuring the same Tailscale IP.
 func (pm *PodManager) recoverPodBackend(ctx context.Context, containerID string, meta *PodMetadata, expectedIP netip.Addr) (*ManagedServer, error) {
 	podStateDir := filepath.Join(pm.stateDir, "pods", containerID)
-
-	logf := func(format string, args ...any) {
-		log.Printf("[ts:%s] %s", meta.Hostname, fmt.Sprintf(format, args...))
-	}
-
-	// Create TUN device (deletes any existing one first)
-	tunName := tunNameForContainer(containerID)
-	tunDev, actualTunName, err := pm.getOrCreateTUN(logf, tunName)
-	if err != nil {
-		return nil, fmt.Errorf("getting TUN: %w", err)
+	wgPort := pm.allocWireGuardPort(containerID, meta.WireGuardPort)
+	// Metadata written before tables were allocated has none; a new one
+	// replaces the old rules
+	var routeTable int
+	if !meta.TUNInPod {
+		var err error
+		if routeTable, err = pm.allocRouteTable(containerID, meta.RouteTableID); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create system dependencies (same as AddPod)
-	sys := tsd.NewSystem()
-	dialer := &tsdial.Dialer{Logf: logf}
-	dialer.SetBus(sys.Bus.Get())
-	sys.Set(dialer)
+	logf := nodeLogf(meta.Hostname, pm.nodeLogLevel, pm.quietNodes)
 
-	netMon, err := netmon.New(sys.Bus.Get(), logf)
-	if err != nil {
-		tunDev.Close()
-		return nil, fmt.Errorf("creating network monitor: %w", err)
+	// Metadata written before standalone mode has no interface name
+	podIfName := meta.PodIfName
+	if podIfName == "" {
+		podIfName = defaultPodIfName
 	}
-	sys.Set(netMon)
 
-	// Create wgengine
-	eng, err := wgengine.NewUserspaceEngine(logf, wgengine.Config{
-		Tun:           tunDev,
-		EventBus:      sys.Bus.Get(),
-		NetMon:        netMon,
-		Dialer:        dialer,
-		SetSubsystem:  sys.Set,
-		ControlKnobs:  sys.ControlKnobs(),
-		HealthTracker: sys.HealthTracker.Get(),
-		Metrics:       sys.UserMetricsRegistry(),
-	})
-	if err != nil {
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("creating wgengine: %w", err)
+	// Pods recorded before routing modes existed used kernel routing
+	routingMode := meta.RoutingMode
+	if routingMode == "" {
+		routingMode = RoutingModeKernel
 	}
-	sys.Set(eng)
-	sys.HealthTracker.Get().SetMetricsRegistry(sys.UserMetricsRegistry())
 
-	// Create netstack
-	nsImpl, err := netstack.Create(logf, sys.Tun.Get(), eng, sys.MagicSock.Get(), dialer, sys.DNSManager.Get(), sys.ProxyMapper())
-	if err != nil {
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("creating netstack: %w", err)
+	// A pod with its TUN inside may still have it, if it was preserved.
+	// Otherwise a TUN is created on the host, replacing any left there.
+	var podTUN tun.Device
+	if meta.TUNInPod {
+		dev, err := reopenPodTUN(logf, meta.NetnsPath, podIfName)
+		if err != nil {
+			return nil, fmt.Errorf("reopening pod TUN: %w", err)
+		}
+		podTUN = dev
 	}
-	sys.Tun.Get().Start()
-	sys.Set(nsImpl)
-	nsImpl.ProcessLocalIPs = false
-	nsImpl.ProcessSubnets = false
+	tunReopened := podTUN != nil
 
-	// Load existing FileStore (preserves node key)
-	stateStorePath := filepath.Join(podStateDir, "tailscale.state")
-	stateStore, err := store.NewFileStore(logf, stateStorePath)
+	// Load existing state store (preserves node key)
+	stateStore, err := pm.openStateStore(logf, podStateDir, meta.Namespace, meta.PodName, meta.stateOwner())
 	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
+		if podTUN != nil {
+			podTUN.Close()
+		}
 		return nil, fmt.Errorf("loading state store: %w", err)
 	}
-	sys.Set(stateStore)
 
-	logID, err := logid.NewPrivateID()
-	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("creating log ID: %w", err)
-	}
+	// Log in and wait for the connection, both within tailscaleIPTimeout
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, tailscaleIPTimeout)
+	defer cancel()
 
-	// Do NOT use LoginEphemeral - we want to reuse existing identity
-	loginFlags := controlclient.LocalBackendStartKeyOSNeutral
-	lb, err := ipnlocal.NewLocalBackend(logf, logID.Public(), sys, loginFlags)
+	// With no auth key, the node logs in with the persisted node key, which
+	// keeps its Tailscale IP. Its device is left to RecoverPods to delete,
+	// since a canceled recovery must keep it.
+	log.Printf("Pod %s/%s reconnecting with persisted identity...", meta.Namespace, meta.PodName)
+	splitDNS := podDNSFromMetadata(meta)
+	prefs := meta.prefs()
+	n, err := pm.startNode(ctxWithTimeout, logf, nodeSpec{
+		id:          containerID,
+		varRoot:     podStateDir,
+		store:       stateStore,
+		wgPort:      wgPort,
+		routingMode: routingMode,
+		derpRegion:  meta.DERPRegion,
+		dns:         splitDNS,
+		prefs:       prefs,
+		tun:         podTUN,
+		reuseTUN:    true,
+	})
 	if err != nil {
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("creating LocalBackend: %w", err)
-	}
-	lb.SetVarRoot(podStateDir)
-
-	if err := nsImpl.Start(lb); err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("starting netstack: %w", err)
-	}
-
-	prefs := ipn.NewPrefs()
-	prefs.Hostname = meta.Hostname
-	prefs.WantRunning = true
-	prefs.ControlURL = ipn.DefaultControlURL
-
-	// Start with persisted state - the FileStore contains the node key which
-	// determines our Tailscale IP. We do NOT create a new auth key here.
-	if err := lb.Start(ipn.Options{
-		UpdatePrefs: prefs,
-	}); err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("starting LocalBackend: %w", err)
-	}
-
-	// If NeedsLogin, use StartLoginInteractive which reconnects with the
-	// persisted node key - preserving our Tailscale IP.
-	if st := lb.State(); st == ipn.NeedsLogin {
-		log.Printf("Pod %s/%s reconnecting with persisted identity...",
-			meta.Namespace, meta.PodName)
-		if err := lb.StartLoginInteractive(ctx); err != nil {
-			lb.Shutdown()
-			nsImpl.Close()
-			eng.Close()
-			netMon.Close()
-			tunDev.Close()
-			return nil, fmt.Errorf("reconnecting with persisted identity: %w", err)
+		return nil, fmt.Errorf("reconnecting with persisted identity: %w", err)
+	}
+	// A failure from here on, cancellation included, takes the pod's
+	// interface down with the node: its veth, rules and table go, and a
+	// full-tunnel pod gets its primary default routes back
+	var hostVethName string
+	ok := false
+	defer func() {
+		if ok {
+			return
 		}
-	}
-
-	// Wait for connection
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 60*time.Second)
-	defer cancel()
-
-	var actualIP netip.Addr
-	for {
-		status := lb.Status()
-		if status.BackendState == "Running" && len(status.TailscaleIPs) > 0 {
-			for _, ip := range status.TailscaleIPs {
-				if ip.Is4() {
-					actualIP = ip
-					break
-				}
-			}
-			if actualIP.IsValid() {
-				break
+		if meta.FullTunnel && !tunReopened {
+			if err := restorePrimaryRoutes(meta.NetnsPath, podIfName, meta.PrimaryRoutes); err != nil && !errors.Is(err, errNetnsGone) {
+				log.Printf("Warning: failed to restore default routes of pod %s/%s: %v", meta.Namespace, meta.PodName, err)
 			}
 		}
-
-		select {
-		case <-ctxWithTimeout.Done():
-			lb.Shutdown()
-			nsImpl.Close()
-			eng.Close()
-			netMon.Close()
-			tunDev.Close()
-			return nil, fmt.Errorf("timeout waiting for Tailscale connection")
-		case <-time.After(500 * time.Millisecond):
+		switch {
+		case hostVethName != "":
+			removeVethBridge(pm.nl, meta.NetnsPath, podIfName, hostVethName, routeTable)
+		case !meta.TUNInPod:
+			// The veth couldn't be recreated; the old one's rules may remain
+			if meta.HostVethName != "" {
+				delPodRules(pm.nl, meta.HostVethName, 0)
+			}
+			if isPodTable(routeTable) {
+				flushPodTable(pm.nl, routeTable)
+			}
 		}
-	}
+		n.close()
+	}()
+	lb := n.lb
+	actualIP, tailscaleIPv6, actualTunName := n.ipv4, n.ipv6, n.tunName
 
 	// Handle IP change if needed
 	if actualIP != expectedIP {
-		log.Printf("Tailscale IP changed for pod %s/%s: %s -> %s",
-			meta.Namespace, meta.PodName, expectedIP, actualIP)
-
-		// Update the pod's interface IP in-place
-		if err := pm.updatePodIP(meta.NetnsPath, expectedIP, actualIP); err != nil {
-			log.Printf("Warning: failed to update pod IP: %v", err)
-			// Continue anyway - might need manual intervention
+		// The node key should have kept the IP; connections and firewall
+		// rules keyed on the old one are now broken
+		log.Printf("Warning: Tailscale IP changed on recovery: container=%s pod=%s/%s old=%s new=%s",
+			containerID, meta.Namespace, meta.PodName, expectedIP, actualIP)
+		metricPodIPChanges.Add(1)
+		pm.events.IPChanged(podRef{Name: meta.PodName, Namespace: meta.Namespace, UID: meta.PodUID}, expectedIP.String(), actualIP.String())
+		pm.publish(podEvent{
+			Type:         podIPChanged,
+			Time:         time.Now(),
+			ContainerID:  containerID,
+			Namespace:    meta.Namespace,
+			PodName:      meta.PodName,
+			IPv4:         actualIP,
+			PreviousIPv4: expectedIP,
+		})
+
+		// Update the pod's interface IP in-place. A new TUN for the pod gets
+		// the new IP when it's moved in below.
+		if !meta.TUNInPod || tunReopened {
+			if err := pm.updatePodIP(meta.NetnsPath, podIfName, expectedIP, actualIP); err != nil {
+				log.Printf("Warning: failed to update pod IP: %v", err)
+				// Continue anyway - might need manual intervention
+			}
 		}
 
 		// Update host-side route if veth exists
@@ -1053,68 +2976,138 @@ func (pm *PodManager) recoverPodBackend(ctx context.Context, containerID string,
 		meta.TailscaleIPv4 = actualIP.String()
 	}
 
-	// Reconnect veth bridge if needed (handles any remaining route setup)
-	hostVethName, err := pm.reconnectVethBridge(meta.NetnsPath, actualTunName, meta.HostVethName, actualIP)
+	// Metadata written before routes were configurable has none: use the default
+	routes, err := ParseTailscaleRoutes(meta.Routes)
 	if err != nil {
-		lb.Shutdown()
-		nsImpl.Close()
-		eng.Close()
-		netMon.Close()
-		tunDev.Close()
-		return nil, fmt.Errorf("reconnecting veth bridge: %w", err)
+		return nil, fmt.Errorf("parsing stored routes: %w", err)
 	}
 
-	var tailscaleIPv6 netip.Addr
-	status := lb.Status()
-	for _, ip := range status.TailscaleIPs {
-		if ip.Is6() {
-			tailscaleIPv6 = ip
-			break
+	// Reconnect veth bridge if needed (handles any remaining route setup),
+	// or move a new TUN into the pod
+	switch {
+	case tunReopened:
+	case meta.TUNInPod:
+		err = moveTUNToPod(meta.NetnsPath, actualTunName, podIfName, actualIP, tailscaleIPv6, routes)
+	default:
+		hostVethName, err = pm.reconnectVethBridge(meta.NetnsPath, podIfName, actualTunName, meta.HostVethName, routeTable, actualIP, tailscaleIPv6, routes, routingMode)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reconnecting pod interface: %w", err)
+	}
+
+	// A reopened TUN kept the pod's default routes. Otherwise they went with
+	// the old interface, and a veth's rules need pointing at the new TUN;
+	// the primary routes saved at attach stay the ones to restore.
+	primaryRoutes := meta.PrimaryRoutes
+	if meta.FullTunnel && !tunReopened {
+		saved, err := setupFullTunnel(meta.NetnsPath, podIfName, hostVethName, actualTunName, routeTable, actualIP, tailscaleIPv6, routingMode)
+		if err != nil {
+			return nil, err
+		}
+		if len(saved) > 0 {
+			primaryRoutes = saved
 		}
 	}
 
+	status := lb.Status()
+	// Metadata written before device deletion was supported has no device ID
+	deviceID := meta.DeviceID
+	if status.Self != nil {
+		deviceID = string(status.Self.ID)
+	}
+	dnsName := magicDNSName(status)
+	renamed := renamedHostname(meta.Hostname, dnsName)
+	if dnsName == "" {
+		dnsName = meta.DNSName
+		renamed = meta.Renamed
+	}
+
 	managed := &ManagedServer{
 		Backend:       lb,
-		Engine:        eng,
-		Sys:           sys,
-		NetMon:        netMon,
+		Engine:        n.eng,
+		Sys:           n.sys,
+		NetMon:        n.netMon,
 		ContainerID:   containerID,
 		PodName:       meta.PodName,
 		Namespace:     meta.Namespace,
+		PodUID:        meta.PodUID,
 		Hostname:      meta.Hostname,
+		DNSName:       dnsName,
+		Renamed:       renamed,
 		ClusterIP:     meta.ClusterIP,
 		HostVethName:  hostVethName,
+		PodIfName:     podIfName,
+		NetnsPath:     meta.NetnsPath,
 		TailscaleIPv4: actualIP,
 		TailscaleIPv6: tailscaleIPv6,
+		Routes:        routes,
+		Advertised:    prefs.AdvertiseRoutes,
+		DeviceID:      deviceID,
+		DERPRegion:    meta.DERPRegion,
+		Tags:          meta.Tags,
+		RoutingMode:   routingMode,
+		WireGuardPort: wgPort,
+		TUNInPod:      meta.TUNInPod,
+		RouteTableID:  routeTable,
+		ExitNode:      prefs.ExitNodeIP,
+		FullTunnel:    meta.FullTunnel,
+		PrimaryRoutes: primaryRoutes,
+		DNS:           splitDNS,
+		KeepIdentity:  meta.KeepIdentity,
 		CreatedAt:     meta.CreatedAt,
+
+		stopLinkChanges: n.stopLinkChanges,
+		tunDev:          n.tunDev,
 	}
 
+	ok = true
 	return managed, nil
 }
 
 // recoverPod attempts to recover a single pod from persisted state.
-// Must be called with pm.mu held.
-func (pm *PodManager) recoverPod(ctx context.Context, containerID string) error {
+// Safe to call concurrently for different containers; pm.mu is only taken
+// to register the recovered server.
+func (pm *PodManager) recoverPod(ctx context.Context, containerID string, rec *PodRecovery) error {
 	// Load metadata
 	meta, err := pm.loadMetadata(containerID)
 	if err != nil {
 		return fmt.Errorf("loading metadata: %w", err)
 	}
+	rec.Namespace = meta.Namespace
+	rec.PodName = meta.PodName
+	rec.PreviousIPv4 = meta.TailscaleIPv4
 
 	// Check if netns still exists
 	if !netnsExists(meta.NetnsPath) {
 		log.Printf("Pod %s/%s netns %s no longer exists, cleaning up",
 			meta.Namespace, meta.PodName, meta.NetnsPath)
 		pm.cleanupOrphanedPod(containerID, meta.HostVethName)
+		pm.releasePod(meta.Namespace, meta.PodName, meta.DeviceID, meta.stateOwner())
+		rec.CleanedUp = true
+		rec.Error = "netns no longer exists"
 		return nil
 	}
 
-	// Check if state file exists (needed for IP stability)
-	stateStorePath := filepath.Join(pm.stateDir, "pods", containerID, "tailscale.state")
-	if _, err := os.Stat(stateStorePath); os.IsNotExist(err) {
-		log.Printf("Pod %s/%s has no state file, cannot recover with same IP, cleaning up",
+	// Check if persisted state exists (needed for IP stability)
+	hasState, err := pm.hasPersistedState(containerID, meta)
+	if err != nil {
+		return fmt.Errorf("checking persisted state: %w", err)
+	}
+	if !hasState {
+		hasState, err = pm.restoreState(containerID, meta)
+		if err != nil {
+			return fmt.Errorf("restoring state backup: %w", err)
+		}
+		if hasState {
+			log.Printf("Restored state for pod %s/%s from its backup secret", meta.Namespace, meta.PodName)
+		}
+	}
+	if !hasState {
+		log.Printf("Pod %s/%s has no persisted state, cannot recover with same IP, cleaning up",
 			meta.Namespace, meta.PodName)
 		pm.cleanupOrphanedPod(containerID, meta.HostVethName)
+		rec.CleanedUp = true
+		rec.Error = "no persisted Tailscale state"
 		return nil
 	}
 
@@ -1127,13 +3120,20 @@ func (pm *PodManager) recoverPod(ctx context.Context, containerID string) error
 		return fmt.Errorf("parsing stored Tailscale IP: %w", err)
 	}
 
-	// Recover with same state (node key persisted in FileStore)
+	// Recover with same state (node key persisted in the state store)
 	managed, err := pm.recoverPodBackend(ctx, containerID, meta, tailscaleIPv4)
 	if err != nil {
+		pm.mu.Lock()
+		pm.releaseWireGuardPort(containerID)
+		pm.releaseRouteTable(containerID)
+		pm.mu.Unlock()
 		return fmt.Errorf("recovering backend: %w", err)
 	}
 
+	pm.mu.Lock()
 	pm.servers[containerID] = managed
+	metricManagedPods.Set(int64(len(pm.servers)))
+	pm.mu.Unlock()
 
 	// Update persisted metadata if IP changed
 	if managed.TailscaleIPv4 != tailscaleIPv4 {
@@ -1145,55 +3145,190 @@ func (pm *PodManager) recoverPod(ctx context.Context, containerID string) error
 
 	log.Printf("Recovered pod %s/%s with IP %s",
 		meta.Namespace, meta.PodName, managed.TailscaleIPv4)
+	rec.Recovered = true
+	rec.IPv4 = managed.TailscaleIPv4.String()
 
 	return nil
 }
 
-// RecoverPods scans stored metadata and recovers pods that still exist.
-// Returns number of recovered pods and list of errors encountered.
-func (pm *PodManager) RecoverPods(ctx context.Context) (int, []error) {
-	pm.mu.Lock()
-	defer pm.mu.Unlock()
+// processTombstones cleans up containers the CNI plugin deleted while the
+// daemon was unreachable. Each tombstone is a file named after the container ID.
+func (pm *PodManager) processTombstones() {
+	if pm.tombstoneDir == "" {
+		return
+	}
+	entries, err := os.ReadDir(pm.tombstoneDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: failed to read tombstone dir: %v", err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		containerID := entry.Name()
+		log.Printf("Found tombstone for container %s, finishing cleanup", containerID)
+
+		pm.cleanupUnmanagedPod(containerID)
+
+		if err := os.Remove(filepath.Join(pm.tombstoneDir, containerID)); err != nil {
+			log.Printf("Warning: failed to remove tombstone for %s: %v", containerID, err)
+		}
+	}
+}
 
-	var recovered int
-	var errors []error
+// RecoverPods scans stored metadata and recovers pods that still exist.
+// Up to recoveryConcurrency pods are recovered in parallel, since each one
+// may wait up to a minute for its Tailscale connection.
+// Returns the number of pods recovered, the number cleaned up because they
+// no longer exist, and the errors of the pods that failed, which are cleaned
+// up too.
+//
+// If ctx is done before recovery finishes, pods not yet started are
+// skipped, and a pod whose recovery is cut short has its node torn down;
+// either way its state is kept on disk for the next start to recover.
+func (pm *PodManager) RecoverPods(ctx context.Context) (int, int, []error) {
+	report := &RecoveryReport{Started: time.Now()}
+	defer func() {
+		report.Finished = time.Now()
+		slices.SortFunc(report.Pods, func(a, b PodRecovery) int { return strings.Compare(a.ContainerID, b.ContainerID) })
+		report.updateMetrics()
+		pm.recoveryReport.Store(report)
+		pm.recovered.Store(true)
+	}()
+
+	// Finish cleanup for pods deleted while we were down, so they aren't recovered
+	pm.processTombstones()
 
 	podsDir := filepath.Join(pm.stateDir, "pods")
 	entries, err := os.ReadDir(podsDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Printf("No pods directory, nothing to recover")
-			return 0, nil
+			return 0, 0, nil
 		}
-		return 0, []error{fmt.Errorf("reading pods directory: %w", err)}
+		return 0, 0, []error{fmt.Errorf("reading pods directory: %w", err)}
 	}
 
+	var (
+		mu        sync.Mutex // guards recovered, cleanedUp, errors and report.Pods
+		recovered int
+		cleanedUp int
+		errors    []error
+		wg        sync.WaitGroup
+	)
+	sem := make(chan struct{}, pm.recoveryConcurrency)
+
 	for _, entry := range entries {
 		if !entry.IsDir() {
 			continue
 		}
 		containerID := entry.Name()
 
-		if err := pm.recoverPod(ctx, containerID); err != nil {
-			log.Printf("Failed to recover pod %s: %v", containerID, err)
-			errors = append(errors, fmt.Errorf("pod %s: %w", containerID, err))
-			// Clean up this pod's resources on failure
-			meta, _ := pm.loadMetadata(containerID)
-			vethName := ""
-			if meta != nil {
-				vethName = meta.HostVethName
-			}
-			pm.cleanupOrphanedPod(containerID, vethName)
-		} else {
-			recovered++
+		// canceled leaves the pod for the next start
+		canceled := func(rec *PodRecovery) {
+			rec.Error = errRecoveryCanceled.Error()
+			mu.Lock()
+			errors = append(errors, fmt.Errorf("pod %s: %w", containerID, errRecoveryCanceled))
+			mu.Unlock()
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			rec := PodRecovery{ContainerID: containerID}
+			canceled(&rec)
+			mu.Lock()
+			report.Pods = append(report.Pods, rec)
+			mu.Unlock()
+			continue
 		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			rec := PodRecovery{ContainerID: containerID}
+			defer func() {
+				mu.Lock()
+				report.Pods = append(report.Pods, rec)
+				mu.Unlock()
+			}()
+
+			if ctx.Err() != nil {
+				canceled(&rec)
+				return
+			}
+			if err := pm.recoverPod(ctx, containerID, &rec); err != nil {
+				// The node was torn down, but its state must survive
+				// for the next start to use
+				if ctx.Err() != nil {
+					log.Printf("Recovery of pod %s canceled, keeping its state: %v", containerID, err)
+					canceled(&rec)
+					return
+				}
+				log.Printf("Failed to recover pod %s: %v", containerID, err)
+				rec.Failed = true
+				rec.Error = err.Error()
+				rec.CleanedUp = true
+				// Clean up this pod's resources on failure
+				meta, _ := pm.loadMetadata(containerID)
+				vethName := ""
+				if meta != nil {
+					vethName = meta.HostVethName
+				}
+				pm.cleanupOrphanedPod(containerID, vethName)
+				if meta != nil {
+					pm.releasePod(meta.Namespace, meta.PodName, meta.DeviceID, meta.stateOwner())
+				}
+
+				mu.Lock()
+				errors = append(errors, fmt.Errorf("pod %s: %w", containerID, err))
+				mu.Unlock()
+				return
+			}
+
+			mu.Lock()
+			if rec.CleanedUp {
+				cleanedUp++
+			} else {
+				recovered++
+			}
+			mu.Unlock()
+		}()
 	}
+	wg.Wait()
+
+	return recovered, cleanedUp, errors
+}
+
+// GetRecoveryReport returns what RecoverPods did with each pod it found, or
+// nil if it hasn't finished.
+func (pm *PodManager) GetRecoveryReport() *RecoveryReport {
+	return pm.recoveryReport.Load()
+}
 
-	return recovered, errors
+// Ready returns an error unless the daemon can bring up pods: RecoverPods
+// has run and the OAuth client can get a Tailscale API token.
+func (pm *PodManager) Ready(ctx context.Context) error {
+	if !pm.recovered.Load() {
+		return errors.New("still recovering pods from the previous session")
+	}
+	if pm.oauthMgr != nil {
+		if _, err := pm.oauthMgr.getAccessToken(ctx); err != nil {
+			return fmt.Errorf("getting a Tailscale API token: %w", err)
+		}
+	}
+	return nil
 }
 
-// Close shuts down all managed servers.
+// Close shuts down all managed servers and the warm pool's nodes.
 func (pm *PodManager) Close() error {
+	pm.closeWarmPool()
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
@@ -1201,13 +3336,79 @@ func (pm *PodManager) Close() error {
 		log.Printf("Closing Tailscale node for %s", containerID)
 		managed.Backend.Shutdown()
 		managed.Engine.Close()
-		if managed.NetMon != nil {
-			managed.NetMon.Close()
-		}
+		managed.stopLinkChanges()
 	}
 	pm.servers = make(map[string]*ManagedServer)
+	metricManagedPods.Set(0)
+
+	pm.netMonMu.Lock()
+	defer pm.netMonMu.Unlock()
+	if pm.netMon != nil {
+		pm.netMon.Close()
+		pm.netMonBus.Close()
+		pm.netMon, pm.netMonBus = nil, nil
+	}
 	return nil
 }
 
+// Preserve prepares for a daemon restart without tearing pods down, in place
+// of Close. Each pod's TUN is made persistent so that it and the routes
+// through it outlive the daemon; the next daemon's RecoverPods reopens them.
+// Nodes are left running until the process exits, so their sessions aren't
+// closed. Packets sent while no daemon is running are dropped. The warm
+// pool's nodes aren't preserved; they are shut down and deleted.
+func (pm *PodManager) Preserve() {
+	pm.closeWarmPool()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	for containerID, managed := range pm.servers {
+		if err := setTUNPersist(managed.tunDev, true); err != nil {
+			log.Printf("Warning: TUN for %s will be recreated on restart: %v", containerID, err)
+			continue
+		}
+		log.Printf("Preserved TUN for %s/%s", managed.Namespace, managed.PodName)
+	}
+	pm.servers = make(map[string]*ManagedServer)
+	metricManagedPods.Set(0)
+}
+
+// sharedNetMon returns the network monitor shared by every pod, creating and
+// starting it on first use. It watches host-global state (interfaces, routes),
+// so one per daemon is enough; Close closes it.
+func (pm *PodManager) sharedNetMon() (*netmon.Monitor, error) {
+	pm.netMonMu.Lock()
+	defer pm.netMonMu.Unlock()
+	if pm.netMon != nil {
+		return pm.netMon, nil
+	}
+	bus := eventbus.New()
+	netMon, err := netmon.New(bus, logger.WithPrefix(log.Printf, "netmon: "))
+	if err != nil {
+		bus.Close()
+		return nil, err
+	}
+	netMon.Start()
+	pm.netMonBus, pm.netMon = bus, netMon
+	return netMon, nil
+}
+
+// forwardLinkChanges republishes the shared monitor's changes on a pod's event
+// bus, where its engine, LocalBackend and dialer subscribe to them. Each pod
+// keeps its own bus so one pod's magicsock and health events don't reach
+// another. The returned func stops forwarding.
+func forwardLinkChanges(netMon *netmon.Monitor, bus *eventbus.Bus) (stop func()) {
+	ec := bus.Client("tscni.netmon")
+	pub := eventbus.Publish[netmon.ChangeDelta](ec)
+	unregister := netMon.RegisterChangeCallback(func(delta *netmon.ChangeDelta) {
+		pub.Publish(*delta)
+	})
+	return func() {
+		unregister()
+		ec.Close()
+	}
+}
+
 // Ensure tun.Device is imported
 var _ tun.Device
@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// PprofHandler serves the Go runtime profiles under /debug/pprof/. Every
+// pod's engine and netstack run goroutines in the daemon, so the goroutine
+// profile shows what a pod left behind after DeletePod.
+func PprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// PprofListenAddr checks a pprof listen address. Profiles expose the
+// daemon's memory and command line, and the daemon uses host networking,
+// so the address must be on loopback; one without a host (":6060") is
+// bound to 127.0.0.1.
+func PprofListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid pprof address %q: %w", addr, err)
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if host == "localhost" {
+		return addr, nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return "", fmt.Errorf("invalid pprof address %q: host must be loopback", addr)
+	}
+	return addr, nil
+}
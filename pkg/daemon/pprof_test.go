@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPprofListenAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		want    string
+		wantErr bool
+	}{
+		{addr: ":6060", want: "127.0.0.1:6060"},
+		{addr: "127.0.0.1:6060", want: "127.0.0.1:6060"},
+		{addr: "localhost:6060", want: "localhost:6060"},
+		{addr: "[::1]:6060", want: "[::1]:6060"},
+		{addr: "0.0.0.0:6060", wantErr: true},
+		{addr: "10.0.0.1:6060", wantErr: true},
+		{addr: "6060", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, err := PprofListenAddr(tt.addr)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("PprofListenAddr(%q) error = %v, wantErr %v", tt.addr, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("PprofListenAddr(%q) = %q, want %q", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPprofHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	PprofHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != 200 {
+		t.Errorf("GET /debug/pprof/goroutine = %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultPruneMinOffline is how long a device must have been offline for
+// PruneStaleDevices to count it as stale, unless told otherwise. It leaves
+// time for a daemon that is restarting to recover its pods.
+const defaultPruneMinOffline = time.Hour
+
+// PruneStaleDevices returns the tailnet devices the cluster's pods left
+// behind, as when a daemon died before it could delete a pod's device:
+// tagged devices named after the cluster that no pod or warm pool node here
+// holds, and that have been offline for at least minOffline. Pods on other
+// nodes hold their own devices, which stay connected to control, so they
+// are never stale. Unless dryRun, the devices are also queued for
+// deletion.
+//
+// Devices are matched by hostname, so those of pods named by annotation
+// rather than after the cluster are never found.
+func (pm *PodManager) PruneStaleDevices(ctx context.Context, minOffline time.Duration, dryRun bool) ([]Device, error) {
+	if pm.oauthMgr == nil {
+		return nil, fmt.Errorf("no Tailscale API client")
+	}
+	devices, err := pm.oauthMgr.ListDevices(ctx, sanitizeHostname(pm.clusterName)+"-")
+	if err != nil {
+		return nil, err
+	}
+	stale := staleDevices(devices, pm.heldDevices(), minOffline, time.Now())
+	for _, d := range stale {
+		if dryRun {
+			log.Printf("Stale device %s (%s), offline since %s", d.ID, d.Hostname, d.LastSeen.Format(time.RFC3339))
+			continue
+		}
+		log.Printf("Deleting stale device %s (%s), offline since %s", d.ID, d.Hostname, d.LastSeen.Format(time.RFC3339))
+		pm.oauthMgr.QueueDeviceDeletion(d.ID)
+	}
+	return stale, nil
+}
+
+// heldDevices returns the IDs of the devices of running pods, warm pool
+// nodes and pods whose state is on disk but that aren't running, which a
+// restart may yet recover.
+func (pm *PodManager) heldDevices() map[string]bool {
+	held := make(map[string]bool)
+	if entries, err := os.ReadDir(filepath.Join(pm.stateDir, "pods")); err == nil {
+		for _, entry := range entries {
+			if meta, err := pm.loadMetadata(entry.Name()); err == nil && meta.DeviceID != "" {
+				held[meta.DeviceID] = true
+			}
+		}
+	}
+
+	pm.mu.RLock()
+	for _, srv := range pm.servers {
+		held[srv.DeviceID] = true
+	}
+	pm.mu.RUnlock()
+
+	pm.pool.mu.Lock()
+	for _, n := range pm.pool.ready {
+		held[n.deviceID] = true
+	}
+	pm.pool.mu.Unlock()
+	return held
+}
+
+// staleDevices returns the devices that aren't held, aren't connected to
+// control and were last seen at least minOffline before now.
+func staleDevices(devices []Device, held map[string]bool, minOffline time.Duration, now time.Time) []Device {
+	var stale []Device
+	for _, d := range devices {
+		if held[d.ID] || d.ConnectedToControl || now.Sub(d.LastSeen) < minOffline {
+			continue
+		}
+		stale = append(stale, d)
+	}
+	return stale
+}
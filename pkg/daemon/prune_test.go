@@ -0,0 +1,27 @@
+//go:build linux
+
+package daemon
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStaleDevices(t *testing.T) {
+	now := time.Date(2025, 1, 2, 12, 0, 0, 0, time.UTC)
+	devices := []Device{
+		{ID: "held", LastSeen: now.Add(-24 * time.Hour)},
+		{ID: "connected", ConnectedToControl: true, LastSeen: now.Add(-24 * time.Hour)},
+		{ID: "recent", LastSeen: now.Add(-10 * time.Minute)},
+		{ID: "stale", LastSeen: now.Add(-2 * time.Hour)},
+		{ID: "never seen"},
+	}
+	var got []string
+	for _, d := range staleDevices(devices, map[string]bool{"held": true}, time.Hour, now) {
+		got = append(got, d.ID)
+	}
+	if want := []string{"stale", "never seen"}; !slices.Equal(got, want) {
+		t.Errorf("staleDevices() = %v, want %v", got, want)
+	}
+}
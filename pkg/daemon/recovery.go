@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+)
+
+// PodRecovery is what happened to one pod when the daemon started.
+type PodRecovery struct {
+	ContainerID string `json:"containerId"`
+	Namespace   string `json:"namespace,omitempty"`
+	PodName     string `json:"podName,omitempty"`
+
+	// Recovered is set if the pod's node is running again.
+	Recovered bool `json:"recovered"`
+	// Failed is set if recovering the pod was attempted and failed.
+	Failed bool `json:"failed"`
+	// CleanedUp is set if the pod's resources were removed as orphaned
+	// instead, because its netns or Tailscale state was gone or recovery
+	// failed.
+	CleanedUp bool `json:"cleanedUp"`
+	// Error says why the pod wasn't recovered or was cleaned up, "" if it
+	// was recovered.
+	Error string `json:"error,omitempty"`
+
+	// PreviousIPv4 is the Tailscale IP the pod had before the restart, and
+	// IPv4 the one it has now, if it was recovered.
+	PreviousIPv4 string `json:"previousIpv4,omitempty"`
+	IPv4         string `json:"ipv4,omitempty"`
+}
+
+// errRecoveryCanceled is the error of pods RecoverPods left for the next
+// start because its context was done.
+var errRecoveryCanceled = errors.New("recovery canceled, state kept for the next start")
+
+// RecoveryReport describes a RecoverPods run.
+type RecoveryReport struct {
+	Started  time.Time     `json:"started"`
+	Finished time.Time     `json:"finished"`
+	Pods     []PodRecovery `json:"pods"` // sorted by container ID
+}
+
+// Recovery outcome metrics, set when RecoverPods finishes.
+var (
+	metricRecoveryRecovered = newGauge("tscni_recovery_pods_recovered")
+	metricRecoveryFailed    = newGauge("tscni_recovery_pods_failed")
+	metricRecoveryCleanedUp = newGauge("tscni_recovery_pods_cleaned_up")
+)
+
+// updateMetrics sets the recovery metrics from r. Pods that failed are
+// cleaned up, so they count as both.
+func (r *RecoveryReport) updateMetrics() {
+	var recovered, failed, cleanedUp int64
+	for _, p := range r.Pods {
+		if p.Recovered {
+			recovered++
+		}
+		if p.Failed {
+			failed++
+		}
+		if p.CleanedUp {
+			cleanedUp++
+		}
+	}
+	metricRecoveryRecovered.Set(recovered)
+	metricRecoveryFailed.Set(failed)
+	metricRecoveryCleanedUp.Set(cleanedUp)
+}
+
+// proto converts r to its gRPC form.
+func (r *RecoveryReport) proto() *pb.GetRecoveryReportResponse {
+	resp := &pb.GetRecoveryReportResponse{
+		StartedAt:  r.Started.Format(time.RFC3339),
+		FinishedAt: r.Finished.Format(time.RFC3339),
+	}
+	for _, p := range r.Pods {
+		resp.Pods = append(resp.Pods, &pb.PodRecovery{
+			ContainerId:  p.ContainerID,
+			PodNamespace: p.Namespace,
+			PodName:      p.PodName,
+			Recovered:    p.Recovered,
+			Failed:       p.Failed,
+			CleanedUp:    p.CleanedUp,
+			Error:        p.Error,
+			PreviousIpv4: p.PreviousIPv4,
+			Ipv4:         p.IPv4,
+		})
+	}
+	return resp
+}
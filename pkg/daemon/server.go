@@ -3,35 +3,173 @@
 package daemon
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/user"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
 
 	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
+// defaultSocketMode lets root and the socket's group use the socket.
+const defaultSocketMode os.FileMode = 0660
+
+// minKeepalivePing is the shortest keepalive interval gRPC clients may use,
+// and how often the server lets them ping.
+const minKeepalivePing = 10 * time.Second
+
+// adminShutdownTimeout bounds how long Stop waits for admin API requests
+// in progress to finish.
+const adminShutdownTimeout = 10 * time.Second
+
+// ServerConfig configures a Server.
+type ServerConfig struct {
+	// SocketPath is where the Unix socket is created.
+	SocketPath string
+	// SocketMode is the socket's permission bits. Defaults to 0660.
+	SocketMode os.FileMode
+	// SocketGID, if positive, is the group the socket is chowned to.
+	// Otherwise the socket keeps the daemon's group.
+	SocketGID int
+	// AllowedUIDs, if non-empty, restricts callers to processes running as
+	// one of these UIDs, checked with SO_PEERCRED.
+	AllowedUIDs []uint32
+	// TCPAddr, if set, is an address to also serve the gRPC API on, for
+	// remote management. It requires TLSConfig.
+	TCPAddr string
+	// TLSConfig secures the TCP listener; see LoadServerTLS.
+	TLSConfig *tls.Config
+	// Events, if set, records Kubernetes Events on pods as they attach.
+	Events *EventRecorder
+	// Annotator, if set, writes each pod's Tailscale IPs onto the Pod.
+	Annotator *PodAnnotator
+	// MaxMessageSize, if positive, is the largest message the server
+	// receives or sends, in bytes, instead of gRPC's 4MB.
+	MaxMessageSize int
+	// Keepalive, if positive, is how long a client connection can be idle
+	// before the server pings it, to find connections that died without
+	// closing. It must be at least minKeepalivePing. Clients may ping the
+	// server every minKeepalivePing, whether or not they have a call open.
+	Keepalive time.Duration
+	// AdminAddr, if set, is where to serve the HTTP admin API: a Unix
+	// socket if it's an absolute path, which AllowedUIDs and SocketMode
+	// apply to, or a TCP address, which requires AdminToken.
+	AdminAddr string
+	// AdminToken, if set, is the bearer token admin API requests must
+	// carry.
+	AdminToken string
+}
+
 // Server implements the TailscaleCNI gRPC service.
 type Server struct {
 	pb.UnimplementedTailscaleCNIServer
 	podMgr     *PodManager
 	grpcServer *grpc.Server
 	socketPath string
+	socketMode os.FileMode
+	socketGID  int
+	allowUIDs  []uint32
+	tcpAddr    string
+	tlsConfig  *tls.Config
+	tcpLis     net.Listener
+	events     *EventRecorder
+	annotator  *PodAnnotator
+	maxMsgSize int
+	keepalive  time.Duration
+
+	// watchCtx is canceled by Stop, ending Watch streams, which would
+	// otherwise keep GracefulStop waiting
+	watchCtx    context.Context
+	stopWatches context.CancelFunc
+
+	adminAddr   string
+	adminToken  string
+	adminServer *http.Server
 }
 
 // NewServer creates a new gRPC server.
-func NewServer(socketPath string, podMgr *PodManager) *Server {
+func NewServer(cfg ServerConfig, podMgr *PodManager) *Server {
+	if cfg.SocketMode == 0 {
+		cfg.SocketMode = defaultSocketMode
+	}
+	watchCtx, stopWatches := context.WithCancel(context.Background())
 	return &Server{
-		socketPath: socketPath,
+		socketPath: cfg.SocketPath,
+		socketMode: cfg.SocketMode,
+		socketGID:  cfg.SocketGID,
+		allowUIDs:  cfg.AllowedUIDs,
+		tcpAddr:    cfg.TCPAddr,
+		tlsConfig:  cfg.TLSConfig,
+		events:     cfg.Events,
+		annotator:  cfg.Annotator,
+		maxMsgSize: cfg.MaxMessageSize,
+		keepalive:  cfg.Keepalive,
+		adminAddr:  cfg.AdminAddr,
+		adminToken: cfg.AdminToken,
 		podMgr:     podMgr,
+
+		watchCtx:    watchCtx,
+		stopWatches: stopWatches,
+	}
+}
+
+// ParseSocketMode parses an octal permission string such as "0660".
+func ParseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q: want octal permission bits like 0660", s)
 	}
+	if mode&0600 != 0600 {
+		return 0, fmt.Errorf("invalid socket mode %q: owner needs read and write", s)
+	}
+	return os.FileMode(mode), nil
 }
 
-// Start begins listening on the Unix socket.
+// LookupSocketGroup resolves a group name or numeric GID. An empty group
+// returns 0, meaning the socket's group is left alone.
+func LookupSocketGroup(group string) (int, error) {
+	if group == "" {
+		return 0, nil
+	}
+	if gid, err := strconv.Atoi(group); err == nil && gid >= 0 {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, fmt.Errorf("looking up socket group %q: %w", group, err)
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// Start begins listening on the Unix socket, and on the TCP address if one
+// is configured.
 func (s *Server) Start() error {
+	if s.tcpAddr != "" && s.tlsConfig == nil {
+		return errors.New("TCP listener requires a TLS config")
+	}
+	if s.adminAddr != "" && !filepath.IsAbs(s.adminAddr) && s.adminToken == "" {
+		return errors.New("admin API on a TCP address requires a token")
+	}
+	if s.keepalive > 0 && s.keepalive < minKeepalivePing {
+		return fmt.Errorf("keepalive %s is shorter than %s", s.keepalive, minKeepalivePing)
+	}
+
 	// Ensure socket directory exists
 	socketDir := filepath.Dir(s.socketPath)
 	if err := os.MkdirAll(socketDir, 0755); err != nil {
@@ -49,14 +187,53 @@ func (s *Server) Start() error {
 		return fmt.Errorf("listening on %s: %w", s.socketPath, err)
 	}
 
-	// Set socket permissions to allow CNI binary access
-	if err := os.Chmod(s.socketPath, 0660); err != nil {
+	// Set socket ownership and permissions to allow CNI binary access
+	if s.socketGID > 0 {
+		if err := os.Chown(s.socketPath, -1, s.socketGID); err != nil {
+			listener.Close()
+			return fmt.Errorf("setting socket group: %w", err)
+		}
+	}
+	if err := os.Chmod(s.socketPath, s.socketMode); err != nil {
 		listener.Close()
 		return fmt.Errorf("setting socket permissions: %w", err)
 	}
 
-	// Create gRPC server
-	s.grpcServer = grpc.NewServer()
+	if s.tcpAddr != "" {
+		s.tcpLis, err = net.Listen("tcp", s.tcpAddr)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("listening on %s: %w", s.tcpAddr, err)
+		}
+	}
+
+	// Create gRPC server. Both listeners share it, so with a TCP listener
+	// the credentials are chosen per connection.
+	var opts []grpc.ServerOption
+	switch {
+	case s.tcpLis != nil:
+		opts = append(opts, grpc.Creds(newListenerTransport(s.tlsConfig, len(s.allowUIDs) > 0)))
+	case len(s.allowUIDs) > 0:
+		opts = append(opts, grpc.Creds(peerCredTransport{}))
+	}
+	if len(s.allowUIDs) > 0 {
+		opts = append(opts,
+			grpc.UnaryInterceptor(uidAllowlistInterceptor(s.allowUIDs)),
+			grpc.StreamInterceptor(uidAllowlistStreamInterceptor(s.allowUIDs)))
+	}
+	if s.maxMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(s.maxMsgSize), grpc.MaxSendMsgSize(s.maxMsgSize))
+	}
+	if s.keepalive > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{Time: s.keepalive}))
+	}
+	// The default policy closes connections whose clients ping more than
+	// every 5 minutes, or at all between calls
+	opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+		MinTime:             minKeepalivePing,
+		PermitWithoutStream: true,
+	}))
+	s.grpcServer = grpc.NewServer(opts...)
 	pb.RegisterTailscaleCNIServer(s.grpcServer, s)
 
 	log.Printf("Starting gRPC server on %s", s.socketPath)
@@ -67,12 +244,37 @@ func (s *Server) Start() error {
 			log.Printf("gRPC server error: %v", err)
 		}
 	}()
+	if s.tcpLis != nil {
+		log.Printf("Starting gRPC server on %s (mTLS)", s.tcpLis.Addr())
+		go func() {
+			if err := s.grpcServer.Serve(s.tcpLis); err != nil {
+				log.Printf("gRPC TCP server error: %v", err)
+			}
+		}()
+	}
+
+	if s.adminAddr != "" {
+		if err := s.startAdmin(); err != nil {
+			s.Stop()
+			return fmt.Errorf("starting admin API: %w", err)
+		}
+	}
 
 	return nil
 }
 
 // Stop gracefully shuts down the server.
 func (s *Server) Stop() {
+	if s.adminServer != nil {
+		log.Printf("Stopping admin API server")
+		ctx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+		s.adminServer.Shutdown(ctx)
+		cancel()
+		if filepath.IsAbs(s.adminAddr) {
+			os.Remove(s.adminAddr)
+		}
+	}
+	s.stopWatches()
 	if s.grpcServer != nil {
 		log.Printf("Stopping gRPC server")
 		s.grpcServer.GracefulStop()
@@ -85,24 +287,55 @@ func (s *Server) Add(ctx context.Context, req *pb.AddRequest) (*pb.AddResponse,
 	log.Printf("CNI ADD: container=%s pod=%s/%s netns=%s ifname=%s clusterIP=%s",
 		req.ContainerId, req.PodNamespace, req.PodName, req.Netns, req.IfName, req.ClusterIp)
 
-	// Use ts0 as the Tailscale interface name (eth0 is already used by primary CNI)
-	tsIfName := "ts0"
-	managed, err := s.podMgr.AddPod(ctx, req.ContainerId, req.Netns, tsIfName, req.PodName, req.PodNamespace, req.ClusterIp)
+	pod := podRef{Name: req.PodName, Namespace: req.PodNamespace, UID: req.PodUid}
+
+	routes, err := ParseTailscaleRoutes(req.TailscaleRoutes)
+	if err != nil {
+		log.Printf("CNI ADD failed: %v", err)
+		s.events.AttachFailed(pod, err)
+		return nil, statusError(fmt.Errorf("adding pod: %w: %w", errInvalidRequest, err))
+	}
+
+	if req.RoutingMode != "" {
+		if err := ValidateRoutingMode(req.RoutingMode); err != nil {
+			log.Printf("CNI ADD failed: %v", err)
+			s.events.AttachFailed(pod, err)
+			return nil, statusError(fmt.Errorf("adding pod: %w: %w", errInvalidRequest, err))
+		}
+	}
+
+	// Use ts0 as the Tailscale interface name (eth0 is already used by primary CNI),
+	// unless Tailscale is the pod's only network
+	tsIfName := defaultPodIfName
+	if req.Standalone && req.IfName != "" {
+		tsIfName = req.IfName
+	}
+	managed, err := s.podMgr.AddPod(ctx, req.ContainerId, req.Netns, tsIfName, req.PodName, req.PodNamespace, req.PodUid, req.ClusterIp, routes, req.RoutingMode)
+	if errors.Is(err, errNamespaceDisabled) || errors.Is(err, errHostNetwork) {
+		log.Printf("CNI ADD skipped: container=%s: %v", req.ContainerId, err)
+		return &pb.AddResponse{Skipped: true}, nil
+	}
 	if err != nil {
 		log.Printf("CNI ADD failed: %v", err)
-		return nil, fmt.Errorf("adding pod: %w", err)
+		s.events.AttachFailed(pod, err)
+		return nil, statusError(fmt.Errorf("adding pod: %w", err))
 	}
 
 	resp := &pb.AddResponse{
 		TailscaleIpv4:     managed.TailscaleIPv4.String(),
-		TailscaleHostname: managed.Hostname,
+		TailscaleHostname: managed.TailnetHostname(),
+		TailscaleFqdn:     managed.MagicDNSName(),
+		InterfaceName:     managed.PodIfName,
+		HostInterfaceName: managed.HostVethName,
 	}
 	if managed.TailscaleIPv6.IsValid() {
 		resp.TailscaleIpv6 = managed.TailscaleIPv6.String()
 	}
 
-	log.Printf("CNI ADD success: container=%s ip=%s hostname=%s",
-		req.ContainerId, resp.TailscaleIpv4, resp.TailscaleHostname)
+	log.Printf("CNI ADD success: container=%s ip=%s hostname=%s fqdn=%s",
+		req.ContainerId, resp.TailscaleIpv4, resp.TailscaleHostname, resp.TailscaleFqdn)
+	s.events.Attached(pod, resp.TailscaleIpv4, resp.TailscaleHostname)
+	s.annotator.Annotate(pod, resp.TailscaleIpv4, resp.TailscaleIpv6, resp.TailscaleHostname, resp.TailscaleFqdn)
 
 	return resp, nil
 }
@@ -112,7 +345,7 @@ func (s *Server) Del(ctx context.Context, req *pb.DelRequest) (*pb.DelResponse,
 	log.Printf("CNI DEL: container=%s netns=%s ifname=%s",
 		req.ContainerId, req.Netns, req.IfName)
 
-	if err := s.podMgr.DeletePod(req.ContainerId); err != nil {
+	if err := s.deletePod(ctx, req.ContainerId); err != nil {
 		log.Printf("CNI DEL failed: %v", err)
 		return nil, fmt.Errorf("deleting pod: %w", err)
 	}
@@ -122,6 +355,220 @@ func (s *Server) Del(ctx context.Context, req *pb.DelRequest) (*pb.DelResponse,
 	return &pb.DelResponse{}, nil
 }
 
+// GC handles CNI GC requests.
+func (s *Server) GC(ctx context.Context, req *pb.GCRequest) (*pb.GCResponse, error) {
+	log.Printf("CNI GC: %d valid containers", len(req.ValidContainerIds))
+
+	valid := make(map[string]bool, len(req.ValidContainerIds))
+	for _, id := range req.ValidContainerIds {
+		valid[id] = true
+	}
+
+	resp := &pb.GCResponse{}
+	for _, id := range s.podMgr.StaleContainers(valid) {
+		log.Printf("CNI GC: removing pod for container %s, which the runtime no longer knows", id)
+		if err := s.deletePod(ctx, id); err != nil {
+			log.Printf("CNI GC failed: %v", err)
+			return resp, fmt.Errorf("deleting pod %s: %w", id, err)
+		}
+		resp.RemovedContainerIds = append(resp.RemovedContainerIds, id)
+	}
+
+	log.Printf("CNI GC success: removed %d pods", len(resp.RemovedContainerIds))
+
+	return resp, nil
+}
+
+// Status handles CNI STATUS requests.
+func (s *Server) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
+	if err := s.podMgr.Ready(ctx); err != nil {
+		log.Printf("CNI STATUS: not ready: %v", err)
+		return &pb.StatusResponse{Message: err.Error()}, nil
+	}
+	return &pb.StatusResponse{Ready: true}, nil
+}
+
+// GetRecoveryReport returns the outcome of the daemon's startup recovery.
+func (s *Server) GetRecoveryReport(ctx context.Context, req *pb.GetRecoveryReportRequest) (*pb.GetRecoveryReportResponse, error) {
+	report := s.podMgr.GetRecoveryReport()
+	if report == nil {
+		return &pb.GetRecoveryReportResponse{}, nil
+	}
+	return report.proto(), nil
+}
+
+// Reattach restarts a pod's Tailscale node.
+func (s *Server) Reattach(ctx context.Context, req *pb.ReattachRequest) (*pb.ReattachResponse, error) {
+	log.Printf("Reattach: container=%s", req.ContainerId)
+
+	managed, err := s.reattachPod(ctx, req.ContainerId)
+	if err != nil {
+		log.Printf("Reattach failed: %v", err)
+		return nil, statusError(fmt.Errorf("reattaching pod: %w", err))
+	}
+
+	resp := &pb.ReattachResponse{TailscaleIpv4: managed.TailscaleIPv4.String(), TailscaleFqdn: managed.MagicDNSName()}
+	if managed.TailscaleIPv6.IsValid() {
+		resp.TailscaleIpv6 = managed.TailscaleIPv6.String()
+	}
+	log.Printf("Reattach success: container=%s ip=%s", req.ContainerId, resp.TailscaleIpv4)
+
+	return resp, nil
+}
+
+// reattachPod restarts a container's pod's node and updates its
+// annotations.
+func (s *Server) reattachPod(ctx context.Context, containerID string) (*ManagedServer, error) {
+	managed, err := s.podMgr.ReattachPod(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	var ipv6 string
+	if managed.TailscaleIPv6.IsValid() {
+		ipv6 = managed.TailscaleIPv6.String()
+	}
+	pod := podRef{Name: managed.PodName, Namespace: managed.Namespace, UID: managed.PodUID}
+	s.annotator.Annotate(pod, managed.TailscaleIPv4.String(), ipv6, managed.TailnetHostname(), managed.MagicDNSName())
+	return managed, nil
+}
+
+// GetRecentFailures returns recent auth key creation failures.
+func (s *Server) GetRecentFailures(ctx context.Context, req *pb.GetRecentFailuresRequest) (*pb.GetRecentFailuresResponse, error) {
+	resp := &pb.GetRecentFailuresResponse{}
+	if s.podMgr.oauthMgr == nil {
+		return resp, nil
+	}
+	for _, f := range s.podMgr.oauthMgr.RecentFailures(req.PodNamespace) {
+		resp.Failures = append(resp.Failures, &pb.AuthKeyFailure{
+			Time:         f.Time.UTC().Format(time.RFC3339),
+			PodNamespace: f.Namespace,
+			PodName:      f.Pod,
+			Reason:       f.Reason,
+			Error:        f.Err,
+		})
+	}
+	return resp, nil
+}
+
+// PruneStaleDevices lists or deletes tailnet devices no pod holds.
+func (s *Server) PruneStaleDevices(ctx context.Context, req *pb.PruneStaleDevicesRequest) (*pb.PruneStaleDevicesResponse, error) {
+	log.Printf("PruneStaleDevices: delete=%v min_offline=%ds", req.Delete, req.MinOfflineSeconds)
+
+	if req.MinOfflineSeconds < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "min_offline_seconds %d is negative", req.MinOfflineSeconds)
+	}
+	minOffline := defaultPruneMinOffline
+	if req.MinOfflineSeconds > 0 {
+		minOffline = time.Duration(req.MinOfflineSeconds) * time.Second
+	}
+	devices, err := s.podMgr.PruneStaleDevices(ctx, minOffline, !req.Delete)
+	if err != nil {
+		log.Printf("PruneStaleDevices failed: %v", err)
+		return nil, statusError(fmt.Errorf("pruning devices: %w", err))
+	}
+
+	resp := &pb.PruneStaleDevicesResponse{Deleted: req.Delete}
+	for _, d := range devices {
+		resp.Devices = append(resp.Devices, &pb.StaleDevice{
+			Id:       d.ID,
+			Hostname: d.Hostname,
+			LastSeen: d.LastSeen.UTC().Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
+// DrainNode removes every pod's node and device and clears their
+// annotations.
+func (s *Server) DrainNode(ctx context.Context, req *pb.DrainNodeRequest) (*pb.DrainNodeResponse, error) {
+	log.Printf("DrainNode")
+
+	drained := s.podMgr.DrainNode(ctx)
+	slices.SortFunc(drained, func(a, b *ManagedServer) int {
+		return cmp.Or(cmp.Compare(a.Namespace, b.Namespace), cmp.Compare(a.PodName, b.PodName))
+	})
+	resp := &pb.DrainNodeResponse{}
+	for _, managed := range drained {
+		s.annotator.Clear(podRef{Name: managed.PodName, Namespace: managed.Namespace, UID: managed.PodUID})
+		resp.Pods = append(resp.Pods, &pb.DrainedPod{
+			ContainerId:   managed.ContainerID,
+			PodNamespace:  managed.Namespace,
+			PodName:       managed.PodName,
+			TailscaleIpv4: managed.TailscaleIPv4.String(),
+		})
+	}
+	return resp, nil
+}
+
+// Watch streams pods' lifecycle events until the client cancels or the
+// daemon stops.
+func (s *Server) Watch(req *pb.WatchRequest, stream grpc.ServerStreamingServer[pb.PodEvent]) error {
+	events, stop := s.podMgr.WatchPods()
+	defer stop()
+	log.Printf("Watch: namespace=%q", req.PodNamespace)
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.watchCtx.Done():
+			return status.Error(codes.Unavailable, "daemon is shutting down")
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "watcher fell behind; list pods and watch again")
+			}
+			if req.PodNamespace != "" && ev.Namespace != req.PodNamespace {
+				continue
+			}
+			if err := stream.Send(ev.proto()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RecoveryReportHandler serves the daemon's startup recovery report as
+// JSON, or 503 if recovery hasn't finished.
+func RecoveryReportHandler(pm *PodManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := pm.GetRecoveryReport()
+		if report == nil {
+			http.Error(w, "recovery has not finished", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	})
+}
+
+// ReadyzHandler reports whether pm is ready to add pods, for readiness
+// probes: 200 if so, 503 with the reason if not.
+func ReadyzHandler(pm *PodManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := pm.Ready(r.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+}
+
+// deletePod removes a container's pod and clears its annotations.
+func (s *Server) deletePod(ctx context.Context, containerID string) error {
+	// Look the pod up before it's gone, to clear its annotations
+	var pod podRef
+	if managed, ok := s.podMgr.GetPod(containerID); ok {
+		pod = podRef{Name: managed.PodName, Namespace: managed.Namespace, UID: managed.PodUID}
+	}
+
+	if err := s.podMgr.DeletePod(ctx, containerID); err != nil {
+		return err
+	}
+	s.annotator.Clear(pod)
+	return nil
+}
+
 // Check handles CNI CHECK requests.
 func (s *Server) Check(ctx context.Context, req *pb.CheckRequest) (*pb.CheckResponse, error) {
 	log.Printf("CNI CHECK: container=%s netns=%s ifname=%s",
@@ -136,8 +583,18 @@ func (s *Server) Check(ctx context.Context, req *pb.CheckRequest) (*pb.CheckResp
 	log.Printf("CNI CHECK result: container=%s healthy=%v message=%s",
 		req.ContainerId, healthy, message)
 
-	return &pb.CheckResponse{
+	resp := &pb.CheckResponse{
 		Healthy: healthy,
 		Message: message,
-	}, nil
+	}
+	if managed, ok := s.podMgr.GetPod(req.ContainerId); ok {
+		resp.DerpRegion = int32(managed.HomeDERP())
+		if age, ok := managed.HandshakeAge(); ok {
+			resp.HandshakeAgeSeconds = int64(age / time.Second)
+		}
+		if expiry, ok := managed.KeyExpiry(); ok {
+			resp.KeyExpiry = expiry.Unix()
+		}
+	}
+	return resp, nil
 }
@@ -0,0 +1,390 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseSocketMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{input: "0660", want: 0660},
+		{input: "600", want: 0600},
+		{input: "0666", want: 0666},
+		{input: "0640", want: 0640},
+		{input: "0460", wantErr: true}, // owner can't write
+		{input: "01660", wantErr: true},
+		{input: "rw-rw----", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSocketMode(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSocketMode(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSocketMode(%q) = %04o, want %04o", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupSocketGroup(t *testing.T) {
+	if gid, err := LookupSocketGroup(""); err != nil || gid != 0 {
+		t.Errorf("LookupSocketGroup(\"\") = %d, %v; want 0, nil", gid, err)
+	}
+	if gid, err := LookupSocketGroup("1234"); err != nil || gid != 1234 {
+		t.Errorf("LookupSocketGroup(\"1234\") = %d, %v; want 1234, nil", gid, err)
+	}
+	if _, err := LookupSocketGroup("no-such-group-tscni"); err == nil {
+		t.Errorf("LookupSocketGroup() for a missing group: want error")
+	}
+}
+
+func TestServerStart_SocketMode(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	srv := NewServer(ServerConfig{SocketPath: socketPath, SocketMode: 0600}, nil)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	fi, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fi.Mode().Perm(); got != 0600 {
+		t.Errorf("socket mode = %04o, want 0600", got)
+	}
+}
+
+func TestServer_MaxMessageSize(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	srv := NewServer(ServerConfig{SocketPath: socketPath, MaxMessageSize: 1024, Keepalive: time.Minute}, pm)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client := pb.NewTailscaleCNIClient(conn)
+	if _, err := client.Check(ctx, &pb.CheckRequest{ContainerId: "missing"}); err != nil {
+		t.Errorf("Check() error = %v", err)
+	}
+	_, err = client.Check(ctx, &pb.CheckRequest{ContainerId: strings.Repeat("a", 2048)})
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("Check() with a 2KB request code = %v, want %v (err = %v)", got, codes.ResourceExhausted, err)
+	}
+}
+
+func TestServerStart_Keepalive(t *testing.T) {
+	srv := NewServer(ServerConfig{SocketPath: filepath.Join(t.TempDir(), "daemon.sock"), Keepalive: time.Second}, nil)
+	if err := srv.Start(); err == nil {
+		srv.Stop()
+		t.Errorf("Start() with a 1s keepalive succeeded")
+	}
+}
+
+func TestParseAllowedUIDs(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []uint32
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "0", want: []uint32{0}},
+		{input: "0, 1000,", want: []uint32{0, 1000}},
+		{input: "root", wantErr: true},
+		{input: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseAllowedUIDs(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAllowedUIDs(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseAllowedUIDs(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_AllowedUIDs(t *testing.T) {
+	uid := uint32(os.Getuid())
+
+	tests := []struct {
+		name     string
+		allowed  []uint32
+		wantCode codes.Code
+	}{
+		{name: "caller allowed", allowed: []uint32{uid}, wantCode: codes.OK},
+		{name: "caller not allowed", allowed: []uint32{uid + 1}, wantCode: codes.PermissionDenied},
+		{name: "check disabled", allowed: nil, wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+			if err != nil {
+				t.Fatalf("NewPodManager() error = %v", err)
+			}
+			socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+			srv := NewServer(ServerConfig{SocketPath: socketPath, AllowedUIDs: tt.allowed}, pm)
+			if err := srv.Start(); err != nil {
+				t.Fatalf("Start() error = %v", err)
+			}
+			defer srv.Stop()
+
+			conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			client := pb.NewTailscaleCNIClient(conn)
+			_, err = client.Check(ctx, &pb.CheckRequest{ContainerId: "missing"})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("Check() code = %v, want %v (err = %v)", got, tt.wantCode, err)
+			}
+
+			// Streams are checked too; an allowed one would wait for events
+			if tt.wantCode != codes.OK {
+				stream, err := client.Watch(ctx, &pb.WatchRequest{})
+				if err == nil {
+					_, err = stream.Recv()
+				}
+				if got := status.Code(err); got != tt.wantCode {
+					t.Errorf("Watch() code = %v, want %v (err = %v)", got, tt.wantCode, err)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_AddInvalidRequest(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	srv := NewServer(ServerConfig{SocketPath: filepath.Join(t.TempDir(), "daemon.sock")}, pm)
+
+	for _, req := range []*pb.AddRequest{
+		{ContainerId: "c1", TailscaleRoutes: []string{"not-a-cidr"}},
+		{ContainerId: "c1", RoutingMode: "fast"},
+	} {
+		_, err := srv.Add(context.Background(), req)
+		st, _ := status.FromError(err)
+		if st.Code() != codes.InvalidArgument {
+			t.Errorf("Add(%v) code = %v, want InvalidArgument (%v)", req, st.Code(), err)
+		}
+		details := st.Details()
+		if len(details) != 1 {
+			t.Fatalf("Add(%v) has %d error details, want 1", req, len(details))
+		}
+		if detail, ok := details[0].(*pb.ErrorDetail); !ok || detail.Retryable {
+			t.Errorf("Add(%v) error detail = %v, want a non-retryable ErrorDetail", req, details[0])
+		}
+	}
+}
+
+func TestServer_Watch(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	srv := NewServer(ServerConfig{SocketPath: socketPath}, pm)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient("unix://"+socketPath, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := pb.NewTailscaleCNIClient(conn).Watch(ctx, &pb.WatchRequest{PodNamespace: "prod"})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	for {
+		pm.watchers.mu.Lock()
+		n := len(pm.watchers.subs)
+		pm.watchers.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ip := netip.MustParseAddr("100.64.0.1")
+	pm.publish(newPodEvent(podAttached, &ManagedServer{ContainerID: "c1", Namespace: "default", PodName: "web-0", TailscaleIPv4: ip}))
+	pm.publish(newPodEvent(podAttached, &ManagedServer{ContainerID: "c2", Namespace: "prod", PodName: "api-0", TailscaleIPv4: ip}))
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv() error = %v", err)
+	}
+	if ev.Type != pb.PodEventType_POD_EVENT_TYPE_ATTACHED || ev.ContainerId != "c2" || ev.TailscaleIpv4 != "100.64.0.1" {
+		t.Errorf("Recv() = %v, want c2's attach only", ev)
+	}
+
+	// Stopping the daemon ends the stream rather than waiting on it
+	srv.Stop()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv() after Stop error = %v, want Unavailable", err)
+	}
+}
+
+// testCert issues a certificate for name, signed by parent (self-signed if
+// parent is nil), and returns it with its key.
+func testCert(t *testing.T, name string, parent *tls.Certificate) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, any(key)
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+// writeTestCert writes cert and its key as PEM files in dir.
+func writeTestCert(t *testing.T, dir, name string, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestServer_TCPListener(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCert(t, "test CA", nil)
+	caFile, _ := writeTestCert(t, dir, "ca", ca)
+	serverCert, serverKey := writeTestCert(t, dir, "server", testCert(t, "daemon", &ca))
+	clientCert := testCert(t, "controller", &ca)
+
+	tlsConfig, err := LoadServerTLS(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatalf("LoadServerTLS() error = %v", err)
+	}
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	uid := uint32(os.Getuid())
+	socketPath := filepath.Join(t.TempDir(), "daemon.sock")
+	srv := NewServer(ServerConfig{SocketPath: socketPath, AllowedUIDs: []uint32{uid}, TCPAddr: "127.0.0.1:0", TLSConfig: tlsConfig}, pm)
+	if err := srv.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer srv.Stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+	check := func(target string, creds credentials.TransportCredentials) error {
+		conn, err := grpc.NewClient(target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, err = pb.NewTailscaleCNIClient(conn).Check(ctx, &pb.CheckRequest{ContainerId: "missing"})
+		return err
+	}
+	tcpTarget := srv.tcpLis.Addr().String()
+
+	if err := check(tcpTarget, credentials.NewTLS(&tls.Config{RootCAs: roots, Certificates: []tls.Certificate{clientCert}})); err != nil {
+		t.Errorf("Check() over TCP with a client certificate error = %v", err)
+	}
+	if err := check(tcpTarget, credentials.NewTLS(&tls.Config{RootCAs: roots})); err == nil {
+		t.Errorf("Check() over TCP without a client certificate succeeded")
+	}
+	if err := check(tcpTarget, insecure.NewCredentials()); err == nil {
+		t.Errorf("Check() over plaintext TCP succeeded")
+	}
+	// The socket still checks peer credentials
+	if err := check("unix://"+socketPath, insecure.NewCredentials()); err != nil {
+		t.Errorf("Check() over the socket error = %v", err)
+	}
+}
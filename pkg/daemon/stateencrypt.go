@@ -0,0 +1,196 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store"
+)
+
+// stateKeyLen is the length of a state encryption key, for AES-256.
+const stateKeyLen = 32
+
+// encryptedMagic starts every value encryptedStore writes, followed by the
+// ID of the key it was sealed with, a nonce and the AES-GCM ciphertext.
+// Values without it are plaintext from before encryption was turned on.
+var encryptedMagic = []byte("tscni-enc1:")
+
+// stateKeyIDLen is the length of a key's ID: the start of its SHA-256.
+const stateKeyIDLen = 4
+
+// StateKeys are the keys pod state is encrypted with at rest. The first
+// seals new state; the rest only open state sealed before a key rotation.
+type StateKeys []stateKey
+
+type stateKey struct {
+	id   [stateKeyIDLen]byte
+	aead cipher.AEAD
+}
+
+// LoadStateKeys reads state encryption keys from a file, such as a key of a
+// mounted Kubernetes Secret: one base64-encoded 32-byte key per line, the
+// current one first. Blank lines are ignored.
+func LoadStateKeys(path string) (StateKeys, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading state keys: %w", err)
+	}
+	var keys StateKeys
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		raw, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: parsing state key: %w", i+1, err)
+		}
+		k, err := newStateKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no state keys in %s", path)
+	}
+	return keys, nil
+}
+
+func newStateKey(raw []byte) (stateKey, error) {
+	if len(raw) != stateKeyLen {
+		return stateKey{}, fmt.Errorf("state key is %d bytes, want %d", len(raw), stateKeyLen)
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return stateKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return stateKey{}, err
+	}
+	k := stateKey{aead: aead}
+	sum := sha256.Sum256(raw)
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// ID returns the current key's ID, as logged and found in sealed values.
+func (keys StateKeys) ID() string {
+	return fmt.Sprintf("%x", keys[0].id)
+}
+
+// seal encrypts a state value with the current key. The state key is
+// authenticated too, so a value can't be passed off as another's.
+func (keys StateKeys) seal(id ipn.StateKey, plaintext []byte) ([]byte, error) {
+	k := keys[0]
+	out := make([]byte, 0, len(encryptedMagic)+stateKeyIDLen+k.aead.NonceSize()+len(plaintext)+k.aead.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, k.id[:]...)
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return k.aead.Seal(out, nonce, plaintext, []byte(id)), nil
+}
+
+// open decrypts a value seal returned, with whichever key sealed it.
+func (keys StateKeys) open(id ipn.StateKey, sealed []byte) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(sealed, encryptedMagic)
+	if !ok || len(rest) < stateKeyIDLen {
+		return nil, fmt.Errorf("state %q is not encrypted", id)
+	}
+	keyID, rest := rest[:stateKeyIDLen], rest[stateKeyIDLen:]
+	for _, k := range keys {
+		if !bytes.Equal(k.id[:], keyID) {
+			continue
+		}
+		if len(rest) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("state %q is truncated", id)
+		}
+		nonce, ciphertext := rest[:k.aead.NonceSize()], rest[k.aead.NonceSize():]
+		plaintext, err := k.aead.Open(nil, nonce, ciphertext, []byte(id))
+		if err != nil {
+			return nil, fmt.Errorf("decrypting state %q: %w", id, err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("state %q was encrypted with key %x, which is not among the state keys", id, keyID)
+}
+
+// sealedWith reports whether value was sealed with the current key.
+func (keys StateKeys) sealedWith(value []byte) bool {
+	rest, ok := bytes.CutPrefix(value, encryptedMagic)
+	return ok && bytes.HasPrefix(rest, keys[0].id[:])
+}
+
+// encryptedStore is an ipn.StateStore that encrypts the values it keeps in
+// another store, so that node and machine keys aren't at rest in plaintext.
+// Plaintext values, from before encryption was turned on, are read as they
+// are until reencrypt rewrites them.
+type encryptedStore struct {
+	st   ipn.StateStore
+	keys StateKeys
+}
+
+func (s *encryptedStore) String() string {
+	return fmt.Sprintf("encryptedStore(%v)", s.st)
+}
+
+// ReadState implements ipn.StateStore.
+func (s *encryptedStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	bs, err := s.st.ReadState(id)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(bs, encryptedMagic) {
+		return bs, nil
+	}
+	return s.keys.open(id, bs)
+}
+
+// WriteState implements ipn.StateStore.
+func (s *encryptedStore) WriteState(id ipn.StateKey, bs []byte) error {
+	sealed, err := s.keys.seal(id, bs)
+	if err != nil {
+		return fmt.Errorf("encrypting state %q: %w", id, err)
+	}
+	return s.st.WriteState(id, sealed)
+}
+
+// reencrypt rewrites every value not sealed with the current key, as after
+// a key rotation or when encryption has just been turned on, and returns
+// how many it rewrote. Stores that can't list their values are left as
+// they are.
+func (s *encryptedStore) reencrypt() (int, error) {
+	exp, ok := s.st.(store.ExportableStore)
+	if !ok {
+		return 0, nil
+	}
+	// ReadState and WriteState can't be used while iterating
+	var stale []ipn.StateKey
+	for id, bs := range exp.All() {
+		if !s.keys.sealedWith(bs) {
+			stale = append(stale, id)
+		}
+	}
+	for _, id := range stale {
+		bs, err := s.ReadState(id)
+		if err != nil {
+			return 0, err
+		}
+		if err := s.WriteState(id, bs); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
@@ -0,0 +1,133 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store"
+)
+
+// writeStateKeys writes a key file holding keys, made of repeated bytes,
+// and loads it.
+func writeStateKeys(t *testing.T, fill ...byte) StateKeys {
+	t.Helper()
+	var lines []string
+	for _, b := range fill {
+		lines = append(lines, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, stateKeyLen)))
+	}
+	path := filepath.Join(t.TempDir(), "keys")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := LoadStateKeys(path)
+	if err != nil {
+		t.Fatalf("LoadStateKeys() error = %v", err)
+	}
+	return keys
+}
+
+func TestLoadStateKeys_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{"empty", "\n\n", "no state keys"},
+		{"not base64", "not a key\n", "parsing state key"},
+		{"short", base64.StdEncoding.EncodeToString(make([]byte, 16)), "is 16 bytes, want 32"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "keys")
+		if err := os.WriteFile(path, []byte(tt.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadStateKeys(path); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("LoadStateKeys(%s) error = %v, want it to mention %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestEncryptedStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tailscale.state")
+	fs, err := store.NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := &encryptedStore{st: fs, keys: writeStateKeys(t, 1)}
+
+	if err := st.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	if got, err := st.ReadState(ipn.MachineKeyStateKey); err != nil || string(got) != "machine-key" {
+		t.Errorf("ReadState() = %q, %v; want %q", got, err, "machine-key")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("machine-key")) {
+		t.Errorf("state file holds the value in plaintext: %s", data)
+	}
+
+	// A value can't be read back as another key's
+	sealed, _ := fs.ReadState(ipn.MachineKeyStateKey)
+	if err := fs.WriteState(ipn.CurrentProfileStateKey, sealed); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.ReadState(ipn.CurrentProfileStateKey); err == nil {
+		t.Errorf("ReadState() of a value moved from another key succeeded")
+	}
+
+	if _, err := st.ReadState("missing"); err != ipn.ErrStateNotExist {
+		t.Errorf("ReadState(missing) error = %v, want ipn.ErrStateNotExist", err)
+	}
+
+	other := &encryptedStore{st: fs, keys: writeStateKeys(t, 2)}
+	if _, err := other.ReadState(ipn.MachineKeyStateKey); err == nil || !strings.Contains(err.Error(), "not among the state keys") {
+		t.Errorf("ReadState() with the wrong key error = %v, want an unknown key error", err)
+	}
+}
+
+func TestEncryptedStore_Reencrypt(t *testing.T) {
+	fs, err := store.NewFileStore(t.Logf, filepath.Join(t.TempDir(), "tailscale.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One value from before encryption and one under the old key
+	if err := fs.WriteState(ipn.CurrentProfileStateKey, []byte("profile")); err != nil {
+		t.Fatal(err)
+	}
+	old := &encryptedStore{st: fs, keys: writeStateKeys(t, 1)}
+	if err := old.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := &encryptedStore{st: fs, keys: writeStateKeys(t, 2, 1)}
+	n, err := rotated.reencrypt()
+	if err != nil || n != 2 {
+		t.Fatalf("reencrypt() = %d, %v; want 2 values rewritten", n, err)
+	}
+	for k, want := range map[ipn.StateKey]string{ipn.MachineKeyStateKey: "machine-key", ipn.CurrentProfileStateKey: "profile"} {
+		raw, _ := fs.ReadState(k)
+		if !rotated.keys.sealedWith(raw) {
+			t.Errorf("%q is not sealed with the current key after reencrypt()", k)
+		}
+		if got, err := rotated.ReadState(k); err != nil || string(got) != want {
+			t.Errorf("ReadState(%q) = %q, %v; want %q", k, got, err, want)
+		}
+	}
+
+	if n, err := rotated.reencrypt(); err != nil || n != 0 {
+		t.Errorf("second reencrypt() = %d, %v; want nothing to rewrite", n, err)
+	}
+	// The old key is no longer needed
+	current := &encryptedStore{st: fs, keys: rotated.keys[:1]}
+	if got, err := current.ReadState(ipn.MachineKeyStateKey); err != nil || string(got) != "machine-key" {
+		t.Errorf("ReadState() with only the new key = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,412 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"tailscale.com/atomicfile"
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store"
+	"tailscale.com/ipn/store/mem"
+)
+
+// State backends for per-pod Tailscale state (node and machine keys).
+const (
+	// StateBackendFile stores state in <state-dir>/pods/<containerID>/tailscale.state.
+	// State is tied to the node the pod runs on.
+	StateBackendFile = "file"
+
+	// StateBackendKubeSecret stores state in a Secret in the pod's namespace,
+	// named after the pod, so it is not tied to a specific node.
+	StateBackendKubeSecret = "k8s-secret"
+)
+
+// ValidateStateBackend returns an error if backend is not a known state backend.
+func ValidateStateBackend(backend string) error {
+	switch backend {
+	case StateBackendFile, StateBackendKubeSecret:
+		return nil
+	}
+	return fmt.Errorf("unknown state backend %q (want %q or %q)", backend, StateBackendFile, StateBackendKubeSecret)
+}
+
+// State backups for the file state backend.
+const (
+	// StateBackupNone keeps state only in the state directory.
+	StateBackupNone = ""
+
+	// StateBackupSecret copies a new pod's state to the Secret the
+	// StateBackendKubeSecret backend would use, and restores the state file
+	// from it during recovery if the file is missing, e.g. because the state
+	// directory was wiped.
+	StateBackupSecret = "secret"
+)
+
+// ValidateStateBackup returns an error if backup is not a known state backup.
+func ValidateStateBackup(backup string) error {
+	switch backup {
+	case StateBackupNone, StateBackupSecret:
+		return nil
+	}
+	return fmt.Errorf("unknown state backup %q (want %q or empty)", backup, StateBackupSecret)
+}
+
+// Annotations on a state Secret saying whose state it holds.
+const (
+	// stateOwnerAnnotation is the UID of the pod the state is for. A pod of
+	// the same name that takes the Secret over, as a rescheduled StatefulSet
+	// pod does, replaces it, and from then on the previous pod can neither
+	// write the state nor delete it.
+	stateOwnerAnnotation = "tailscale.com/pod-uid"
+
+	// stateKeepAnnotation is "true" if the state outlives its pod
+	// (AnnotationKeepIdentity).
+	stateKeepAnnotation = "tailscale.com/keep-identity"
+)
+
+// errStateTakenOver is returned for a state Secret another pod of the same
+// name has taken over.
+var errStateTakenOver = errors.New("state secret was taken over by another pod of the same name")
+
+// stateOwner is the pod a state Secret is for.
+type stateOwner struct {
+	UID  string // empty if unknown
+	Keep bool   // the state outlives the pod
+}
+
+// stamp records o as the owner in a state Secret's metadata.
+func (o stateOwner) stamp(meta *kubeObjectMeta) {
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	if o.UID != "" {
+		meta.Annotations[stateOwnerAnnotation] = o.UID
+	} else {
+		delete(meta.Annotations, stateOwnerAnnotation)
+	}
+	if o.Keep {
+		meta.Annotations[stateKeepAnnotation] = "true"
+	} else {
+		delete(meta.Annotations, stateKeepAnnotation)
+	}
+}
+
+// ownedBy reports whether secret holds the state of the pod with UID uid.
+// A Secret that doesn't record an owner, as those written before owners
+// were, belongs to whichever pod has its name.
+func ownedBy(secret *kubeSecret, uid string) bool {
+	owner := secret.Metadata.Annotations[stateOwnerAnnotation]
+	return owner == "" || owner == uid
+}
+
+var invalidSecretKeyChars = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+
+// stateSecretName returns the name of the Secret holding a pod's Tailscale state.
+func stateSecretName(podName string) string {
+	name := "tailscale-cni-state-" + podName
+	// Secret names are DNS subdomains (max 253 chars).
+	if len(name) > 253 {
+		name = strings.TrimRight(name[:253], "-.")
+	}
+	return name
+}
+
+// secretDataKey maps an ipn.StateKey to a valid Secret data key.
+func secretDataKey(id ipn.StateKey) string {
+	return invalidSecretKeyChars.ReplaceAllString(string(id), "_")
+}
+
+// kubeSecretStore is an ipn.StateStore backed by a Kubernetes Secret.
+// Values are cached in memory; writes go straight through to the API server,
+// and fail with errStateTakenOver once the Secret is another pod's.
+type kubeSecretStore struct {
+	client    *KubeClient
+	namespace string
+	name      string
+	owner     stateOwner
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// newKubeSecretStore opens owner's state Secret, loading any existing state.
+// A missing Secret is not an error; it is created on first write. A Secret
+// another pod has taken over is.
+func newKubeSecretStore(client *KubeClient, namespace, name string, owner stateOwner) (*kubeSecretStore, error) {
+	s := &kubeSecretStore{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		owner:     owner,
+		cache:     make(map[string][]byte),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if err != nil {
+		if isKubeNotFound(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("loading state secret %s/%s: %w", namespace, name, err)
+	}
+	if !ownedBy(secret, owner.UID) {
+		return nil, fmt.Errorf("%s/%s: %w (pod UID %s)", namespace, name, errStateTakenOver, secret.Metadata.Annotations[stateOwnerAnnotation])
+	}
+	for k, v := range secret.Data {
+		s.cache[k] = v
+	}
+	return s, nil
+}
+
+func (s *kubeSecretStore) String() string {
+	return fmt.Sprintf("kubeSecretStore(%s/%s)", s.namespace, s.name)
+}
+
+// ReadState implements ipn.StateStore.
+func (s *kubeSecretStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.cache[secretDataKey(id)]
+	if !ok {
+		return nil, ipn.ErrStateNotExist
+	}
+	return v, nil
+}
+
+// WriteState implements ipn.StateStore.
+func (s *kubeSecretStore) WriteState(id ipn.StateKey, bs []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), kubeRequestTimeout)
+	defer cancel()
+
+	key := secretDataKey(id)
+
+	// Retry once on a write conflict (e.g. the Secret was edited out of band).
+	for attempt := 0; ; attempt++ {
+		err := s.writeKey(ctx, key, bs)
+		if err == nil {
+			s.cache[key] = bs
+			return nil
+		}
+		var apiErr *kubeAPIError
+		if attempt == 0 && errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+			continue
+		}
+		return fmt.Errorf("writing state secret %s/%s: %w", s.namespace, s.name, err)
+	}
+}
+
+// All implements store.ExportableStore.
+func (s *kubeSecretStore) All() iter.Seq2[ipn.StateKey, []byte] {
+	return func(yield func(ipn.StateKey, []byte) bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// The keys a pod's node writes are valid Secret keys, which
+		// secretDataKey leaves unchanged
+		for k, v := range s.cache {
+			if !yield(ipn.StateKey(k), v) {
+				return
+			}
+		}
+	}
+}
+
+// writeKey sets a single data key on the Secret, creating it if needed.
+func (s *kubeSecretStore) writeKey(ctx context.Context, key string, bs []byte) error {
+	secret, err := s.client.GetSecret(ctx, s.namespace, s.name)
+	if isKubeNotFound(err) {
+		meta := kubeObjectMeta{
+			Name:      s.name,
+			Namespace: s.namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "tailscale-cni"},
+		}
+		s.owner.stamp(&meta)
+		return s.client.CreateSecret(ctx, &kubeSecret{
+			Metadata: meta,
+			Type:     "Opaque",
+			Data:     map[string][]byte{key: bs},
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if !ownedBy(secret, s.owner.UID) {
+		return fmt.Errorf("%w (pod UID %s)", errStateTakenOver, secret.Metadata.Annotations[stateOwnerAnnotation])
+	}
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[key] = bs
+	return s.client.UpdateSecret(ctx, secret)
+}
+
+// poolStore is a warm pool node's state store: in memory until a pod takes
+// the node, then the pod's own store, which the state so far is copied to.
+type poolStore struct {
+	mu  sync.Mutex
+	mem mem.Store
+	st  ipn.StateStore // the pod's, once it has taken the node
+}
+
+func (s *poolStore) String() string {
+	return "poolStore"
+}
+
+// ReadState implements ipn.StateStore.
+func (s *poolStore) ReadState(id ipn.StateKey) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st != nil {
+		return s.st.ReadState(id)
+	}
+	return s.mem.ReadState(id)
+}
+
+// WriteState implements ipn.StateStore.
+func (s *poolStore) WriteState(id ipn.StateKey, bs []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.st != nil {
+		return s.st.WriteState(id, bs)
+	}
+	return s.mem.WriteState(id, bs)
+}
+
+// moveTo copies the node's state to st, which holds it from then on.
+func (s *poolStore) moveTo(st ipn.StateStore) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := s.mem.ExportToJSON()
+	if err != nil {
+		return err
+	}
+	var state map[ipn.StateKey][]byte
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	for id, bs := range state {
+		if err := st.WriteState(id, bs); err != nil {
+			return err
+		}
+	}
+	s.st = st
+	return nil
+}
+
+// claimStateSecret makes the state Secret name, if there is one, owner's,
+// returning the UID of the pod it belonged to. A pod rescheduled under the
+// same name so takes over its predecessor's state, which the predecessor,
+// if it is still around, can then no longer write or delete.
+func claimStateSecret(ctx context.Context, client *KubeClient, namespace, name string, owner stateOwner) (string, error) {
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if isKubeNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	prev := secret.Metadata.Annotations[stateOwnerAnnotation]
+	before := maps.Clone(secret.Metadata.Annotations)
+	owner.stamp(&secret.Metadata)
+	if maps.Equal(before, secret.Metadata.Annotations) {
+		return prev, nil
+	}
+	return prev, client.UpdateSecret(ctx, secret)
+}
+
+// deleteStateSecret deletes the state Secret name if it is still the pod
+// uid's, reporting whether it was. A missing Secret counts as the pod's.
+func deleteStateSecret(ctx context.Context, client *KubeClient, namespace, name, uid string) (bool, error) {
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if isKubeNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !ownedBy(secret, uid) {
+		return false, nil
+	}
+	// A conflict means another pod took the Secret over since the read
+	err = client.DeleteSecret(ctx, namespace, name, secret.Metadata.ResourceVersion)
+	var apiErr *kubeAPIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// backupState copies everything in st to the Secret name, replacing what
+// the Secret held, and makes the Secret owner's. The Secret's layout is the
+// same as kubeSecretStore's.
+func backupState(ctx context.Context, client *KubeClient, namespace, name string, owner stateOwner, st store.ExportableStore) error {
+	data := make(map[string][]byte)
+	for k, v := range st.All() {
+		data[secretDataKey(k)] = v
+	}
+
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if isKubeNotFound(err) {
+		meta := kubeObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "tailscale-cni"},
+		}
+		owner.stamp(&meta)
+		return client.CreateSecret(ctx, &kubeSecret{
+			Metadata: meta,
+			Type:     "Opaque",
+			Data:     data,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	owner.stamp(&secret.Metadata)
+	secret.Data = data
+	return client.UpdateSecret(ctx, secret)
+}
+
+// restoreState writes the state backed up in the Secret name to a state
+// file at path. It returns false if there is no backup of the pod with UID
+// uid: none at all, or one another pod of the same name has since made.
+func restoreState(ctx context.Context, client *KubeClient, namespace, name, uid, path string) (bool, error) {
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if isKubeNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if len(secret.Data) == 0 || !ownedBy(secret, uid) {
+		return false, nil
+	}
+
+	// The keys a pod's node writes are valid Secret keys, which
+	// secretDataKey leaves unchanged
+	state := make(map[ipn.StateKey][]byte, len(secret.Data))
+	for k, v := range secret.Data {
+		state[ipn.StateKey(k)] = v
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := atomicfile.WriteFile(path, data, 0600); err != nil {
+		return false, err
+	}
+	return true, nil
+}
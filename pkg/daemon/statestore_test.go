@@ -0,0 +1,263 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"tailscale.com/ipn"
+	"tailscale.com/ipn/store"
+)
+
+// newFakeSecretAPI returns a KubeClient backed by an in-memory Secret API.
+func newFakeSecretAPI(t *testing.T) (*KubeClient, map[string]*kubeSecret) {
+	t.Helper()
+
+	var mu sync.Mutex
+	secrets := make(map[string]*kubeSecret)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// /api/v1/namespaces/<ns>/secrets[/<name>]
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/namespaces/"), "/")
+		key := parts[0] + "/"
+		if len(parts) == 3 {
+			key += parts[2]
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			s, ok := secrets[key]
+			if !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(s)
+		case http.MethodPost, http.MethodPut:
+			var s kubeSecret
+			json.NewDecoder(r.Body).Decode(&s)
+			secrets[parts[0]+"/"+s.Metadata.Name] = &s
+			json.NewEncoder(w).Encode(s)
+		case http.MethodDelete:
+			if _, ok := secrets[key]; !ok {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			delete(secrets, key)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &KubeClient{baseURL: srv.URL, tokenPath: tokenPath, httpClient: srv.Client()}, secrets
+}
+
+func TestKubeSecretStore_RoundTrip(t *testing.T) {
+	client, secrets := newFakeSecretAPI(t)
+
+	st, err := newKubeSecretStore(client, "default", "tailscale-cni-state-web-0", stateOwner{UID: "uid-1"})
+	if err != nil {
+		t.Fatalf("newKubeSecretStore() error = %v", err)
+	}
+
+	if _, err := st.ReadState(ipn.MachineKeyStateKey); !errors.Is(err, ipn.ErrStateNotExist) {
+		t.Errorf("ReadState() on empty store error = %v, want ErrStateNotExist", err)
+	}
+
+	if err := st.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+	if _, ok := secrets["default/tailscale-cni-state-web-0"]; !ok {
+		t.Fatalf("WriteState() did not create the Secret")
+	}
+
+	// A fresh store must load what the previous one wrote.
+	reopened, err := newKubeSecretStore(client, "default", "tailscale-cni-state-web-0", stateOwner{UID: "uid-1"})
+	if err != nil {
+		t.Fatalf("newKubeSecretStore() error = %v", err)
+	}
+	got, err := reopened.ReadState(ipn.MachineKeyStateKey)
+	if err != nil {
+		t.Fatalf("ReadState() error = %v", err)
+	}
+	if string(got) != "machine-key" {
+		t.Errorf("ReadState() = %q, want %q", got, "machine-key")
+	}
+}
+
+func TestPoolStore(t *testing.T) {
+	st := new(poolStore)
+	if err := st.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatalf("WriteState() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tailscale.state")
+	pod, err := store.NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.moveTo(pod); err != nil {
+		t.Fatalf("moveTo() error = %v", err)
+	}
+	if got, err := pod.ReadState(ipn.MachineKeyStateKey); err != nil || string(got) != "machine-key" {
+		t.Errorf("pod's store has %q, %v; want the state written before the move", got, err)
+	}
+
+	// From now on the pod's store is the one read and written
+	if err := st.WriteState(ipn.CurrentProfileStateKey, []byte("profile")); err != nil {
+		t.Fatalf("WriteState() after move error = %v", err)
+	}
+	if got, err := pod.ReadState(ipn.CurrentProfileStateKey); err != nil || string(got) != "profile" {
+		t.Errorf("pod's store has %q, %v after a write; want %q", got, err, "profile")
+	}
+	if got, err := st.ReadState(ipn.MachineKeyStateKey); err != nil || string(got) != "machine-key" {
+		t.Errorf("ReadState() after move = %q, %v", got, err)
+	}
+}
+
+func TestBackupRestoreState(t *testing.T) {
+	client, secrets := newFakeSecretAPI(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	st, err := store.NewFileStore(t.Logf, filepath.Join(dir, "old", "tailscale.state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatal(err)
+	}
+	if err := backupState(ctx, client, "default", "tailscale-cni-state-web-0", stateOwner{UID: "uid-1"}, st.(store.ExportableStore)); err != nil {
+		t.Fatalf("backupState() error = %v", err)
+	}
+	if _, ok := secrets["default/tailscale-cni-state-web-0"]; !ok {
+		t.Fatalf("backupState() did not create the Secret")
+	}
+
+	// Backing up again updates the existing Secret
+	if err := st.WriteState(ipn.CurrentProfileStateKey, []byte("profile")); err != nil {
+		t.Fatal(err)
+	}
+	if err := backupState(ctx, client, "default", "tailscale-cni-state-web-0", stateOwner{UID: "uid-1"}, st.(store.ExportableStore)); err != nil {
+		t.Fatalf("backupState() update error = %v", err)
+	}
+
+	path := filepath.Join(dir, "tailscale.state")
+	restored, err := restoreState(ctx, client, "default", "tailscale-cni-state-web-0", "uid-1", path)
+	if err != nil || !restored {
+		t.Fatalf("restoreState() = %v, %v; want true, nil", restored, err)
+	}
+	got, err := store.NewFileStore(t.Logf, path)
+	if err != nil {
+		t.Fatalf("restored state file doesn't load: %v", err)
+	}
+	for k, want := range map[ipn.StateKey]string{ipn.MachineKeyStateKey: "machine-key", ipn.CurrentProfileStateKey: "profile"} {
+		if v, err := got.ReadState(k); err != nil || string(v) != want {
+			t.Errorf("restored ReadState(%q) = %q, %v; want %q", k, v, err, want)
+		}
+	}
+
+	restored, err = restoreState(ctx, client, "default", "tailscale-cni-state-web-1", "uid-1", filepath.Join(dir, "missing.state"))
+	if err != nil || restored {
+		t.Errorf("restoreState() without a backup = %v, %v; want false, nil", restored, err)
+	}
+
+	// A later pod of the same name doesn't get the first one's backup
+	restored, err = restoreState(ctx, client, "default", "tailscale-cni-state-web-0", "uid-2", filepath.Join(dir, "other.state"))
+	if err != nil || restored {
+		t.Errorf("restoreState() of another pod's backup = %v, %v; want false, nil", restored, err)
+	}
+}
+
+func TestStateSecretOwnership(t *testing.T) {
+	client, secrets := newFakeSecretAPI(t)
+	ctx := context.Background()
+	const name = "tailscale-cni-state-web-0"
+
+	old, err := newKubeSecretStore(client, "default", name, stateOwner{UID: "uid-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.WriteState(ipn.MachineKeyStateKey, []byte("machine-key")); err != nil {
+		t.Fatal(err)
+	}
+	if got := secrets["default/"+name].Metadata.Annotations[stateOwnerAnnotation]; got != "uid-1" {
+		t.Errorf("new Secret's owner = %q, want uid-1", got)
+	}
+
+	// The pod is rescheduled under the same name and takes the state over
+	prev, err := claimStateSecret(ctx, client, "default", name, stateOwner{UID: "uid-2", Keep: true})
+	if err != nil || prev != "uid-1" {
+		t.Fatalf("claimStateSecret() = %q, %v; want uid-1, nil", prev, err)
+	}
+	if got := secrets["default/"+name].Metadata.Annotations[stateKeepAnnotation]; got != "true" {
+		t.Errorf("claimed Secret's %s = %q, want true", stateKeepAnnotation, got)
+	}
+	if _, err := newKubeSecretStore(client, "default", name, stateOwner{UID: "uid-2"}); err != nil {
+		t.Errorf("newKubeSecretStore() for the new owner error = %v", err)
+	}
+
+	// The old pod can no longer open, write or delete it
+	if _, err := newKubeSecretStore(client, "default", name, stateOwner{UID: "uid-1"}); !errors.Is(err, errStateTakenOver) {
+		t.Errorf("newKubeSecretStore() for the old owner error = %v, want errStateTakenOver", err)
+	}
+	if err := old.WriteState(ipn.MachineKeyStateKey, []byte("stale")); !errors.Is(err, errStateTakenOver) {
+		t.Errorf("WriteState() by the old owner error = %v, want errStateTakenOver", err)
+	}
+	if owned, err := deleteStateSecret(ctx, client, "default", name, "uid-1"); err != nil || owned {
+		t.Errorf("deleteStateSecret() by the old owner = %v, %v; want false, nil", owned, err)
+	}
+	if got := string(secrets["default/"+name].Data[secretDataKey(ipn.MachineKeyStateKey)]); got != "machine-key" {
+		t.Errorf("state after the old owner's write and delete = %q, want machine-key", got)
+	}
+
+	if owned, err := deleteStateSecret(ctx, client, "default", name, "uid-2"); err != nil || !owned {
+		t.Errorf("deleteStateSecret() by the owner = %v, %v; want true, nil", owned, err)
+	}
+	if _, ok := secrets["default/"+name]; ok {
+		t.Errorf("deleteStateSecret() by the owner left the Secret")
+	}
+	if owned, err := deleteStateSecret(ctx, client, "default", name, "uid-2"); err != nil || !owned {
+		t.Errorf("deleteStateSecret() of a missing Secret = %v, %v; want true, nil", owned, err)
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	owned := &kubeSecret{Metadata: kubeObjectMeta{Annotations: map[string]string{stateOwnerAnnotation: "uid-1"}}}
+	if !ownedBy(owned, "uid-1") || ownedBy(owned, "uid-2") || ownedBy(owned, "") {
+		t.Errorf("ownedBy() of a Secret owned by uid-1 is wrong")
+	}
+	// Secrets from before owners were recorded are the pod's of their name
+	if !ownedBy(&kubeSecret{}, "uid-2") {
+		t.Errorf("ownedBy() of a Secret without an owner = false, want true")
+	}
+}
+
+func TestStateSecretName(t *testing.T) {
+	if got := stateSecretName("web-0"); got != "tailscale-cni-state-web-0" {
+		t.Errorf("stateSecretName(%q) = %q", "web-0", got)
+	}
+	long := stateSecretName(strings.Repeat("a", 300))
+	if len(long) > 253 {
+		t.Errorf("stateSecretName() length = %d, want <= 253", len(long))
+	}
+}
+
+func TestSecretDataKey(t *testing.T) {
+	if got := secretDataKey("profile-ab/cd"); got != "profile-ab_cd" {
+		t.Errorf("secretDataKey() = %q, want %q", got, "profile-ab_cd")
+	}
+}
@@ -0,0 +1,106 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateSweepInterval is how often RunStateSweep scans pod state.
+const stateSweepInterval = 30 * time.Minute
+
+// RunStateSweep removes pods' leftover state directories, as left by a
+// crash or a missed DEL, at once and then every stateSweepInterval until
+// ctx is done. It also keeps the state directory metrics up to date. It
+// must not start before RecoverPods has finished, and it removes nothing if
+// StateDirTTL is 0.
+func (pm *PodManager) RunStateSweep(ctx context.Context) {
+	pm.sweepState(time.Now())
+	ticker := time.NewTicker(stateSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pm.sweepState(time.Now())
+		}
+	}
+}
+
+// sweepState removes every pod state directory that is stale as of now,
+// along with the rest of what its pod left behind, and updates the state
+// directory metrics.
+func (pm *PodManager) sweepState(now time.Time) {
+	podsDir := filepath.Join(pm.stateDir, "pods")
+	entries, err := os.ReadDir(podsDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Warning: failed to read pods directory: %v", err)
+		}
+		return
+	}
+
+	var dirs, size int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		containerID := entry.Name()
+		if pm.stateDirTTL > 0 && pm.staleStateDir(containerID, now) {
+			log.Printf("Removing state of container %s, unused for over %s", containerID, pm.stateDirTTL)
+			pm.cleanupUnmanagedPod(containerID)
+			metricStateDirsRemoved.Add(1)
+			continue
+		}
+		dirs++
+		size += dirSize(filepath.Join(podsDir, containerID))
+	}
+	metricStatePodDirs.Set(dirs)
+	metricStateDirBytes.Set(size)
+}
+
+// staleStateDir reports whether a container's state directory can go: no
+// node is running or being attached for it, its pod's netns is gone, and
+// it hasn't been modified for pm.stateDirTTL. A directory whose metadata
+// can't be read only has to be old enough.
+func (pm *PodManager) staleStateDir(containerID string, now time.Time) bool {
+	pm.mu.RLock()
+	_, running := pm.servers[containerID]
+	_, attaching := pm.attaching[containerID]
+	pm.mu.RUnlock()
+	if running || attaching {
+		return false
+	}
+
+	info, err := os.Stat(filepath.Join(pm.stateDir, "pods", containerID))
+	if err != nil || now.Sub(info.ModTime()) < pm.stateDirTTL {
+		return false
+	}
+	if meta, err := pm.loadMetadata(containerID); err == nil && netnsExists(meta.NetnsPath) {
+		return false
+	}
+	return true
+}
+
+// dirSize returns the total size of the regular files under dir.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
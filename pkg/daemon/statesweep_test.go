@@ -0,0 +1,73 @@
+//go:build linux
+
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepState(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir(), StateDirTTL: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	now := time.Now()
+	old := now.Add(-2 * time.Hour)
+
+	// writePodDir creates a container's state directory, with metadata for
+	// a pod in netnsPath unless it's "", last modified at mtime.
+	writePodDir := func(containerID, netnsPath string, mtime time.Time) {
+		dir := filepath.Join(pm.stateDir, "pods", containerID)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if netnsPath != "" {
+			data, _ := json.Marshal(PodMetadata{ContainerID: containerID, NetnsPath: netnsPath})
+			if err := os.WriteFile(filepath.Join(dir, "metadata.json"), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writePodDir("gone", "/var/run/netns/gone", old)
+	writePodDir("no-metadata", "", old)
+	writePodDir("recent", "/var/run/netns/gone", now)
+	writePodDir("live-netns", "/proc/self/ns/net", old)
+	writePodDir("running", "/var/run/netns/gone", old)
+	pm.servers["running"] = &ManagedServer{ContainerID: "running"}
+
+	pm.sweepState(now)
+
+	for id, wantKept := range map[string]bool{
+		"gone":        false,
+		"no-metadata": false,
+		"recent":      true,
+		"live-netns":  true,
+		"running":     true,
+	} {
+		_, err := os.Stat(filepath.Join(pm.stateDir, "pods", id))
+		if kept := err == nil; kept != wantKept {
+			t.Errorf("state of %s kept = %v, want %v", id, kept, wantKept)
+		}
+	}
+	if got := metricStatePodDirs.Value(); got != 3 {
+		t.Errorf("tscni_state_pod_dirs = %d, want 3", got)
+	}
+	if got := metricStateDirBytes.Value(); got == 0 {
+		t.Errorf("tscni_state_dir_bytes = 0, want the size of the metadata left")
+	}
+
+	// With no TTL, nothing is removed
+	pm.stateDirTTL = 0
+	writePodDir("gone", "/var/run/netns/gone", old)
+	pm.sweepState(now)
+	if _, err := os.Stat(filepath.Join(pm.stateDir, "pods", "gone")); err != nil {
+		t.Errorf("state removed with StateDirTTL 0: %v", err)
+	}
+}
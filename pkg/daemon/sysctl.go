@@ -0,0 +1,125 @@
+//go:build linux
+
+package daemon
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ipForwardPath is the global IPv4 forwarding sysctl. Writing it also resets
+// every interface's forwarding setting, so it is only used as a fallback.
+// A variable so tests can point it elsewhere.
+var ipForwardPath = "/proc/sys/net/ipv4/ip_forward"
+
+// ipv6ForwardPath is the global IPv6 forwarding sysctl. Unlike IPv4, IPv6
+// has no per-interface forwarding switch that enables forwarding, so the
+// daemon doesn't set it; see warnIPv6Forwarding.
+var ipv6ForwardPath = "/proc/sys/net/ipv6/conf/all/forwarding"
+
+// ifaceSysctlPath returns the path of a per-interface IPv4 sysctl.
+func ifaceSysctlPath(ifName, key string) string {
+	return fmt.Sprintf("/proc/sys/net/ipv4/conf/%s/%s", ifName, key)
+}
+
+func readSysctl(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writeSysctl(path, value string) error {
+	return os.WriteFile(path, []byte(value), 0644)
+}
+
+// enableProxyARP makes the host veth answer ARP for Tailscale IPs.
+// The setting goes away with the interface.
+func (pm *PodManager) enableProxyARP(hostVethName string) {
+	if !pm.manageProxyARP {
+		return
+	}
+	if err := writeSysctl(ifaceSysctlPath(hostVethName, "proxy_arp"), "1"); err != nil {
+		log.Printf("Warning: failed to enable proxy ARP: %v", err)
+	}
+}
+
+// enableForwarding turns on IPv4 forwarding for packets arriving on each of
+// ifNames. Per-interface settings go away with the interfaces; only if they
+// can't be set is the global sysctl changed.
+func (pm *PodManager) enableForwarding(ifNames ...string) {
+	if !pm.manageIPForward {
+		return
+	}
+	for _, ifName := range ifNames {
+		if err := writeSysctl(ifaceSysctlPath(ifName, "forwarding"), "1"); err != nil {
+			log.Printf("Warning: failed to enable forwarding on %s, enabling it globally: %v", ifName, err)
+			pm.enableGlobalForwarding()
+			return
+		}
+	}
+}
+
+// enableGlobalForwarding sets ip_forward, remembering the previous value if
+// it was off so restoreGlobalForwarding can put it back.
+func (pm *PodManager) enableGlobalForwarding() {
+	pm.sysctlMu.Lock()
+	defer pm.sysctlMu.Unlock()
+
+	if pm.ipForwardPrev != "" {
+		return // already ours
+	}
+	prev, err := readSysctl(ipForwardPath)
+	if err != nil {
+		log.Printf("Warning: failed to read IP forwarding: %v", err)
+		return
+	}
+	if prev == "1" {
+		return // someone else turned it on
+	}
+	if err := writeSysctl(ipForwardPath, "1"); err != nil {
+		log.Printf("Warning: failed to enable IP forwarding: %v", err)
+		return
+	}
+	pm.ipForwardPrev = prev
+}
+
+// restoreGlobalForwarding restores ip_forward once no managed pods remain,
+// if this daemon was the one that turned it on.
+func (pm *PodManager) restoreGlobalForwarding(remainingPods int) {
+	pm.sysctlMu.Lock()
+	defer pm.sysctlMu.Unlock()
+
+	if pm.ipForwardPrev == "" || remainingPods > 0 {
+		return
+	}
+	if err := writeSysctl(ipForwardPath, pm.ipForwardPrev); err != nil {
+		log.Printf("Warning: failed to restore IP forwarding: %v", err)
+		return
+	}
+	log.Printf("Restored IP forwarding to %s", pm.ipForwardPrev)
+	pm.ipForwardPrev = ""
+}
+
+var ipv6ForwardWarning sync.Once
+
+// warnIPv6Forwarding logs once if IPv6 forwarding is off on the node, which
+// leaves pods' IPv6 Tailscale traffic with nowhere to go. Turning it on
+// globally also stops the node accepting router advertisements, so that is
+// left to the node's configuration.
+func warnIPv6Forwarding() {
+	ipv6ForwardWarning.Do(func() {
+		v, err := readSysctl(ipv6ForwardPath)
+		if err != nil {
+			log.Printf("Warning: failed to read IPv6 forwarding: %v", err)
+			return
+		}
+		if v != "1" {
+			log.Printf("Warning: IPv6 forwarding is off (%s); pods' IPv6 Tailscale traffic will be dropped until it is enabled", ipv6ForwardPath)
+		}
+	})
+}
@@ -0,0 +1,61 @@
+//go:build linux
+
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobalForwarding_RestoredWhenLastPodGone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip_forward")
+	if err := os.WriteFile(path, []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := ipForwardPath
+	ipForwardPath = path
+	t.Cleanup(func() { ipForwardPath = oldPath })
+
+	read := func() string {
+		v, err := readSysctl(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	pm := &PodManager{manageIPForward: true}
+	pm.enableGlobalForwarding()
+	if got := read(); got != "1" {
+		t.Fatalf("ip_forward after enable = %q, want 1", got)
+	}
+
+	pm.restoreGlobalForwarding(1)
+	if got := read(); got != "1" {
+		t.Errorf("ip_forward with pods remaining = %q, want 1", got)
+	}
+
+	pm.restoreGlobalForwarding(0)
+	if got := read(); got != "0" {
+		t.Errorf("ip_forward after last pod = %q, want 0", got)
+	}
+}
+
+func TestGlobalForwarding_LeavesOthersSettingAlone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip_forward")
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldPath := ipForwardPath
+	ipForwardPath = path
+	t.Cleanup(func() { ipForwardPath = oldPath })
+
+	pm := &PodManager{manageIPForward: true}
+	pm.enableGlobalForwarding()
+	pm.restoreGlobalForwarding(0)
+
+	if got, _ := readSysctl(path); got != "1" {
+		t.Errorf("ip_forward = %q, want it left at 1", got)
+	}
+}
@@ -0,0 +1,49 @@
+package daemon
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"tailscale.com/tka"
+	"tailscale.com/types/key"
+)
+
+// LoadTailnetLockKey reads a tailnet lock private key ("nlpriv:...") from a
+// file. Its public key must be trusted by the tailnet's lock
+// (tailscale lock add tlpub:...) for the nodes it signs to be accepted.
+func LoadTailnetLockKey(path string) (key.NLPrivate, error) {
+	var k key.NLPrivate
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return k, fmt.Errorf("reading tailnet lock key: %w", err)
+	}
+	if err := k.UnmarshalText([]byte(strings.TrimSpace(string(data)))); err != nil {
+		return k, fmt.Errorf("parsing tailnet lock key: %w", err)
+	}
+	return k, nil
+}
+
+// wrapAuthKey adds a tailnet lock credential to an auth key, the same way
+// "tailscale lock sign <auth-key>" does. The credential lets the node that
+// registers with the key sign its own node key, so it is accepted by a
+// locked tailnet without a separate signing step.
+func wrapAuthKey(authKey string, signer key.NLPrivate) (string, error) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", err
+	}
+	sig := tka.NodeKeySignature{
+		SigKind:        tka.SigCredential,
+		KeyID:          signer.KeyID(),
+		WrappingPubkey: pub,
+	}
+	sig.Signature, err = signer.SignNKS(sig.SigHash())
+	if err != nil {
+		return "", fmt.Errorf("signing credential: %w", err)
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s--TL%s-%s", authKey, enc.EncodeToString(sig.Serialize()), enc.EncodeToString(priv)), nil
+}
@@ -0,0 +1,167 @@
+//go:build linux
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/tailscale/wireguard-go/tun"
+	"github.com/vishvananda/netlink"
+	"tailscale.com/net/tstun"
+	"tailscale.com/types/logger"
+)
+
+// getPodNS opens a pod's netns, returning errNetnsGone if it doesn't exist.
+func getPodNS(netnsPath string) (ns.NetNS, error) {
+	podNS, err := ns.GetNS(netnsPath)
+	if err != nil {
+		var notExist ns.NSPathNotExistErr
+		if errors.As(err, &notExist) {
+			return nil, fmt.Errorf("%w: %s", errNetnsGone, netnsPath)
+		}
+		return nil, fmt.Errorf("getting netns: %w", err)
+	}
+	return podNS, nil
+}
+
+// moveTUNToPod moves a pod's TUN from the host into its netns, where it is
+// renamed podIfName and becomes the pod's Tailscale interface, in place of
+// a veth bridge (-tun-in-pod). The daemon's file descriptor for the TUN
+// keeps working across the move, so packets go between the pod and the
+// node's engine without touching the host's routing or sysctls.
+func moveTUNToPod(netnsPath, tunName, podIfName string, ipv4, ipv6 netip.Addr, routes []netip.Prefix) error {
+	podNS, err := getPodNS(netnsPath)
+	if err != nil {
+		return err
+	}
+	defer podNS.Close()
+
+	link, err := netlink.LinkByName(tunName)
+	if err != nil {
+		return fmt.Errorf("getting TUN %s: %w", tunName, err)
+	}
+	if err := netlink.LinkSetNsFd(link, int(podNS.Fd())); err != nil {
+		return fmt.Errorf("moving TUN %s into pod: %w", tunName, err)
+	}
+
+	err = podNS.Do(func(ns.NetNS) error {
+		// Moving the TUN took it down, so it can be renamed
+		link, err := linkByName(tunName)
+		if err != nil {
+			return fmt.Errorf("getting TUN %s in pod: %w", tunName, err)
+		}
+		if err := removeStaleLink(podIfName); err != nil {
+			return err
+		}
+		if err := netlink.LinkSetName(link, podIfName); err != nil {
+			return fmt.Errorf("renaming TUN %s to %s: %w", tunName, podIfName, err)
+		}
+		if err := checkRouteConflicts(link.Attrs().Index, routes); err != nil {
+			return err
+		}
+		return configurePodTUN(link, ipv4, ipv6, routes)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Moved TUN %s into pod as %s", tunName, podIfName)
+	return nil
+}
+
+// reopenPodTUN reopens a TUN left in a pod's netns by the previous daemon
+// (Preserve), keeping its addresses and routes. It returns nil if the pod
+// has no such TUN, as when the daemon exited without preserving it.
+func reopenPodTUN(logf logger.Logf, netnsPath, podIfName string) (tun.Device, error) {
+	podNS, err := getPodNS(netnsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer podNS.Close()
+
+	var dev tun.Device
+	err = podNS.Do(func(ns.NetNS) error {
+		link, err := netlink.LinkByName(podIfName)
+		if err != nil {
+			return nil
+		}
+		if _, ok := link.(*netlink.Tuntap); !ok {
+			return fmt.Errorf("pod interface %s is a %s, not a TUN", podIfName, link.Type())
+		}
+		// TUNSETIFF attaches to an existing TUN in the calling thread's netns
+		dev, _, err = tstun.New(logf, podIfName)
+		if err != nil {
+			return fmt.Errorf("reopening TUN %s: %w", podIfName, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dev != nil {
+		if err := setTUNPersist(dev, false); err != nil {
+			log.Printf("Warning: failed to clear persistence on TUN %s: %v", podIfName, err)
+		}
+		log.Printf("Reattached to preserved TUN %s in pod netns %s", podIfName, netnsPath)
+	}
+	return dev, nil
+}
+
+// movePodTUN moves a -tun-in-pod pod's TUN into netnsPath, for a pod whose
+// netns was replaced under the same container ID. The TUN is deleted with
+// the old netns, so this only works while that still exists; otherwise the
+// pod needs tailscale-cni-ctl reattach. It is called without pm.mu held,
+// with the container marked as attaching; pm.mu is only taken to update srv.
+func (pm *PodManager) movePodTUN(srv *ManagedServer, netnsPath string) error {
+	log.Printf("Pod %s/%s netns changed: %s -> %s, moving TUN", srv.Namespace, srv.PodName, srv.NetnsPath, netnsPath)
+
+	oldNS, err := getPodNS(srv.NetnsPath)
+	if err != nil {
+		return fmt.Errorf("pod's TUN went with its old netns, reattach the pod: %w", err)
+	}
+	defer oldNS.Close()
+
+	// Back to the host under its own name, then into the new netns as if new
+	tunName := tunNameForContainer(srv.ContainerID)
+	err = oldNS.Do(func(hostNS ns.NetNS) error {
+		link, err := netlink.LinkByName(srv.PodIfName)
+		if err != nil {
+			return fmt.Errorf("getting TUN %s: %w", srv.PodIfName, err)
+		}
+		if err := netlink.LinkSetDown(link); err != nil {
+			return fmt.Errorf("bringing down TUN %s: %w", srv.PodIfName, err)
+		}
+		if err := netlink.LinkSetName(link, tunName); err != nil {
+			return fmt.Errorf("renaming TUN %s: %w", srv.PodIfName, err)
+		}
+		return netlink.LinkSetNsFd(link, int(hostNS.Fd()))
+	})
+	if err != nil {
+		return fmt.Errorf("moving TUN out of old netns: %w", err)
+	}
+
+	if err := moveTUNToPod(netnsPath, tunName, srv.PodIfName, srv.TailscaleIPv4, srv.TailscaleIPv6, srv.Routes); err != nil {
+		return err
+	}
+	var primaryRoutes []PrimaryRoute
+	if srv.FullTunnel {
+		// The new netns has its own primary routes
+		primaryRoutes, err = setupFullTunnel(netnsPath, srv.PodIfName, "", tunName, 0, srv.TailscaleIPv4, srv.TailscaleIPv6, srv.RoutingMode)
+	}
+	pm.mu.Lock()
+	srv.NetnsPath = netnsPath
+	srv.PrimaryRoutes = primaryRoutes
+	pm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := pm.saveMetadata(srv.ContainerID, srv, netnsPath); err != nil {
+		log.Printf("Warning: failed to save metadata for %s: %v", srv.ContainerID, err)
+	}
+	return nil
+}
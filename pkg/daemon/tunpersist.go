@@ -0,0 +1,39 @@
+//go:build linux
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tailscale/wireguard-go/tun"
+	"golang.org/x/sys/unix"
+)
+
+// setTUNPersist sets or clears a TUN device's persist flag. A persistent TUN,
+// with its addresses and routes, stays in the kernel after the last file
+// descriptor for it is closed, and can be reopened by name.
+func setTUNPersist(dev tun.Device, persist bool) error {
+	f, ok := dev.(interface{ File() *os.File })
+	if !ok {
+		return fmt.Errorf("TUN device %T has no file descriptor", dev)
+	}
+	rc, err := f.File().SyscallConn()
+	if err != nil {
+		return err
+	}
+	v := 0
+	if persist {
+		v = 1
+	}
+	var ioctlErr error
+	if err := rc.Control(func(fd uintptr) {
+		ioctlErr = unix.IoctlSetInt(int(fd), unix.TUNSETPERSIST, v)
+	}); err != nil {
+		return err
+	}
+	if ioctlErr != nil {
+		return fmt.Errorf("TUNSETPERSIST: %w", ioctlErr)
+	}
+	return nil
+}
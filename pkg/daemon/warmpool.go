@@ -0,0 +1,269 @@
+//go:build linux
+
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"tailscale.com/ipn"
+	"tailscale.com/types/logger"
+)
+
+// warmPoolRetryDelay is how long RunWarmPool waits after failing to create
+// a node before trying again.
+const warmPoolRetryDelay = 30 * time.Second
+
+// warmPoolNamespace stands in for a pod's namespace in a warm pool node's
+// auth key description and in auth key failure metrics.
+const warmPoolNamespace = "warm-pool"
+
+// warmPool holds nodes that are logged in ahead of the pods that will take
+// them (see PodManagerConfig.WarmPoolSize).
+type warmPool struct {
+	size   int
+	refill chan struct{} // wakes RunWarmPool when a node is taken
+
+	mu     sync.Mutex
+	ready  []*node // oldest first
+	closed bool
+}
+
+// needed reports whether the pool is short of nodes.
+func (p *warmPool) needed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.closed && len(p.ready) < p.size
+}
+
+// put adds a ready node to the pool. It returns false, leaving the node to
+// the caller, if the pool is closed.
+func (p *warmPool) put(n *node) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return false
+	}
+	p.ready = append(p.ready, n)
+	metricWarmPoolReady.Set(int64(len(p.ready)))
+	return true
+}
+
+// take removes the oldest node from the pool and asks for another, or
+// returns nil if the pool is empty.
+func (p *warmPool) take() *node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.ready) == 0 {
+		return nil
+	}
+	n := p.ready[0]
+	p.ready = p.ready[1:]
+	metricWarmPoolReady.Set(int64(len(p.ready)))
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+	return n
+}
+
+// close empties the pool for good and returns the nodes it held.
+func (p *warmPool) close() []*node {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	nodes := p.ready
+	p.ready = nil
+	metricWarmPoolReady.Set(0)
+	return nodes
+}
+
+// RunWarmPool keeps the warm pool full until ctx is done, creating one node
+// at a time so that it doesn't crowd pods out of auth keys. It does nothing
+// if the pool is disabled.
+func (pm *PodManager) RunWarmPool(ctx context.Context) {
+	if pm.pool.size == 0 {
+		return
+	}
+	for {
+		for pm.pool.needed() {
+			n, err := pm.newPoolNode(ctx)
+			if err != nil {
+				log.Printf("Warning: failed to create warm pool node: %v", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(warmPoolRetryDelay):
+				}
+				continue
+			}
+			if !pm.pool.put(n) {
+				pm.dropPoolNode(n)
+				return
+			}
+			log.Printf("Warm pool node %s ready with IP %s", n.id, n.ipv4)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-pm.pool.refill:
+		}
+	}
+}
+
+// newPoolNode brings up a node for the warm pool. It has the daemon's tags
+// and routing mode, an ephemeral auth key, so that the tailnet removes it
+// if the daemon dies before deleting it, and its state in memory until a
+// pod takes it.
+func (pm *PodManager) newPoolNode(ctx context.Context) (*node, error) {
+	var randBytes [2]byte
+	if _, err := rand.Read(randBytes[:]); err != nil {
+		return nil, fmt.Errorf("generating pool node ID: %w", err)
+	}
+	id := "pool" + hex.EncodeToString(randBytes[:])
+	hostname := sanitizeHostname(fmt.Sprintf("%s-%s", pm.clusterName, id))
+
+	authKey, err := pm.newAuthKey(ctx, id, warmPoolNamespace, nil, &KeyProfile{Ephemeral: true})
+	if err != nil {
+		return nil, fmt.Errorf("creating auth key: %w", err)
+	}
+
+	varRoot := filepath.Join(pm.stateDir, "pool", id)
+	if err := os.MkdirAll(varRoot, 0700); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+
+	prefs := ipn.NewPrefs()
+	prefs.Hostname = hostname
+	prefs.WantRunning = true
+	prefs.ControlURL = ipn.DefaultControlURL
+
+	ctx, cancel := context.WithTimeout(ctx, tailscaleIPTimeout)
+	defer cancel()
+	logs := newSwapLogf(nodeLogf(hostname, pm.nodeLogLevel, pm.quietNodes))
+	st := new(poolStore)
+	n, err := pm.startNode(ctx, logs.Logf, nodeSpec{
+		id:          id,
+		varRoot:     varRoot,
+		store:       st,
+		wgPort:      pm.allocWireGuardPort(id, 0),
+		routingMode: pm.routingMode,
+		prefs:       prefs,
+		authKey:     authKey,
+		release: func(deviceID string) {
+			pm.oauthMgr.QueueDeviceDeletion(deviceID)
+		},
+	})
+	if err != nil {
+		pm.mu.Lock()
+		pm.releaseWireGuardPort(id)
+		pm.mu.Unlock()
+		os.RemoveAll(varRoot)
+		return nil, err
+	}
+	n.pool = st
+	n.poolLogf = logs
+	return n, nil
+}
+
+// takePoolNode returns a node from the warm pool for a pod, or nil if the
+// pool is empty or the pod can't use one: a pooled node has the daemon's
+// tags and routing mode, which can't be changed once it's up, an ephemeral
+// key, no netstack handling of advertised routes and only the tailnet's DNS
+// settings, and a pod that keeps its identity may have a node already. Nodes
+// that have lost their connection to control are dropped.
+func (pm *PodManager) takePoolNode(podCfg PodConfig, routingMode string) *node {
+	if pm.pool.size == 0 || len(podCfg.Tags) > 0 || podCfg.keyProfile != nil || podCfg.AdvertiseClusterIP || len(podCfg.DNSSearch) > 0 || podCfg.KeepIdentity || routingMode != pm.routingMode {
+		return nil
+	}
+	for {
+		n := pm.pool.take()
+		if n == nil {
+			metricWarmPoolMisses.Add(1)
+			return nil
+		}
+		if st := n.lb.State(); st != ipn.Running {
+			log.Printf("Warning: dropping warm pool node %s in state %s", n.id, st)
+			pm.dropPoolNode(n)
+			continue
+		}
+		metricWarmPoolHits.Add(1)
+		return n
+	}
+}
+
+// claimPoolNode makes a warm pool node a pod's: its WireGuard port moves to
+// the pod, its state to the pod's store and its logs to the pod's hostname,
+// and it takes the pod's hostname, DERP region and exit node. The node
+// sends the new hostname to control in its next map request, as for any
+// hostname change, and control renames the device to match. It returns the
+// pod's store, owner's.
+func (pm *PodManager) claimPoolNode(ctx context.Context, logf logger.Logf, n *node, containerID, hostname, namespace, podName, podStateDir string, owner stateOwner, podCfg PodConfig) (ipn.StateStore, error) {
+	pm.mu.Lock()
+	if port, ok := pm.wgPorts[n.id]; ok {
+		pm.releaseWireGuardPort(n.id)
+		pm.wgPorts[containerID] = port
+	}
+	pm.mu.Unlock()
+	n.poolLogf.swap(logf)
+
+	if err := os.MkdirAll(podStateDir, 0700); err != nil {
+		return nil, fmt.Errorf("creating state directory: %w", err)
+	}
+	if err := pm.claimState(ctx, namespace, podName, owner); err != nil {
+		return nil, fmt.Errorf("claiming state: %w", err)
+	}
+	stateStore, err := pm.openStateStore(logf, podStateDir, namespace, podName, owner)
+	if err != nil {
+		return nil, fmt.Errorf("creating state store: %w", err)
+	}
+	if err := n.pool.moveTo(stateStore); err != nil {
+		return nil, fmt.Errorf("moving state to the pod's store: %w", err)
+	}
+
+	if podCfg.DERPRegion != 0 {
+		log.Printf("Pinning pod %s/%s to DERP region %d", namespace, podName, podCfg.DERPRegion)
+		n.lb.DebugForcePreferDERP(podCfg.DERPRegion)
+	}
+	_, err = n.lb.EditPrefs(&ipn.MaskedPrefs{
+		Prefs: ipn.Prefs{
+			Hostname:   hostname,
+			ExitNodeIP: podCfg.ExitNode,
+		},
+		HostnameSet:   true,
+		ExitNodeIPSet: podCfg.ExitNode.IsValid(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("updating prefs: %w", err)
+	}
+	return stateStore, nil
+}
+
+// dropPoolNode shuts down a warm pool node no pod has taken and deletes its
+// device.
+func (pm *PodManager) dropPoolNode(n *node) {
+	n.close()
+	os.RemoveAll(n.varRoot)
+	pm.mu.Lock()
+	pm.releaseWireGuardPort(n.id)
+	pm.mu.Unlock()
+	if n.deviceID != "" && pm.oauthMgr != nil {
+		pm.oauthMgr.QueueDeviceDeletion(n.deviceID)
+	}
+}
+
+// closeWarmPool drops every node in the warm pool, and any RunWarmPool
+// creates from now on. pm.mu must not be held.
+func (pm *PodManager) closeWarmPool() {
+	for _, n := range pm.pool.close() {
+		log.Printf("Closing warm pool node %s", n.id)
+		pm.dropPoolNode(n)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package daemon
+
+import "testing"
+
+func TestWarmPool(t *testing.T) {
+	p := &warmPool{size: 2, refill: make(chan struct{}, 1)}
+	if !p.needed() {
+		t.Fatal("needed() = false for an empty pool")
+	}
+	a, b := &node{id: "poola"}, &node{id: "poolb"}
+	p.put(a)
+	p.put(b)
+	if p.needed() {
+		t.Error("needed() = true for a full pool")
+	}
+
+	if got := p.take(); got != a {
+		t.Errorf("take() = %+v, want the oldest node", got)
+	}
+	select {
+	case <-p.refill:
+	default:
+		t.Error("take() didn't ask for a refill")
+	}
+
+	if got := p.close(); len(got) != 1 || got[0] != b {
+		t.Errorf("close() = %d nodes, want the one left", len(got))
+	}
+	if p.needed() || p.put(a) || p.take() != nil {
+		t.Error("closed pool still wants, takes or gives nodes")
+	}
+}
+
+func TestTakePoolNode_Ineligible(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir(), WarmPoolSize: 1}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	pm.pool.put(&node{id: "poola"})
+
+	tests := []struct {
+		name        string
+		cfg         PodConfig
+		routingMode string
+	}{
+		{"own tags", PodConfig{Tags: []string{"tag:web"}}, RoutingModeKernel},
+		{"key profile", PodConfig{keyProfile: &KeyProfile{}}, RoutingModeKernel},
+		{"other routing mode", PodConfig{}, RoutingModeNetstack},
+	}
+	for _, tt := range tests {
+		if n := pm.takePoolNode(tt.cfg, tt.routingMode); n != nil {
+			t.Errorf("takePoolNode(%s) = %s, want nil", tt.name, n.id)
+		}
+	}
+	if len(pm.pool.ready) != 1 {
+		t.Error("takePoolNode() took a node for a pod that can't use it")
+	}
+}
@@ -0,0 +1,141 @@
+//go:build linux
+
+package daemon
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	pb "github.com/jakedgy/tailscale-cni/pkg/proto"
+)
+
+// podEventType is what happened to a pod, as reported to watchers.
+type podEventType int
+
+const (
+	podAttached  podEventType = iota + 1 // ADDed with its node up
+	podDetached                          // node removed by a DEL or drain
+	podIPChanged                         // node came back with another IP
+	podUnhealthy                         // found unhealthy after being healthy
+)
+
+// podWatchBuffer is how many events a watcher may fall behind by before it
+// is dropped.
+const podWatchBuffer = 64
+
+// podEvent is something that happened to a pod.
+type podEvent struct {
+	Type         podEventType
+	Time         time.Time
+	ContainerID  string
+	Namespace    string
+	PodName      string
+	IPv4         netip.Addr // the new IP for podIPChanged
+	PreviousIPv4 netip.Addr // set for podIPChanged
+	Message      string     // why the pod is unhealthy
+}
+
+// newPodEvent returns an event of type typ about m, happening now.
+func newPodEvent(typ podEventType, m *ManagedServer) podEvent {
+	return podEvent{
+		Type:        typ,
+		Time:        time.Now(),
+		ContainerID: m.ContainerID,
+		Namespace:   m.Namespace,
+		PodName:     m.PodName,
+		IPv4:        m.TailscaleIPv4,
+	}
+}
+
+// proto converts ev to its gRPC form.
+func (ev podEvent) proto() *pb.PodEvent {
+	p := &pb.PodEvent{
+		Time:         ev.Time.UTC().Format(time.RFC3339),
+		ContainerId:  ev.ContainerID,
+		PodNamespace: ev.Namespace,
+		PodName:      ev.PodName,
+		Message:      ev.Message,
+	}
+	switch ev.Type {
+	case podAttached:
+		p.Type = pb.PodEventType_POD_EVENT_TYPE_ATTACHED
+	case podDetached:
+		p.Type = pb.PodEventType_POD_EVENT_TYPE_DETACHED
+	case podIPChanged:
+		p.Type = pb.PodEventType_POD_EVENT_TYPE_IP_CHANGED
+	case podUnhealthy:
+		p.Type = pb.PodEventType_POD_EVENT_TYPE_UNHEALTHY
+	}
+	if ev.IPv4.IsValid() {
+		p.TailscaleIpv4 = ev.IPv4.String()
+	}
+	if ev.PreviousIPv4.IsValid() {
+		p.PreviousIpv4 = ev.PreviousIPv4.String()
+	}
+	return p
+}
+
+// podWatchers are the subscribers to pods' events. The zero value has none.
+type podWatchers struct {
+	mu   sync.Mutex
+	subs map[chan podEvent]bool
+}
+
+// WatchPods subscribes to pods' lifecycle events, which are delivered in
+// order on events until stop is called. A watcher that falls podWatchBuffer
+// events behind is dropped, closing events, so it can't hold up the pods
+// the events are about.
+func (pm *PodManager) WatchPods() (events <-chan podEvent, stop func()) {
+	ch := make(chan podEvent, podWatchBuffer)
+	w := &pm.watchers
+	w.mu.Lock()
+	if w.subs == nil {
+		w.subs = make(map[chan podEvent]bool)
+	}
+	w.subs[ch] = true
+	metricPodWatchers.Set(int64(len(w.subs)))
+	w.mu.Unlock()
+
+	stop = func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if w.subs[ch] {
+			delete(w.subs, ch)
+			close(ch)
+			metricPodWatchers.Set(int64(len(w.subs)))
+		}
+	}
+	return ch, stop
+}
+
+// publish sends ev to every watcher, dropping those that can't keep up.
+func (pm *PodManager) publish(ev podEvent) {
+	w := &pm.watchers
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.subs {
+		select {
+		case ch <- ev:
+		default:
+			delete(w.subs, ch)
+			close(ch)
+			metricPodWatchersDropped.Add(1)
+		}
+	}
+	metricPodWatchers.Set(int64(len(w.subs)))
+}
+
+// noteHealth records the result of a health check of m, publishing a
+// podUnhealthy event if it was healthy before.
+func (pm *PodManager) noteHealth(m *ManagedServer, healthy bool, message string) {
+	if healthy {
+		m.unhealthy.Store(false)
+		return
+	}
+	if !m.unhealthy.Swap(true) {
+		ev := newPodEvent(podUnhealthy, m)
+		ev.Message = message
+		pm.publish(ev)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build linux
+
+package daemon
+
+import "testing"
+
+func TestWatchPods(t *testing.T) {
+	pm, err := NewPodManager(PodManagerConfig{StateDir: t.TempDir()}, nil)
+	if err != nil {
+		t.Fatalf("NewPodManager() error = %v", err)
+	}
+	m := &ManagedServer{ContainerID: "c1", Namespace: "default", PodName: "web-0"}
+
+	fast, stopFast := pm.WatchPods()
+	defer stopFast()
+	slow, stopSlow := pm.WatchPods()
+	defer stopSlow()
+
+	// A watcher that doesn't keep up is dropped; the others still get
+	// every event
+	for range podWatchBuffer + 1 {
+		pm.publish(newPodEvent(podAttached, m))
+		if ev := <-fast; ev.ContainerID != "c1" || ev.Type != podAttached {
+			t.Fatalf("event = %+v, want c1 attached", ev)
+		}
+	}
+	for range podWatchBuffer {
+		<-slow
+	}
+	if _, ok := <-slow; ok {
+		t.Errorf("watcher that fell behind still subscribed")
+	}
+
+	// Only a change from healthy to unhealthy is published
+	pm.noteHealth(m, false, "backend state is Stopped")
+	pm.noteHealth(m, false, "backend state is Stopped")
+	pm.noteHealth(m, true, "healthy")
+	pm.noteHealth(m, false, "datapath broken: veth missing")
+	for _, want := range []string{"backend state is Stopped", "datapath broken: veth missing"} {
+		if ev := <-fast; ev.Type != podUnhealthy || ev.Message != want {
+			t.Errorf("event = %+v, want unhealthy with %q", ev, want)
+		}
+	}
+	select {
+	case ev := <-fast:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+
+	stopFast()
+	if _, ok := <-fast; ok {
+		t.Errorf("stopped watcher still open")
+	}
+	stopFast() // stopping twice is harmless
+}
@@ -21,6 +21,145 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// ErrorReason classifies why a request failed.
+type ErrorReason int32
+
+const (
+	ErrorReason_ERROR_REASON_UNSPECIFIED ErrorReason = 0
+	// The daemon couldn't authenticate to the Tailscale API.
+	ErrorReason_ERROR_REASON_AUTH_FAILED ErrorReason = 1
+	// The node didn't come up in time.
+	ErrorReason_ERROR_REASON_TIMEOUT ErrorReason = 2
+	// The pod's network namespace no longer exists.
+	ErrorReason_ERROR_REASON_NETNS_GONE ErrorReason = 3
+	// A TUN device with the pod's name already exists.
+	ErrorReason_ERROR_REASON_TUN_COLLISION ErrorReason = 4
+	// The Tailscale API rate-limited the daemon.
+	ErrorReason_ERROR_REASON_API_RATE_LIMITED ErrorReason = 5
+	// The node already has the daemon's maximum number of pods.
+	ErrorReason_ERROR_REASON_POD_LIMIT ErrorReason = 6
+	// A requested tag isn't declared in the tailnet policy.
+	ErrorReason_ERROR_REASON_TAG_NOT_PERMITTED ErrorReason = 7
+	// The node is waiting for an admin to approve it, because its auth key
+	// isn't preauthorized.
+	ErrorReason_ERROR_REASON_NEEDS_APPROVAL ErrorReason = 8
+)
+
+// Enum value maps for ErrorReason.
+var (
+	ErrorReason_name = map[int32]string{
+		0: "ERROR_REASON_UNSPECIFIED",
+		1: "ERROR_REASON_AUTH_FAILED",
+		2: "ERROR_REASON_TIMEOUT",
+		3: "ERROR_REASON_NETNS_GONE",
+		4: "ERROR_REASON_TUN_COLLISION",
+		5: "ERROR_REASON_API_RATE_LIMITED",
+		6: "ERROR_REASON_POD_LIMIT",
+		7: "ERROR_REASON_TAG_NOT_PERMITTED",
+		8: "ERROR_REASON_NEEDS_APPROVAL",
+	}
+	ErrorReason_value = map[string]int32{
+		"ERROR_REASON_UNSPECIFIED":       0,
+		"ERROR_REASON_AUTH_FAILED":       1,
+		"ERROR_REASON_TIMEOUT":           2,
+		"ERROR_REASON_NETNS_GONE":        3,
+		"ERROR_REASON_TUN_COLLISION":     4,
+		"ERROR_REASON_API_RATE_LIMITED":  5,
+		"ERROR_REASON_POD_LIMIT":         6,
+		"ERROR_REASON_TAG_NOT_PERMITTED": 7,
+		"ERROR_REASON_NEEDS_APPROVAL":    8,
+	}
+)
+
+func (x ErrorReason) Enum() *ErrorReason {
+	p := new(ErrorReason)
+	*p = x
+	return p
+}
+
+func (x ErrorReason) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorReason) Descriptor() protoreflect.EnumDescriptor {
+	return file_pkg_proto_cni_proto_enumTypes[0].Descriptor()
+}
+
+func (ErrorReason) Type() protoreflect.EnumType {
+	return &file_pkg_proto_cni_proto_enumTypes[0]
+}
+
+func (x ErrorReason) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorReason.Descriptor instead.
+func (ErrorReason) EnumDescriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{0}
+}
+
+// PodEventType is what happened to a pod.
+type PodEventType int32
+
+const (
+	PodEventType_POD_EVENT_TYPE_UNSPECIFIED PodEventType = 0
+	// The pod was ADDed and its node is up.
+	PodEventType_POD_EVENT_TYPE_ATTACHED PodEventType = 1
+	// The pod's node was removed, by a DEL or a drain.
+	PodEventType_POD_EVENT_TYPE_DETACHED PodEventType = 2
+	// The pod's node came back with a different Tailscale IP when it was
+	// recovered or reattached.
+	PodEventType_POD_EVENT_TYPE_IP_CHANGED PodEventType = 3
+	// A health check, CNI CHECK or the handshake watch, found the pod's node
+	// unhealthy after it had been healthy.
+	PodEventType_POD_EVENT_TYPE_UNHEALTHY PodEventType = 4
+)
+
+// Enum value maps for PodEventType.
+var (
+	PodEventType_name = map[int32]string{
+		0: "POD_EVENT_TYPE_UNSPECIFIED",
+		1: "POD_EVENT_TYPE_ATTACHED",
+		2: "POD_EVENT_TYPE_DETACHED",
+		3: "POD_EVENT_TYPE_IP_CHANGED",
+		4: "POD_EVENT_TYPE_UNHEALTHY",
+	}
+	PodEventType_value = map[string]int32{
+		"POD_EVENT_TYPE_UNSPECIFIED": 0,
+		"POD_EVENT_TYPE_ATTACHED":    1,
+		"POD_EVENT_TYPE_DETACHED":    2,
+		"POD_EVENT_TYPE_IP_CHANGED":  3,
+		"POD_EVENT_TYPE_UNHEALTHY":   4,
+	}
+)
+
+func (x PodEventType) Enum() *PodEventType {
+	p := new(PodEventType)
+	*p = x
+	return p
+}
+
+func (x PodEventType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (PodEventType) Descriptor() protoreflect.EnumDescriptor {
+	return file_pkg_proto_cni_proto_enumTypes[1].Descriptor()
+}
+
+func (PodEventType) Type() protoreflect.EnumType {
+	return &file_pkg_proto_cni_proto_enumTypes[1]
+}
+
+func (x PodEventType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use PodEventType.Descriptor instead.
+func (PodEventType) EnumDescriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{1}
+}
+
 type AddRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// container_id is the unique identifier for the container.
@@ -36,7 +175,17 @@ type AddRequest struct {
 	// pod_uid is the unique identifier of the pod.
 	PodUid string `protobuf:"bytes,6,opt,name=pod_uid,json=podUid,proto3" json:"pod_uid,omitempty"`
 	// cluster_ip is the pod's cluster IP (from previous CNI, e.g., flannel).
-	ClusterIp     string `protobuf:"bytes,7,opt,name=cluster_ip,json=clusterIp,proto3" json:"cluster_ip,omitempty"`
+	ClusterIp string `protobuf:"bytes,7,opt,name=cluster_ip,json=clusterIp,proto3" json:"cluster_ip,omitempty"`
+	// tailscale_routes are the CIDRs routed via the pod's Tailscale interface.
+	// If empty, the daemon routes the full Tailscale CGNAT range (100.64.0.0/10).
+	TailscaleRoutes []string `protobuf:"bytes,8,rep,name=tailscale_routes,json=tailscaleRoutes,proto3" json:"tailscale_routes,omitempty"`
+	// standalone is set when no plugin ran before this one, so Tailscale is
+	// the pod's only network. The pod interface is then named if_name
+	// rather than ts0.
+	Standalone bool `protobuf:"varint,9,opt,name=standalone,proto3" json:"standalone,omitempty"`
+	// routing_mode is "kernel" or "netstack" (see the daemon's -routing-mode
+	// flag). If empty, the daemon's default is used.
+	RoutingMode   string `protobuf:"bytes,10,opt,name=routing_mode,json=routingMode,proto3" json:"routing_mode,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -120,6 +269,27 @@ func (x *AddRequest) GetClusterIp() string {
 	return ""
 }
 
+func (x *AddRequest) GetTailscaleRoutes() []string {
+	if x != nil {
+		return x.TailscaleRoutes
+	}
+	return nil
+}
+
+func (x *AddRequest) GetStandalone() bool {
+	if x != nil {
+		return x.Standalone
+	}
+	return false
+}
+
+func (x *AddRequest) GetRoutingMode() string {
+	if x != nil {
+		return x.RoutingMode
+	}
+	return ""
+}
+
 type AddResponse struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// tailscale_ipv4 is the assigned Tailscale IPv4 address (e.g., "100.64.1.10").
@@ -128,8 +298,21 @@ type AddResponse struct {
 	TailscaleIpv6 string `protobuf:"bytes,2,opt,name=tailscale_ipv6,json=tailscaleIpv6,proto3" json:"tailscale_ipv6,omitempty"`
 	// tailscale_hostname is the hostname registered in the tailnet.
 	TailscaleHostname string `protobuf:"bytes,3,opt,name=tailscale_hostname,json=tailscaleHostname,proto3" json:"tailscale_hostname,omitempty"`
-	unknownFields     protoimpl.UnknownFields
-	sizeCache         protoimpl.SizeCache
+	// skipped is set when Tailscale is disabled for the pod's namespace, or
+	// the pod is on the host network. No interface was created and the other
+	// fields are empty.
+	Skipped bool `protobuf:"varint,4,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	// interface_name is the pod-side Tailscale interface, in the pod's netns
+	// (ts0, or the runtime's if_name in standalone mode).
+	InterfaceName string `protobuf:"bytes,5,opt,name=interface_name,json=interfaceName,proto3" json:"interface_name,omitempty"`
+	// host_interface_name is the host side of the pod's veth pair.
+	HostInterfaceName string `protobuf:"bytes,6,opt,name=host_interface_name,json=hostInterfaceName,proto3" json:"host_interface_name,omitempty"`
+	// tailscale_fqdn is the node's MagicDNS name (e.g.
+	// "prod-default-web-0.tailnet-1234.ts.net"), which is what peers
+	// connect to. It is empty if the node has none.
+	TailscaleFqdn string `protobuf:"bytes,7,opt,name=tailscale_fqdn,json=tailscaleFqdn,proto3" json:"tailscale_fqdn,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *AddResponse) Reset() {
@@ -183,6 +366,34 @@ func (x *AddResponse) GetTailscaleHostname() string {
 	return ""
 }
 
+func (x *AddResponse) GetSkipped() bool {
+	if x != nil {
+		return x.Skipped
+	}
+	return false
+}
+
+func (x *AddResponse) GetInterfaceName() string {
+	if x != nil {
+		return x.InterfaceName
+	}
+	return ""
+}
+
+func (x *AddResponse) GetHostInterfaceName() string {
+	if x != nil {
+		return x.HostInterfaceName
+	}
+	return ""
+}
+
+func (x *AddResponse) GetTailscaleFqdn() string {
+	if x != nil {
+		return x.TailscaleFqdn
+	}
+	return ""
+}
+
 type DelRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// container_id is the unique identifier for the container.
@@ -350,7 +561,17 @@ type CheckResponse struct {
 	// healthy indicates whether the pod's Tailscale connection is healthy.
 	Healthy bool `protobuf:"varint,1,opt,name=healthy,proto3" json:"healthy,omitempty"`
 	// message provides additional details about the health status.
-	Message       string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// derp_region is the node's current home DERP region ID, or 0 if unknown.
+	DerpRegion int32 `protobuf:"varint,3,opt,name=derp_region,json=derpRegion,proto3" json:"derp_region,omitempty"`
+	// handshake_age_seconds is how long ago the node last completed a
+	// WireGuard handshake with one of its recently active peers, or 0 if it
+	// has no active peer it has completed one with.
+	HandshakeAgeSeconds int64 `protobuf:"varint,4,opt,name=handshake_age_seconds,json=handshakeAgeSeconds,proto3" json:"handshake_age_seconds,omitempty"`
+	// key_expiry is when the node's key expires, in Unix seconds, or 0 if it
+	// doesn't expire. A node whose key has expired is off the tailnet until
+	// it re-authenticates.
+	KeyExpiry     int64 `protobuf:"varint,5,opt,name=key_expiry,json=keyExpiry,proto3" json:"key_expiry,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -399,42 +620,1381 @@ func (x *CheckResponse) GetMessage() string {
 	return ""
 }
 
-var File_pkg_proto_cni_proto protoreflect.FileDescriptor
+func (x *CheckResponse) GetDerpRegion() int32 {
+	if x != nil {
+		return x.DerpRegion
+	}
+	return 0
+}
 
-const file_pkg_proto_cni_proto_rawDesc = "" +
-	"\n" +
-	"\x13pkg/proto/cni.proto\x12\ftailscalecni\"\xd6\x01\n" +
-	"\n" +
-	"AddRequest\x12!\n" +
-	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
-	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
-	"\aif_name\x18\x03 \x01(\tR\x06ifName\x12\x19\n" +
-	"\bpod_name\x18\x04 \x01(\tR\apodName\x12#\n" +
-	"\rpod_namespace\x18\x05 \x01(\tR\fpodNamespace\x12\x17\n" +
-	"\apod_uid\x18\x06 \x01(\tR\x06podUid\x12\x1d\n" +
-	"\n" +
-	"cluster_ip\x18\a \x01(\tR\tclusterIp\"\x8a\x01\n" +
-	"\vAddResponse\x12%\n" +
-	"\x0etailscale_ipv4\x18\x01 \x01(\tR\rtailscaleIpv4\x12%\n" +
-	"\x0etailscale_ipv6\x18\x02 \x01(\tR\rtailscaleIpv6\x12-\n" +
-	"\x12tailscale_hostname\x18\x03 \x01(\tR\x11tailscaleHostname\"^\n" +
-	"\n" +
-	"DelRequest\x12!\n" +
-	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
-	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
-	"\aif_name\x18\x03 \x01(\tR\x06ifName\"\r\n" +
-	"\vDelResponse\"`\n" +
-	"\fCheckRequest\x12!\n" +
-	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
-	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
-	"\aif_name\x18\x03 \x01(\tR\x06ifName\"C\n" +
-	"\rCheckResponse\x12\x18\n" +
-	"\ahealthy\x18\x01 \x01(\bR\ahealthy\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\xc8\x01\n" +
+func (x *CheckResponse) GetHandshakeAgeSeconds() int64 {
+	if x != nil {
+		return x.HandshakeAgeSeconds
+	}
+	return 0
+}
+
+func (x *CheckResponse) GetKeyExpiry() int64 {
+	if x != nil {
+		return x.KeyExpiry
+	}
+	return 0
+}
+
+type GCRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// valid_container_ids are the containers the runtime still has attached
+	// to the network. Pods for any other container are removed.
+	ValidContainerIds []string `protobuf:"bytes,1,rep,name=valid_container_ids,json=validContainerIds,proto3" json:"valid_container_ids,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *GCRequest) Reset() {
+	*x = GCRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GCRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GCRequest) ProtoMessage() {}
+
+func (x *GCRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GCRequest.ProtoReflect.Descriptor instead.
+func (*GCRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GCRequest) GetValidContainerIds() []string {
+	if x != nil {
+		return x.ValidContainerIds
+	}
+	return nil
+}
+
+type GCResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// removed_container_ids are the containers whose pods were removed.
+	RemovedContainerIds []string `protobuf:"bytes,1,rep,name=removed_container_ids,json=removedContainerIds,proto3" json:"removed_container_ids,omitempty"`
+	unknownFields       protoimpl.UnknownFields
+	sizeCache           protoimpl.SizeCache
+}
+
+func (x *GCResponse) Reset() {
+	*x = GCResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GCResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GCResponse) ProtoMessage() {}
+
+func (x *GCResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GCResponse.ProtoReflect.Descriptor instead.
+func (*GCResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GCResponse) GetRemovedContainerIds() []string {
+	if x != nil {
+		return x.RemovedContainerIds
+	}
+	return nil
+}
+
+type StatusRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusRequest) Reset() {
+	*x = StatusRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusRequest) ProtoMessage() {}
+
+func (x *StatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusRequest.ProtoReflect.Descriptor instead.
+func (*StatusRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{8}
+}
+
+type StatusResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ready is set when the daemon has finished recovering pods and can reach
+	// the Tailscale API.
+	Ready bool `protobuf:"varint,1,opt,name=ready,proto3" json:"ready,omitempty"`
+	// message says why the daemon isn't ready.
+	Message       string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatusResponse) Reset() {
+	*x = StatusResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatusResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatusResponse) ProtoMessage() {}
+
+func (x *StatusResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatusResponse.ProtoReflect.Descriptor instead.
+func (*StatusResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StatusResponse) GetReady() bool {
+	if x != nil {
+		return x.Ready
+	}
+	return false
+}
+
+func (x *StatusResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type GetRecoveryReportRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecoveryReportRequest) Reset() {
+	*x = GetRecoveryReportRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecoveryReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecoveryReportRequest) ProtoMessage() {}
+
+func (x *GetRecoveryReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecoveryReportRequest.ProtoReflect.Descriptor instead.
+func (*GetRecoveryReportRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{10}
+}
+
+type GetRecoveryReportResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// started_at and finished_at bound the recovery run (RFC 3339). Both are
+	// empty if recovery hasn't finished.
+	StartedAt  string `protobuf:"bytes,1,opt,name=started_at,json=startedAt,proto3" json:"started_at,omitempty"`
+	FinishedAt string `protobuf:"bytes,2,opt,name=finished_at,json=finishedAt,proto3" json:"finished_at,omitempty"`
+	// pods has one entry per pod found on disk, by container ID.
+	Pods          []*PodRecovery `protobuf:"bytes,3,rep,name=pods,proto3" json:"pods,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecoveryReportResponse) Reset() {
+	*x = GetRecoveryReportResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecoveryReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecoveryReportResponse) ProtoMessage() {}
+
+func (x *GetRecoveryReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecoveryReportResponse.ProtoReflect.Descriptor instead.
+func (*GetRecoveryReportResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetRecoveryReportResponse) GetStartedAt() string {
+	if x != nil {
+		return x.StartedAt
+	}
+	return ""
+}
+
+func (x *GetRecoveryReportResponse) GetFinishedAt() string {
+	if x != nil {
+		return x.FinishedAt
+	}
+	return ""
+}
+
+func (x *GetRecoveryReportResponse) GetPods() []*PodRecovery {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+type ReattachRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// container_id is the container whose node is restarted.
+	ContainerId   string `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReattachRequest) Reset() {
+	*x = ReattachRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReattachRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReattachRequest) ProtoMessage() {}
+
+func (x *ReattachRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReattachRequest.ProtoReflect.Descriptor instead.
+func (*ReattachRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ReattachRequest) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+type ReattachResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// tailscale_ipv4 and tailscale_ipv6 are the node's addresses after the
+	// restart; tailscale_ipv6 is empty if it has none.
+	TailscaleIpv4 string `protobuf:"bytes,1,opt,name=tailscale_ipv4,json=tailscaleIpv4,proto3" json:"tailscale_ipv4,omitempty"`
+	TailscaleIpv6 string `protobuf:"bytes,2,opt,name=tailscale_ipv6,json=tailscaleIpv6,proto3" json:"tailscale_ipv6,omitempty"`
+	// tailscale_fqdn is the node's MagicDNS name, as in AddResponse.
+	TailscaleFqdn string `protobuf:"bytes,3,opt,name=tailscale_fqdn,json=tailscaleFqdn,proto3" json:"tailscale_fqdn,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReattachResponse) Reset() {
+	*x = ReattachResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReattachResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReattachResponse) ProtoMessage() {}
+
+func (x *ReattachResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReattachResponse.ProtoReflect.Descriptor instead.
+func (*ReattachResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ReattachResponse) GetTailscaleIpv4() string {
+	if x != nil {
+		return x.TailscaleIpv4
+	}
+	return ""
+}
+
+func (x *ReattachResponse) GetTailscaleIpv6() string {
+	if x != nil {
+		return x.TailscaleIpv6
+	}
+	return ""
+}
+
+func (x *ReattachResponse) GetTailscaleFqdn() string {
+	if x != nil {
+		return x.TailscaleFqdn
+	}
+	return ""
+}
+
+type GetRecentFailuresRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// pod_namespace limits the failures to pods in this namespace, if set.
+	PodNamespace  string `protobuf:"bytes,1,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecentFailuresRequest) Reset() {
+	*x = GetRecentFailuresRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecentFailuresRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecentFailuresRequest) ProtoMessage() {}
+
+func (x *GetRecentFailuresRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecentFailuresRequest.ProtoReflect.Descriptor instead.
+func (*GetRecentFailuresRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *GetRecentFailuresRequest) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+type GetRecentFailuresResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Failures      []*AuthKeyFailure      `protobuf:"bytes,1,rep,name=failures,proto3" json:"failures,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecentFailuresResponse) Reset() {
+	*x = GetRecentFailuresResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecentFailuresResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecentFailuresResponse) ProtoMessage() {}
+
+func (x *GetRecentFailuresResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecentFailuresResponse.ProtoReflect.Descriptor instead.
+func (*GetRecentFailuresResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *GetRecentFailuresResponse) GetFailures() []*AuthKeyFailure {
+	if x != nil {
+		return x.Failures
+	}
+	return nil
+}
+
+// AuthKeyFailure is a failed attempt to create an auth key for a pod.
+type AuthKeyFailure struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// time is when the attempt failed, in RFC 3339 format.
+	Time         string `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	PodNamespace string `protobuf:"bytes,2,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName      string `protobuf:"bytes,3,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	// reason classifies the failure, e.g. "rate_limited" or "tag_not_permitted";
+	// it is the reason label of tscni_authkey_failures_total.
+	Reason        string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Error         string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuthKeyFailure) Reset() {
+	*x = AuthKeyFailure{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthKeyFailure) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthKeyFailure) ProtoMessage() {}
+
+func (x *AuthKeyFailure) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthKeyFailure.ProtoReflect.Descriptor instead.
+func (*AuthKeyFailure) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *AuthKeyFailure) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *AuthKeyFailure) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+func (x *AuthKeyFailure) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *AuthKeyFailure) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *AuthKeyFailure) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type PruneStaleDevicesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// delete queues the stale devices for deletion. Without it they are only
+	// listed.
+	Delete bool `protobuf:"varint,1,opt,name=delete,proto3" json:"delete,omitempty"`
+	// min_offline_seconds is how long a device must have been offline to be
+	// stale. 0 means an hour.
+	MinOfflineSeconds int64 `protobuf:"varint,2,opt,name=min_offline_seconds,json=minOfflineSeconds,proto3" json:"min_offline_seconds,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *PruneStaleDevicesRequest) Reset() {
+	*x = PruneStaleDevicesRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneStaleDevicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneStaleDevicesRequest) ProtoMessage() {}
+
+func (x *PruneStaleDevicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneStaleDevicesRequest.ProtoReflect.Descriptor instead.
+func (*PruneStaleDevicesRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *PruneStaleDevicesRequest) GetDelete() bool {
+	if x != nil {
+		return x.Delete
+	}
+	return false
+}
+
+func (x *PruneStaleDevicesRequest) GetMinOfflineSeconds() int64 {
+	if x != nil {
+		return x.MinOfflineSeconds
+	}
+	return 0
+}
+
+type PruneStaleDevicesResponse struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Devices []*StaleDevice         `protobuf:"bytes,1,rep,name=devices,proto3" json:"devices,omitempty"`
+	// deleted is set if the devices were queued for deletion.
+	Deleted       bool `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PruneStaleDevicesResponse) Reset() {
+	*x = PruneStaleDevicesResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneStaleDevicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneStaleDevicesResponse) ProtoMessage() {}
+
+func (x *PruneStaleDevicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneStaleDevicesResponse.ProtoReflect.Descriptor instead.
+func (*PruneStaleDevicesResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PruneStaleDevicesResponse) GetDevices() []*StaleDevice {
+	if x != nil {
+		return x.Devices
+	}
+	return nil
+}
+
+func (x *PruneStaleDevicesResponse) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
+// StaleDevice is a tailnet device no pod holds.
+type StaleDevice struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is the device's stable node ID.
+	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Hostname string `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	// last_seen is when the device was last connected to control, in
+	// RFC 3339 format.
+	LastSeen      string `protobuf:"bytes,3,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StaleDevice) Reset() {
+	*x = StaleDevice{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StaleDevice) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StaleDevice) ProtoMessage() {}
+
+func (x *StaleDevice) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StaleDevice.ProtoReflect.Descriptor instead.
+func (*StaleDevice) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *StaleDevice) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *StaleDevice) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *StaleDevice) GetLastSeen() string {
+	if x != nil {
+		return x.LastSeen
+	}
+	return ""
+}
+
+// PodRecovery is what happened to one pod during recovery.
+type PodRecovery struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ContainerId  string                 `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	PodNamespace string                 `protobuf:"bytes,2,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName      string                 `protobuf:"bytes,3,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	// recovered is set if the pod's node is running again.
+	Recovered bool `protobuf:"varint,4,opt,name=recovered,proto3" json:"recovered,omitempty"`
+	// cleaned_up is set if the pod's resources were removed as orphaned
+	// instead, because its netns or state was gone or recovery failed.
+	CleanedUp bool `protobuf:"varint,5,opt,name=cleaned_up,json=cleanedUp,proto3" json:"cleaned_up,omitempty"`
+	// error says why the pod wasn't recovered or was cleaned up.
+	Error string `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	// previous_ipv4 is the pod's Tailscale IP before the restart; ipv4 is the
+	// one it has now, if it was recovered.
+	PreviousIpv4 string `protobuf:"bytes,7,opt,name=previous_ipv4,json=previousIpv4,proto3" json:"previous_ipv4,omitempty"`
+	Ipv4         string `protobuf:"bytes,8,opt,name=ipv4,proto3" json:"ipv4,omitempty"`
+	// failed is set if recovering the pod was attempted and failed.
+	Failed        bool `protobuf:"varint,9,opt,name=failed,proto3" json:"failed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PodRecovery) Reset() {
+	*x = PodRecovery{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PodRecovery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodRecovery) ProtoMessage() {}
+
+func (x *PodRecovery) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodRecovery.ProtoReflect.Descriptor instead.
+func (*PodRecovery) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *PodRecovery) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetRecovered() bool {
+	if x != nil {
+		return x.Recovered
+	}
+	return false
+}
+
+func (x *PodRecovery) GetCleanedUp() bool {
+	if x != nil {
+		return x.CleanedUp
+	}
+	return false
+}
+
+func (x *PodRecovery) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetPreviousIpv4() string {
+	if x != nil {
+		return x.PreviousIpv4
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetIpv4() string {
+	if x != nil {
+		return x.Ipv4
+	}
+	return ""
+}
+
+func (x *PodRecovery) GetFailed() bool {
+	if x != nil {
+		return x.Failed
+	}
+	return false
+}
+
+// ErrorDetail is attached to error statuses returned by the daemon, so the
+// CNI shim can tell retryable failures from fatal ones.
+type ErrorDetail struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// reason classifies the failure.
+	Reason ErrorReason `protobuf:"varint,1,opt,name=reason,proto3,enum=tailscalecni.ErrorReason" json:"reason,omitempty"`
+	// retryable indicates whether repeating the request may succeed.
+	Retryable     bool `protobuf:"varint,2,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ErrorDetail) Reset() {
+	*x = ErrorDetail{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ErrorDetail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorDetail) ProtoMessage() {}
+
+func (x *ErrorDetail) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ErrorDetail.ProtoReflect.Descriptor instead.
+func (*ErrorDetail) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *ErrorDetail) GetReason() ErrorReason {
+	if x != nil {
+		return x.Reason
+	}
+	return ErrorReason_ERROR_REASON_UNSPECIFIED
+}
+
+func (x *ErrorDetail) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+type DrainNodeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainNodeRequest) Reset() {
+	*x = DrainNodeRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainNodeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainNodeRequest) ProtoMessage() {}
+
+func (x *DrainNodeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainNodeRequest.ProtoReflect.Descriptor instead.
+func (*DrainNodeRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{22}
+}
+
+type DrainNodeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// pods are the pods whose nodes were removed.
+	Pods          []*DrainedPod `protobuf:"bytes,1,rep,name=pods,proto3" json:"pods,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainNodeResponse) Reset() {
+	*x = DrainNodeResponse{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainNodeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainNodeResponse) ProtoMessage() {}
+
+func (x *DrainNodeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainNodeResponse.ProtoReflect.Descriptor instead.
+func (*DrainNodeResponse) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *DrainNodeResponse) GetPods() []*DrainedPod {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+// DrainedPod is a pod DrainNode removed.
+type DrainedPod struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ContainerId   string                 `protobuf:"bytes,1,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	PodNamespace  string                 `protobuf:"bytes,2,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName       string                 `protobuf:"bytes,3,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	TailscaleIpv4 string                 `protobuf:"bytes,4,opt,name=tailscale_ipv4,json=tailscaleIpv4,proto3" json:"tailscale_ipv4,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DrainedPod) Reset() {
+	*x = DrainedPod{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DrainedPod) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DrainedPod) ProtoMessage() {}
+
+func (x *DrainedPod) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DrainedPod.ProtoReflect.Descriptor instead.
+func (*DrainedPod) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *DrainedPod) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *DrainedPod) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+func (x *DrainedPod) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *DrainedPod) GetTailscaleIpv4() string {
+	if x != nil {
+		return x.TailscaleIpv4
+	}
+	return ""
+}
+
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// pod_namespace limits the events to pods in this namespace, if set.
+	PodNamespace  string `protobuf:"bytes,1,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *WatchRequest) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+// PodEvent is something that happened to a pod.
+type PodEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Type  PodEventType           `protobuf:"varint,1,opt,name=type,proto3,enum=tailscalecni.PodEventType" json:"type,omitempty"`
+	// time is when it happened, in RFC 3339 format.
+	Time         string `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	ContainerId  string `protobuf:"bytes,3,opt,name=container_id,json=containerId,proto3" json:"container_id,omitempty"`
+	PodNamespace string `protobuf:"bytes,4,opt,name=pod_namespace,json=podNamespace,proto3" json:"pod_namespace,omitempty"`
+	PodName      string `protobuf:"bytes,5,opt,name=pod_name,json=podName,proto3" json:"pod_name,omitempty"`
+	// tailscale_ipv4 is the pod's Tailscale IP: the new one for IP_CHANGED.
+	TailscaleIpv4 string `protobuf:"bytes,6,opt,name=tailscale_ipv4,json=tailscaleIpv4,proto3" json:"tailscale_ipv4,omitempty"`
+	// previous_ipv4 is the pod's Tailscale IP before an IP_CHANGED.
+	PreviousIpv4 string `protobuf:"bytes,7,opt,name=previous_ipv4,json=previousIpv4,proto3" json:"previous_ipv4,omitempty"`
+	// message says why the pod is UNHEALTHY.
+	Message       string `protobuf:"bytes,8,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PodEvent) Reset() {
+	*x = PodEvent{}
+	mi := &file_pkg_proto_cni_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PodEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodEvent) ProtoMessage() {}
+
+func (x *PodEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_pkg_proto_cni_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodEvent.ProtoReflect.Descriptor instead.
+func (*PodEvent) Descriptor() ([]byte, []int) {
+	return file_pkg_proto_cni_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *PodEvent) GetType() PodEventType {
+	if x != nil {
+		return x.Type
+	}
+	return PodEventType_POD_EVENT_TYPE_UNSPECIFIED
+}
+
+func (x *PodEvent) GetTime() string {
+	if x != nil {
+		return x.Time
+	}
+	return ""
+}
+
+func (x *PodEvent) GetContainerId() string {
+	if x != nil {
+		return x.ContainerId
+	}
+	return ""
+}
+
+func (x *PodEvent) GetPodNamespace() string {
+	if x != nil {
+		return x.PodNamespace
+	}
+	return ""
+}
+
+func (x *PodEvent) GetPodName() string {
+	if x != nil {
+		return x.PodName
+	}
+	return ""
+}
+
+func (x *PodEvent) GetTailscaleIpv4() string {
+	if x != nil {
+		return x.TailscaleIpv4
+	}
+	return ""
+}
+
+func (x *PodEvent) GetPreviousIpv4() string {
+	if x != nil {
+		return x.PreviousIpv4
+	}
+	return ""
+}
+
+func (x *PodEvent) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_pkg_proto_cni_proto protoreflect.FileDescriptor
+
+const file_pkg_proto_cni_proto_rawDesc = "" +
+	"\n" +
+	"\x13pkg/proto/cni.proto\x12\ftailscalecni\"\xc4\x02\n" +
+	"\n" +
+	"AddRequest\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
+	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
+	"\aif_name\x18\x03 \x01(\tR\x06ifName\x12\x19\n" +
+	"\bpod_name\x18\x04 \x01(\tR\apodName\x12#\n" +
+	"\rpod_namespace\x18\x05 \x01(\tR\fpodNamespace\x12\x17\n" +
+	"\apod_uid\x18\x06 \x01(\tR\x06podUid\x12\x1d\n" +
+	"\n" +
+	"cluster_ip\x18\a \x01(\tR\tclusterIp\x12)\n" +
+	"\x10tailscale_routes\x18\b \x03(\tR\x0ftailscaleRoutes\x12\x1e\n" +
+	"\n" +
+	"standalone\x18\t \x01(\bR\n" +
+	"standalone\x12!\n" +
+	"\frouting_mode\x18\n" +
+	" \x01(\tR\vroutingMode\"\xa2\x02\n" +
+	"\vAddResponse\x12%\n" +
+	"\x0etailscale_ipv4\x18\x01 \x01(\tR\rtailscaleIpv4\x12%\n" +
+	"\x0etailscale_ipv6\x18\x02 \x01(\tR\rtailscaleIpv6\x12-\n" +
+	"\x12tailscale_hostname\x18\x03 \x01(\tR\x11tailscaleHostname\x12\x18\n" +
+	"\askipped\x18\x04 \x01(\bR\askipped\x12%\n" +
+	"\x0einterface_name\x18\x05 \x01(\tR\rinterfaceName\x12.\n" +
+	"\x13host_interface_name\x18\x06 \x01(\tR\x11hostInterfaceName\x12%\n" +
+	"\x0etailscale_fqdn\x18\a \x01(\tR\rtailscaleFqdn\"^\n" +
+	"\n" +
+	"DelRequest\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
+	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
+	"\aif_name\x18\x03 \x01(\tR\x06ifName\"\r\n" +
+	"\vDelResponse\"`\n" +
+	"\fCheckRequest\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12\x14\n" +
+	"\x05netns\x18\x02 \x01(\tR\x05netns\x12\x17\n" +
+	"\aif_name\x18\x03 \x01(\tR\x06ifName\"\xb7\x01\n" +
+	"\rCheckResponse\x12\x18\n" +
+	"\ahealthy\x18\x01 \x01(\bR\ahealthy\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1f\n" +
+	"\vderp_region\x18\x03 \x01(\x05R\n" +
+	"derpRegion\x122\n" +
+	"\x15handshake_age_seconds\x18\x04 \x01(\x03R\x13handshakeAgeSeconds\x12\x1d\n" +
+	"\n" +
+	"key_expiry\x18\x05 \x01(\x03R\tkeyExpiry\";\n" +
+	"\tGCRequest\x12.\n" +
+	"\x13valid_container_ids\x18\x01 \x03(\tR\x11validContainerIds\"@\n" +
+	"\n" +
+	"GCResponse\x122\n" +
+	"\x15removed_container_ids\x18\x01 \x03(\tR\x13removedContainerIds\"\x0f\n" +
+	"\rStatusRequest\"@\n" +
+	"\x0eStatusResponse\x12\x14\n" +
+	"\x05ready\x18\x01 \x01(\bR\x05ready\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\x1a\n" +
+	"\x18GetRecoveryReportRequest\"\x8a\x01\n" +
+	"\x19GetRecoveryReportResponse\x12\x1d\n" +
+	"\n" +
+	"started_at\x18\x01 \x01(\tR\tstartedAt\x12\x1f\n" +
+	"\vfinished_at\x18\x02 \x01(\tR\n" +
+	"finishedAt\x12-\n" +
+	"\x04pods\x18\x03 \x03(\v2\x19.tailscalecni.PodRecoveryR\x04pods\"4\n" +
+	"\x0fReattachRequest\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\"\x87\x01\n" +
+	"\x10ReattachResponse\x12%\n" +
+	"\x0etailscale_ipv4\x18\x01 \x01(\tR\rtailscaleIpv4\x12%\n" +
+	"\x0etailscale_ipv6\x18\x02 \x01(\tR\rtailscaleIpv6\x12%\n" +
+	"\x0etailscale_fqdn\x18\x03 \x01(\tR\rtailscaleFqdn\"?\n" +
+	"\x18GetRecentFailuresRequest\x12#\n" +
+	"\rpod_namespace\x18\x01 \x01(\tR\fpodNamespace\"U\n" +
+	"\x19GetRecentFailuresResponse\x128\n" +
+	"\bfailures\x18\x01 \x03(\v2\x1c.tailscalecni.AuthKeyFailureR\bfailures\"\x92\x01\n" +
+	"\x0eAuthKeyFailure\x12\x12\n" +
+	"\x04time\x18\x01 \x01(\tR\x04time\x12#\n" +
+	"\rpod_namespace\x18\x02 \x01(\tR\fpodNamespace\x12\x19\n" +
+	"\bpod_name\x18\x03 \x01(\tR\apodName\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x14\n" +
+	"\x05error\x18\x05 \x01(\tR\x05error\"b\n" +
+	"\x18PruneStaleDevicesRequest\x12\x16\n" +
+	"\x06delete\x18\x01 \x01(\bR\x06delete\x12.\n" +
+	"\x13min_offline_seconds\x18\x02 \x01(\x03R\x11minOfflineSeconds\"j\n" +
+	"\x19PruneStaleDevicesResponse\x123\n" +
+	"\adevices\x18\x01 \x03(\v2\x19.tailscalecni.StaleDeviceR\adevices\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\bR\adeleted\"V\n" +
+	"\vStaleDevice\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x1b\n" +
+	"\tlast_seen\x18\x03 \x01(\tR\blastSeen\"\x94\x02\n" +
+	"\vPodRecovery\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12#\n" +
+	"\rpod_namespace\x18\x02 \x01(\tR\fpodNamespace\x12\x19\n" +
+	"\bpod_name\x18\x03 \x01(\tR\apodName\x12\x1c\n" +
+	"\trecovered\x18\x04 \x01(\bR\trecovered\x12\x1d\n" +
+	"\n" +
+	"cleaned_up\x18\x05 \x01(\bR\tcleanedUp\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12#\n" +
+	"\rprevious_ipv4\x18\a \x01(\tR\fpreviousIpv4\x12\x12\n" +
+	"\x04ipv4\x18\b \x01(\tR\x04ipv4\x12\x16\n" +
+	"\x06failed\x18\t \x01(\bR\x06failed\"^\n" +
+	"\vErrorDetail\x121\n" +
+	"\x06reason\x18\x01 \x01(\x0e2\x19.tailscalecni.ErrorReasonR\x06reason\x12\x1c\n" +
+	"\tretryable\x18\x02 \x01(\bR\tretryable\"\x12\n" +
+	"\x10DrainNodeRequest\"A\n" +
+	"\x11DrainNodeResponse\x12,\n" +
+	"\x04pods\x18\x01 \x03(\v2\x18.tailscalecni.DrainedPodR\x04pods\"\x96\x01\n" +
+	"\n" +
+	"DrainedPod\x12!\n" +
+	"\fcontainer_id\x18\x01 \x01(\tR\vcontainerId\x12#\n" +
+	"\rpod_namespace\x18\x02 \x01(\tR\fpodNamespace\x12\x19\n" +
+	"\bpod_name\x18\x03 \x01(\tR\apodName\x12%\n" +
+	"\x0etailscale_ipv4\x18\x04 \x01(\tR\rtailscaleIpv4\"3\n" +
+	"\fWatchRequest\x12#\n" +
+	"\rpod_namespace\x18\x01 \x01(\tR\fpodNamespace\"\x97\x02\n" +
+	"\bPodEvent\x12.\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x1a.tailscalecni.PodEventTypeR\x04type\x12\x12\n" +
+	"\x04time\x18\x02 \x01(\tR\x04time\x12!\n" +
+	"\fcontainer_id\x18\x03 \x01(\tR\vcontainerId\x12#\n" +
+	"\rpod_namespace\x18\x04 \x01(\tR\fpodNamespace\x12\x19\n" +
+	"\bpod_name\x18\x05 \x01(\tR\apodName\x12%\n" +
+	"\x0etailscale_ipv4\x18\x06 \x01(\tR\rtailscaleIpv4\x12#\n" +
+	"\rprevious_ipv4\x18\a \x01(\tR\fpreviousIpv4\x12\x18\n" +
+	"\amessage\x18\b \x01(\tR\amessage*\xa4\x02\n" +
+	"\vErrorReason\x12\x1c\n" +
+	"\x18ERROR_REASON_UNSPECIFIED\x10\x00\x12\x1c\n" +
+	"\x18ERROR_REASON_AUTH_FAILED\x10\x01\x12\x18\n" +
+	"\x14ERROR_REASON_TIMEOUT\x10\x02\x12\x1b\n" +
+	"\x17ERROR_REASON_NETNS_GONE\x10\x03\x12\x1e\n" +
+	"\x1aERROR_REASON_TUN_COLLISION\x10\x04\x12!\n" +
+	"\x1dERROR_REASON_API_RATE_LIMITED\x10\x05\x12\x1a\n" +
+	"\x16ERROR_REASON_POD_LIMIT\x10\x06\x12\"\n" +
+	"\x1eERROR_REASON_TAG_NOT_PERMITTED\x10\a\x12\x1f\n" +
+	"\x1bERROR_REASON_NEEDS_APPROVAL\x10\b*\xa5\x01\n" +
+	"\fPodEventType\x12\x1e\n" +
+	"\x1aPOD_EVENT_TYPE_UNSPECIFIED\x10\x00\x12\x1b\n" +
+	"\x17POD_EVENT_TYPE_ATTACHED\x10\x01\x12\x1b\n" +
+	"\x17POD_EVENT_TYPE_DETACHED\x10\x02\x12\x1d\n" +
+	"\x19POD_EVENT_TYPE_IP_CHANGED\x10\x03\x12\x1c\n" +
+	"\x18POD_EVENT_TYPE_UNHEALTHY\x10\x042\xd0\x06\n" +
 	"\fTailscaleCNI\x12:\n" +
 	"\x03Add\x12\x18.tailscalecni.AddRequest\x1a\x19.tailscalecni.AddResponse\x12:\n" +
 	"\x03Del\x12\x18.tailscalecni.DelRequest\x1a\x19.tailscalecni.DelResponse\x12@\n" +
-	"\x05Check\x12\x1a.tailscalecni.CheckRequest\x1a\x1b.tailscalecni.CheckResponseB,Z*github.com/jakedgy/tailscale-cni/pkg/protob\x06proto3"
+	"\x05Check\x12\x1a.tailscalecni.CheckRequest\x1a\x1b.tailscalecni.CheckResponse\x127\n" +
+	"\x02GC\x12\x17.tailscalecni.GCRequest\x1a\x18.tailscalecni.GCResponse\x12C\n" +
+	"\x06Status\x12\x1b.tailscalecni.StatusRequest\x1a\x1c.tailscalecni.StatusResponse\x12d\n" +
+	"\x11GetRecoveryReport\x12&.tailscalecni.GetRecoveryReportRequest\x1a'.tailscalecni.GetRecoveryReportResponse\x12I\n" +
+	"\bReattach\x12\x1d.tailscalecni.ReattachRequest\x1a\x1e.tailscalecni.ReattachResponse\x12d\n" +
+	"\x11GetRecentFailures\x12&.tailscalecni.GetRecentFailuresRequest\x1a'.tailscalecni.GetRecentFailuresResponse\x12d\n" +
+	"\x11PruneStaleDevices\x12&.tailscalecni.PruneStaleDevicesRequest\x1a'.tailscalecni.PruneStaleDevicesResponse\x12L\n" +
+	"\tDrainNode\x12\x1e.tailscalecni.DrainNodeRequest\x1a\x1f.tailscalecni.DrainNodeResponse\x12=\n" +
+	"\x05Watch\x12\x1a.tailscalecni.WatchRequest\x1a\x16.tailscalecni.PodEvent0\x01B,Z*github.com/jakedgy/tailscale-cni/pkg/protob\x06proto3"
 
 var (
 	file_pkg_proto_cni_proto_rawDescOnce sync.Once
@@ -448,27 +2008,73 @@ func file_pkg_proto_cni_proto_rawDescGZIP() []byte {
 	return file_pkg_proto_cni_proto_rawDescData
 }
 
-var file_pkg_proto_cni_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_pkg_proto_cni_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_pkg_proto_cni_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
 var file_pkg_proto_cni_proto_goTypes = []any{
-	(*AddRequest)(nil),    // 0: tailscalecni.AddRequest
-	(*AddResponse)(nil),   // 1: tailscalecni.AddResponse
-	(*DelRequest)(nil),    // 2: tailscalecni.DelRequest
-	(*DelResponse)(nil),   // 3: tailscalecni.DelResponse
-	(*CheckRequest)(nil),  // 4: tailscalecni.CheckRequest
-	(*CheckResponse)(nil), // 5: tailscalecni.CheckResponse
+	(ErrorReason)(0),                  // 0: tailscalecni.ErrorReason
+	(PodEventType)(0),                 // 1: tailscalecni.PodEventType
+	(*AddRequest)(nil),                // 2: tailscalecni.AddRequest
+	(*AddResponse)(nil),               // 3: tailscalecni.AddResponse
+	(*DelRequest)(nil),                // 4: tailscalecni.DelRequest
+	(*DelResponse)(nil),               // 5: tailscalecni.DelResponse
+	(*CheckRequest)(nil),              // 6: tailscalecni.CheckRequest
+	(*CheckResponse)(nil),             // 7: tailscalecni.CheckResponse
+	(*GCRequest)(nil),                 // 8: tailscalecni.GCRequest
+	(*GCResponse)(nil),                // 9: tailscalecni.GCResponse
+	(*StatusRequest)(nil),             // 10: tailscalecni.StatusRequest
+	(*StatusResponse)(nil),            // 11: tailscalecni.StatusResponse
+	(*GetRecoveryReportRequest)(nil),  // 12: tailscalecni.GetRecoveryReportRequest
+	(*GetRecoveryReportResponse)(nil), // 13: tailscalecni.GetRecoveryReportResponse
+	(*ReattachRequest)(nil),           // 14: tailscalecni.ReattachRequest
+	(*ReattachResponse)(nil),          // 15: tailscalecni.ReattachResponse
+	(*GetRecentFailuresRequest)(nil),  // 16: tailscalecni.GetRecentFailuresRequest
+	(*GetRecentFailuresResponse)(nil), // 17: tailscalecni.GetRecentFailuresResponse
+	(*AuthKeyFailure)(nil),            // 18: tailscalecni.AuthKeyFailure
+	(*PruneStaleDevicesRequest)(nil),  // 19: tailscalecni.PruneStaleDevicesRequest
+	(*PruneStaleDevicesResponse)(nil), // 20: tailscalecni.PruneStaleDevicesResponse
+	(*StaleDevice)(nil),               // 21: tailscalecni.StaleDevice
+	(*PodRecovery)(nil),               // 22: tailscalecni.PodRecovery
+	(*ErrorDetail)(nil),               // 23: tailscalecni.ErrorDetail
+	(*DrainNodeRequest)(nil),          // 24: tailscalecni.DrainNodeRequest
+	(*DrainNodeResponse)(nil),         // 25: tailscalecni.DrainNodeResponse
+	(*DrainedPod)(nil),                // 26: tailscalecni.DrainedPod
+	(*WatchRequest)(nil),              // 27: tailscalecni.WatchRequest
+	(*PodEvent)(nil),                  // 28: tailscalecni.PodEvent
 }
 var file_pkg_proto_cni_proto_depIdxs = []int32{
-	0, // 0: tailscalecni.TailscaleCNI.Add:input_type -> tailscalecni.AddRequest
-	2, // 1: tailscalecni.TailscaleCNI.Del:input_type -> tailscalecni.DelRequest
-	4, // 2: tailscalecni.TailscaleCNI.Check:input_type -> tailscalecni.CheckRequest
-	1, // 3: tailscalecni.TailscaleCNI.Add:output_type -> tailscalecni.AddResponse
-	3, // 4: tailscalecni.TailscaleCNI.Del:output_type -> tailscalecni.DelResponse
-	5, // 5: tailscalecni.TailscaleCNI.Check:output_type -> tailscalecni.CheckResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	22, // 0: tailscalecni.GetRecoveryReportResponse.pods:type_name -> tailscalecni.PodRecovery
+	18, // 1: tailscalecni.GetRecentFailuresResponse.failures:type_name -> tailscalecni.AuthKeyFailure
+	21, // 2: tailscalecni.PruneStaleDevicesResponse.devices:type_name -> tailscalecni.StaleDevice
+	0,  // 3: tailscalecni.ErrorDetail.reason:type_name -> tailscalecni.ErrorReason
+	26, // 4: tailscalecni.DrainNodeResponse.pods:type_name -> tailscalecni.DrainedPod
+	1,  // 5: tailscalecni.PodEvent.type:type_name -> tailscalecni.PodEventType
+	2,  // 6: tailscalecni.TailscaleCNI.Add:input_type -> tailscalecni.AddRequest
+	4,  // 7: tailscalecni.TailscaleCNI.Del:input_type -> tailscalecni.DelRequest
+	6,  // 8: tailscalecni.TailscaleCNI.Check:input_type -> tailscalecni.CheckRequest
+	8,  // 9: tailscalecni.TailscaleCNI.GC:input_type -> tailscalecni.GCRequest
+	10, // 10: tailscalecni.TailscaleCNI.Status:input_type -> tailscalecni.StatusRequest
+	12, // 11: tailscalecni.TailscaleCNI.GetRecoveryReport:input_type -> tailscalecni.GetRecoveryReportRequest
+	14, // 12: tailscalecni.TailscaleCNI.Reattach:input_type -> tailscalecni.ReattachRequest
+	16, // 13: tailscalecni.TailscaleCNI.GetRecentFailures:input_type -> tailscalecni.GetRecentFailuresRequest
+	19, // 14: tailscalecni.TailscaleCNI.PruneStaleDevices:input_type -> tailscalecni.PruneStaleDevicesRequest
+	24, // 15: tailscalecni.TailscaleCNI.DrainNode:input_type -> tailscalecni.DrainNodeRequest
+	27, // 16: tailscalecni.TailscaleCNI.Watch:input_type -> tailscalecni.WatchRequest
+	3,  // 17: tailscalecni.TailscaleCNI.Add:output_type -> tailscalecni.AddResponse
+	5,  // 18: tailscalecni.TailscaleCNI.Del:output_type -> tailscalecni.DelResponse
+	7,  // 19: tailscalecni.TailscaleCNI.Check:output_type -> tailscalecni.CheckResponse
+	9,  // 20: tailscalecni.TailscaleCNI.GC:output_type -> tailscalecni.GCResponse
+	11, // 21: tailscalecni.TailscaleCNI.Status:output_type -> tailscalecni.StatusResponse
+	13, // 22: tailscalecni.TailscaleCNI.GetRecoveryReport:output_type -> tailscalecni.GetRecoveryReportResponse
+	15, // 23: tailscalecni.TailscaleCNI.Reattach:output_type -> tailscalecni.ReattachResponse
+	17, // 24: tailscalecni.TailscaleCNI.GetRecentFailures:output_type -> tailscalecni.GetRecentFailuresResponse
+	20, // 25: tailscalecni.TailscaleCNI.PruneStaleDevices:output_type -> tailscalecni.PruneStaleDevicesResponse
+	25, // 26: tailscalecni.TailscaleCNI.DrainNode:output_type -> tailscalecni.DrainNodeResponse
+	28, // 27: tailscalecni.TailscaleCNI.Watch:output_type -> tailscalecni.PodEvent
+	17, // [17:28] is the sub-list for method output_type
+	6,  // [6:17] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_pkg_proto_cni_proto_init() }
@@ -481,13 +2087,14 @@ func file_pkg_proto_cni_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pkg_proto_cni_proto_rawDesc), len(file_pkg_proto_cni_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   6,
+			NumEnums:      2,
+			NumMessages:   27,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_pkg_proto_cni_proto_goTypes,
 		DependencyIndexes: file_pkg_proto_cni_proto_depIdxs,
+		EnumInfos:         file_pkg_proto_cni_proto_enumTypes,
 		MessageInfos:      file_pkg_proto_cni_proto_msgTypes,
 	}.Build()
 	File_pkg_proto_cni_proto = out.File
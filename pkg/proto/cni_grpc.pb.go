@@ -19,9 +19,17 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TailscaleCNI_Add_FullMethodName   = "/tailscalecni.TailscaleCNI/Add"
-	TailscaleCNI_Del_FullMethodName   = "/tailscalecni.TailscaleCNI/Del"
-	TailscaleCNI_Check_FullMethodName = "/tailscalecni.TailscaleCNI/Check"
+	TailscaleCNI_Add_FullMethodName               = "/tailscalecni.TailscaleCNI/Add"
+	TailscaleCNI_Del_FullMethodName               = "/tailscalecni.TailscaleCNI/Del"
+	TailscaleCNI_Check_FullMethodName             = "/tailscalecni.TailscaleCNI/Check"
+	TailscaleCNI_GC_FullMethodName                = "/tailscalecni.TailscaleCNI/GC"
+	TailscaleCNI_Status_FullMethodName            = "/tailscalecni.TailscaleCNI/Status"
+	TailscaleCNI_GetRecoveryReport_FullMethodName = "/tailscalecni.TailscaleCNI/GetRecoveryReport"
+	TailscaleCNI_Reattach_FullMethodName          = "/tailscalecni.TailscaleCNI/Reattach"
+	TailscaleCNI_GetRecentFailures_FullMethodName = "/tailscalecni.TailscaleCNI/GetRecentFailures"
+	TailscaleCNI_PruneStaleDevices_FullMethodName = "/tailscalecni.TailscaleCNI/PruneStaleDevices"
+	TailscaleCNI_DrainNode_FullMethodName         = "/tailscalecni.TailscaleCNI/DrainNode"
+	TailscaleCNI_Watch_FullMethodName             = "/tailscalecni.TailscaleCNI/Watch"
 )
 
 // TailscaleCNIClient is the client API for TailscaleCNI service.
@@ -36,6 +44,31 @@ type TailscaleCNIClient interface {
 	Del(ctx context.Context, in *DelRequest, opts ...grpc.CallOption) (*DelResponse, error)
 	// Check is called to verify the pod's network is healthy.
 	Check(ctx context.Context, in *CheckRequest, opts ...grpc.CallOption) (*CheckResponse, error)
+	// GC is called with the attachments the runtime still knows about, so the
+	// daemon can remove the pods it holds for any others.
+	GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResponse, error)
+	// Status reports whether the daemon is ready to add pods.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// GetRecoveryReport returns what happened to each pod the daemon found
+	// on disk when it started.
+	GetRecoveryReport(ctx context.Context, in *GetRecoveryReportRequest, opts ...grpc.CallOption) (*GetRecoveryReportResponse, error)
+	// Reattach restarts a pod's Tailscale node from its persisted state,
+	// keeping its identity, without touching the pod.
+	Reattach(ctx context.Context, in *ReattachRequest, opts ...grpc.CallOption) (*ReattachResponse, error)
+	// GetRecentFailures returns the daemon's most recent auth key creation
+	// failures, oldest first.
+	GetRecentFailures(ctx context.Context, in *GetRecentFailuresRequest, opts ...grpc.CallOption) (*GetRecentFailuresResponse, error)
+	// PruneStaleDevices lists, and optionally deletes, the tailnet devices
+	// left behind by the cluster's pods: devices no pod holds any more.
+	PruneStaleDevices(ctx context.Context, in *PruneStaleDevicesRequest, opts ...grpc.CallOption) (*PruneStaleDevicesResponse, error)
+	// DrainNode removes every pod's Tailscale node and tailnet device, for a
+	// node that is being taken out of service.
+	DrainNode(ctx context.Context, in *DrainNodeRequest, opts ...grpc.CallOption) (*DrainNodeResponse, error)
+	// Watch streams pods' lifecycle events as they happen, until the client
+	// cancels. Events from before the call aren't replayed. A client that
+	// falls too far behind has its stream ended with RESOURCE_EXHAUSTED and
+	// should list the pods again before watching again.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PodEvent], error)
 }
 
 type tailscaleCNIClient struct {
@@ -76,6 +109,95 @@ func (c *tailscaleCNIClient) Check(ctx context.Context, in *CheckRequest, opts .
 	return out, nil
 }
 
+func (c *tailscaleCNIClient) GC(ctx context.Context, in *GCRequest, opts ...grpc.CallOption) (*GCResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GCResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_GC_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_Status_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) GetRecoveryReport(ctx context.Context, in *GetRecoveryReportRequest, opts ...grpc.CallOption) (*GetRecoveryReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRecoveryReportResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_GetRecoveryReport_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) Reattach(ctx context.Context, in *ReattachRequest, opts ...grpc.CallOption) (*ReattachResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReattachResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_Reattach_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) GetRecentFailures(ctx context.Context, in *GetRecentFailuresRequest, opts ...grpc.CallOption) (*GetRecentFailuresResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetRecentFailuresResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_GetRecentFailures_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) PruneStaleDevices(ctx context.Context, in *PruneStaleDevicesRequest, opts ...grpc.CallOption) (*PruneStaleDevicesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PruneStaleDevicesResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_PruneStaleDevices_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) DrainNode(ctx context.Context, in *DrainNodeRequest, opts ...grpc.CallOption) (*DrainNodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DrainNodeResponse)
+	err := c.cc.Invoke(ctx, TailscaleCNI_DrainNode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailscaleCNIClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[PodEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TailscaleCNI_ServiceDesc.Streams[0], TailscaleCNI_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, PodEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TailscaleCNI_WatchClient = grpc.ServerStreamingClient[PodEvent]
+
 // TailscaleCNIServer is the server API for TailscaleCNI service.
 // All implementations must embed UnimplementedTailscaleCNIServer
 // for forward compatibility.
@@ -88,6 +210,31 @@ type TailscaleCNIServer interface {
 	Del(context.Context, *DelRequest) (*DelResponse, error)
 	// Check is called to verify the pod's network is healthy.
 	Check(context.Context, *CheckRequest) (*CheckResponse, error)
+	// GC is called with the attachments the runtime still knows about, so the
+	// daemon can remove the pods it holds for any others.
+	GC(context.Context, *GCRequest) (*GCResponse, error)
+	// Status reports whether the daemon is ready to add pods.
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// GetRecoveryReport returns what happened to each pod the daemon found
+	// on disk when it started.
+	GetRecoveryReport(context.Context, *GetRecoveryReportRequest) (*GetRecoveryReportResponse, error)
+	// Reattach restarts a pod's Tailscale node from its persisted state,
+	// keeping its identity, without touching the pod.
+	Reattach(context.Context, *ReattachRequest) (*ReattachResponse, error)
+	// GetRecentFailures returns the daemon's most recent auth key creation
+	// failures, oldest first.
+	GetRecentFailures(context.Context, *GetRecentFailuresRequest) (*GetRecentFailuresResponse, error)
+	// PruneStaleDevices lists, and optionally deletes, the tailnet devices
+	// left behind by the cluster's pods: devices no pod holds any more.
+	PruneStaleDevices(context.Context, *PruneStaleDevicesRequest) (*PruneStaleDevicesResponse, error)
+	// DrainNode removes every pod's Tailscale node and tailnet device, for a
+	// node that is being taken out of service.
+	DrainNode(context.Context, *DrainNodeRequest) (*DrainNodeResponse, error)
+	// Watch streams pods' lifecycle events as they happen, until the client
+	// cancels. Events from before the call aren't replayed. A client that
+	// falls too far behind has its stream ended with RESOURCE_EXHAUSTED and
+	// should list the pods again before watching again.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[PodEvent]) error
 	mustEmbedUnimplementedTailscaleCNIServer()
 }
 
@@ -107,6 +254,30 @@ func (UnimplementedTailscaleCNIServer) Del(context.Context, *DelRequest) (*DelRe
 func (UnimplementedTailscaleCNIServer) Check(context.Context, *CheckRequest) (*CheckResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Check not implemented")
 }
+func (UnimplementedTailscaleCNIServer) GC(context.Context, *GCRequest) (*GCResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GC not implemented")
+}
+func (UnimplementedTailscaleCNIServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedTailscaleCNIServer) GetRecoveryReport(context.Context, *GetRecoveryReportRequest) (*GetRecoveryReportResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRecoveryReport not implemented")
+}
+func (UnimplementedTailscaleCNIServer) Reattach(context.Context, *ReattachRequest) (*ReattachResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Reattach not implemented")
+}
+func (UnimplementedTailscaleCNIServer) GetRecentFailures(context.Context, *GetRecentFailuresRequest) (*GetRecentFailuresResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRecentFailures not implemented")
+}
+func (UnimplementedTailscaleCNIServer) PruneStaleDevices(context.Context, *PruneStaleDevicesRequest) (*PruneStaleDevicesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method PruneStaleDevices not implemented")
+}
+func (UnimplementedTailscaleCNIServer) DrainNode(context.Context, *DrainNodeRequest) (*DrainNodeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DrainNode not implemented")
+}
+func (UnimplementedTailscaleCNIServer) Watch(*WatchRequest, grpc.ServerStreamingServer[PodEvent]) error {
+	return status.Error(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedTailscaleCNIServer) mustEmbedUnimplementedTailscaleCNIServer() {}
 func (UnimplementedTailscaleCNIServer) testEmbeddedByValue()                      {}
 
@@ -182,6 +353,143 @@ func _TailscaleCNI_Check_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TailscaleCNI_GC_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GCRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).GC(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_GC_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).GC(ctx, req.(*GCRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_Status_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_GetRecoveryReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecoveryReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).GetRecoveryReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_GetRecoveryReport_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).GetRecoveryReport(ctx, req.(*GetRecoveryReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_Reattach_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReattachRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).Reattach(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_Reattach_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).Reattach(ctx, req.(*ReattachRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_GetRecentFailures_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecentFailuresRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).GetRecentFailures(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_GetRecentFailures_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).GetRecentFailures(ctx, req.(*GetRecentFailuresRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_PruneStaleDevices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PruneStaleDevicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).PruneStaleDevices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_PruneStaleDevices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).PruneStaleDevices(ctx, req.(*PruneStaleDevicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_DrainNode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DrainNodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailscaleCNIServer).DrainNode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TailscaleCNI_DrainNode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailscaleCNIServer).DrainNode(ctx, req.(*DrainNodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TailscaleCNI_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TailscaleCNIServer).Watch(m, &grpc.GenericServerStream[WatchRequest, PodEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TailscaleCNI_WatchServer = grpc.ServerStreamingServer[PodEvent]
+
 // TailscaleCNI_ServiceDesc is the grpc.ServiceDesc for TailscaleCNI service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -201,7 +509,41 @@ var TailscaleCNI_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Check",
 			Handler:    _TailscaleCNI_Check_Handler,
 		},
+		{
+			MethodName: "GC",
+			Handler:    _TailscaleCNI_GC_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _TailscaleCNI_Status_Handler,
+		},
+		{
+			MethodName: "GetRecoveryReport",
+			Handler:    _TailscaleCNI_GetRecoveryReport_Handler,
+		},
+		{
+			MethodName: "Reattach",
+			Handler:    _TailscaleCNI_Reattach_Handler,
+		},
+		{
+			MethodName: "GetRecentFailures",
+			Handler:    _TailscaleCNI_GetRecentFailures_Handler,
+		},
+		{
+			MethodName: "PruneStaleDevices",
+			Handler:    _TailscaleCNI_PruneStaleDevices_Handler,
+		},
+		{
+			MethodName: "DrainNode",
+			Handler:    _TailscaleCNI_DrainNode_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _TailscaleCNI_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "pkg/proto/cni.proto",
 }